@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// maxWaitHistory bounds how many past waits the state file keeps per
+// resource for -adaptive-timeout.
+const maxWaitHistory = 20
+
+const (
+	// adaptiveMinSamples is how many past waits -adaptive-timeout needs
+	// before it derives a timeout.
+	adaptiveMinSamples = 3
+	// adaptiveSafetyFactor is applied to the p95 of the past waits.
+	adaptiveSafetyFactor = 3
+	// adaptiveMinTimeout is the lowest timeout -adaptive-timeout derives.
+	adaptiveMinTimeout = time.Minute
+)
+
+// recordWait appends the wait of a result that became Ready during the wait
+// to the history, keeping the latest maxWaitHistory entries. Resources that
+// were already Ready waited for nothing and are left out.
+func recordWait(history []float64, r *checkResult) []float64 {
+	if !r.Ready() || r.ReadyState != readyDuringWait {
+		return history
+	}
+	history = append(history, r.Waited.Seconds())
+	if len(history) > maxWaitHistory {
+		history = history[len(history)-maxWaitHistory:]
+	}
+	return history
+}
+
+// adaptiveTimeout derives the timeout from the past waits: their p95 times
+// adaptiveSafetyFactor, no lower than adaptiveMinTimeout and never above
+// maxTimeout. Without enough history it returns maxTimeout. The second
+// value describes the basis of the result.
+func adaptiveTimeout(history []float64, maxTimeout time.Duration) (time.Duration, string) {
+	if len(history) < adaptiveMinSamples {
+		return maxTimeout, fmt.Sprintf("static -timeout, only %d of %d past waits recorded", len(history), adaptiveMinSamples)
+	}
+	sorted := append([]float64(nil), history...)
+	sort.Float64s(sorted)
+	p95 := sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+	timeout := time.Duration(math.Ceil(p95*adaptiveSafetyFactor)) * time.Second
+	basis := fmt.Sprintf("%dx p95 %s of %d past waits", adaptiveSafetyFactor, formatDuration(time.Duration(p95*float64(time.Second))), len(history))
+	switch {
+	case timeout < adaptiveMinTimeout:
+		timeout = adaptiveMinTimeout
+		basis += ", raised to the minimum " + formatDuration(adaptiveMinTimeout)
+	case timeout > maxTimeout:
+		timeout = maxTimeout
+		basis += ", capped at -timeout"
+	}
+	return timeout, basis
+}
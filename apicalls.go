@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxLatencySamples bounds the memory used for latency percentiles.
+const maxLatencySamples = 10000
+
+// apiCallLog records every request made to the API server. Only the method,
+// path and response code are kept; request and response bodies are never
+// inspected so that secret data cannot leak into the log. It is safe for
+// concurrent use.
+type apiCallLog struct {
+	// debug prints every request as it completes.
+	debug bool
+
+	mu          sync.Mutex
+	counts      map[string]int
+	throttled   int
+	apfRejected int
+	latencies   []time.Duration
+	// notBefore is the earliest time the server asked us to come back,
+	// from the last Retry-After header seen.
+	notBefore time.Time
+	// clockOffset is how far the API server's clock, from the Date header
+	// of the last response, is ahead of ours. It has a resolution of a
+	// second.
+	clockOffset    time.Duration
+	hasClockOffset bool
+	// watchFallback is why the waits poll instead of watching, once the
+	// server rejected a watch as not allowed.
+	watchFallback string
+	// reconnects counts the watches re-established after one ended.
+	reconnects atomic.Int64
+}
+
+func newAPICallLog(debug bool) *apiCallLog {
+	return &apiCallLog{debug: debug, counts: map[string]int{}}
+}
+
+// wrap is meant to be used as rest.Config.WrapTransport.
+func (l *apiCallLog) wrap(rt http.RoundTripper) http.RoundTripper {
+	return &loggingTransport{next: rt, log: l}
+}
+
+func (l *apiCallLog) record(verb, resource string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.counts[verb+" "+resource]++
+}
+
+func (l *apiCallLog) recordResponse(resp *http.Response, latency time.Duration, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.latencies) < maxLatencySamples {
+		l.latencies = append(l.latencies, latency)
+	}
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		l.clockOffset = date.Sub(now).Truncate(time.Second)
+		l.hasClockOffset = true
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+
+	if flowSchema := resp.Header.Get(apfFlowSchemaHeader); resp.StatusCode == http.StatusTooManyRequests && flowSchema != "" {
+		l.apfRejected++
+		console.warnf("API server priority and fairness rejected a request: flow schema %s, priority level %s",
+			flowSchema, resp.Header.Get(apfPriorityLevelHeader))
+	} else if resp.StatusCode == http.StatusTooManyRequests {
+		l.throttled++
+	}
+	if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok && now.Add(delay).After(l.notBefore) {
+		l.notBefore = now.Add(delay)
+	}
+}
+
+// fallBackToPolling records that the waits poll for reason, reporting
+// whether it is the first fallback. Without a log every one is the first.
+func (l *apiCallLog) fallBackToPolling(reason string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.watchFallback != "" {
+		return false
+	}
+	l.watchFallback = reason
+	return true
+}
+
+// pollingFallback returns why the waits fell back to polling, empty while
+// they may watch.
+func (l *apiCallLog) pollingFallback() string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.watchFallback
+}
+
+// RetryNotBefore returns the time before which the server asked not to be
+// called again, or the zero time.
+func (l *apiCallLog) RetryNotBefore() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.notBefore
+}
+
+// ServerNow returns now as seen by the API server's clock, or now itself
+// when no response told the server's time yet.
+func (l *apiCallLog) ServerNow(now time.Time) time.Time {
+	if l == nil {
+		return now
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.hasClockOffset {
+		return now
+	}
+	return now.Add(l.clockOffset)
+}
+
+// Headers set by API priority and fairness identifying the flow a request
+// was classified into.
+const (
+	apfFlowSchemaHeader    = "X-Kubernetes-PF-FlowSchema-UID"
+	apfPriorityLevelHeader = "X-Kubernetes-PF-PriorityLevel-UID"
+)
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// apiStats summarizes the API pressure generated by a run.
+type apiStats struct {
+	Gets       int
+	Lists      int
+	Watches    int
+	Reconnects int
+	Throttled  int
+	// APFRejected counts 429s issued by API priority and fairness, which
+	// are not included in Throttled.
+	APFRejected int
+	LatencyP50  time.Duration
+	LatencyP90  time.Duration
+	LatencyP99  time.Duration
+	// WatchFallback is why the waits polled instead of watching, if they
+	// fell back to it.
+	WatchFallback string
+}
+
+func (s apiStats) String() string {
+	line := fmt.Sprintf("gets=%d lists=%d watches=%d reconnects=%d throttled=%d apf-rejected=%d latency p50=%v p90=%v p99=%v",
+		s.Gets, s.Lists, s.Watches, s.Reconnects, s.Throttled, s.APFRejected, s.LatencyP50, s.LatencyP90, s.LatencyP99)
+	if s.WatchFallback != "" {
+		line += fmt.Sprintf(" polling-fallback=%q", s.WatchFallback)
+	}
+	return line
+}
+
+// reconnected counts a watch re-established after the previous one of the
+// same stream ended. It does nothing on a nil log.
+func (l *apiCallLog) reconnected() {
+	if l != nil {
+		l.reconnects.Add(1)
+	}
+}
+
+// Stats returns the request counters and latency percentiles so far.
+func (l *apiCallLog) Stats() apiStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := apiStats{
+		Reconnects:    int(l.reconnects.Load()),
+		Throttled:     l.throttled,
+		APFRejected:   l.apfRejected,
+		WatchFallback: l.watchFallback,
+	}
+	for key, count := range l.counts {
+		verb, _, _ := strings.Cut(key, " ")
+		switch verb {
+		case "get":
+			stats.Gets += count
+		case "list":
+			stats.Lists += count
+		case "watch":
+			stats.Watches += count
+		}
+	}
+
+	sorted := append([]time.Duration(nil), l.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.LatencyP50 = percentile(sorted, 50)
+	stats.LatencyP90 = percentile(sorted, 90)
+	stats.LatencyP99 = percentile(sorted, 99)
+	return stats
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := (len(sorted)*p + 99) / 100
+	return sorted[max(index-1, 0)].Round(time.Millisecond)
+}
+
+// Summary returns the number of requests per "verb resource".
+func (l *apiCallLog) Summary() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	summary := make(map[string]int, len(l.counts))
+	for key, count := range l.counts {
+		summary[key] = count
+	}
+	return summary
+}
+
+func (l *apiCallLog) String() string {
+	summary := l.Summary()
+	keys := make([]string, 0, len(summary))
+	for key := range summary {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", key, summary[key]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+type loggingTransport struct {
+	next http.RoundTripper
+	log  *apiCallLog
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	verb, resource := requestVerbResource(req)
+	t.log.record(verb, resource)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		if t.log.debug {
+			console.debugf("DEBUG api: %s %s error=%v latency=%v", req.Method, req.URL.Path, err, latency.Round(time.Millisecond))
+		}
+		return resp, err
+	}
+	t.log.recordResponse(resp, latency, time.Now())
+	if t.log.debug {
+		console.debugf("DEBUG api: %s %s code=%d latency=%v", req.Method, req.URL.Path, resp.StatusCode, latency.Round(time.Millisecond))
+	}
+	return resp, nil
+}
+
+// requestVerbResource derives the Kubernetes verb and resource of a request
+// from its method and path, e.g. "GET /api/v1/namespaces/ns/events?watch=true"
+// is a watch on events.
+func requestVerbResource(req *http.Request) (string, string) {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		segments = segments[3:]
+	default:
+		return strings.ToLower(req.Method), req.URL.Path
+	}
+
+	var resource string
+	named := false
+	switch {
+	case len(segments) >= 3 && segments[0] == "namespaces":
+		resource = segments[2]
+		named = len(segments) >= 4
+	case len(segments) >= 1:
+		resource = segments[0]
+		named = len(segments) >= 2
+	default:
+		return strings.ToLower(req.Method), "discovery"
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		if req.URL.Query().Get("watch") == "true" || req.URL.Query().Get("watch") == "1" {
+			return "watch", resource
+		}
+		if named {
+			return "get", resource
+		}
+		return "list", resource
+	case http.MethodPost:
+		return "create", resource
+	case http.MethodPut:
+		return "update", resource
+	case http.MethodPatch:
+		return "patch", resource
+	case http.MethodDelete:
+		return "delete", resource
+	default:
+		return strings.ToLower(req.Method), resource
+	}
+}
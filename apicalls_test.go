@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestReconnectsIgnoreWatchCount records the watches of a batch, one per
+// resource: none of them is a reconnect.
+func TestReconnectsIgnoreWatchCount(t *testing.T) {
+	calls := newAPICallLog(false)
+	for i := 0; i < 5; i++ {
+		calls.record("watch", "externalsecrets")
+		calls.record("watch", "events")
+	}
+	if stats := calls.Stats(); stats.Watches != 10 || stats.Reconnects != 0 {
+		t.Errorf("watches, reconnects = %d, %d, want 10, 0", stats.Watches, stats.Reconnects)
+	}
+}
+
+// TestResourceWatchCountsReconnects closes the watches of concurrent waits
+// and checks that only re-establishing one counts as a reconnect.
+func TestResourceWatchCountsReconnects(t *testing.T) {
+	captureConsole(t)
+	dynamicClient := newFakeDynamicClient()
+	dynamicClient.PrependWatchReactor("externalsecrets", func(k8stesting.Action) (bool, watch.Interface, error) {
+		return true, watch.NewFake(), nil
+	})
+	calls := newAPICallLog(false)
+	c := &checker{dynamicClient: dynamicClient, gvr: externalSecretGVR, watchMode: watchModeAuto, apiCalls: calls}
+
+	const waits = 8
+	var wg sync.WaitGroup
+	for i := 0; i < waits; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rw := &resourceWatch{checker: c, namespace: "apps", name: "db"}
+			for attempt := 0; attempt < 3; attempt++ {
+				rw.lastAttempt = time.Time{}
+				if err := rw.ensure(context.Background()); err != nil || rw.w == nil {
+					t.Errorf("ensure: watch %v, error %v", rw.w, err)
+					return
+				}
+				// The server ends the watch
+				rw.w.Stop()
+				if _, ok := <-rw.events(); ok {
+					t.Error("event received from a stopped watch")
+				}
+				rw.handle(watch.Event{}, false)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, want := calls.Stats().Reconnects, waits*2; got != want {
+		t.Errorf("reconnects = %d, want %d", got, want)
+	}
+}
+
+// reconnectingEvents serves watches that are closed right away, canceling
+// the run once it served the given number of them.
+type reconnectingEvents struct {
+	watches int
+	cancel  context.CancelFunc
+}
+
+func (e *reconnectingEvents) List(context.Context, metav1.ListOptions) (*corev1.EventList, error) {
+	return &corev1.EventList{ListMeta: metav1.ListMeta{ResourceVersion: "10"}}, nil
+}
+
+func (e *reconnectingEvents) Watch(ctx context.Context, _ metav1.ListOptions) (watch.Interface, error) {
+	if e.watches == 0 {
+		e.cancel()
+		return nil, ctx.Err()
+	}
+	e.watches--
+	return watch.NewEmptyWatch(), nil
+}
+
+func TestEventWatcherCountsReconnects(t *testing.T) {
+	captureConsole(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := newAPICallLog(false)
+	w := &eventWatcher{
+		events:   &reconnectingEvents{watches: 3, cancel: cancel},
+		stats:    &eventStats{},
+		apiCalls: calls,
+		log:      console,
+	}
+	w.run(ctx)
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Fatal("the watcher returned before its watches were served")
+	}
+	if got := calls.Stats().Reconnects; got != 2 {
+		t.Errorf("reconnects = %d, want 2", got)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+
+	escheck "external-secret-watcher/pkg/checker"
+)
+
+// isResourceUnavailable reports whether err means the resource type itself
+// (rather than the named object) can no longer be served in this version,
+// which is what happens while the external-secrets operator is upgraded and
+// the served CRD version changes.
+func isResourceUnavailable(err error) bool {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return false
+	}
+	details := status.Status().Details
+	if apierrors.IsNotFound(err) {
+		return details == nil || details.Name == ""
+	}
+	return strings.Contains(strings.ToLower(status.Status().Message), "conversion")
+}
+
+// errNotServed and servedVersion are those of pkg/checker, which
+// pkg/health resolves the served version with too.
+var (
+	errNotServed  = escheck.ErrNotServed
+	servedVersion = escheck.ServedVersion
+)
+
+// resolveAPIVersion returns gvr with the version the checker should read:
+// pinned when set, otherwise the preferred version the server serves. When
+// discovery itself fails, gvr is returned unchanged along with the error.
+func resolveAPIVersion(client discovery.DiscoveryInterface, gvr schema.GroupVersionResource, pinned string) (schema.GroupVersionResource, error) {
+	if pinned != "" {
+		gvr.Version = pinned
+		return gvr, nil
+	}
+	version, err := servedVersion(client, gvr)
+	if err != nil {
+		return gvr, err
+	}
+	gvr.Version = version
+	return gvr, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+)
+
+func TestServedVersion(t *testing.T) {
+	storesOnly := &metav1.APIResourceList{
+		GroupVersion: externalSecretGVR.Group + "/v1",
+		APIResources: []metav1.APIResource{{Name: clusterSecretStoresResource, Kind: "ClusterSecretStore"}},
+	}
+	for _, test := range []struct {
+		name      string
+		resources []*metav1.APIResourceList
+		want      string
+	}{
+		{"v1beta1 only", newFakeDiscovery("v1beta1").Resources, "v1beta1"},
+		{"v1 only", newFakeDiscovery("v1").Resources, "v1"},
+		{"v1 preferred", newFakeDiscovery("v1", "v1beta1").Resources, "v1"},
+		{"v1beta1 preferred", newFakeDiscovery("v1beta1", "v1").Resources, "v1beta1"},
+		{"preferred version lacking the kind", append([]*metav1.APIResourceList{storesOnly}, newFakeDiscovery("v1beta1").Resources...), "v1beta1"},
+		{"not installed", nil, ""},
+		{"stores only", []*metav1.APIResourceList{storesOnly}, ""},
+	} {
+		client := newFakeDiscovery()
+		client.Resources = test.resources
+		version, err := servedVersion(client, externalSecretGVR)
+		if test.want == "" {
+			if !errors.Is(err, errNotServed) {
+				t.Errorf("%s: servedVersion = %q, %v, want errNotServed", test.name, version, err)
+			}
+			continue
+		}
+		if err != nil || version != test.want {
+			t.Errorf("%s: servedVersion = %q, %v, want %s", test.name, version, err, test.want)
+		}
+	}
+}
+
+// failingDiscovery is a discovery client whose server is unreachable.
+type failingDiscovery struct {
+	discovery.DiscoveryInterface
+}
+
+func (failingDiscovery) ServerGroups() (*metav1.APIGroupList, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestResolveAPIVersion(t *testing.T) {
+	client := newFakeDiscovery("v1beta1")
+	if gvr, err := resolveAPIVersion(client, externalSecretGVR, "v1"); err != nil || gvr.Version != "v1" || len(client.Actions()) != 0 {
+		t.Errorf("pinned: %v, %v after %d discovery calls, want v1 without discovery", gvr, err, len(client.Actions()))
+	}
+
+	pinned := externalSecretGVR
+	pinned.Version = "v1alpha1"
+	if gvr, err := resolveAPIVersion(failingDiscovery{client}, pinned, ""); err == nil || errors.Is(err, errNotServed) || gvr != pinned {
+		t.Errorf("failing discovery: %v, %v, want the version unchanged and the error", gvr, err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// staleTempAge is how old the temporary file of a write must be for a later
+// write to remove it as left over by a crash. Writes take far less, so a
+// concurrent writer's file is never mistaken for one.
+const staleTempAge = time.Minute
+
+// writeFileAtomic writes a file through a temporary file in the same
+// directory which is synced and renamed over the destination, so readers
+// never observe a partially written file: after a crash the path holds
+// either the previous content or the new one. Temporary files of writes
+// killed midway are removed first.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	pattern := "." + filepath.Base(path) + ".tmp-*"
+	removeStaleTemps(filepath.Join(filepath.Dir(path), pattern))
+	tmp, err := os.CreateTemp(filepath.Dir(path), pattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp makes the file 0600, which the rename keeps, but readers
+	// such as node-exporter may run as another user
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	buf := bufio.NewWriter(tmp)
+	if err := write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// removeStaleTemps removes the temporary files matching pattern that a
+// write killed before its rename, such as by the OOM killer, left behind.
+// It is best effort, as they only waste space.
+func removeStaleTemps(pattern string) {
+	matches, _ := filepath.Glob(pattern)
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && time.Since(info.ModTime()) > staleTempAge {
+			os.Remove(match)
+		}
+	}
+}
+
+// syncDir makes a rename in dir durable across a crash of the node. File
+// systems that cannot sync directories are left to their own guarantees.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
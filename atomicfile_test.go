@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.prom")
+	stale := filepath.Join(dir, ".metrics.prom.tmp-1")
+	if err := os.WriteFile(stale, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleTempAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "external_secret_ready 1\n")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "external_secret_ready 1\n" {
+		t.Fatalf("content = %q, %v, want the written metrics", data, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o644 {
+		t.Errorf("mode = %v, want -rw-r--r-- so that collectors running as other users can read it", mode)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("the stale temporary file is still there: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".metrics.prom.tmp-*")); len(matches) > 0 {
+		t.Errorf("temporary files left behind: %q", matches)
+	}
+}
+
+// atomicWriterEnv names the destination the helper process writes to.
+const atomicWriterEnv = "ATOMIC_WRITER_PATH"
+
+// TestAtomicWriterProcess is the writer killed by
+// TestKilledWriteKeepsPreviousContent: it writes part of its content, says
+// so and hangs.
+func TestAtomicWriterProcess(t *testing.T) {
+	path := os.Getenv(atomicWriterEnv)
+	if path == "" {
+		t.Skip("only run as the writer of TestKilledWriteKeepsPreviousContent")
+	}
+	writeFileAtomic(path, func(w io.Writer) error {
+		chunk := strings.Repeat("partial content\n", 64<<10)
+		if _, err := io.WriteString(w, chunk); err != nil {
+			return err
+		}
+		fmt.Println("mid-stream")
+		time.Sleep(time.Hour)
+		return nil
+	})
+}
+
+// TestKilledWriteKeepsPreviousContent kills a writer mid-stream: the
+// destination is left absent or with its previous content, and the next
+// write cleans up the temporary file.
+func TestKilledWriteKeepsPreviousContent(t *testing.T) {
+	for _, previous := range []string{"", "previous complete content\n"} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "result.json")
+		if previous != "" {
+			if err := os.WriteFile(path, []byte(previous), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		writer := exec.Command(os.Args[0], "-test.run=^TestAtomicWriterProcess$")
+		writer.Env = append(os.Environ(), atomicWriterEnv+"="+path)
+		stdout, err := writer.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Start(); err != nil {
+			t.Fatal(err)
+		}
+		line, err := bufio.NewReader(stdout).ReadString('\n')
+		if err != nil || line != "mid-stream\n" {
+			writer.Process.Kill()
+			t.Fatalf("the writer said %q, %v", line, err)
+		}
+		writer.Process.Kill()
+		writer.Wait()
+
+		data, err := os.ReadFile(path)
+		switch {
+		case previous == "" && !os.IsNotExist(err):
+			t.Errorf("the destination exists after a killed first write: %q, %v", data, err)
+		case previous != "" && string(data) != previous:
+			t.Errorf("content = %q, %v after a killed write, want the previous one", data, err)
+		}
+		temps, _ := filepath.Glob(filepath.Join(dir, ".result.json.tmp-*"))
+		if len(temps) != 1 {
+			t.Fatalf("temporary files = %q, want the one of the killed write", temps)
+		}
+
+		// The next run finds the temporary file stale and removes it
+		old := time.Now().Add(-2 * staleTempAge)
+		if err := os.Chtimes(temps[0], old, old); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFileAtomic(path, func(w io.Writer) error {
+			_, err := io.WriteString(w, "new content\n")
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(temps[0]); !os.IsNotExist(err) {
+			t.Errorf("the temporary file of the killed write is still there: %v", err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// Origins of the effective configuration values.
+const (
+	originFlag      = "flag"
+	originEnv       = "env"
+	originFile      = "file"
+	originDefault   = "default"
+	originInCluster = "in-cluster"
+)
+
+// configEntry is one value of the effective configuration and where it came
+// from.
+type configEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Origin string `json:"origin"`
+}
+
+// effectiveConfig describes what the run is about to do, tagging every value
+// with its origin. setFlags holds the flags given on the command line.
+func effectiveConfig(opts *options, setFlags map[string]bool, config *rest.Config, context, cluster string, timeout time.Duration, timeoutOrigin string) []configEntry {
+	fromFlag := func(names ...string) string {
+		for _, name := range names {
+			if setFlags[name] {
+				return originFlag
+			}
+		}
+		return originDefault
+	}
+
+	var entries []configEntry
+	kubeconfig, kubeconfigOrigin := opts.kube.describe()
+	entries = append(entries, configEntry{"kubeconfig", kubeconfig, kubeconfigOrigin})
+	if context != "" {
+		entries = append(entries, configEntry{"context", context, originFlag})
+	} else if current := opts.kube.currentContext(); current != "" {
+		entries = append(entries, configEntry{"context", current, originFile})
+	}
+	hostOrigin := originFile
+	if kubeconfigOrigin == originInCluster {
+		hostOrigin = originInCluster
+	}
+	clusterOrigin := hostOrigin
+	if setFlags["cluster-name"] || context != "" {
+		clusterOrigin = originFlag
+	}
+
+	checks := strings.Join(enabledChecks(opts), ", ")
+	var targets []string
+	for _, requested := range opts.requested() {
+		targets = append(targets, requested.Namespace+"/"+requested.Name)
+	}
+	kind := opts.resourceKind()
+	target := kind.name + " " + strings.Join(targets, ", ")
+	switch {
+	case opts.discovers():
+		target = fmt.Sprintf("%ss %s in %s", kind.name, discoveryTarget(opts), opts.scope())
+	case opts.waitList != nil:
+		target = fmt.Sprintf("%d %ss of %s", len(opts.waitList), kind.name, opts.waitList[0].source)
+	}
+	namespace := opts.namespace
+	if opts.allNamespaces {
+		namespace = "(all)"
+	}
+	entries = append(entries,
+		configEntry{"cluster", cluster, clusterOrigin},
+		configEntry{"host", maskSecret(config.Host), hostOrigin},
+		configEntry{"namespace", namespace, fromFlag("namespace", "all-namespaces")},
+		configEntry{"target", target, originFlag},
+		configEntry{"resource", resourceDescription(kind, opts.apiVersion), fromFlag("kind", "api-version")},
+		configEntry{"timeout", formatDuration(timeout), timeoutOrigin},
+		configEntry{"poll interval", formatDuration(opts.interval), opts.origin(setFlags, "interval")},
+		configEntry{"per-call timeout", formatDuration(opts.perCallTimeout), fromFlag("per-call-timeout")},
+		configEntry{"checks", checks, fromFlag("for", "fail-on-condition", "require-exists", "consecutive-ready-polls", "fail-fast", "fatal-reason", "wait-on-template-error", "max-wait-for-pass", "max-sync-latency", "skip-freshness", "watch-target-secret", "state-file")},
+		configEntry{"outputs", maskSecret(strings.Join(enabledOutputs(opts), ", ")), fromFlag("result-file", "metrics-textfile", "csv-report", "csv-transitions", "state-file", "capture-file", "ndjson-file", "notify-socket", "record")},
+	)
+	if opts.discovers() {
+		entries = append(entries, configEntry{"discovery window", formatDuration(opts.discoveryWindow), fromFlag("discovery-window")})
+		if opts.prioritySelector != "" {
+			entries = append(entries, configEntry{"priority", opts.prioritySelector, originFlag})
+		}
+	}
+	if opts.concurrency > 0 && opts.several() {
+		entries = append(entries, configEntry{"concurrency", fmt.Sprint(opts.concurrency), originFlag})
+	}
+	if opts.readOnly {
+		entries = append(entries, configEntry{"mode", "read-only", originFlag})
+	}
+	if opts.watchMode != watchModeAuto {
+		entries = append(entries, configEntry{"watch mode", opts.watchMode, originFlag})
+	}
+	if opts.waitFor == waitForDeleted {
+		value := "deletion"
+		if opts.includeTargetSecret {
+			value += ", target Secret included"
+		}
+		entries = append(entries, configEntry{"wait for", value, originFlag})
+	}
+	if !opts.enforce {
+		entries = append(entries, configEntry{"enforce", "false, failures exit 0", originFlag})
+	}
+	if opts.killSwitchConfigMap != "" {
+		entries = append(entries, configEntry{"kill switch", "ConfigMap " + opts.killSwitchConfigMap, originFlag})
+	}
+	if annotation := opts.honoredSkipAnnotation(); annotation != "" {
+		entries = append(entries, configEntry{"skip annotation", annotation, fromFlag("skip-annotation")})
+	}
+	return entries
+}
+
+// setFlags returns the names of the flags given explicitly on the command
+// line, as opposed to those left at their defaults.
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// printConfig prints the effective configuration as one block.
+func printConfig(entries []configEntry) {
+	fmt.Println("Configuration:")
+	for _, entry := range entries {
+		fmt.Printf("  %-17s %s (%s)\n", entry.Key+":", entry.Value, entry.Origin)
+	}
+}
+
+// maskSecret hides credentials embedded in URLs found in value, such as
+// user:password pairs and query strings that carry tokens.
+func maskSecret(value string) string {
+	fields := strings.Fields(value)
+	for i, field := range fields {
+		trimmed := strings.TrimRight(field, ",")
+		u, err := url.Parse(trimmed)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			continue
+		}
+		if u.User == nil && u.RawQuery == "" {
+			continue
+		}
+		if u.User != nil {
+			u.User = url.User("***")
+		}
+		if u.RawQuery != "" {
+			u.RawQuery = "***"
+		}
+		fields[i] = u.String() + strings.TrimPrefix(field, trimmed)
+	}
+	return strings.Join(fields, " ")
+}
+
+// resourceDescription names the resource read for the banner; without
+// -api-version the version is only known once discovery ran.
+func resourceDescription(kind resourceKind, apiVersion string) string {
+	resource := kind.gvr.Resource + "." + kind.gvr.Group
+	if apiVersion == "" {
+		return resource + ", preferred served version"
+	}
+	return resource + "/" + apiVersion
+}
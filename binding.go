@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// secretBinding is the Secret that satisfied the wait.
+type secretBinding struct {
+	Namespace       string
+	Name            string
+	ResourceVersion string
+	// FromStatus is set when the controller reported the Secret through
+	// status.binding, rather than it being derived from spec.target.name.
+	FromStatus bool
+}
+
+func (b *secretBinding) String() string {
+	s := b.Namespace + "/" + b.Name
+	if b.ResourceVersion != "" {
+		s += fmt.Sprintf(" (resourceVersion %s)", b.ResourceVersion)
+	}
+	if !b.FromStatus {
+		s += ", from spec.target.name"
+	}
+	return s
+}
+
+// resolveBinding finds the Secret a Ready ExternalSecret is bound to: the one
+// in status.binding when the controller reports it, otherwise the target
+// Secret. A binding that disagrees with spec.target.name is warned about,
+// since it means the template and the name have drifted apart. The Secret
+// is read for its resourceVersion, time-boxed within ctx.
+func resolveBinding(ctx context.Context, clientset kubernetes.Interface, unstructuredES *unstructured.Unstructured, perCallTimeout time.Duration) (*secretBinding, error) {
+	target := targetSecretName(unstructuredES)
+	binding := &secretBinding{Namespace: unstructuredES.GetNamespace(), Name: target}
+	if name, _, _ := unstructured.NestedString(unstructuredES.Object, "status", "binding", "name"); name != "" {
+		binding.Name = name
+		binding.FromStatus = true
+		if name != target {
+			console.warnf("Warning: ExternalSecret %s is bound to Secret %s, but its target is %s", unstructuredES.GetName(), name, target)
+		}
+	}
+
+	ctx, cancel, err := phaseContext(ctx, perCallTimeout)
+	if err != nil {
+		return binding, err
+	}
+	defer cancel()
+	secret, err := clientset.CoreV1().Secrets(binding.Namespace).Get(ctx, binding.Name, metav1.GetOptions{})
+	if err != nil {
+		return binding, fmt.Errorf("reading bound Secret %s: %w", binding.Name, err)
+	}
+	binding.ResourceVersion = secret.ResourceVersion
+	return binding, nil
+}
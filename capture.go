@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// capture is a redacted copy of the ExternalSecret taken when one of its
+// conditions transitioned.
+type capture struct {
+	ObservedAt time.Time              `json:"observedAt"`
+	Object     map[string]interface{} `json:"object"`
+}
+
+// captureBuffer keeps the last max captures.
+type captureBuffer struct {
+	max      int
+	captures []capture
+}
+
+func (b *captureBuffer) add(unstructuredES *unstructured.Unstructured, observedAt time.Time) {
+	if b == nil || b.max <= 0 {
+		return
+	}
+	b.captures = append(b.captures, capture{ObservedAt: observedAt, Object: redactObject(unstructuredES)})
+	if len(b.captures) > b.max {
+		b.captures = b.captures[len(b.captures)-b.max:]
+	}
+}
+
+// redactObject returns a copy of the object without managedFields and the
+// last-applied-configuration annotation, which are noisy and may embed
+// values from other tools, and with -redact-pattern applied to the condition
+// messages. ExternalSecrets reference secret data but never contain it, so
+// nothing else needs removing.
+func redactObject(unstructuredES *unstructured.Unstructured) map[string]interface{} {
+	redacted := unstructuredES.DeepCopy()
+	redacted.SetManagedFields(nil)
+	if annotations := redacted.GetAnnotations(); annotations != nil {
+		delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+		redacted.SetAnnotations(annotations)
+	}
+	if conditions, found, _ := unstructured.NestedSlice(redacted.Object, "status", "conditions"); found {
+		for _, c := range conditions {
+			if condition, ok := c.(map[string]interface{}); ok {
+				if message, ok := condition["message"].(string); ok {
+					condition["message"] = redactions.redact(redacted.GetNamespace(), redacted.GetName(), message)
+				}
+			}
+		}
+		unstructured.SetNestedSlice(redacted.Object, conditions, "status", "conditions")
+	}
+	return redacted.Object
+}
+
+func writeCaptures(w io.Writer, captures []capture) error {
+	if captures == nil {
+		captures = []capture{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(captures)
+}
+
+// printCaptureDiffs prints the field-level changes between consecutive
+// captures.
+func printCaptureDiffs(captures []capture) {
+	for i := 1; i < len(captures); i++ {
+		console.infof("Changes at %s:", formatTime(captures[i].ObservedAt, time.Now()))
+		for _, line := range diffObjects(captures[i-1].Object, captures[i].Object) {
+			console.infof("  %s", line)
+		}
+	}
+}
+
+// diffObjects lists the leaf fields that were added, removed or changed
+// between two objects, skipping resourceVersion which changes on every write.
+func diffObjects(before, after map[string]interface{}) []string {
+	old := map[string]string{}
+	flattenObject("", before, old)
+	current := map[string]string{}
+	flattenObject("", after, current)
+	delete(old, "metadata.resourceVersion")
+	delete(current, "metadata.resourceVersion")
+
+	var lines []string
+	for path, value := range current {
+		previous, existed := old[path]
+		switch {
+		case !existed:
+			lines = append(lines, fmt.Sprintf("+ %s: %s", path, value))
+		case previous != value:
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", path, previous, value))
+		}
+	}
+	for path, value := range old {
+		if _, exists := current[path]; !exists {
+			lines = append(lines, fmt.Sprintf("- %s: %s", path, value))
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+	return lines
+}
+
+func flattenObject(prefix string, value interface{}, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenObject(strings.TrimPrefix(prefix+"."+key, "."), child, out)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenObject(fmt.Sprintf("%s[%d]", prefix, i), child, out)
+		}
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The checks after, or besides, the readiness wait that are timed one by one
+// and may be given a -check-budget.
+const (
+	checkNameStore            = "store"
+	checkNameTargetState      = "target-state"
+	checkNameBoundSecret      = "bound-secret"
+	checkNameRequiredKeys     = "required-keys"
+	checkNameTemplateMetadata = "template-metadata"
+	checkNameCompareWith      = "compare-with"
+)
+
+// checkNames lists the timed checks, for validating -check-budget.
+var checkNames = []string{checkNameStore, checkNameTargetState, checkNameBoundSecret, checkNameRequiredKeys, checkNameTemplateMetadata, checkNameCompareWith}
+
+// checkTiming is how long one check of a resource took.
+type checkTiming struct {
+	Name     string
+	Duration time.Duration
+}
+
+// checkTimings are the timed checks of a resource, in the order they ran.
+type checkTimings []checkTiming
+
+func (t checkTimings) String() string {
+	parts := make([]string, len(t))
+	for i, timing := range t {
+		parts[i] = fmt.Sprintf("%s=%v", timing.Name, timing.Duration.Round(time.Millisecond))
+	}
+	return strings.Join(parts, " ")
+}
+
+// timeCheck records the check that started at start as done now.
+func (r *checkResult) timeCheck(name string, start time.Time) {
+	r.CheckTimings = append(r.CheckTimings, checkTiming{name, time.Since(start)})
+}
+
+// checkBudgetFlag is the repeatable -check-budget flag of name=duration
+// pairs. Unknown names are rejected, to catch typos before the run.
+type checkBudgetFlag map[string]time.Duration
+
+func (f checkBudgetFlag) String() string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + f[name].String()
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f checkBudgetFlag) Set(value string) error {
+	name, raw, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected name=duration, got %q", value)
+	}
+	known := false
+	for _, n := range checkNames {
+		known = known || n == name
+	}
+	if !known {
+		return fmt.Errorf("unknown check %q, expected one of %s", name, strings.Join(checkNames, ", "))
+	}
+	budget, err := time.ParseDuration(raw)
+	if err != nil || budget <= 0 {
+		return fmt.Errorf("invalid budget %q of check %s, expected a positive duration", raw, name)
+	}
+	f[name] = budget
+	return nil
+}
+
+// checkBudgets logs the check timings of a finished resource and warns about
+// those over their -check-budget. With -strict-budgets an overrun fails an
+// otherwise passing resource as an SLO violation; code is the exit code of
+// the resource so far, and the one it ends with is returned.
+func (r *run) checkBudgets(result *checkResult, code int) int {
+	log := console.forCluster(r.cluster).forResource(result.Namespace, result.Name)
+	if r.opts.verbose && len(result.CheckTimings) > 0 {
+		log.debugf("Check durations: %s", result.CheckTimings)
+	}
+	var overruns []string
+	for _, timing := range result.CheckTimings {
+		budget, ok := r.opts.checkBudgets[timing.Name]
+		if !ok || timing.Duration <= budget {
+			continue
+		}
+		overrun := fmt.Sprintf("check %s took %s, over its budget of %s", timing.Name, formatDuration(timing.Duration), formatDuration(budget))
+		log.warnf("Warning: %s", overrun)
+		overruns = append(overruns, overrun)
+	}
+	if !r.opts.strictBudgets || len(overruns) == 0 || (code != exitOK && code != exitSLOViolated) || !result.Ready() {
+		return code
+	}
+	result.SLOViolations = append(result.SLOViolations, overruns...)
+	result.Outcome = outcomeSLOViolated
+	for _, overrun := range overruns {
+		log.infof("SLO violated: %s", overrun)
+	}
+	return exitSLOViolated
+}
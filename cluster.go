@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+)
+
+// clusterTarget is a cluster the run checks in, with clients of its own.
+type clusterTarget struct {
+	// context is the kubeconfig context, empty for the current one.
+	context string
+	name    string
+	// log attributes the output to the cluster in runs fanning out to
+	// several.
+	log *logger
+
+	config         *rest.Config
+	clientset      kubernetes.Interface
+	dynamicClient  dynamic.Interface
+	metadataClient metadata.Interface
+	// discovery is shared by everything that resolves API versions.
+	discovery *memoDiscovery
+	// revalidation is set with -revalidate-store.
+	revalidation *storeRevalidation
+	apiCalls     *apiCallLog
+	startup      *startupTimer
+	entries      []configEntry
+	results      []*checkResult
+}
+
+// connectCluster builds the clients of a cluster, that of kubeContext or else
+// of -context, and prints its effective configuration, extra being appended
+// to it. Its startup is measured from
+// now, after the init phase that ended at initEnd. When the cluster cannot be
+// connected to, its results are failed with the error.
+func connectCluster(opts *options, kubeContext string, results []*checkResult, timeout time.Duration, timeoutOrigin string, extra []configEntry, initEnd time.Time) (*clusterTarget, error) {
+	if kubeContext == "" {
+		kubeContext = opts.kube.context
+	}
+	t := &clusterTarget{context: kubeContext, name: opts.clusterName, results: results}
+	if t.name == "" {
+		t.name = kubeContext
+	}
+	t.log = console
+	if opts.severalClusters() {
+		t.log = console.forCluster(t.name)
+	}
+	t.startup = newStartupTimer(t.log, opts.verbose, opts.startupBudget, initEnd)
+	for _, result := range results {
+		result.Cluster = t.name
+	}
+
+	config, err := opts.kube.load(kubeContext)
+	if err != nil {
+		t.log.errorf("Error building kubeconfig: %v", err)
+		return t, err
+	}
+	if t.name == "" {
+		t.name = clusterName(opts.kube, config)
+		for _, result := range results {
+			result.Cluster = t.name
+		}
+	}
+	t.startup.record(startupConfig)
+
+	t.entries = append(effectiveConfig(opts, setFlags(flag.CommandLine), config, kubeContext, t.name, timeout, timeoutOrigin), extra...)
+	t.log.config(t.entries)
+	for _, result := range results {
+		result.Config = t.entries
+	}
+
+	// API calls are always counted for the stats; -log-api-calls only adds
+	// the per-request log lines
+	t.apiCalls = newAPICallLog(opts.logAPICalls)
+	config.WrapTransport = t.apiCalls.wrap
+	if opts.readOnly {
+		// The guard wraps everything else, so a mutating request is refused
+		// before any other transport sees it
+		config.Wrap(wrapReadOnly)
+	}
+	t.config = config
+
+	// Create client sets
+	if t.clientset, err = kubernetes.NewForConfig(config); err != nil {
+		t.log.errorf("Error creating Kubernetes clientset: %v", err)
+		return t, err
+	}
+	t.discovery = newMemoDiscovery(t.clientset.Discovery(), opts.logAPICalls)
+	t.discovery.fresh = opts.refreshDiscovery
+	if opts.revalidateStore {
+		t.revalidation = newStoreRevalidation(t.clientset)
+	}
+	if t.dynamicClient, err = dynamic.NewForConfig(config); err != nil {
+		t.log.errorf("Error creating dynamic client: %v", err)
+		return t, err
+	}
+	if t.metadataClient, err = metadata.NewForConfig(config); err != nil {
+		t.log.errorf("Error creating metadata client: %v", err)
+		return t, err
+	}
+	t.startup.record(startupClients)
+	return t, nil
+}
+
+// check waits for the resources of the cluster, within timeout of being
+// called, and returns their results with the exit code. An engaged kill
+// switch passes them, whether at the start or during the wait.
+func (t *clusterTarget) check(shutdown context.Context, opts *options, reports reportFiles, timeout time.Duration) ([]*checkResult, int) {
+	killSwitch := newKillSwitch(opts, t)
+	if killSwitch.engaged(shutdown) {
+		return killSwitch.bypass(t.results), exitOK
+	}
+	ctx, cancel := context.WithCancelCause(shutdown)
+	defer cancel(nil)
+	go killSwitch.watch(ctx, cancel)
+	results, code := t.checkResources(ctx, opts, reports, timeout)
+	if errors.Is(context.Cause(ctx), errBypassed) {
+		return killSwitch.bypass(results), exitOK
+	}
+	return results, code
+}
+
+// checkResources is check without the kill switch, shutdown being canceled
+// on a signal or by the kill switch.
+func (t *clusterTarget) checkResources(shutdown context.Context, opts *options, reports reportFiles, timeout time.Duration) ([]*checkResult, int) {
+	kind := opts.resourceKind()
+	gvr, err := resolveAPIVersion(t.discovery, kind.gvr, opts.apiVersion)
+	switch {
+	case errors.Is(err, errNotServed):
+		t.log.errorf("Error: %v", err)
+		return failAll(t.results, err), exitNotFound
+	case err != nil:
+		t.log.warnf("Warning: could not discover the served %s API version, using %s: %v", kind.name, gvr.Version, err)
+	case opts.apiVersion == "":
+		t.log.infof("Using %s API %s/%s, the preferred served version", kind.name, gvr.Group, gvr.Version)
+	}
+	t.startup.record(startupDiscovery)
+
+	// The overall deadline covers waiting for the namespace as well
+	ctx, cancel := context.WithTimeout(shutdown, timeout)
+	defer cancel()
+
+	// Cluster-scoped resources, and those of -all-namespaces, have no
+	// namespace to wait for. Every namespace of -namespace is waited for
+	// in turn, within the same deadline. A deletion wait is done once the
+	// namespace is gone, so it does not wait for it.
+	if namespaces := opts.namespaces(); !kind.clusterScoped && len(namespaces) > 0 && opts.waitFor != waitForDeleted {
+		reports.observers.phase(phaseNamespace)
+		var err error
+		for _, namespace := range namespaces {
+			if err = waitForNamespace(ctx, t.clientset, t.apiCalls, namespace, opts.perCallTimeout); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			t.log.errorf("Error: %v", err)
+			failAll(t.results, err)
+			var terminating *namespaceTerminatingError
+			for _, result := range t.results {
+				switch {
+				case errors.As(err, &terminating):
+					result.Outcome = outcomeNamespaceTerminating
+				case shutdown.Err() != nil:
+					result.Outcome = outcomeCanceled
+				case ctx.Err() != nil:
+					result.Outcome = outcomeTimeout
+				}
+			}
+			code := exitCodeFor(err)
+			if ctx.Err() != nil && shutdown.Err() == nil {
+				code = exitTimeout
+			}
+			return t.results, code
+		}
+		t.startup.record(startupNamespace)
+	}
+
+	// Check the status of the ExternalSecret with timeout
+	r := &run{
+		opts:           opts,
+		clientset:      t.clientset,
+		metadataClient: t.metadataClient,
+		observers:      reports.observers,
+		stateFile:      reports.stateFile,
+		prefixNames:    opts.several(),
+		cluster:        t.log.cluster,
+		// Denials are isolated per namespace unless -fail-fast is given
+		isolateDenied: opts.severalNamespaces() && !setFlags(flag.CommandLine)["fail-fast"],
+		checker: checker{
+			dynamicClient:       t.dynamicClient,
+			clientset:           t.clientset,
+			discovery:           t.discovery,
+			kind:                kind,
+			gvr:                 gvr,
+			pinnedVersion:       opts.apiVersion != "",
+			timeout:             timeout,
+			pollInterval:        opts.interval,
+			consecutiveReady:    opts.consecutiveReady,
+			requirements:        opts.requirements,
+			requireExists:       opts.requireExists,
+			perCallTimeout:      opts.perCallTimeout,
+			uid:                 opts.uid,
+			rebindOnUIDChange:   opts.onUIDChange == uidChangeRebind,
+			apiCalls:            t.apiCalls,
+			skipAnnotation:      opts.honoredSkipAnnotation(),
+			watchTargetSecret:   opts.watchTargetSecret,
+			watchMode:           opts.watchMode,
+			failOn:              opts.failOnConditions,
+			fatalRules:          opts.fatalRules(),
+			failOnTemplate:      !opts.waitOnTemplateError,
+			waitOnDenied:        opts.waitOnDenied,
+			eventHistory:        opts.eventHistory,
+			checkStore:          opts.checkStore,
+			revalidation:        t.revalidation,
+			startup:             t.startup,
+			unreconciledAfter:   opts.unreconciledAfter,
+			noProgressAfter:     opts.noProgressAfter,
+			checkController:     opts.checkController,
+			heartbeat:           opts.heartbeat,
+			includeTargetSecret: opts.includeTargetSecret,
+			maxConditionAge:     opts.maxConditionAge,
+			failOnOldCondition:  opts.onOldCondition == oldConditionFail,
+			verifyFreshness:     !opts.skipFreshness && kind.hasTarget,
+			minRefreshTime:      opts.minRefreshTime,
+			waitForGeneration:   opts.waitForGeneration,
+			clockSkewTolerance:  opts.clockSkewTolerance,
+			captures:            reports.captures,
+			recorder:            reports.recorder,
+			observers:           reports.observers,
+			progress:            opts.progress,
+		},
+	}
+	if opts.discovers() {
+		return r.checkSelected(ctx, checkResult{
+			Cluster:        t.name,
+			Labels:         opts.labels,
+			IdempotencyKey: opts.idempotencyKey,
+			Enforced:       opts.enforce,
+			Config:         t.entries,
+		})
+	}
+	return r.checkAll(ctx, t.results)
+}
+
+// checkClusters checks every cluster concurrently, each with the whole
+// timeout, and returns the results of all of them. Clusters that could not be
+// connected to have their results failed already and are not checked. The
+// exit code is the most severe of the clusters.
+func checkClusters(shutdown context.Context, opts *options, reports reportFiles, targets []*clusterTarget, connectErrs []error, timeout time.Duration) ([]*checkResult, int) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []*checkResult
+		codes   []int
+	)
+	for i, t := range targets {
+		if connectErrs[i] != nil {
+			results = append(results, failAll(t.results, connectErrs[i])...)
+			codes = append(codes, exitCodeFor(connectErrs[i]))
+			continue
+		}
+		wg.Add(1)
+		go func(t *clusterTarget) {
+			defer wg.Done()
+			clusterResults, code := t.check(shutdown, opts, reports, timeout)
+			reports.attachStats(t.apiCalls, t.startup, clusterResults, t.log)
+			mu.Lock()
+			results = append(results, clusterResults...)
+			codes = append(codes, code)
+			mu.Unlock()
+		}(t)
+	}
+	wg.Wait()
+	code := exitOK
+	for _, c := range codes {
+		code = mergeExitCode(code, c)
+	}
+	return results, code
+}
+
+// spansClusters reports whether the results come from more than one cluster.
+func spansClusters(results []*checkResult) bool {
+	for _, result := range results {
+		if result.Cluster != results[0].Cluster {
+			return true
+		}
+	}
+	return false
+}
+
+// printClusterSummary prints the results of a run fanning out to several
+// clusters grouped by cluster, then every resource that is not in the same
+// state everywhere, since a rollout that went through in some clusters only
+// is what such a run is for catching, and finally the verdict of the run.
+func printClusterSummary(results []*checkResult) {
+	var clusters []string
+	byCluster := map[string][]*checkResult{}
+	withNamespace := false
+	for _, result := range results {
+		if _, seen := byCluster[result.Cluster]; !seen {
+			clusters = append(clusters, result.Cluster)
+		}
+		byCluster[result.Cluster] = append(byCluster[result.Cluster], result)
+		withNamespace = withNamespace || result.Namespace != results[0].Namespace
+	}
+	sort.Strings(clusters)
+
+	console.infof("Results by cluster:")
+	var notReadyClusters []string
+	for _, cluster := range clusters {
+		line := readyLine(byCluster[cluster], withNamespace)
+		for _, result := range byCluster[cluster] {
+			if !result.Ready() {
+				notReadyClusters = append(notReadyClusters, cluster)
+				break
+			}
+		}
+		console.infof("  Cluster %s: %s", cluster, line)
+	}
+
+	// Resources by label, with their result in each cluster they were
+	// checked in
+	var labels []string
+	byLabel := map[string]map[string]*checkResult{}
+	for _, result := range results {
+		label := resourceLabel(result.Namespace, result.Name, withNamespace)
+		if byLabel[label] == nil {
+			labels = append(labels, label)
+			byLabel[label] = map[string]*checkResult{}
+		}
+		byLabel[label][result.Cluster] = result
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		var ready, notReady, missing []string
+		for _, cluster := range clusters {
+			result, checked := byLabel[label][cluster]
+			switch {
+			case !checked:
+				missing = append(missing, cluster)
+			case result.Ready():
+				ready = append(ready, cluster)
+			default:
+				notReady = append(notReady, fmt.Sprintf("%s (%s)", cluster, result.Outcome))
+			}
+		}
+		if len(ready) == len(clusters) || len(ready) == 0 && len(missing) == 0 && sameOutcome(byLabel[label]) {
+			continue
+		}
+		line := fmt.Sprintf("Divergence: %s is Ready in %d of %d clusters", label, len(ready), len(clusters))
+		if len(notReady) > 0 {
+			line += "; not ready in " + strings.Join(notReady, ", ")
+		}
+		if len(missing) > 0 {
+			line += "; not found in " + strings.Join(missing, ", ")
+		}
+		console.warnf("Warning: %s", line)
+	}
+
+	if len(notReadyClusters) == 0 {
+		console.infof("Verdict: Ready in all %d clusters", len(clusters))
+		return
+	}
+	console.errorf("Verdict: not Ready in %d of %d clusters (%s)", len(notReadyClusters), len(clusters), strings.Join(notReadyClusters, ", "))
+}
+
+// sameOutcome reports whether a resource ended the same way in every cluster.
+func sameOutcome(byCluster map[string]*checkResult) bool {
+	var first outcome
+	for _, result := range byCluster {
+		if first == "" {
+			first = result.Outcome
+		} else if result.Outcome != first {
+			return false
+		}
+	}
+	return true
+}
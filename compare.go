@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// parseResourceRef parses namespace/name, or a bare name in defaultNamespace.
+func parseResourceRef(ref, defaultNamespace string) (string, string, error) {
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found {
+		namespace, name = defaultNamespace, ref
+	}
+	if namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid resource %q, expected namespace/name", ref)
+	}
+	return namespace, name, nil
+}
+
+// secretComparison is the verdict of comparing the target Secrets of two
+// ExternalSecrets by key names and data hash, never by values.
+type secretComparison struct {
+	OnlyInFirst  []string
+	OnlyInSecond []string
+	SameDataHash bool
+}
+
+// Diverged reports whether the key sets differ.
+func (c secretComparison) Diverged() bool {
+	return len(c.OnlyInFirst) > 0 || len(c.OnlyInSecond) > 0
+}
+
+func (c secretComparison) String() string {
+	hash := "different data hashes"
+	if c.SameDataHash {
+		hash = "same data hash"
+	}
+	if !c.Diverged() {
+		return "identical key sets, " + hash
+	}
+	var parts []string
+	if len(c.OnlyInFirst) > 0 {
+		parts = append(parts, "only in first: "+strings.Join(c.OnlyInFirst, ", "))
+	}
+	if len(c.OnlyInSecond) > 0 {
+		parts = append(parts, "only in second: "+strings.Join(c.OnlyInSecond, ", "))
+	}
+	return "key sets diverge (" + strings.Join(parts, "; ") + "), " + hash
+}
+
+// waitAndCompare waits for the ExternalSecret of -compare-with within the
+// remaining deadline and compares its target Secret with that of result.
+func (c *checker) waitAndCompare(ctx context.Context, namespace, name string, result *checkResult) error {
+	other := &checkResult{Cluster: result.Cluster, Labels: result.Labels, Enforced: result.Enforced, Namespace: namespace, Name: name}
+	result.Compared = other
+	compared := *c
+	compared.uid = ""
+	compared.log = c.log.forResource(namespace, name)
+	c.log.infof("Waiting for ExternalSecret %s/%s to compare with...", namespace, name)
+	if err := compared.checkStatusWithTimeout(ctx, namespace, name, other); err != nil {
+		other.ReasonCode = reasonCodeFor(other)
+		return fmt.Errorf("compared ExternalSecret %s/%s: %w", namespace, name, err)
+	}
+
+	comparison, err := compareTargets(ctx, c.clientset, result.object, other.object, c.perCallTimeout)
+	if err != nil {
+		return err
+	}
+	result.Comparison = &comparison
+	c.log.infof("Comparison with %s/%s: %s", namespace, name, comparison)
+	if comparison.Diverged() {
+		result.Outcome = outcomeDiverged
+		result.Reason = "key sets diverge"
+		return fmt.Errorf("target Secrets of %s/%s and %s/%s have different keys", result.Namespace, result.Name, namespace, name)
+	}
+	return nil
+}
+
+// compareTargets compares the target Secrets of two ExternalSecrets.
+func compareTargets(ctx context.Context, clientset kubernetes.Interface, first, second *unstructured.Unstructured, timeout time.Duration) (secretComparison, error) {
+	firstKeys, firstHash, err := targetKeys(ctx, clientset, first, timeout)
+	if err != nil {
+		return secretComparison{}, err
+	}
+	secondKeys, secondHash, err := targetKeys(ctx, clientset, second, timeout)
+	if err != nil {
+		return secretComparison{}, err
+	}
+
+	comparison := secretComparison{SameDataHash: firstHash != "" && firstHash == secondHash}
+	for key := range firstKeys {
+		if !secondKeys[key] {
+			comparison.OnlyInFirst = append(comparison.OnlyInFirst, key)
+		}
+	}
+	for key := range secondKeys {
+		if !firstKeys[key] {
+			comparison.OnlyInSecond = append(comparison.OnlyInSecond, key)
+		}
+	}
+	sort.Strings(comparison.OnlyInFirst)
+	sort.Strings(comparison.OnlyInSecond)
+	return comparison, nil
+}
+
+// targetKeys returns the data key names and the data-hash annotation of the
+// target Secret of an ExternalSecret.
+func targetKeys(ctx context.Context, clientset kubernetes.Interface, unstructuredES *unstructured.Unstructured, timeout time.Duration) (map[string]bool, string, error) {
+	ctx, cancel, err := phaseContext(ctx, timeout)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cancel()
+	target := targetSecretName(unstructuredES)
+	secret, err := clientset.CoreV1().Secrets(unstructuredES.GetNamespace()).Get(ctx, target, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read target Secret %s/%s: %w", unstructuredES.GetNamespace(), target, err)
+	}
+	keys := make(map[string]bool, len(secret.Data))
+	for key := range secret.Data {
+		keys[key] = true
+	}
+	return keys, secret.Annotations[dataHashAnnotation], nil
+}
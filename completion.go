@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// completeCommand is the hidden subcommand the completion script calls to
+// obtain suggestions.
+const completeCommand = "__complete"
+
+// completionBudget bounds cluster lookups during completion so an unreachable
+// cluster never makes the shell hang.
+const completionBudget = 2 * time.Second
+
+var subcommands = []string{"rbac", "health", "completion", "check-update", "replay", "schema", "version"}
+
+const bashCompletion = `# bash completion for external-secret-watcher
+_external_secret_watcher() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$("${COMP_WORDS[0]}" __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)" -- "$cur"))
+}
+complete -o default -F _external_secret_watcher external-secret-watcher
+`
+
+// runCompletion implements the completion subcommand, which prints the shell
+// script to source. zsh users can load it through bashcompinit.
+func runCompletion(args []string) int {
+	if len(args) != 1 || args[0] != "bash" {
+		fmt.Println("Usage: ./external-secret-watcher completion bash")
+		return 1
+	}
+	fmt.Print(bashCompletion)
+	return 0
+}
+
+// runComplete prints one suggestion per line for the last word of args. It
+// never prints errors and always exits successfully, since anything written
+// here ends up in the shell's completion display.
+func runComplete(args []string) int {
+	// Keep client-go's own logging out of the completion output.
+	if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		os.Stderr = devNull
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionBudget)
+	defer cancel()
+	for _, suggestion := range completions(ctx, args) {
+		fmt.Println(suggestion)
+	}
+	return 0
+}
+
+func completions(ctx context.Context, args []string) []string {
+	// Bash splits "-flag=value" into separate words around the "=".
+	var words []string
+	for _, arg := range args {
+		if arg != "=" {
+			words = append(words, arg)
+		}
+	}
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+	previous := ""
+	if len(words) > 1 {
+		previous = strings.TrimLeft(words[len(words)-2], "-")
+	}
+
+	switch {
+	case previous == "namespace":
+		return completeNamespaces(ctx, typedSource(words))
+	case previous == "name":
+		return completeNames(ctx, typedSource(words), typedFlag(words, "namespace"))
+	case strings.HasPrefix(current, "-"):
+		return completeFlags()
+	case len(words) == 1:
+		return subcommands
+	}
+	return nil
+}
+
+// typedFlag returns the value of a flag already present on the command line.
+func typedFlag(words []string, name string) string {
+	for i, word := range words {
+		flagName := strings.TrimLeft(word, "-")
+		if flagName == word {
+			continue
+		}
+		if value, ok := strings.CutPrefix(flagName, name+"="); ok {
+			return value
+		}
+		if flagName == name && i+1 < len(words)-1 {
+			return words[i+1]
+		}
+	}
+	return ""
+}
+
+// typedSource returns the kubeconfig source selected by the -kubeconfig and
+// -context flags already present on the command line, so that completions
+// come from the cluster the command will run against.
+func typedSource(words []string) kubeconfigSource {
+	return kubeconfigSource{path: typedFlag(words, "kubeconfig"), context: typedFlag(words, "context")}
+}
+
+func completeFlags() []string {
+	var opts options
+	fs := flag.NewFlagSet("complete", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	opts.register(fs)
+
+	var flags []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			flags = append(flags, "-"+f.Name)
+		}
+	})
+	return flags
+}
+
+func completeNamespaces(ctx context.Context, source kubeconfigSource) []string {
+	config, err := source.load("")
+	if err != nil {
+		return nil
+	}
+	config.Timeout = completionBudget
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil
+	}
+	list, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, ns := range list.Items {
+		names = append(names, ns.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func completeNames(ctx context.Context, source kubeconfigSource, namespace string) []string {
+	if namespace == "" {
+		namespace = defaultNamespace(source)
+	}
+	config, err := source.load("")
+	if err != nil {
+		return nil
+	}
+	config.Timeout = completionBudget
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil
+	}
+	list, err := dynamicClient.Resource(externalSecretGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.GetName())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultNamespace returns the namespace of the context source selects.
+func defaultNamespace(source kubeconfigSource) string {
+	files, _ := source.files()
+	if len(files) == 0 {
+		return "default"
+	}
+	namespace, _, err := source.clientConfig(files, "").Namespace()
+	if err != nil || namespace == "" {
+		return "default"
+	}
+	return namespace
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// namespaceServer is an API server whose only namespace is its name, and
+// which records the namespaces ExternalSecrets are listed in.
+func namespaceServer(t *testing.T, name string, listed *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/v1/namespaces":
+			fmt.Fprintf(w, `{"kind":"NamespaceList","apiVersion":"v1","items":[{"metadata":{"name":%q}}]}`, name)
+		case strings.HasSuffix(r.URL.Path, "/externalsecrets"):
+			*listed = append(*listed, name+":"+strings.Split(r.URL.Path, "/")[5])
+			fmt.Fprintf(w, `{"kind":"ExternalSecretList","apiVersion":"external-secrets.io/v1beta1","items":[{"metadata":{"name":%q}}]}`, name+"-es")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeKubeconfig writes a kubeconfig with a context per server, named after
+// it, the first one being current.
+func writeKubeconfig(t *testing.T, servers map[string]*httptest.Server, current, namespace string) string {
+	var clusters, contexts strings.Builder
+	for name, server := range servers {
+		fmt.Fprintf(&clusters, "- name: %s\n  cluster:\n    server: %s\n", name, server.URL)
+		fmt.Fprintf(&contexts, "- name: %s\n  context:\n    cluster: %s\n    user: test\n    namespace: %s\n", name, name, namespace)
+	}
+	path := filepath.Join(t.TempDir(), "config")
+	content := fmt.Sprintf("apiVersion: v1\nkind: Config\ncurrent-context: %s\nclusters:\n%scontexts:\n%susers:\n- name: test\n  user:\n    token: test\n", current, clusters.String(), contexts.String())
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestCompletionFollowsTypedKubeconfig completes against the kubeconfig and
+// context typed on the command line, over $KUBECONFIG and the current
+// context.
+func TestCompletionFollowsTypedKubeconfig(t *testing.T) {
+	var listed []string
+	env := namespaceServer(t, "env", &listed)
+	flagged := namespaceServer(t, "flagged", &listed)
+	other := namespaceServer(t, "other", &listed)
+	t.Setenv("KUBECONFIG", writeKubeconfig(t, map[string]*httptest.Server{"env": env}, "env", "env-ns"))
+	typed := writeKubeconfig(t, map[string]*httptest.Server{"flagged": flagged, "other": other}, "flagged", "typed-ns")
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-namespace", ""}, "env"},
+		{[]string{"-kubeconfig", typed, "-namespace", ""}, "flagged"},
+		{[]string{"-kubeconfig=" + typed, "-context=other", "-namespace", ""}, "other"},
+		// -context applies to $KUBECONFIG as well, which lacks it
+		{[]string{"-context", "other", "-namespace", ""}, ""},
+	} {
+		if got := strings.Join(completions(context.Background(), test.args), " "); got != test.want {
+			t.Errorf("%q: namespaces = %q, want %q", test.args, got, test.want)
+		}
+	}
+
+	if got := completions(context.Background(), []string{"-context=other", "-kubeconfig", typed, "-name", ""}); strings.Join(got, " ") != "other-es" {
+		t.Errorf("names = %q, want other-es", got)
+	}
+	if got := completions(context.Background(), []string{"-name", ""}); strings.Join(got, " ") != "env-es" {
+		t.Errorf("names = %q, want env-es", got)
+	}
+	// Without -namespace, names come from the namespace of the context
+	if want := "other:typed-ns env:env-ns"; strings.Join(listed, " ") != want {
+		t.Errorf("listed ExternalSecrets in %q, want %q", listed, want)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// What -on-old-condition does with a Ready state frozen in time.
+const (
+	oldConditionFail = "fail"
+	oldConditionWait = "wait"
+)
+
+// frozenReady returns why a Ready state looks frozen in time, as left behind
+// by a controller shard that was decommissioned, or an empty string. The
+// Ready condition being older than -max-condition-age is not enough, as a
+// healthy resource keeps its transition time for as long as it stays
+// Ready: its refreshTime, and when there is one the last write of its target
+// Secret, must be older too. A signal that cannot be read does not
+// corroborate, so that a resource is never failed on its age alone.
+func (c *checker) frozenReady(ctx context.Context, unstructuredES *unstructured.Unstructured, conditions []Condition) string {
+	if c.maxConditionAge <= 0 {
+		return ""
+	}
+	var since time.Time
+	for _, condition := range conditions {
+		if condition.Type == "Ready" {
+			since = condition.TransitionTime()
+		}
+	}
+	now := c.now()
+	if since.IsZero() || now.Sub(since) <= c.maxConditionAge {
+		return ""
+	}
+	refreshTimeRaw, _, _ := unstructured.NestedString(unstructuredES.Object, "status", "refreshTime")
+	refreshTime, err := time.Parse(time.RFC3339, refreshTimeRaw)
+	if err != nil || now.Sub(refreshTime) <= c.maxConditionAge {
+		return ""
+	}
+	signals := []string{
+		"Ready since " + formatTime(since, now),
+		"last refresh " + formatTime(refreshTime, now),
+	}
+	if c.kind.hasTarget {
+		target := targetSecretName(unstructuredES)
+		callCtx, cancel := context.WithTimeout(ctx, c.perCallTimeout)
+		defer cancel()
+		secret, err := c.clientset.CoreV1().Secrets(unstructuredES.GetNamespace()).Get(callCtx, target, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			signals = append(signals, "target Secret "+target+" missing")
+		case err != nil:
+			return ""
+		default:
+			written := lastObjectUpdate(&secret.ObjectMeta)
+			if now.Sub(written) <= c.maxConditionAge {
+				return ""
+			}
+			signals = append(signals, fmt.Sprintf("target Secret %s last written %s (resourceVersion %s)", target, formatTime(written, now), secret.ResourceVersion))
+		}
+	}
+	return fmt.Sprintf("the status looks frozen in time, as if no controller reconciles this resource any more: %s, all older than -max-condition-age %s",
+		strings.Join(signals, ", "), formatDuration(c.maxConditionAge))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	escheck "external-secret-watcher/pkg/checker"
+)
+
+// conditionsReady is the readiness of ExternalSecrets and PushSecrets: the
+// Ready rule of pkg/checker, applied to the conditions the wait judges by.
+func conditionsReady(_ *unstructured.Unstructured, conditions []Condition) bool {
+	return escheck.IsReady(conditions)
+}
+
+// Condition is a status condition, as the embeddable checker parses it.
+type Condition = escheck.Condition
+
+func getConditions(unstructuredES *unstructured.Unstructured) []Condition {
+	conditions, _ := parseConditions(unstructuredES)
+	return conditions
+}
+
+// parseConditions returns the status conditions along with the types that
+// appeared more than once, as pkg/checker resolves them, with the messages
+// redacted.
+func parseConditions(unstructuredES *unstructured.Unstructured) ([]Condition, []string) {
+	conditions, duplicates := escheck.ParseConditions(unstructuredES)
+	for i := range conditions {
+		conditions[i].Message = redactions.redact(unstructuredES.GetNamespace(), unstructuredES.GetName(), conditions[i].Message)
+	}
+	return conditions, duplicates
+}
+
+// conditionField reads a status field leniently, other value types passing
+// through in their printed form.
+func conditionField(conditionMap map[string]interface{}, key string) string {
+	switch value := conditionMap[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// matchCondition returns the first condition matching one of the given
+// Type=Status pairs.
+func matchCondition(conditions []Condition, matches []conditionMatch) (Condition, bool) {
+	for _, condition := range conditions {
+		for _, m := range matches {
+			if condition.Type == m.Type && condition.Status == m.Status {
+				return condition, true
+			}
+		}
+	}
+	return Condition{}, false
+}
+
+// otherTrueConditions lists the types of conditions other than Ready that are
+// currently True, e.g. Deleted.
+func otherTrueConditions(conditions []Condition) []string {
+	var types []string
+	for _, condition := range conditions {
+		if condition.Type != "Ready" && condition.Status == "True" {
+			types = append(types, condition.Type)
+		}
+	}
+	return types
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const hintNoProgress = "ControllerNotRunning"
+
+// controllerSelector selects the pods of the external-secrets controller as
+// the Helm chart labels them.
+const controllerSelector = "app.kubernetes.io/name=external-secrets"
+
+// quietFor returns how long a resource without any status condition has
+// gone without an event either: since the last event observed for it, the
+// start of the wait at the earliest. It returns 0 once it has conditions.
+func quietFor(conditions []Condition, events *eventStats, start, now time.Time) time.Duration {
+	if len(conditions) > 0 {
+		return 0
+	}
+	since := start
+	if last := events.lastEvent(); last.After(since) {
+		since = last
+	}
+	return now.Sub(since)
+}
+
+// noProgressHint is the diagnosis of a resource nothing happens to at all,
+// which is what a controller that is not running looks like.
+func noProgressHint(quiet time.Duration, controller string) hint {
+	message := fmt.Sprintf("no status conditions and no events for %s: the external-secrets controller may not be running, or may be scaled to zero", formatDuration(quiet))
+	if controller != "" {
+		message += "; " + controller
+	}
+	return hint{Code: hintNoProgress, Message: message}
+}
+
+// describeController reports whether any pod of the controller is Running,
+// looking in every namespace, for -check-controller.
+func (c *checker) describeController(ctx context.Context) string {
+	ctx, cancel, err := phaseContext(ctx, c.perCallTimeout)
+	if err != nil {
+		return ""
+	}
+	defer cancel()
+	pods, err := c.clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{LabelSelector: controllerSelector})
+	if err != nil {
+		return fmt.Sprintf("could not list the controller pods (%s): %v", controllerSelector, err)
+	}
+	if len(pods.Items) == 0 {
+		return fmt.Sprintf("no controller pods (%s) found in any namespace", controllerSelector)
+	}
+	var running, others []string
+	for _, pod := range pods.Items {
+		name := pod.Namespace + "/" + pod.Name
+		if pod.Status.Phase == corev1.PodRunning {
+			running = append(running, name)
+		} else {
+			others = append(others, fmt.Sprintf("%s (%s)", name, pod.Status.Phase))
+		}
+	}
+	sort.Strings(running)
+	sort.Strings(others)
+	if len(running) == 0 {
+		return fmt.Sprintf("none of the controller pods is Running: %s", strings.Join(others, ", "))
+	}
+	return fmt.Sprintf("%d of %d controller pods Running: %s", len(running), len(pods.Items), strings.Join(running, ", "))
+}
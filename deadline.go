@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errDeadlineExhausted is reported for phases after the wait that were not
+// run because the overall deadline had passed.
+var errDeadlineExhausted = errors.New("verification skipped: deadline exhausted")
+
+// verificationCalls is the number of requests the phases after the wait may
+// make: the target Secret diagnosis, the bound Secret and the target Secret
+// state.
+const verificationCalls = 3
+
+// verificationReserve is the part of the overall deadline kept for the
+// phases after the wait, so that they do not push the run past it. It never
+// exceeds a quarter of the timeout.
+func verificationReserve(timeout, perCallTimeout time.Duration) time.Duration {
+	reserve := verificationCalls * perCallTimeout
+	if reserve > timeout/4 {
+		reserve = timeout / 4
+	}
+	return reserve
+}
+
+// waitContext bounds the wait loop by the timeout and by the deadline of
+// ctx minus the verification reserve.
+func (c *checker) waitContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancelTimeout := context.WithTimeout(ctx, c.timeout)
+	deadline, _ := ctx.Deadline()
+	waitCtx, cancel := context.WithDeadline(ctx, deadline.Add(-verificationReserve(c.timeout, c.perCallTimeout)))
+	return waitCtx, func() { cancel(); cancelTimeout() }
+}
+
+// waitWithin describes how long the wait bounded by ctx, started at start,
+// could last: the timeout, or less when the verification reserve or the
+// deadline of the run cut it short.
+func (c *checker) waitWithin(ctx context.Context, start time.Time) string {
+	deadline, ok := ctx.Deadline()
+	if !ok || !deadline.Before(start.Add(c.timeout)) {
+		return formatDuration(c.timeout)
+	}
+	return fmt.Sprintf("%s (of the %s timeout, the rest kept for the checks after the wait)", formatDuration(deadline.Sub(start)), formatDuration(c.timeout))
+}
+
+// phaseContext time-boxes a single phase after the wait by perCallTimeout
+// within ctx. It returns errDeadlineExhausted when ctx is already done.
+func phaseContext(ctx context.Context, perCallTimeout time.Duration) (context.Context, context.CancelFunc, error) {
+	if ctx.Err() != nil {
+		return nil, nil, errDeadlineExhausted
+	}
+	phaseCtx, cancel := context.WithTimeout(ctx, perCallTimeout)
+	return phaseCtx, cancel, nil
+}
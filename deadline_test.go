@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// hangingServer serves a namespace and an ExternalSecret that never becomes
+// Ready, and hangs every other request, the phases after the wait
+// included, until the client gives up on it.
+func hangingServer(t *testing.T) *rest.Config {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/apps":
+			fmt.Fprint(w, `{"kind":"Namespace","apiVersion":"v1","metadata":{"name":"apps"},"status":{"phase":"Active"}}`)
+		case r.URL.Path == "/apis/external-secrets.io/v1beta1/namespaces/apps/externalsecrets/db":
+			fmt.Fprint(w, `{"kind":"ExternalSecret","apiVersion":"external-secrets.io/v1beta1","metadata":{"namespace":"apps","name":"db","uid":"uid-db","resourceVersion":"1"},`+
+				`"spec":{"target":{"name":"db"}},"status":{"conditions":[{"type":"Ready","status":"False","reason":"SecretSyncedError","message":"provider timed out"}]}}`)
+		case r.URL.Path == "/api/v1/namespaces/apps/events" && r.URL.Query().Get("resourceVersion") == "0":
+			fmt.Fprint(w, `{"kind":"EventList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[]}`)
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(server.Close)
+	return &rest.Config{Host: server.URL}
+}
+
+// TestPhasesAfterTheWaitHonorTheDeadline times out against a server on
+// which every phase after the wait hangs: the run still ends within the
+// timeout, reporting the phases it skipped.
+func TestPhasesAfterTheWaitHonorTheDeadline(t *testing.T) {
+	out := captureConsole(t)
+	config := hangingServer(t)
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := parseTestOptions(t, "-namespace=apps", "-name=db", "-timeout=2s", "-interval=100ms", "-per-call-timeout=1s", "-watch-mode=poll", "-min-keys=1")
+	target := &clusterTarget{
+		name:          "test",
+		log:           console,
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+		discovery:     newMemoDiscovery(newFakeDiscovery("v1beta1"), false),
+		apiCalls:      newAPICallLog(false),
+		results:       []*checkResult{{Namespace: "apps", Name: "db"}},
+	}
+
+	const epsilon = 250 * time.Millisecond
+	start := time.Now()
+	results, code := target.checkResources(context.Background(), opts, reportFiles{}, opts.timeout)
+	if took := time.Since(start); took > opts.timeout+epsilon {
+		t.Errorf("the run took %s, over the %s timeout:\n%s", took, opts.timeout, out)
+	}
+	if code != exitTimeout {
+		t.Errorf("exit code %d, want %d:\n%s", code, exitTimeout, out)
+	}
+	if want := "(of the 2s timeout, the rest kept for the checks after the wait)"; !strings.Contains(out.String(), want) {
+		t.Errorf("the timeout does not report the wait deadline left by the reserve, %q:\n%s", want, out)
+	}
+	if skipped := strings.Join(results[0].SkippedPhases, "; "); !strings.Contains(skipped, errDeadlineExhausted.Error()) {
+		t.Errorf("skipped phases = %q, want those after the deadline", skipped)
+	}
+	if record := newResultRecord(results[0]); len(record.SkippedPhases) != len(results[0].SkippedPhases) {
+		t.Errorf("the result record lists skipped phases %q, want %q", record.SkippedPhases, results[0].SkippedPhases)
+	}
+}
+
+func TestVerificationReserve(t *testing.T) {
+	for _, test := range []struct {
+		timeout, perCall, want time.Duration
+	}{
+		{10 * time.Minute, 10 * time.Second, 30 * time.Second},
+		// Never more than a quarter of the timeout
+		{20 * time.Second, 10 * time.Second, 5 * time.Second},
+	} {
+		if got := verificationReserve(test.timeout, test.perCall); got != test.want {
+			t.Errorf("verificationReserve(%s, %s) = %s, want %s", test.timeout, test.perCall, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// What -wait-for waits for.
+const (
+	waitForReady   = "ready"
+	waitForDeleted = "deleted"
+)
+
+// leftover is an object the deletion wait still finds.
+type leftover struct {
+	what       string
+	terminated *metav1.Time
+	finalizers []string
+}
+
+func (l leftover) String() string {
+	if l.terminated == nil {
+		return l.what + " still exists and is not being deleted"
+	}
+	held := "no finalizers left"
+	if len(l.finalizers) > 0 {
+		held = "finalizers " + strings.Join(l.finalizers, ", ")
+	}
+	return fmt.Sprintf("%s is stuck terminating since %s, held by %s", l.what, formatTime(l.terminated.Time, time.Now()), held)
+}
+
+// waitForDeletion waits until the ExternalSecret is gone, and with
+// includeTargetSecret its target Secret too, for -wait-for=deleted. The
+// target Secret is the one the ExternalSecret named when it was last seen,
+// else the Secret of the same name. Errors that may clear up are retried at
+// the next poll.
+func (c *checker) waitForDeletion(ctx context.Context, namespace, name string, result *checkResult) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	c.observers.phase(phaseWaiting)
+	start := time.Now()
+	defer func() { result.Waited = time.Since(start) }()
+
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+	target := name
+	var last string
+	for {
+		remaining, err := c.remaining(ctx, namespace, name, &target, result)
+		switch {
+		case isDenied(err):
+			result.failed(err)
+			return fmt.Errorf("not allowed to check the deletion of %s %s: %w", c.kind.name, name, err)
+		case err != nil:
+			c.log.warnf("Warning: %v (retrying)", err)
+		case remaining == nil:
+			result.Outcome = outcomeDeleted
+			c.log.infof("%s %s is deleted.", c.kind.name, name)
+			return nil
+		case remaining.String() != last:
+			last = remaining.String()
+			c.log.infof("%sWaiting for deletion: %s", c.prefix, last)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			result.Outcome = outcomeTimeout
+			if remaining == nil {
+				return fmt.Errorf("%w: could not check the deletion of %s %s within %s", errTimeout, c.kind.name, name, formatDuration(c.timeout))
+			}
+			result.Reason = remaining.String()
+			return fmt.Errorf("%w: %s %s not deleted within %s: %s", errTimeout, c.kind.name, name, formatDuration(c.timeout), remaining)
+		}
+	}
+}
+
+// remaining returns the first object of the deletion wait that still
+// exists, nil when none does. target is updated to the target Secret of the
+// ExternalSecret while it is found.
+func (c *checker) remaining(ctx context.Context, namespace, name string, target *string, result *checkResult) (*leftover, error) {
+	callCtx, cancel := context.WithTimeout(ctx, c.perCallTimeout)
+	defer cancel()
+	obj, err := c.dynamicClient.Resource(c.gvr).Namespace(namespace).Get(callCtx, name, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		result.observe(obj, getConditions(obj))
+		*target = targetSecretName(obj)
+		return &leftover{what: c.kind.name + " " + name, terminated: obj.GetDeletionTimestamp(), finalizers: obj.GetFinalizers()}, nil
+	case !apierrors.IsNotFound(err) || isResourceUnavailable(err):
+		return nil, fmt.Errorf("getting %s %s: %w", c.kind.name, name, err)
+	}
+	if !c.includeTargetSecret {
+		return nil, nil
+	}
+	secret, err := c.clientset.CoreV1().Secrets(namespace).Get(callCtx, *target, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("getting target Secret %s: %w", *target, err)
+	}
+	return &leftover{what: "target Secret " + *target, terminated: secret.DeletionTimestamp, finalizers: secret.Finalizers}, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+)
+
+// memoDiscovery memoizes the discovery lookups of a cluster for the run:
+// resolving the served version of each kind, for each resource and again
+// while the resource type is unavailable, would otherwise repeat the same
+// requests. Failed lookups are not memoized. It is safe for concurrent use.
+type memoDiscovery struct {
+	discovery.DiscoveryInterface
+	// debug logs how long each lookup that reached the server took.
+	debug bool
+	// fresh sends every lookup to the server, with -refresh-discovery.
+	fresh bool
+
+	mu        sync.Mutex
+	groups    *metav1.APIGroupList
+	resources map[string]*metav1.APIResourceList
+	fetchedAt time.Time
+}
+
+func newMemoDiscovery(client discovery.DiscoveryInterface, debug bool) *memoDiscovery {
+	return &memoDiscovery{DiscoveryInterface: client, debug: debug, resources: map[string]*metav1.APIResourceList{}}
+}
+
+func (d *memoDiscovery) ServerGroups() (*metav1.APIGroupList, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.groups != nil && !d.fresh {
+		return d.groups, nil
+	}
+	start := time.Now()
+	groups, err := d.DiscoveryInterface.ServerGroups()
+	d.fetched("server groups", start, err)
+	if err == nil {
+		d.groups = groups
+	}
+	return groups, err
+}
+
+func (d *memoDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if resources, ok := d.resources[groupVersion]; ok && !d.fresh {
+		return resources, nil
+	}
+	start := time.Now()
+	resources, err := d.DiscoveryInterface.ServerResourcesForGroupVersion(groupVersion)
+	d.fetched("resources of "+groupVersion, start, err)
+	if err == nil {
+		d.resources[groupVersion] = resources
+	}
+	return resources, err
+}
+
+// fetched notes a lookup that reached the server. d.mu must be held.
+func (d *memoDiscovery) fetched(what string, start time.Time, err error) {
+	if d.fetchedAt.IsZero() {
+		d.fetchedAt = start
+	}
+	if !d.debug {
+		return
+	}
+	latency := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		console.debugf("DEBUG api: discovery of %s error=%v latency=%v", what, err, latency)
+		return
+	}
+	console.debugf("DEBUG api: discovery of %s latency=%v (memoized for the run)", what, latency)
+}
+
+// refresh drops the memoized lookups made before failedAt, when a request
+// started then found the served versions changed. Many waits noticing the
+// change together thus query discovery once: the lookups the first one
+// makes are newer than the failures of the others.
+func (d *memoDiscovery) refresh(failedAt time.Time) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fetchedAt.IsZero() || !d.fetchedAt.Before(failedAt) {
+		return
+	}
+	d.groups = nil
+	d.resources = map[string]*metav1.APIResourceList{}
+	d.fetchedAt = time.Time{}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newFakeDiscovery(versions ...string) *fakediscovery.FakeDiscovery {
+	client := fake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	for _, version := range versions {
+		client.Resources = append(client.Resources, &metav1.APIResourceList{
+			GroupVersion: externalSecretGVR.Group + "/" + version,
+			APIResources: []metav1.APIResource{{Name: externalSecretGVR.Resource, Kind: "ExternalSecret", Namespaced: true}},
+		})
+	}
+	return client
+}
+
+// discoveryCalls counts the discovery requests among the actions of the
+// fake clientset, which its discovery client shares.
+func discoveryCalls(c *testCluster) int {
+	calls := 0
+	for _, action := range c.discovery.Actions() {
+		if resource := action.GetResource().Resource; resource == "group" || resource == "resource" {
+			calls++
+		}
+	}
+	return calls
+}
+
+// TestCheckQueriesDiscoveryOnce checks one resource and then several: the
+// number of discovery requests stays that of one resolution.
+func TestCheckQueriesDiscoveryOnce(t *testing.T) {
+	out := captureConsole(t)
+	for _, names := range [][]string{
+		{"db"},
+		{"db", "cache", "queue"},
+		{"db", "cache", "queue", "search", "mail", "billing", "ledger", "audit"},
+	} {
+		var objects []runtime.Object
+		for _, name := range names {
+			objects = append(objects, newTestObject(externalSecretGVR, "ExternalSecret", "apps", name, readyCondition("True", "SecretSynced")))
+		}
+		c := newTestCluster(objects...)
+		results, code := c.check(t, 10*time.Second, "-namespace=apps", "-name="+strings.Join(names, ","), "-watch-mode=poll", "-skip-freshness")
+		if code != exitOK || len(results) != len(names) {
+			t.Fatalf("%d names: exit code %d with %d results, want all Ready:\n%s", len(names), code, len(results), out)
+		}
+		if calls := discoveryCalls(c); calls != 2 {
+			t.Errorf("%d names: %d discovery calls, want 2", len(names), calls)
+		}
+	}
+}
+
+// TestRefreshDiscoveryQueriesEachLookup checks that -refresh-discovery
+// sends every lookup to the server.
+func TestRefreshDiscoveryQueriesEachLookup(t *testing.T) {
+	opts := parseTestOptions(t, "-namespace=apps", "-name=db", "-refresh-discovery")
+	client := newFakeDiscovery("v1beta1")
+	memo := newMemoDiscovery(client, false)
+	memo.fresh = opts.refreshDiscovery
+	for i := 0; i < 3; i++ {
+		if version, err := servedVersion(memo, externalSecretGVR); err != nil || version != "v1beta1" {
+			t.Fatalf("resolved %q, %v, want v1beta1", version, err)
+		}
+	}
+	if calls := len(client.Actions()); calls != 6 {
+		t.Errorf("%d discovery calls, want 6: %v", calls, client.Actions())
+	}
+}
+
+// TestMemoDiscoveryRefresh checks that refresh only drops lookups made
+// before the failure, so that waits re-resolving together query discovery
+// once.
+func TestMemoDiscoveryRefresh(t *testing.T) {
+	client := newFakeDiscovery("v1beta1")
+	memo := newMemoDiscovery(client, false)
+	if _, err := servedVersion(memo, externalSecretGVR); err != nil {
+		t.Fatal(err)
+	}
+	client.Resources = newFakeDiscovery("v1").Resources
+	memo.refresh(time.Now().Add(-time.Hour))
+	if version, _ := servedVersion(memo, externalSecretGVR); version != "v1beta1" {
+		t.Errorf("version = %s after a failure older than the lookups, want the memoized v1beta1", version)
+	}
+
+	failedAt := time.Now()
+	for i := 0; i < 10; i++ {
+		memo.refresh(failedAt)
+		if version, _ := servedVersion(memo, externalSecretGVR); version != "v1" {
+			t.Fatalf("version = %s after a refresh, want v1", version)
+		}
+	}
+	if calls := len(client.Actions()); calls != 4 {
+		t.Errorf("%d discovery calls, want 4: %v", calls, client.Actions())
+	}
+
+	var unset *memoDiscovery
+	unset.refresh(failedAt)
+}
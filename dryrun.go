@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// runDryRun validates configuration and connectivity without waiting: it runs
+// the pre-flight checks, evaluates the target once and prints what a real run
+// would do. The exit code reflects whether the pre-flight checks passed, not
+// whether the ExternalSecret is Ready.
+func runDryRun(opts *options, t *clusterTarget, timeout time.Duration) int {
+	clientset, dynamicClient := t.clientset, t.dynamicClient
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var problems []string
+	console.infof("Dry run: cluster %s (%s)", t.name, t.config.Host)
+
+	kind := opts.resourceKind()
+	version, err := servedVersion(t.discovery, kind.gvr)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("%s CRD not available: %v", kind.name, err))
+	} else {
+		console.infof("Pre-flight: %s API served as %s/%s", kind.name, kind.gvr.Group, version)
+		if opts.apiVersion != "" && version != opts.apiVersion {
+			console.infof("Pre-flight: note that -api-version pins %s while the server prefers %s", opts.apiVersion, version)
+		}
+	}
+
+	// Read what a real run would read
+	gvr := kind.gvr
+	if opts.apiVersion != "" {
+		gvr.Version = opts.apiVersion
+	} else if version != "" {
+		gvr.Version = version
+	}
+
+	permissionProblems := checkPermissions(ctx, clientset, opts)
+	if len(permissionProblems) == 0 {
+		console.infof("Pre-flight: RBAC permissions OK")
+	}
+	problems = append(problems, permissionProblems...)
+
+	for _, namespace := range opts.namespaces() {
+		if kind.clusterScoped {
+			break
+		}
+		callCtx, cancelCall := context.WithTimeout(ctx, opts.perCallTimeout)
+		_, err = clientset.CoreV1().Namespaces().Get(callCtx, namespace, metav1.GetOptions{})
+		cancelCall()
+		switch {
+		case apierrors.IsNotFound(err):
+			console.infof("Pre-flight: namespace %s does not exist yet; a real run would wait for it", namespace)
+		case err != nil:
+			console.infof("Pre-flight: could not check namespace %s: %v", namespace, err)
+		}
+	}
+
+	var targets []types.NamespacedName
+	if opts.discovers() {
+		l := newLister(opts, t.metadataClient, dynamicClient, gvr)
+		for _, namespace := range listScope(opts) {
+			found, err := l.listSelected(ctx, namespace, opts.selector, opts.names)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("cannot list %ss %s in %s: %v", kind.name, discoveryTarget(opts), orAll(namespace), err))
+			}
+			for _, resource := range found {
+				targets = append(targets, resource.NamespacedName)
+			}
+		}
+		console.infof("Target: %d %ss %s in %s; a real run would keep discovering for %s", len(targets), kind.name, discoveryTarget(opts), opts.scope(), formatDuration(opts.discoveryWindow))
+	} else {
+		targets = opts.requested()
+	}
+	judge := judgingChecker(opts, kind)
+	for _, target := range targets {
+		namespace, name := target.Namespace, target.Name
+		callCtx, cancelCall := context.WithTimeout(ctx, opts.perCallTimeout)
+		unstructuredES, err := dynamicClient.Resource(gvr).Namespace(namespace).Get(callCtx, name, metav1.GetOptions{})
+		cancelCall()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cannot get %s %s/%s: %v", kind.name, namespace, name, err))
+			continue
+		}
+		// The state is judged as the wait would judge it
+		conditions, duplicates := parseConditions(unstructuredES)
+		j := judge.judge(unstructuredES, conditions)
+		state := "not Ready"
+		if j.ready {
+			state = "Ready"
+		}
+		if j.verdict != "" || j.pending != "" {
+			state += " (" + j.String() + ")"
+		}
+		console.infof("Target: %s %s/%s is currently %s, conditions: %v", kind.name, namespace, name, state, conditions)
+		if len(duplicates) > 0 {
+			console.infof("Target: %s %s/%s has duplicate conditions of type %s, judged by the newest of each", kind.name, namespace, name, strings.Join(duplicates, ", "))
+		}
+	}
+
+	console.infof("Plan: timeout %v, poll interval %v, per-call timeout %v", timeout, opts.interval, opts.perCallTimeout)
+	console.infof("Plan: enabled checks: %s", strings.Join(enabledChecks(opts), ", "))
+	console.infof("Plan: outputs: %s", strings.Join(enabledOutputs(opts), ", "))
+
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			console.errorf("Pre-flight failed: %s", problem)
+		}
+		return exitFailure
+	}
+	console.infof("Dry run OK: pre-flight checks passed")
+	return exitOK
+}
+
+// enabledChecks lists the features a run with the given options performs.
+func enabledChecks(opts *options) []string {
+	var checks []string
+	for _, p := range requiredPermissions(opts) {
+		checks = append(checks, strings.Split(p.Feature, ", ")...)
+	}
+	if len(opts.failOnConditions) > 0 {
+		checks = append(checks, "fail on "+opts.failOnConditions.String())
+	}
+	if len(opts.requirements) > 0 {
+		checks = append(checks, "require "+opts.requirements.String())
+	}
+	if opts.requireExists {
+		checks = append(checks, "fail when missing")
+	}
+	if opts.consecutiveReady > 1 {
+		checks = append(checks, fmt.Sprintf("Ready on %d consecutive checks", opts.consecutiveReady))
+	}
+	if opts.failFast {
+		checks = append(checks, "fail fast on fatal reasons")
+	}
+	if !opts.waitOnTemplateError {
+		checks = append(checks, "fail on template errors")
+	}
+	if opts.maxWaitForPass > 0 || opts.maxSyncLatency > 0 {
+		checks = append(checks, "SLO thresholds")
+	}
+	return checks
+}
+
+// enabledOutputs lists where a run with the given options reports to.
+func enabledOutputs(opts *options) []string {
+	outputs := []string{"console"}
+	if opts.resultFile != "" {
+		outputs = append(outputs, "result-file="+opts.resultFile)
+	}
+	if opts.metricsTextfile != "" {
+		outputs = append(outputs, "metrics-textfile="+opts.metricsTextfile)
+	}
+	if opts.csvReport != "" {
+		outputs = append(outputs, "csv-report="+opts.csvReport)
+	}
+	if opts.csvTransitions != "" {
+		outputs = append(outputs, "csv-transitions="+opts.csvTransitions)
+	}
+	if opts.stateFile != "" {
+		outputs = append(outputs, "state-file="+opts.stateFile)
+	}
+	if opts.captureFile != "" {
+		outputs = append(outputs, "capture-file="+opts.captureFile)
+	}
+	if opts.ndjsonFile != "" {
+		outputs = append(outputs, "ndjson-file="+opts.ndjsonFile)
+	}
+	if opts.notifySocket != "" {
+		outputs = append(outputs, "notify-socket="+opts.notifySocket)
+	}
+	if opts.record != "" {
+		outputs = append(outputs, "record="+opts.record)
+	}
+	return outputs
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// TestDryRunJudgesAsTheWait evaluates a Ready ExternalSecret that also has
+// a -fail-on-condition condition: the dry run reports it failing, as the
+// wait would, rather than Ready.
+func TestDryRunJudgesAsTheWait(t *testing.T) {
+	out := captureConsole(t)
+	deleted := map[string]any{"type": "Deleted", "status": "True", "reason": "SourceDeleted", "lastTransitionTime": "2024-05-01T10:00:00Z"}
+	c := newTestCluster(newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", readyCondition("True", "SecretSynced"), deleted))
+	opts := parseTestOptions(t, "-namespace=apps", "-name=db", "-fail-on-condition=Deleted=True")
+	target := &clusterTarget{
+		name:          "test",
+		log:           console,
+		config:        &rest.Config{Host: "https://api.example.com"},
+		clientset:     c.clientset,
+		dynamicClient: c.dynamicClient,
+		discovery:     newMemoDiscovery(c.discovery, false),
+	}
+	runDryRun(opts, target, 5*time.Second)
+	if want := "ExternalSecret apps/db is currently not Ready (fail-on-condition Deleted=True (SourceDeleted))"; !strings.Contains(out.String(), want) {
+		t.Errorf("the dry run does not judge as the wait, want %q:\n%s", want, out)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// eventRetryInterval is the first delay before the event stream is retried
+// after a failure.
+const eventRetryInterval = time.Second
+
+// watchEvents streams the events of the ExternalSecret. Watches are long-lived
+// by design, so instead of the per-call timeout they are bounded by
+// idleTimeout on the server side and then re-established.
+//
+// Existing events are listed once up front, of which only the history most
+// recent are shown; afterwards the watch resumes from the last seen
+// resourceVersion, kept current by bookmarks, so reconnects neither replay
+// old events nor force a relist. Only an expired resourceVersion (410 Gone)
+// triggers a new list.
+//
+// The events of a resource in namespace are watched there, selected by
+// involvedObject.namespace as well so that events of a namesake in another
+// namespace never show up; those of a cluster-scoped resource, with an empty
+// namespace, are recorded in the default namespace. A non-empty uid
+// restricts the watch to the events of that very object. The watch stops
+// once ctx is done.
+func watchEvents(ctx context.Context, clientset kubernetes.Interface, apiCalls *apiCallLog, namespace, kind, name, uid string, history int, idleTimeout time.Duration, stats *eventStats, observers *observerHub) {
+	log := console.forResource(namespace, name)
+	eventsNamespace, selector := eventSelector(namespace, kind, name, uid)
+	log.infof("Watching events for %s %s in namespace %s...", kind, name, eventsNamespace)
+	w := &eventWatcher{
+		events:        clientset.CoreV1().Events(eventsNamespace),
+		fieldSelector: selector,
+		history:       history,
+		idleTimeout:   idleTimeout,
+		stats:         stats,
+		observers:     observers,
+		apiCalls:      apiCalls,
+		log:           log,
+	}
+	w.run(ctx)
+}
+
+// eventSelector returns the namespace the events of a resource are recorded
+// in and the field selector matching them, as described for watchEvents.
+func eventSelector(namespace, kind, name, uid string) (string, string) {
+	selectors := []fields.Selector{
+		fields.OneTermEqualSelector("involvedObject.kind", kind),
+		fields.OneTermEqualSelector("involvedObject.name", name),
+	}
+	eventsNamespace := namespace
+	if namespace == "" {
+		eventsNamespace = metav1.NamespaceDefault
+	} else {
+		selectors = append(selectors, fields.OneTermEqualSelector("involvedObject.namespace", namespace))
+	}
+	if uid != "" {
+		selectors = append(selectors, fields.OneTermEqualSelector("involvedObject.uid", uid))
+	}
+	return eventsNamespace, fields.AndSelectors(selectors...).String()
+}
+
+type eventWatcher struct {
+	events        eventsGetter
+	fieldSelector string
+	// history is how many of the events existing at the start are shown.
+	history     int
+	idleTimeout time.Duration
+	stats       *eventStats
+	observers   *observerHub
+	// apiCalls counts the reconnects of the watch; it may be nil.
+	apiCalls *apiCallLog
+	log      *logger
+
+	resourceVersion string
+	// listed is set once the events existing at the start were listed;
+	// every event of a later relist is new to the run.
+	listed bool
+}
+
+type eventsGetter interface {
+	List(ctx context.Context, opts metav1.ListOptions) (*corev1.EventList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// run lists and watches the events until ctx is done. Failures are retried
+// with a growing delay; a refused request stops the event stream, which is
+// informational, for the rest of the run.
+func (w *eventWatcher) run(ctx context.Context) {
+	failures := 0
+	retry := func(what string, err error) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if isDenied(err) {
+			w.log.errorf("Error %s events: %v (not streaming events)", what, err)
+			return false
+		}
+		failures++
+		delay := retryBackoff(eventRetryInterval, failures)
+		w.log.errorf("Error %s events: %v (retrying in %s)", what, err, formatDuration(delay))
+		sleepContext(ctx, delay)
+		return true
+	}
+	established := false
+	for ctx.Err() == nil {
+		if w.resourceVersion == "" {
+			if err := w.list(ctx); err != nil {
+				if !retry("listing", err) {
+					return
+				}
+				continue
+			}
+		}
+
+		timeoutSeconds := int64(w.idleTimeout.Seconds())
+		watcher, err := w.events.Watch(ctx, metav1.ListOptions{
+			FieldSelector:       w.fieldSelector,
+			ResourceVersion:     w.resourceVersion,
+			AllowWatchBookmarks: true,
+			TimeoutSeconds:      &timeoutSeconds,
+		})
+		if err != nil {
+			if isExpired(err) {
+				w.resourceVersion = ""
+				continue
+			}
+			if !retry("watching", err) {
+				return
+			}
+			continue
+		}
+		failures = 0
+		if established {
+			w.apiCalls.reconnected()
+		}
+		established = true
+		w.consume(watcher)
+		watcher.Stop()
+	}
+}
+
+// list prints the events that already exist, by lastTimestamp and at first
+// only the history most recent, and remembers the collection's
+// resourceVersion as the starting point of the watch. It reads from the API
+// server's watch cache, which is all a starting point needs.
+func (w *eventWatcher) list(ctx context.Context) error {
+	list, err := w.events.List(ctx, metav1.ListOptions{
+		FieldSelector:        w.fieldSelector,
+		ResourceVersion:      "0",
+		ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan,
+	})
+	if err != nil {
+		return err
+	}
+	sortEvents(list.Items)
+	for i := range list.Items {
+		if !w.listed && i < len(list.Items)-w.history {
+			// Older history is left out for good
+			w.stats.markSeen(&list.Items[i])
+			continue
+		}
+		w.print(&list.Items[i])
+	}
+	w.listed = true
+	w.resourceVersion = list.ResourceVersion
+	return nil
+}
+
+// consume handles the events of one watch until it is closed.
+func (w *eventWatcher) consume(watcher watch.Interface) {
+	for event := range watcher.ResultChan() {
+		switch event.Type {
+		case watch.Error:
+			err := apierrors.FromObject(event.Object)
+			if isExpired(err) {
+				w.resourceVersion = ""
+				return
+			}
+			w.log.errorf("Error watching events: %v", err)
+		case watch.Bookmark, watch.Deleted:
+			if e, ok := event.Object.(*corev1.Event); ok {
+				w.resourceVersion = e.ResourceVersion
+			}
+		case watch.Added, watch.Modified:
+			if e, ok := event.Object.(*corev1.Event); ok {
+				w.resourceVersion = e.ResourceVersion
+				w.print(e)
+			}
+		}
+	}
+}
+
+func (w *eventWatcher) print(e *corev1.Event) {
+	printEvent(e, w.stats, w.observers)
+}
+
+// printEvent hands a redacted copy of the event to the stats and observers,
+// unless it was shown before.
+func printEvent(e *corev1.Event, stats *eventStats, observers *observerHub) {
+	if !stats.markSeen(e) {
+		return
+	}
+	redacted := *e
+	redacted.Message = redactions.redact(e.InvolvedObject.Namespace, e.InvolvedObject.Name, e.Message)
+	stats.record(&redacted)
+	observers.event(&redacted)
+}
+
+// sortEvents orders events by lastTimestamp, oldest first, falling back to
+// eventTime for events that only have that.
+func sortEvents(events []corev1.Event) {
+	at := func(e *corev1.Event) time.Time {
+		if !e.LastTimestamp.IsZero() {
+			return e.LastTimestamp.Time
+		}
+		return e.EventTime.Time
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return at(&events[i]).Before(at(&events[j]))
+	})
+}
+
+// printFailureEvents shows the most recent Warning events of a resource whose
+// wait failed that the event stream did not show, such as those recorded
+// while the stream was down. It lists the events afresh, time-boxed within
+// ctx.
+func (c *checker) printFailureEvents(ctx context.Context, result *checkResult) {
+	if c.clientset == nil || c.events == nil || c.eventHistory == 0 {
+		return
+	}
+	ctx, cancel, err := phaseContext(ctx, c.perCallTimeout)
+	if err != nil {
+		return
+	}
+	defer cancel()
+	uid := c.uid
+	if c.rebindOnUIDChange {
+		uid = ""
+	}
+	eventsNamespace, selector := eventSelector(result.Namespace, c.kind.name, result.Name, uid)
+	list, err := c.clientset.CoreV1().Events(eventsNamespace).List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		c.log.warnf("Warning: could not list the recent events of %s %s: %v", c.kind.name, result.Name, err)
+		return
+	}
+	var warnings []corev1.Event
+	for _, e := range list.Items {
+		if e.Type == corev1.EventTypeWarning {
+			warnings = append(warnings, e)
+		}
+	}
+	sortEvents(warnings)
+	if len(warnings) > c.eventHistory {
+		warnings = warnings[len(warnings)-c.eventHistory:]
+	}
+	for i := range warnings {
+		printEvent(&warnings[i], c.events, c.observers)
+	}
+}
+
+// isExpired reports whether a watch or list failed because the requested
+// resourceVersion is too old.
+func isExpired(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+// sleepContext sleeps for d or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// recentEvents is how many of the last events the result keeps.
+const recentEvents = 5
+
+// syncEventReasons are the reasons of the events the controller records
+// with a successful sync, which make the wait check the resource right away
+// instead of at the next tick.
+var syncEventReasons = map[string]bool{"Updated": true, "Created": true}
+
+// eventStats aggregates the events seen by watchEvents so the wait loop can
+// include them in the final result. It is safe for concurrent use.
+type eventStats struct {
+	total    atomic.Int64
+	warnings atomic.Int64
+
+	mu   sync.Mutex
+	last []notifyEvent
+	// lastAt is when the last event observed happened, for telling a
+	// resource nothing happens to.
+	lastAt time.Time
+	// seen holds the UID/resourceVersion of the events handed out, so that
+	// neither a relist nor the failure output shows one twice.
+	seen map[string]bool
+	// synced is signaled on events of syncEventReasons.
+	synced chan struct{}
+}
+
+// syncs returns the channel signaled when a sync event arrives, which
+// coalesces the signals the wait has not taken yet. It is safe to call on a
+// nil eventStats, whose channel never fires.
+func (s *eventStats) syncs() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.synced == nil {
+		s.synced = make(chan struct{}, 1)
+	}
+	return s.synced
+}
+
+// markSeen records the event as shown and reports whether it was not yet.
+func (s *eventStats) markSeen(e *corev1.Event) bool {
+	key := string(e.UID) + "/" + e.ResourceVersion
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen[key] {
+		return false
+	}
+	if s.seen == nil {
+		s.seen = map[string]bool{}
+	}
+	s.seen[key] = true
+	return true
+}
+
+func (s *eventStats) record(e *corev1.Event) {
+	s.total.Add(1)
+	if e.Type == corev1.EventTypeWarning {
+		s.warnings.Add(1)
+	}
+	event := notifyEvent{Type: e.Type, Reason: e.Reason, Message: e.Message}
+	if !e.LastTimestamp.IsZero() {
+		event.Time = e.LastTimestamp.UTC().Format(time.RFC3339)
+	}
+	at := e.LastTimestamp.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	s.mu.Lock()
+	if at.After(s.lastAt) {
+		s.lastAt = at
+	}
+	s.last = append(s.last, event)
+	if len(s.last) > recentEvents {
+		s.last = s.last[len(s.last)-recentEvents:]
+	}
+	synced := s.synced
+	s.mu.Unlock()
+	if syncEventReasons[e.Reason] && synced != nil {
+		select {
+		case synced <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// lastEvent returns when the last event observed happened, zero if none. It
+// is safe to call on a nil eventStats.
+func (s *eventStats) lastEvent() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastAt
+}
+
+// recent returns the last events observed, oldest first.
+func (s *eventStats) recent() []notifyEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]notifyEvent(nil), s.last...)
+}
+
+// counts returns the events observed so far. It is safe to call on a nil
+// eventStats.
+func (s *eventStats) counts() eventCounts {
+	if s == nil {
+		return eventCounts{}
+	}
+	return eventCounts{Total: int(s.total.Load()), Warnings: s.Warnings()}
+}
+
+// Warnings returns the number of Warning events observed so far.
+func (s *eventStats) Warnings() int {
+	return int(s.warnings.Load())
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The exit codes of a run. Pipelines tell apart what to retry from what to
+// page someone for by them; the RESULT line at the end of a run names them.
+const (
+	exitOK       = 0
+	exitFailure  = 1 // any other failure, such as missing keys
+	exitTimeout  = 2
+	exitFatal    = 3 // a condition that will not recover on its own
+	exitNotFound = 4
+	exitDenied   = 5 // authentication or RBAC
+	exitUsage    = 6
+	// exitSLOViolated is 7 and exitOutdated 8; signals exit with 128
+	// plus the signal number.
+)
+
+// exitCodes documents the exit codes in the usage message and names them
+// on the RESULT line.
+var exitCodes = []struct {
+	Code        int
+	Name        string
+	Description string
+}{
+	{exitOK, "OK", "every resource is Ready, or -killswitch-configmap bypassed the gate"},
+	{exitFailure, "FAILED", "any other failure"},
+	{exitTimeout, "TIMEOUT", "not Ready within -timeout; worth retrying"},
+	{exitFatal, "FATAL", "a sync error that will not recover without intervention"},
+	{exitNotFound, "NOT_FOUND", "the resource does not exist"},
+	{exitDenied, "DENIED", "authentication or RBAC denied access"},
+	{exitUsage, "USAGE", "invalid flags or environment"},
+	{exitSLOViolated, "SLO_VIOLATED", "Ready, but slower than -max-wait-for-pass or -max-sync-latency"},
+	{exitOutdated, "OUTDATED", "the binary is older than -min-version"},
+}
+
+// exitSeverity orders the failure codes from the most to the least severe.
+// A run checking several resources exits with the most severe code of them.
+var exitSeverity = []int{exitUsage, exitDenied, exitNotFound, exitFatal, exitFailure, exitTimeout, exitOutdated, exitSLOViolated}
+
+// Typed errors of the wait, which exitCodeFor maps to exit codes.
+var (
+	errTimeout  = errors.New("timeout reached")
+	errNotFound = errors.New("does not exist")
+)
+
+// conditionError ends a wait on a state that will not recover on its own: a
+// fatal or -fail-on-condition condition, a template error or a broken store.
+type conditionError struct {
+	// Reason is the reason of the condition, or the reason code of the
+	// store.
+	Reason string
+	err    error
+}
+
+func (e *conditionError) Error() string { return e.err.Error() }
+func (e *conditionError) Unwrap() error { return e.err }
+
+// exitCodeFor maps the error a check failed with to its exit code.
+func exitCodeFor(err error) int {
+	var condition *conditionError
+	switch {
+	case err == nil:
+		return exitOK
+	case isDenied(err):
+		return exitDenied
+	case errors.Is(err, errNotFound):
+		return exitNotFound
+	case errors.As(err, &condition):
+		return exitFatal
+	case errors.Is(err, errTimeout):
+		return exitTimeout
+	}
+	return exitFailure
+}
+
+// mergeExitCode returns the more severe of two exit codes. Codes outside
+// exitSeverity, those of signals, win over every other.
+func mergeExitCode(a, b int) int {
+	rank := func(code int) int {
+		if code == exitOK {
+			return len(exitSeverity)
+		}
+		for i, c := range exitSeverity {
+			if c == code {
+				return i
+			}
+		}
+		return -1
+	}
+	if rank(b) < rank(a) {
+		return b
+	}
+	return a
+}
+
+// failing reports whether the code fails the check. An SLO violation is
+// still Ready, so it does not stop the checks of other resources.
+func failing(code int) bool {
+	return code != exitOK && code != exitSLOViolated
+}
+
+// exitName names the code on the RESULT line.
+func exitName(code int) string {
+	for _, c := range exitCodes {
+		if c.Code == code {
+			return c.Name
+		}
+	}
+	if code > 128 {
+		return "INTERRUPTED"
+	}
+	return fmt.Sprintf("EXIT_%d", code)
+}
+
+// exit prints the RESULT line of code, for log scrapers, and terminates the
+// process with it.
+func exit(code int) {
+	console.infof("RESULT=%s", exitName(code))
+	os.Exit(code)
+}
+
+// printExitCodes documents the exit codes in the usage message.
+func printExitCodes(w io.Writer) {
+	fmt.Fprintln(w, "Exit codes:")
+	for _, c := range exitCodes {
+		fmt.Fprintf(w, "  %d %-13s %s\n", c.Code, c.Name, c.Description)
+	}
+	fmt.Fprintln(w, "  130/143 for SIGINT/SIGTERM; with several resources the most severe code wins")
+}
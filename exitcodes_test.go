@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// TestExitCodeForConnectErrors maps the errors connecting to a cluster fails
+// with: an authentication failure is denied, like any other denial.
+func TestExitCodeForConnectErrors(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("connecting: %w", apierrors.NewUnauthorized("token expired")), exitDenied},
+		{fmt.Errorf("connecting: %w", apierrors.NewForbidden(externalSecretGVR.GroupResource(), "", errors.New("denied"))), exitDenied},
+		{errors.New("invalid configuration: no server found for cluster"), exitFailure},
+	} {
+		if got := exitCodeFor(test.err); got != test.want {
+			t.Errorf("exitCodeFor(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
+
+// TestUnservedKindIsNotFound checks a cluster without the CRDs: the
+// resources do not exist there.
+func TestUnservedKindIsNotFound(t *testing.T) {
+	captureConsole(t)
+	target := &clusterTarget{
+		log:       console,
+		discovery: newMemoDiscovery(newFakeDiscovery(), false),
+		results:   []*checkResult{{Namespace: "apps", Name: "db"}},
+	}
+	opts := parseTestOptions(t, "-namespace=apps", "-name=db")
+	results, code := target.checkResources(context.Background(), opts, reportFiles{}, 0)
+	if code != exitNotFound || len(results) != 1 || !errors.Is(results[0].lastErr, errNotServed) {
+		t.Errorf("checkResources = %v, %d, want the result failed with errNotServed and %d", results, code, exitNotFound)
+	}
+}
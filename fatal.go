@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// fatalRule classifies a Ready=False condition as one that will not recover
+// without intervention. Message, when set, must also match the condition
+// message.
+type fatalRule struct {
+	Reason  string
+	Message *regexp.Regexp
+	Code    reasonCode
+}
+
+func (r fatalRule) String() string {
+	if r.Message == nil {
+		return r.Reason
+	}
+	return r.Reason + "=" + r.Message.String()
+}
+
+// defaultFatalRules are the failures the controller reports under a generic
+// reason that waiting never fixes: a missing store and a provider rejecting
+// the credentials.
+var defaultFatalRules = []fatalRule{
+	{
+		Reason:  "SecretSyncedError",
+		Message: regexp.MustCompile(`(?i)(secretstore|clustersecretstore)\b.*\b(not found|does not exist|could not get)|could not get (cluster)?secretstore`),
+		Code:    reasonStoreNotFound,
+	},
+	{
+		Reason:  "SecretSyncedError",
+		Message: regexp.MustCompile(`(?i)\b403\b|forbidden|access ?denied|permission denied|unauthori[sz]ed|invalid (credentials|token|client)`),
+		Code:    reasonProviderDenied,
+	},
+}
+
+// transientMessage matches failures that clear up on their own, which are
+// never fatal whatever the reason.
+var transientMessage = regexp.MustCompile(`(?i)throttl|rate.?limit|too many requests|\b429\b|timed? ?out|temporar|try again|unavailable`)
+
+// parseFatalRule parses Reason or Reason=message-regexp.
+func parseFatalRule(value string) (fatalRule, error) {
+	reason, pattern, hasPattern := strings.Cut(value, "=")
+	if reason == "" {
+		return fatalRule{}, fmt.Errorf("expected Reason or Reason=regexp, got %q", value)
+	}
+	rule := fatalRule{Reason: reason, Code: reasonFatalCondition}
+	if hasPattern {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fatalRule{}, fmt.Errorf("message pattern of %s: %w", reason, err)
+		}
+		rule.Message = re
+	}
+	return rule, nil
+}
+
+// classifyFatal returns the Ready=False condition and the rule it matches,
+// if the conditions show a failure that will not recover.
+func classifyFatal(conditions []Condition, rules []fatalRule) (Condition, fatalRule, bool) {
+	for _, condition := range conditions {
+		if condition.Type != "Ready" {
+			continue
+		}
+		if condition.Status != "False" || transientMessage.MatchString(condition.Message) {
+			return Condition{}, fatalRule{}, false
+		}
+		for _, rule := range rules {
+			if rule.Reason == condition.Reason && (rule.Message == nil || rule.Message.MatchString(condition.Message)) {
+				return condition, rule, true
+			}
+		}
+		return Condition{}, fatalRule{}, false
+	}
+	return Condition{}, fatalRule{}, false
+}
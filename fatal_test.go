@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// readyPayload is an ExternalSecret whose status holds the conditions given
+// as JSON.
+func readyPayload(t *testing.T, conditions string) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	payload := `{"apiVersion":"external-secrets.io/v1beta1","kind":"ExternalSecret","metadata":{"namespace":"apps","name":"db"},"status":{"conditions":[` + conditions + `]}}`
+	if err := object.UnmarshalJSON([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return object
+}
+
+func TestClassifyFatal(t *testing.T) {
+	custom, err := parseFatalRule("ProviderMisconfigured=(?i)unknown region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := append(append([]fatalRule{}, defaultFatalRules...), custom)
+	for _, test := range []struct {
+		name       string
+		conditions string
+		want       reasonCode
+	}{
+		{"missing store", `{"type":"Ready","status":"False","reason":"SecretSyncedError","message":"could not get ClusterSecretStore \"vault\", SecretStore does not exist"}`, reasonStoreNotFound},
+		{"provider 403", `{"type":"Ready","status":"False","reason":"SecretSyncedError","message":"error retrieving secret: AccessDenied: status code 403"}`, reasonProviderDenied},
+		{"custom rule", `{"type":"Ready","status":"False","reason":"ProviderMisconfigured","message":"Unknown region eu-mars-1"}`, reasonFatalCondition},
+		{"throttled provider", `{"type":"Ready","status":"False","reason":"SecretSyncedError","message":"403 rate limit exceeded, try again later"}`, ""},
+		{"timed out", `{"type":"Ready","status":"False","reason":"SecretSyncedError","message":"SecretStore vault could not get token: request timed out"}`, ""},
+		{"other sync error", `{"type":"Ready","status":"False","reason":"SecretSyncedError","message":"key db/password not found in provider"}`, ""},
+		{"custom rule, other message", `{"type":"Ready","status":"False","reason":"ProviderMisconfigured","message":"retrying"}`, ""},
+		{"ready", `{"type":"Ready","status":"True","reason":"SecretSynced","message":"Secret was synced"}`, ""},
+		{"unknown", `{"type":"Ready","status":"Unknown","reason":"SecretSyncedError","message":"SecretStore vault does not exist"}`, ""},
+		{"other condition type", `{"type":"Deleted","status":"False","reason":"SecretSyncedError","message":"SecretStore vault does not exist"}`, ""},
+		{"no conditions", ``, ""},
+	} {
+		_, rule, fatal := classifyFatal(getConditions(readyPayload(t, test.conditions)), rules)
+		if fatal != (test.want != "") || rule.Code != test.want {
+			t.Errorf("%s: fatal = %v with %q, want %q", test.name, fatal, rule.Code, test.want)
+		}
+	}
+}
+
+func TestFatalRuleOptions(t *testing.T) {
+	if rules := parseTestOptions(t, "-name=db", "-fail-fast=false").fatalRules(); len(rules) != 0 {
+		t.Errorf("-fail-fast=false applies %v, want no rules", rules)
+	}
+	rules := parseTestOptions(t, "-name=db", "-fatal-reason=ProviderMisconfigured", "-fatal-reason=Forbidden=quota").fatalRules()
+	if got := len(rules); got != len(defaultFatalRules)+2 || rules[len(rules)-1].String() != "Forbidden=quota" {
+		t.Errorf("rules = %v, want the defaults and both -fatal-reason", rules)
+	}
+	if _, err := validateTestOptions(t, "-name=db", "-fail-fast=false", "-fatal-reason=ProviderMisconfigured"); err == nil {
+		t.Error("-fatal-reason accepted without -fail-fast")
+	}
+	for _, value := range []string{"", "=message", "Reason=(unclosed"} {
+		if _, err := parseFatalRule(value); err == nil {
+			t.Errorf("parseFatalRule(%q) succeeded", value)
+		}
+	}
+}
+
+// TestFailFastOnMissingStore checks that a missing store ends the wait at
+// once with the condition message, unless -fail-fast=false.
+func TestFailFastOnMissingStore(t *testing.T) {
+	missingStore := `{"type":"Ready","status":"False","reason":"SecretSyncedError","message":"could not get SecretStore \"vault\": not found"}`
+
+	out := captureConsole(t)
+	c := newTestCluster(readyPayload(t, missingStore))
+	start := time.Now()
+	results, code := c.check(t, time.Minute, "-namespace=apps", "-name=db", "-watch-mode=poll")
+	if code != exitFatal || results[0].Outcome != outcomeFatalCondition || time.Since(start) > 10*time.Second {
+		t.Errorf("exit code %d, outcome %s after %s, want a fatal condition at once", code, results[0].Outcome, time.Since(start))
+	}
+	if !strings.Contains(out.String(), `could not get SecretStore "vault": not found`) {
+		t.Errorf("the condition message was not printed:\n%s", out)
+	}
+
+	c = newTestCluster(readyPayload(t, missingStore))
+	results, code = c.check(t, 300*time.Millisecond, "-namespace=apps", "-name=db", "-interval=50ms", "-watch-mode=poll", "-fail-fast=false")
+	if code != exitTimeout || results[0].Outcome != outcomeTimeout {
+		t.Errorf("-fail-fast=false: exit code %d, outcome %s, want a timeout", code, results[0].Outcome)
+	}
+}
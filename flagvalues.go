@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// keyValueFlag is a repeatable key=value flag.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+f[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	f[key] = val
+	return nil
+}
+
+// conditionMatch selects conditions of a type with a given status.
+type conditionMatch struct {
+	Type   string
+	Status string
+}
+
+func (m conditionMatch) String() string {
+	return m.Type + "=" + m.Status
+}
+
+// conditionMatchFlag is a repeatable Type=Status flag.
+type conditionMatchFlag []conditionMatch
+
+func (f *conditionMatchFlag) String() string {
+	parts := make([]string, len(*f))
+	for i, m := range *f {
+		parts[i] = m.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *conditionMatchFlag) Set(value string) error {
+	conditionType, status, ok := strings.Cut(value, "=")
+	if !ok || conditionType == "" || status == "" {
+		return fmt.Errorf("expected Type=Status, got %q", value)
+	}
+	*f = append(*f, conditionMatch{Type: conditionType, Status: status})
+	return nil
+}
+
+// fatalRuleFlag is a repeatable Reason or Reason=message-regexp flag.
+type fatalRuleFlag []fatalRule
+
+func (f *fatalRuleFlag) String() string {
+	parts := make([]string, len(*f))
+	for i, rule := range *f {
+		parts[i] = rule.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *fatalRuleFlag) Set(value string) error {
+	rule, err := parseFatalRule(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, rule)
+	return nil
+}
+
+// nameListFlag is a repeatable flag of comma-separated names.
+type nameListFlag []string
+
+func (f *nameListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *nameListFlag) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("empty name in %q", value)
+		}
+		*f = append(*f, name)
+	}
+	return nil
+}
+
+// clusterListFlag is the repeatable -cluster flag: kubeconfig contexts given
+// as context=NAME, or as a bare NAME.
+type clusterListFlag []string
+
+func (f *clusterListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *clusterListFlag) Set(value string) error {
+	context := value
+	if key, name, ok := strings.Cut(value, "="); ok {
+		if key != "context" {
+			return fmt.Errorf("expected context=NAME, got %q", value)
+		}
+		context = name
+	}
+	if context == "" {
+		return fmt.Errorf("empty context in %q", value)
+	}
+	for _, seen := range *f {
+		if seen == context {
+			return fmt.Errorf("context %s is given twice", context)
+		}
+	}
+	*f = append(*f, context)
+	return nil
+}
+
+// regexpListFlag is a repeatable regular expression flag, compiled when set
+// so that invalid patterns fail at startup.
+type regexpListFlag []*regexp.Regexp
+
+func (f *regexpListFlag) String() string {
+	parts := make([]string, len(*f))
+	for i, re := range *f {
+		parts[i] = re.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *regexpListFlag) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	if re.MatchString("") {
+		return fmt.Errorf("%q matches the empty string", value)
+	}
+	*f = append(*f, re)
+	return nil
+}
+
+// requirementFlag is the repeatable -for flag.
+type requirementFlag []conditionRequirement
+
+func (f *requirementFlag) String() string {
+	parts := make([]string, len(*f))
+	for i, r := range *f {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *requirementFlag) Set(value string) error {
+	r, err := parseRequirement(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, r)
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// forceSyncAnnotation is the annotation the external-secrets controller
+// re-syncs an ExternalSecret on whenever its value changes.
+const forceSyncAnnotation = "force-sync"
+
+// forceSyncAttempts bounds the patches sent when they keep conflicting with
+// concurrent updates or failing transiently.
+const forceSyncAttempts = 5
+
+// forceSync sets forceSyncAnnotation to the current time and returns the
+// refreshTime the ExternalSecret had just before, which the wait must see
+// advance. The patch carries the resourceVersion that refreshTime was read
+// from, so a refresh slipping in between conflicts and is read again rather
+// than mistaken for the forced one. A resource that does not exist yet is
+// left alone, since it syncs once created.
+func (c *checker) forceSync(ctx context.Context, namespace, name string) (time.Time, error) {
+	resource := c.dynamicClient.Resource(c.gvr).Namespace(namespace)
+	var err error
+	for attempt := 1; attempt <= forceSyncAttempts; attempt++ {
+		if attempt > 1 {
+			sleepContext(ctx, retryBackoff(c.pollInterval, attempt-1))
+			if ctx.Err() != nil {
+				return time.Time{}, fmt.Errorf("forcing a sync of ExternalSecret %s: %w", name, ctx.Err())
+			}
+		}
+		callCtx, cancel := context.WithTimeout(ctx, c.perCallTimeout)
+		object, getErr := resource.Get(callCtx, name, metav1.GetOptions{})
+		cancel()
+		if apierrors.IsNotFound(getErr) {
+			c.log.infof("ExternalSecret %s does not exist yet, not forcing a sync", name)
+			return time.Time{}, nil
+		}
+		if err = getErr; err != nil {
+			if isTransient(err) {
+				continue
+			}
+			return time.Time{}, fmt.Errorf("reading ExternalSecret %s to force a sync: %w", name, err)
+		}
+
+		// Without a previous refresh, any refresh counts
+		before := time.Unix(0, 0)
+		if status := parseStatus(object); status.RefreshTimeValid {
+			before = status.RefreshTime
+		}
+		patch, _ := json.Marshal(map[string]any{"metadata": map[string]any{
+			"resourceVersion": object.GetResourceVersion(),
+			"annotations":     map[string]string{forceSyncAnnotation: strconv.FormatInt(time.Now().Unix(), 10)},
+		}})
+		callCtx, cancel = context.WithTimeout(ctx, c.perCallTimeout)
+		_, err = resource.Patch(callCtx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+		cancel()
+		switch {
+		case err == nil:
+			c.recorder.forceSync(namespace, name, before)
+			c.log.infof("Forced a sync of ExternalSecret %s, waiting for a refresh after %s", name, before.UTC().Format(time.RFC3339))
+			return before, nil
+		case apierrors.IsConflict(err):
+			c.log.debugf("ExternalSecret %s changed while forcing a sync, retrying", name)
+		case !isTransient(err):
+			return time.Time{}, fmt.Errorf("forcing a sync of ExternalSecret %s: %w", name, err)
+		}
+	}
+	return time.Time{}, fmt.Errorf("forcing a sync of ExternalSecret %s: giving up after %d attempts: %w", name, forceSyncAttempts, err)
+}
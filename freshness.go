@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// refreshGrace is how much later than spec.refreshInterval a refresh may
+// happen before the status is considered stale.
+const refreshGrace = time.Minute
+
+// How a Ready result was reached, for the summary.
+const (
+	readyAlready         = "already ready"
+	readyAlreadyVerified = "already ready (verified fresh)"
+	readyDuringWait      = "became ready during wait"
+)
+
+// checkFreshness verifies that a Ready ExternalSecret is actually being kept
+// in sync: its refreshTime must be within spec.refreshInterval and its target
+// Secret must exist. It returns a description of why the state looks stale,
+// or an empty string when it looks fresh or cannot be verified, and a note
+// when only the clock skew tolerance kept it from being stale.
+func (c *checker) checkFreshness(ctx context.Context, unstructuredES *unstructured.Unstructured, result *checkResult) (string, string) {
+	stale, note := staleRefresh(unstructuredES, c.now(), c.clockSkewTolerance)
+	if stale != "" {
+		return stale, note
+	}
+
+	target := targetSecretName(unstructuredES)
+	callCtx, cancel := context.WithTimeout(ctx, c.perCallTimeout)
+	defer cancel()
+	_, err := c.clientset.CoreV1().Secrets(unstructuredES.GetNamespace()).Get(callCtx, target, metav1.GetOptions{})
+	result.targetMissing = apierrors.IsNotFound(err)
+	switch {
+	case err == nil:
+		return "", note
+	case apierrors.IsNotFound(err):
+		return fmt.Sprintf("target Secret %s does not exist", target), note
+	default:
+		c.log.warnf("Warning: could not verify target Secret %s: %v", target, err)
+		return "", note
+	}
+}
+
+// now returns the current time by the API server's clock when known, so
+// that cluster timestamps are not compared against a skewed local clock.
+func (c *checker) now() time.Time {
+	return c.apiCalls.ServerNow(time.Now())
+}
+
+// staleRefresh checks status.refreshTime against spec.refreshInterval,
+// allowing for tolerance of clock skew in either direction. Resources
+// without a refresh interval, or without a parsable refreshTime, are not
+// judged. The note is set when the tolerance decided the verdict.
+func staleRefresh(unstructuredES *unstructured.Unstructured, now time.Time, tolerance time.Duration) (string, string) {
+	raw, _, _ := unstructured.NestedString(unstructuredES.Object, "spec", "refreshInterval")
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval <= 0 {
+		return "", ""
+	}
+	refreshTimeRaw, _, _ := unstructured.NestedString(unstructuredES.Object, "status", "refreshTime")
+	refreshTime, err := time.Parse(time.RFC3339, refreshTimeRaw)
+	if err != nil {
+		return "", ""
+	}
+	age := now.Sub(refreshTime)
+	switch {
+	case age > interval+refreshGrace+tolerance:
+		return fmt.Sprintf("last refresh was %s but refreshInterval is %s", formatTime(refreshTime, now), formatDuration(interval)), ""
+	case age > interval+refreshGrace:
+		return "", fmt.Sprintf("refresh is %s overdue, within the clock skew tolerance of %s", formatDuration(age-interval-refreshGrace), formatDuration(tolerance))
+	case age < -tolerance:
+		return "", fmt.Sprintf("refreshTime is %s in the future, beyond the clock skew tolerance of %s", formatDuration(-age), formatDuration(tolerance))
+	}
+	return "", ""
+}
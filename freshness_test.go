@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func refreshedObject(refreshInterval string, refreshTime time.Time) *unstructured.Unstructured {
+	object := newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", readyCondition("True", "SecretSynced"))
+	object.Object["spec"] = map[string]any{"refreshInterval": refreshInterval}
+	object.Object["status"].(map[string]any)["refreshTime"] = refreshTime.Format(time.RFC3339)
+	return object
+}
+
+// TestStaleRefreshAllowsForClockSkew judges refresh times against a local
+// clock running behind and ahead of the cluster's.
+func TestStaleRefreshAllowsForClockSkew(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	const tolerance = 10 * time.Second
+	for _, test := range []struct {
+		name        string
+		refreshedAt time.Time
+		stale, note string
+	}{
+		{"fresh", now.Add(-30 * time.Second), "", ""},
+		// Our clock is ahead: the refresh looks overdue but within the tolerance
+		{"ahead within tolerance", now.Add(-time.Hour - refreshGrace - 5*time.Second), "", "overdue, within the clock skew tolerance of 10s"},
+		{"ahead beyond tolerance", now.Add(-time.Hour - refreshGrace - 15*time.Second), "but refreshInterval is 1h0m0s", ""},
+		// Our clock is behind: the refresh looks to be in the future
+		{"behind within tolerance", now.Add(5 * time.Second), "", ""},
+		{"behind beyond tolerance", now.Add(15 * time.Second), "", "in the future, beyond the clock skew tolerance of 10s"},
+	} {
+		stale, note := staleRefresh(refreshedObject("1h", test.refreshedAt), now, tolerance)
+		if (stale == "") != (test.stale == "") || !strings.Contains(stale, test.stale) {
+			t.Errorf("%s: stale = %q, want %q", test.name, stale, test.stale)
+		}
+		if (note == "") != (test.note == "") || !strings.Contains(note, test.note) {
+			t.Errorf("%s: note = %q, want %q", test.name, note, test.note)
+		}
+	}
+}
+
+// TestServerNowFollowsDateHeader checks that the clock of the API server,
+// behind or ahead of ours, is what freshness is judged against.
+func TestServerNowFollowsDateHeader(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	calls := newAPICallLog(false)
+	if got := calls.ServerNow(now); !got.Equal(now) {
+		t.Errorf("ServerNow = %s before any response, want the local time", got)
+	}
+	for _, skew := range []time.Duration{-42 * time.Second, 42 * time.Second} {
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Date": {now.Add(skew).Format(http.TimeFormat)}}}
+		calls.recordResponse(resp, time.Millisecond, now)
+		if got := calls.ServerNow(now.Add(time.Minute)); !got.Equal(now.Add(time.Minute + skew)) {
+			t.Errorf("skew %s: ServerNow = %s, want %s", skew, got, now.Add(time.Minute+skew))
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"external-secret-watcher/pkg/health"
+)
+
+const healthUsage = "Usage: ./external-secret-watcher health -namespace=<namespace> -name=<name> [-api-version=<version>] [-timeout=5s]"
+
+// runHealth implements the health subcommand: a one-shot health probe for
+// exec-based health checks. It prints the status word and message on one
+// line and exits 0 for Healthy, 1 for Progressing and 2 for Degraded.
+func runHealth(args []string) int {
+	fs := flag.NewFlagSet("health", flag.ContinueOnError)
+	namespace := fs.String("namespace", "", "Namespace of the ExternalSecret")
+	name := fs.String("name", "", "Name of the ExternalSecret")
+	apiVersion := fs.String("api-version", "", "Version of the external-secrets.io API to read, such as v1 or v1beta1 (defaults to the preferred version the cluster serves)")
+	timeout := fs.Duration("timeout", 5*time.Second, "Upper bound of the whole probe")
+	var source kubeconfigSource
+	source.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return health.Degraded.ExitCode()
+	}
+	if *namespace == "" || *name == "" || *timeout <= 0 || source.validate() != nil {
+		fmt.Println(healthUsage)
+		return health.Degraded.ExitCode()
+	}
+
+	config, err := source.load("")
+	if err != nil {
+		fmt.Printf("%s: cannot build kubeconfig: %v\n", health.Degraded, err)
+		return health.Degraded.ExitCode()
+	}
+	result := health.Check(context.Background(), config, *namespace, *name, *apiVersion, *timeout)
+	fmt.Printf("%s: %s\n", result.Status, result.Message)
+	return result.Status.ExitCode()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// parseTestOptions parses args as the flags of a run and validates them.
+func parseTestOptions(t *testing.T, args ...string) *options {
+	t.Helper()
+	opts, err := validateTestOptions(t, args...)
+	if err != nil {
+		t.Fatalf("validating %q: %v", args, err)
+	}
+	return opts
+}
+
+// validateTestOptions parses args as the flags of a run and returns the
+// error of validating them.
+func validateTestOptions(t *testing.T, args ...string) (*options, error) {
+	t.Helper()
+	var opts options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	opts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parsing %q: %v", args, err)
+	}
+	return &opts, opts.validate()
+}
+
+// lockedBuffer is a buffer safe for the concurrent writes of the loggers.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureConsole redirects the console to a buffer until the test ends.
+func captureConsole(t *testing.T) *lockedBuffer {
+	t.Helper()
+	out := &lockedBuffer{}
+	console.mu.Lock()
+	w, json := console.w, console.json
+	console.w, console.json = out, false
+	console.mu.Unlock()
+	t.Cleanup(func() {
+		console.mu.Lock()
+		console.w, console.json = w, json
+		console.mu.Unlock()
+	})
+	return out
+}
+
+// newFakeDynamicClient returns a fake dynamic client serving the resources
+// of every kind.
+func newFakeDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, kind := range resourceKinds {
+		listKinds[kind.gvr] = kind.name + "List"
+	}
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+}
+
+// newTestObject returns an object of gvr with the given status conditions,
+// as written by the controller.
+func newTestObject(gvr schema.GroupVersionResource, kind, namespace, name string, conditions ...map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": gvr.GroupVersion().String(),
+		"kind":       kind,
+		"metadata":   map[string]any{"name": name, "uid": "uid-" + name, "resourceVersion": "1"},
+	}}
+	if namespace != "" {
+		obj.SetNamespace(namespace)
+	}
+	if len(conditions) > 0 {
+		raw := make([]any, len(conditions))
+		for i, condition := range conditions {
+			raw[i] = condition
+		}
+		obj.Object["status"] = map[string]any{"conditions": raw}
+	}
+	return obj
+}
+
+// readyCondition is a Ready condition with the given status and reason.
+func readyCondition(status, reason string) map[string]any {
+	return map[string]any{"type": "Ready", "status": status, "reason": reason, "message": reason + " message", "lastTransitionTime": "2024-05-01T10:00:00Z"}
+}
+
+// testCluster is a cluster of fake clients serving the ExternalSecret API
+// v1beta1, with the namespace apps.
+type testCluster struct {
+	clientset     *fake.Clientset
+	dynamicClient *dynamicfake.FakeDynamicClient
+	discovery     *fakediscovery.FakeDiscovery
+	// apiCalls is the API call log of the checks of the cluster.
+	apiCalls *apiCallLog
+}
+
+// newTestCluster returns a cluster serving objects, the typed ones through
+// the clientset and the unstructured ones through the dynamic client.
+func newTestCluster(objects ...runtime.Object) *testCluster {
+	typed := []runtime.Object{&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "apps"},
+		Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+	}}
+	var unstructuredObjects []runtime.Object
+	for _, object := range objects {
+		if _, ok := object.(*unstructured.Unstructured); ok {
+			unstructuredObjects = append(unstructuredObjects, object)
+		} else {
+			typed = append(typed, object)
+		}
+	}
+	c := &testCluster{clientset: fake.NewSimpleClientset(typed...), dynamicClient: newFakeDynamicClient(unstructuredObjects...), apiCalls: newAPICallLog(false)}
+	c.discovery = c.clientset.Discovery().(*fakediscovery.FakeDiscovery)
+	c.serve("v1beta1")
+	// The fake watches ignore the context of the check, which waits for
+	// its event stream to end: events are listed, but not watched
+	c.clientset.PrependWatchReactor("events", func(k8stesting.Action) (bool, watch.Interface, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("events"), "", errors.New("not watched in tests"))
+	})
+	return c
+}
+
+// serve makes discovery list versions as the served ones of the
+// ExternalSecret API, the first one preferred.
+func (c *testCluster) serve(versions ...string) {
+	c.discovery.Resources = nil
+	for _, version := range versions {
+		c.discovery.Resources = append(c.discovery.Resources, &metav1.APIResourceList{
+			GroupVersion: externalSecretGVR.Group + "/" + version,
+			APIResources: []metav1.APIResource{{Name: externalSecretGVR.Resource, Kind: "ExternalSecret", Namespaced: true}},
+		})
+	}
+}
+
+// check runs a check of the cluster with the flags of args, as the run would
+// after connecting to it.
+func (c *testCluster) check(t *testing.T, timeout time.Duration, args ...string) ([]*checkResult, int) {
+	t.Helper()
+	opts := parseTestOptions(t, args...)
+	var results []*checkResult
+	for _, requested := range opts.requested() {
+		results = append(results, &checkResult{Cluster: "test", Namespace: requested.Namespace, Name: requested.Name})
+	}
+	discovery := newMemoDiscovery(c.discovery, false)
+	discovery.fresh = opts.refreshDiscovery
+	target := &clusterTarget{
+		name:          "test",
+		log:           console,
+		clientset:     c.clientset,
+		dynamicClient: c.dynamicClient,
+		discovery:     discovery,
+		apiCalls:      c.apiCalls,
+		results:       results,
+	}
+	return target.checkResources(context.Background(), opts, reportFiles{}, timeout)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// hint is a diagnosis of a likely cause for a failing or slow check. Code is
+// stable and meant for automation; Message is for humans.
+type hint struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	hintStatusStaleSecretFresh = "StatusStaleSecretFresh"
+	hintTargetSecretImmutable  = "TargetSecretImmutable"
+	hintRBACDenied             = "RBACDenied"
+)
+
+func printHints(result *checkResult) {
+	if result.LagAttribution != "" {
+		console.infof("Lag attribution: %s", result.LagAttribution)
+	}
+	for i, h := range result.Hints {
+		h.Message = redactions.redact(result.Namespace, result.Name, h.Message)
+		result.Hints[i] = h
+		console.infof("Hint [%s]: %s", h.Code, h.Message)
+	}
+}
+
+// targetHints diagnoses a failing sync through the target Secret. It runs
+// after the wait has ended, time-boxed within ctx.
+func (c *checker) targetHints(ctx context.Context, result *checkResult) []hint {
+	unstructuredES := result.object
+	if unstructuredES == nil || c.clientset == nil || !syncFailing(getConditions(unstructuredES)) {
+		return nil
+	}
+	ctx, cancel, err := phaseContext(ctx, c.perCallTimeout)
+	if err != nil {
+		result.skipPhase("target Secret diagnosis", err)
+		return nil
+	}
+	defer cancel()
+	target := targetSecretName(unstructuredES)
+	secret, err := c.clientset.CoreV1().Secrets(unstructuredES.GetNamespace()).Get(ctx, target, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	if secret.Immutable != nil && *secret.Immutable {
+		return []hint{{
+			Code:    hintTargetSecretImmutable,
+			Message: fmt.Sprintf("target Secret %s is immutable; ESO cannot update it — delete it or disable immutability", target),
+		}}
+	}
+	return nil
+}
+
+// syncFailing reports whether the Ready condition is explicitly False.
+func syncFailing(conditions []Condition) bool {
+	for _, condition := range conditions {
+		if condition.Type == "Ready" {
+			return condition.Status == "False"
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// immutableSyncFailure is an ExternalSecret the controller cannot sync
+// because its target Secret is immutable, as the controller reports it.
+func immutableSyncFailure() *unstructured.Unstructured {
+	condition := readyCondition("False", "SecretSyncedError")
+	condition["message"] = `could not update Secret: Secret "db" is invalid: data: Forbidden: field is immutable when ` + "`immutable`" + ` is set`
+	return newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", condition)
+}
+
+func targetSecret(name string, immutable bool) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: name},
+		Immutable:  &immutable,
+		Data:       map[string][]byte{"password": []byte("secret")},
+	}
+}
+
+// TestImmutableTargetSecretHint fails on the immutable fixture: the result
+// carries the diagnosis, under its own code in the JSON report.
+func TestImmutableTargetSecretHint(t *testing.T) {
+	out := captureConsole(t)
+	c := newTestCluster(immutableSyncFailure(), targetSecret("db", true))
+	results, code := c.check(t, time.Second, "-namespace=apps", "-name=db", "-interval=50ms", "-watch-mode=poll")
+	if !failing(code) {
+		t.Fatalf("exit code %d, want a failure:\n%s", code, out)
+	}
+	var found bool
+	for _, h := range results[0].Hints {
+		found = found || h.Code == hintTargetSecretImmutable && strings.Contains(h.Message, "target Secret db is immutable")
+	}
+	if !found {
+		t.Errorf("hints = %+v, want %s", results[0].Hints, hintTargetSecretImmutable)
+	}
+	if !strings.Contains(out.String(), "Hint ["+hintTargetSecretImmutable+"]") {
+		t.Errorf("the hint was not printed:\n%s", out)
+	}
+
+	var b strings.Builder
+	if err := writeResultFile(&b, results); err != nil {
+		t.Fatal(err)
+	}
+	var record struct {
+		Hints []hint `json:"hints"`
+	}
+	if err := json.Unmarshal([]byte(b.String()), &record); err != nil || len(record.Hints) == 0 || record.Hints[0].Code != hintTargetSecretImmutable {
+		t.Errorf("the result file lacks the hint code (%v):\n%s", err, b.String())
+	}
+}
+
+// TestTargetHintsRequireImmutableAndFailing checks that neither a mutable
+// target Secret nor a Ready ExternalSecret is diagnosed.
+func TestTargetHintsRequireImmutableAndFailing(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		es        *unstructured.Unstructured
+		immutable bool
+	}{
+		{"mutable", immutableSyncFailure(), false},
+		{"ready", newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", readyCondition("True", "SecretSynced")), true},
+	} {
+		cluster := newTestCluster(targetSecret("db", test.immutable))
+		c := &checker{clientset: cluster.clientset, perCallTimeout: 5 * time.Second}
+		if hints := c.targetHints(context.Background(), &checkResult{object: test.es}); len(hints) != 0 {
+			t.Errorf("%s: hints = %+v, want none", test.name, hints)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// notifiedAnnotation records on the ExternalSecret the last failure that was
+// notified, as idempotency-key;reason-code;RFC3339 time, so that a retried
+// pipeline step failing the same way does not notify again.
+const notifiedAnnotation = "statuschecker.io/notified"
+
+// dedupeNotification marks a failed result as a duplicate when the
+// ExternalSecret records the same failure under the same -idempotency-key
+// within -idempotency-window, and otherwise records it. This is best effort:
+// the patch is sent after the wait and may race a concurrent run, and
+// failing to send it only means the next retry notifies again.
+func (r *run) dedupeNotification(result *checkResult) {
+	key := r.opts.idempotencyKey
+	if key == "" || result.Ready() || result.Outcome == outcomeSkipped || result.object == nil {
+		return
+	}
+	code := string(reasonCodeFor(result))
+	if previousKey, previousCode, at, ok := parseNotified(result.object.GetAnnotations()[notifiedAnnotation]); ok &&
+		previousKey == key && previousCode == code && time.Since(at) < r.opts.idempotencyWindow {
+		result.Duplicate = true
+		return
+	}
+
+	value := strings.Join([]string{key, code, time.Now().UTC().Format(time.RFC3339)}, ";")
+	patch, _ := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": map[string]string{notifiedAnnotation: value}}})
+	// The wait deadline may be over already; the patch gets its own.
+	ctx, cancel := context.WithTimeout(context.Background(), r.opts.perCallTimeout)
+	defer cancel()
+	c := r.checker
+	if _, err := c.dynamicClient.Resource(c.gvr).Namespace(result.Namespace).Patch(ctx, result.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		console.forResource(result.Namespace, result.Name).warnf("Warning: could not record the notification of ExternalSecret %s: %v", result.Name, err)
+	}
+}
+
+// parseNotified parses the value of notifiedAnnotation.
+func parseNotified(value string) (key, code string, at time.Time, ok bool) {
+	i := strings.LastIndex(value, ";")
+	if i < 0 {
+		return "", "", time.Time{}, false
+	}
+	rest, stamp := value[:i], value[i+1:]
+	j := strings.LastIndex(rest, ";")
+	if j < 0 {
+		return "", "", time.Time{}, false
+	}
+	at, err := time.Parse(time.RFC3339, stamp)
+	if err != nil {
+		return "", "", time.Time{}, false
+	}
+	return rest[:j], rest[j+1:], at, true
+}
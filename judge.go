@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Verdicts of judge that end the wait.
+const (
+	verdictFailOn        = "fail-on-condition"
+	verdictTemplateError = "template-error"
+	verdictFatal         = "fatal"
+)
+
+// judgement is what a state of the resource says about the wait from the
+// object alone. It needs no API access, which lets replay re-run it offline.
+type judgement struct {
+	// verdict is set when the state aborts the wait, condition being the
+	// condition that did and rule the fatal rule it matched.
+	verdict   string
+	condition Condition
+	rule      fatalRule
+	// templateError is the template error the conditions report, if any.
+	templateError *templateError
+
+	ready        bool
+	requirements []requirementVerdict
+	// pending is why a ready state does not yet satisfy -min-refresh-time
+	// and -wait-for-generation.
+	pending string
+}
+
+// String describes the decision for -record and replay.
+func (j judgement) String() string {
+	switch {
+	case j.verdict == verdictFatal:
+		return fmt.Sprintf("%s [%s] %s=%s (%s)", j.verdict, j.rule.Code, j.condition.Type, j.condition.Status, j.condition.Reason)
+	case j.verdict != "":
+		return fmt.Sprintf("%s %s=%s (%s)", j.verdict, j.condition.Type, j.condition.Status, j.condition.Reason)
+	case j.ready && j.pending != "":
+		return "ready, but " + j.pending
+	case j.ready:
+		return "ready"
+	case len(j.requirements) > 0:
+		verdicts := make([]string, len(j.requirements))
+		for i, verdict := range j.requirements {
+			verdicts[i] = verdict.String()
+		}
+		return "waiting: " + strings.Join(verdicts, ", ")
+	}
+	return "waiting"
+}
+
+// judgingChecker is a checker with only the options judge applies, for
+// judging states without waiting, in a dry run or a replay.
+func judgingChecker(opts *options, kind resourceKind) checker {
+	return checker{
+		kind:              kind,
+		failOn:            opts.failOnConditions,
+		failOnTemplate:    !opts.waitOnTemplateError,
+		fatalRules:        opts.fatalRules(),
+		requirements:      opts.requirements,
+		minRefreshTime:    opts.minRefreshTime,
+		waitForGeneration: opts.waitForGeneration,
+	}
+}
+
+// judge applies -fail-on-condition, template errors, -fail-fast, the
+// readiness of the kind or -for, and the status requirements, in that
+// order.
+func (c *checker) judge(unstructuredES *unstructured.Unstructured, conditions []Condition) judgement {
+	var j judgement
+	if condition, ok := matchCondition(conditions, c.failOn); ok {
+		j.verdict, j.condition = verdictFailOn, condition
+		return j
+	}
+	if te, condition, ok := findTemplateError(conditions); ok {
+		j.templateError = te
+		if c.failOnTemplate {
+			j.verdict, j.condition = verdictTemplateError, condition
+			return j
+		}
+	}
+	if condition, rule, ok := classifyFatal(conditions, c.fatalRules); ok {
+		j.verdict, j.condition, j.rule = verdictFatal, condition, rule
+		return j
+	}
+
+	j.ready = c.kind.ready(unstructuredES, conditions)
+	if len(c.requirements) > 0 {
+		j.requirements, j.ready = checkRequirements(conditions, c.requirements)
+	}
+	if j.ready {
+		j.pending = parseStatus(unstructuredES).pending(c.minRefreshTime, c.waitForGeneration)
+	}
+	return j
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// killSwitchKey is the key of the kill-switch ConfigMap that bypasses the
+// gate when set to "true".
+const killSwitchKey = "bypass"
+
+// killSwitchInterval is how often a wait re-reads the kill-switch ConfigMap.
+const killSwitchInterval = 30 * time.Second
+
+// errBypassed is the cancellation cause of the waits of a cluster whose
+// kill switch was engaged while they ran.
+var errBypassed = errors.New("gate bypassed via kill-switch")
+
+// killSwitch is the -killswitch-configmap of a cluster, a break-glass bypass
+// that platform teams control centrally: during an outage of the controller,
+// setting bypass=true in it lets every gate reading it pass. It never blocks
+// the wait itself, so a ConfigMap that cannot be read, missing or denied,
+// means no bypass. Its permissions row grants the get in the namespace of
+// the ConfigMap, whatever the namespaces of the checked resources.
+type killSwitch struct {
+	clientset      kubernetes.Interface
+	namespace      string
+	name           string
+	perCallTimeout time.Duration
+	log            *logger
+	// warned is set once a read failure other than a missing ConfigMap was
+	// logged, so that a denial is not repeated at every read.
+	warned bool
+}
+
+// newKillSwitch returns the kill switch of the cluster, nil without
+// -killswitch-configmap.
+func newKillSwitch(opts *options, t *clusterTarget) *killSwitch {
+	if opts.killSwitchConfigMap == "" {
+		return nil
+	}
+	namespace, name, _ := parseResourceRef(opts.killSwitchConfigMap, "")
+	return &killSwitch{
+		clientset:      t.clientset,
+		namespace:      namespace,
+		name:           name,
+		perCallTimeout: opts.perCallTimeout,
+		log:            t.log,
+	}
+}
+
+func (k *killSwitch) String() string {
+	return "ConfigMap " + k.namespace + "/" + k.name
+}
+
+// engaged reads the ConfigMap and reports whether it bypasses the gate.
+func (k *killSwitch) engaged(ctx context.Context) bool {
+	if k == nil {
+		return false
+	}
+	ctx, cancel, err := phaseContext(ctx, k.perCallTimeout)
+	if err != nil {
+		return false
+	}
+	defer cancel()
+	configMap, err := k.clientset.CoreV1().ConfigMaps(k.namespace).Get(ctx, k.name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return false
+	case err != nil:
+		if !k.warned && ctx.Err() == nil {
+			k.log.warnf("Warning: could not read the kill-switch %s, assuming no bypass: %v", k, err)
+			k.warned = true
+		}
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(configMap.Data[killSwitchKey]), "true")
+}
+
+// watch re-reads the ConfigMap every killSwitchInterval until ctx is done,
+// canceling it with errBypassed once the kill switch is engaged.
+func (k *killSwitch) watch(ctx context.Context, cancel context.CancelCauseFunc) {
+	if k == nil {
+		return
+	}
+	ticker := time.NewTicker(killSwitchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if k.engaged(ctx) {
+				cancel(errBypassed)
+				return
+			}
+		}
+	}
+}
+
+// bypass passes every result that is not Ready yet as bypassed, loudly, as
+// a bypassed gate should never go unnoticed in the logs.
+func (k *killSwitch) bypass(results []*checkResult) []*checkResult {
+	k.log.errorf("==== GATE BYPASSED via kill-switch %s (%s=true); exiting 0 ====", k, killSwitchKey)
+	for _, result := range results {
+		if result.Ready() {
+			continue
+		}
+		result.Outcome = outcomeBypassed
+		result.Reason = fmt.Sprintf("%v %s", errBypassed, k)
+		result.lastErr = nil
+	}
+	return results
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// resourceKind is a kind of external-secrets resource the checker can wait
+// for.
+type resourceKind struct {
+	name          string
+	gvr           schema.GroupVersionResource
+	clusterScoped bool
+	// hasTarget is set for kinds that sync into a single target Secret,
+	// which the Secret verifications need.
+	hasTarget bool
+	// refreshes is set for kinds whose status reports refreshTime and
+	// syncedResourceVersion.
+	refreshes bool
+	// ready decides readiness from the object and its conditions as
+	// parseConditions resolves them.
+	ready func(*unstructured.Unstructured, []Condition) bool
+}
+
+// resourceKinds are the values of -kind.
+var resourceKinds = map[string]resourceKind{
+	"ExternalSecret": {
+		name:      "ExternalSecret",
+		gvr:       externalSecretGVR,
+		hasTarget: true,
+		refreshes: true,
+		ready:     conditionsReady,
+	},
+	"ClusterExternalSecret": {
+		name:          "ClusterExternalSecret",
+		gvr:           schema.GroupVersionResource{Group: "external-secrets.io", Version: "v1beta1", Resource: "clusterexternalsecrets"},
+		clusterScoped: true,
+		ready:         isClusterExternalSecretReady,
+	},
+	"PushSecret": {
+		name:      "PushSecret",
+		gvr:       schema.GroupVersionResource{Group: "external-secrets.io", Version: "v1alpha1", Resource: "pushsecrets"},
+		refreshes: true,
+		ready:     conditionsReady,
+	},
+}
+
+// kindNames lists the values of -kind for messages.
+const kindNames = "ExternalSecret, ClusterExternalSecret or PushSecret"
+
+// isClusterExternalSecretReady requires Ready=True and no namespace the
+// ExternalSecrets failed to be created in, since Ready alone only covers the
+// namespaces provisioned so far.
+func isClusterExternalSecretReady(unstructuredCES *unstructured.Unstructured, conditions []Condition) bool {
+	return conditionsReady(unstructuredCES, conditions) && len(failedNamespaces(unstructuredCES)) == 0
+}
+
+// failedNamespaces returns status.failedNamespaces of a
+// ClusterExternalSecret, as namespace names.
+func failedNamespaces(unstructuredCES *unstructured.Unstructured) []string {
+	failed, _, _ := unstructured.NestedSlice(unstructuredCES.Object, "status", "failedNamespaces")
+	var names []string
+	for _, entry := range failed {
+		switch entry := entry.(type) {
+		case string:
+			names = append(names, entry)
+		case map[string]any:
+			if namespace, ok := entry["namespace"].(string); ok {
+				reason, _ := entry["reason"].(string)
+				names = append(names, strings.TrimSuffix(namespace+" ("+reason+")", " ()"))
+			}
+		}
+	}
+	return names
+}
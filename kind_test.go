@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+// TestKindReadiness checks that the kinds decide readiness by the conditions
+// they are given, as parseConditions resolves them, and that a
+// ClusterExternalSecret also needs every namespace provisioned.
+func TestKindReadiness(t *testing.T) {
+	stale := readyCondition("False", "SecretSyncedError")
+	stale["lastTransitionTime"] = "2024-05-01T09:00:00Z"
+	object := newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", stale, readyCondition("True", "SecretSynced"))
+	conditions, duplicates := parseConditions(object)
+	if len(duplicates) != 1 || !resourceKinds["ExternalSecret"].ready(object, conditions) {
+		t.Errorf("ExternalSecret with a newer Ready=True duplicate: ready = false, duplicates %q, want ready", duplicates)
+	}
+	if resourceKinds["ExternalSecret"].ready(object, nil) {
+		t.Error("ExternalSecret judged without conditions is ready")
+	}
+
+	cluster := resourceKinds["ClusterExternalSecret"]
+	provisioned := newTestObject(cluster.gvr, "ClusterExternalSecret", "", "db", readyCondition("True", "Provisioned"))
+	if !cluster.ready(provisioned, getConditions(provisioned)) {
+		t.Error("ClusterExternalSecret provisioned everywhere is not ready")
+	}
+	failed := newTestObject(cluster.gvr, "ClusterExternalSecret", "", "db", readyCondition("True", "Provisioned"))
+	failed.Object["status"].(map[string]any)["failedNamespaces"] = []any{map[string]any{"namespace": "payments", "reason": "forbidden"}}
+	if cluster.ready(failed, getConditions(failed)) {
+		t.Errorf("ClusterExternalSecret that failed in %q is ready", failedNamespaces(failed))
+	}
+}
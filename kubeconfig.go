@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/homedir"
+)
+
+// kubeconfigSource selects the client configuration as kubectl does:
+// -kubeconfig, then $KUBECONFIG, then ~/.kube/config when it exists, and
+// finally the in-cluster service account. -in-cluster forces the latter,
+// since a stale kubeconfig left in an image would otherwise win over it.
+type kubeconfigSource struct {
+	path      string
+	context   string
+	inCluster bool
+}
+
+func (s *kubeconfigSource) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.path, "kubeconfig", "", "Path of the kubeconfig file (defaults to $KUBECONFIG, then ~/.kube/config if it exists, then the in-cluster service account)")
+	fs.StringVar(&s.context, "context", "", "Kubeconfig context to use instead of the current one")
+	fs.BoolVar(&s.inCluster, "in-cluster", false, "Use the in-cluster service account, ignoring any kubeconfig on disk")
+}
+
+func (s kubeconfigSource) validate() error {
+	if s.inCluster && (s.path != "" || s.context != "") {
+		return errors.New("-in-cluster is mutually exclusive with -kubeconfig and -context")
+	}
+	return nil
+}
+
+// files returns the kubeconfig files to load, with where they come from. No
+// files means the in-cluster service account.
+func (s kubeconfigSource) files() ([]string, string) {
+	switch {
+	case s.inCluster:
+		return nil, originInCluster
+	case s.path != "":
+		return []string{s.path}, originFlag
+	case os.Getenv("KUBECONFIG") != "":
+		return filepath.SplitList(os.Getenv("KUBECONFIG")), originEnv
+	}
+	if path := defaultKubeconfig(); path != "" {
+		return []string{path}, originDefault
+	}
+	return nil, originInCluster
+}
+
+// defaultKubeconfig returns ~/.kube/config if it exists.
+func defaultKubeconfig() string {
+	home := homedir.HomeDir()
+	if home == "" {
+		return ""
+	}
+	path := filepath.Join(home, ".kube", "config")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// inClusterAvailable reports whether the process runs in a pod, where the
+// service account could be used.
+func inClusterAvailable() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != "" && os.Getenv("KUBERNETES_SERVICE_PORT") != ""
+}
+
+// alternatives lists the sources that were available but not selected, for
+// telling which one won.
+func (s kubeconfigSource) alternatives() []string {
+	_, origin := s.files()
+	var others []string
+	if origin != originEnv && os.Getenv("KUBECONFIG") != "" && !s.inCluster {
+		others = append(others, "$KUBECONFIG")
+	}
+	if path := defaultKubeconfig(); origin != originDefault && path != "" && !s.inCluster {
+		others = append(others, path)
+	}
+	if origin != originInCluster && inClusterAvailable() {
+		others = append(others, "the in-cluster service account")
+	}
+	return others
+}
+
+// clientConfig returns the kubeconfig client configuration of the files for
+// context, -context or the current context.
+func (s kubeconfigSource) clientConfig(files []string, context string) clientcmd.ClientConfig {
+	rules := &clientcmd.ClientConfigLoadingRules{Precedence: files}
+	if len(files) == 1 {
+		// An explicit path must exist, unlike those of a precedence list
+		rules.ExplicitPath = files[0]
+	}
+	if context == "" {
+		context = s.context
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: context})
+}
+
+// load builds the client configuration of a kubeconfig context, or of
+// -context or the current one when context is empty. Naming a context
+// requires a kubeconfig file.
+func (s kubeconfigSource) load(context string) (*rest.Config, error) {
+	files, _ := s.files()
+	if len(files) == 0 {
+		if context == "" {
+			context = s.context
+		}
+		if context != "" {
+			return nil, fmt.Errorf("context %s needs a kubeconfig file", context)
+		}
+		return rest.InClusterConfig()
+	}
+	return s.clientConfig(files, context).ClientConfig()
+}
+
+// currentContext returns the context the kubeconfig files select, empty for
+// the in-cluster service account.
+func (s kubeconfigSource) currentContext() string {
+	if s.context != "" {
+		return s.context
+	}
+	files, _ := s.files()
+	if len(files) == 0 {
+		return ""
+	}
+	raw, err := s.clientConfig(files, "").RawConfig()
+	if err != nil {
+		return ""
+	}
+	return raw.CurrentContext
+}
+
+// describe names the selected source for the banner.
+func (s kubeconfigSource) describe() (string, string) {
+	files, origin := s.files()
+	if len(files) == 0 {
+		return "service account", origin
+	}
+	return strings.Join(files, string(filepath.ListSeparator)), origin
+}
+
+// clusterName returns the name identifying the cluster in reports: the
+// kubeconfig context, or the API server host for in-cluster configs.
+func clusterName(source kubeconfigSource, config *rest.Config) string {
+	if context := source.currentContext(); context != "" {
+		return context
+	}
+	if u, err := url.Parse(config.Host); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return config.Host
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// statusStaleThreshold is how long the ExternalSecret status has to lag
+// behind a fresh target Secret before it is reported as stuck.
+const statusStaleThreshold = time.Minute
+
+// lagTracker records when the ExternalSecret status and its target Secret
+// last changed, so slow readiness can be attributed to one side. It is
+// updated by the wait loop and the Secret watch concurrently.
+type lagTracker struct {
+	mu            sync.Mutex
+	secretName    string
+	secretExists  bool
+	secretChanged time.Time
+	statusChanged time.Time
+}
+
+func (t *lagTracker) statusUpdated(at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.statusChanged = at
+}
+
+func (t *lagTracker) secretUpdated(exists bool, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.secretExists = exists
+	t.secretChanged = at
+}
+
+// describe states which side moved last, e.g. "Secret updated 5s ago,
+// ExternalSecret status unchanged for 4m0s" with -time-format=relative.
+func (t *lagTracker) describe(now time.Time) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := "ExternalSecret status never updated"
+	if !t.statusChanged.IsZero() {
+		status = fmt.Sprintf("ExternalSecret status unchanged %s", formatPeriod(t.statusChanged, now))
+	}
+	switch {
+	case t.secretChanged.IsZero():
+		return fmt.Sprintf("Secret %s not observed yet, %s", t.secretName, status)
+	case !t.secretExists:
+		return fmt.Sprintf("Secret %s deleted %s, %s", t.secretName, formatTime(t.secretChanged, now), status)
+	case t.secretChanged.After(t.statusChanged):
+		return fmt.Sprintf("Secret %s updated %s, %s", t.secretName, formatTime(t.secretChanged, now), status)
+	default:
+		return fmt.Sprintf("ExternalSecret status updated %s, Secret %s unchanged %s",
+			formatTime(t.statusChanged, now), t.secretName, formatPeriod(t.secretChanged, now))
+	}
+}
+
+// hints diagnoses a status that is stuck while the Secret keeps being
+// written, which usually means the controller cannot update the status.
+func (t *lagTracker) hints(now time.Time) []hint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.secretExists || !t.secretChanged.After(t.statusChanged) || now.Sub(t.statusChanged) < statusStaleThreshold {
+		return nil
+	}
+	return []hint{{
+		Code: hintStatusStaleSecretFresh,
+		Message: fmt.Sprintf("Secret %s is being updated but the ExternalSecret status is not; "+
+			"check that the controller is allowed to update externalsecrets/status", t.secretName),
+	}}
+}
+
+// watchTargetSecret feeds changes of the target Secret into the tracker until
+// the context is done.
+func watchTargetSecret(ctx context.Context, clientset kubernetes.Interface, apiCalls *apiCallLog, namespace string, tracker *lagTracker) {
+	listOptions := metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", tracker.secretName).String(),
+	}
+
+	established := false
+	for ctx.Err() == nil {
+		watcher, err := clientset.CoreV1().Secrets(namespace).Watch(ctx, listOptions)
+		if err != nil {
+			console.errorf("Error watching target Secret: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		if established {
+			apiCalls.reconnected()
+		}
+		established = true
+
+		for event := range watcher.ResultChan() {
+			secret, ok := event.Object.(*corev1.Secret)
+			if !ok {
+				continue
+			}
+			switch event.Type {
+			case watch.Added:
+				tracker.secretUpdated(true, lastObjectUpdate(&secret.ObjectMeta))
+			case watch.Modified:
+				tracker.secretUpdated(true, time.Now())
+			case watch.Deleted:
+				tracker.secretUpdated(false, time.Now())
+			}
+		}
+		watcher.Stop()
+	}
+}
+
+// lastObjectUpdate estimates when an object was last written from its
+// managedFields, falling back to its creation time.
+func lastObjectUpdate(meta *metav1.ObjectMeta) time.Time {
+	latest := meta.CreationTimestamp.Time
+	for _, entry := range meta.ManagedFields {
+		if entry.Time != nil && entry.Time.After(latest) {
+			latest = entry.Time.Time
+		}
+	}
+	return latest
+}
+
+// lastStatusUpdate estimates when the controller last wrote the status of an
+// ExternalSecret from its refreshTime and condition transition times.
+func lastStatusUpdate(unstructuredES *unstructured.Unstructured) time.Time {
+	var latest time.Time
+	refreshTime, _, _ := unstructured.NestedString(unstructuredES.Object, "status", "refreshTime")
+	candidates := []string{refreshTime}
+	for _, condition := range getConditions(unstructuredES) {
+		candidates = append(candidates, condition.LastTransitionTime)
+	}
+	for _, candidate := range candidates {
+		if t, err := time.Parse(time.RFC3339, candidate); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	escheck "external-secret-watcher/pkg/checker"
+)
+
+// syncLatency describes how long it took the controller to bring an
+// ExternalSecret to Ready, measured from its metadata.creationTimestamp.
+type syncLatency struct {
+	// SinceCreation is the time between creationTimestamp and the moment the
+	// checker observed the Ready state.
+	SinceCreation time.Duration
+	// ReadyTransition is the time between creationTimestamp and the Ready
+	// condition's lastTransitionTime. Only valid when HasReadyTransition is set.
+	ReadyTransition    time.Duration
+	HasReadyTransition bool
+	// AlreadyReady is set when the resource was Ready on the very first poll,
+	// i.e. before the checker started waiting.
+	AlreadyReady bool
+}
+
+// Latency returns the value to report as the end-to-end sync latency. For
+// resources that were already Ready before the checker started, the time we
+// observed it is meaningless, so the historical lastTransitionTime is used.
+func (l syncLatency) Latency() time.Duration {
+	if l.AlreadyReady && l.HasReadyTransition {
+		return l.ReadyTransition
+	}
+	return l.SinceCreation
+}
+
+func (l syncLatency) String() string {
+	if l.AlreadyReady {
+		if l.HasReadyTransition {
+			return fmt.Sprintf("%s after creation (already Ready before the checker started)", formatDuration(l.Latency()))
+		}
+		return fmt.Sprintf("unknown (already Ready before the checker started, %s since creation)", formatDuration(l.SinceCreation))
+	}
+	if l.HasReadyTransition {
+		return fmt.Sprintf("%s after creation (Ready condition transitioned %s after creation)", formatDuration(l.SinceCreation), formatDuration(l.ReadyTransition))
+	}
+	return fmt.Sprintf("%s after creation", formatDuration(l.SinceCreation))
+}
+
+// measureSyncLatency computes the sync latency of a Ready ExternalSecret
+// observed at the given time, its Ready transition taken from conditions as
+// the wait judged them, duplicates resolved.
+func measureSyncLatency(unstructuredES *unstructured.Unstructured, conditions []Condition, observedAt time.Time, alreadyReady bool) syncLatency {
+	created := unstructuredES.GetCreationTimestamp().Time
+	latency := syncLatency{
+		SinceCreation: observedAt.Sub(created).Round(time.Second),
+		AlreadyReady:  alreadyReady,
+	}
+
+	ready, ok := escheck.FindCondition(conditions, "Ready")
+	if !ok || ready.Status != "True" {
+		return latency
+	}
+	if transition := ready.TransitionTime(); !transition.IsZero() {
+		latency.ReadyTransition = transition.Sub(created).Round(time.Second)
+		latency.HasReadyTransition = true
+	}
+	return latency
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Values of -output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// Levels of log lines.
+const (
+	levelDebug   = "debug"
+	levelInfo    = "info"
+	levelWarning = "warning"
+	levelError   = "error"
+)
+
+// logRecord is one line of -output=json.
+type logRecord struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Timestamp     string        `json:"timestamp"`
+	Level         string        `json:"level"`
+	Cluster       string        `json:"cluster,omitempty"`
+	Namespace     string        `json:"namespace,omitempty"`
+	Name          string        `json:"name,omitempty"`
+	Phase         string        `json:"phase,omitempty"`
+	Message       string        `json:"message,omitempty"`
+	Reason        string        `json:"reason,omitempty"`
+	EventType     string        `json:"eventType,omitempty"`
+	Config        []configEntry `json:"config,omitempty"`
+	Result        *resultRecord `json:"result,omitempty"`
+	Summary       []summaryRow  `json:"summary,omitempty"`
+}
+
+// logger writes the console output of a run: plain text lines, or with
+// -output=json one JSON object per line. Loggers derived by forResource add
+// the resource to their records, and those derived by forCluster the
+// cluster, which text lines are prefixed with. A nil logger writes through
+// console.
+type logger struct {
+	*logOutput
+	cluster   string
+	namespace string
+	name      string
+}
+
+// logOutput is shared by a logger and those derived from it, so that lines
+// of concurrent checks never interleave.
+type logOutput struct {
+	mu    sync.Mutex
+	w     io.Writer
+	json  bool
+	phase string
+}
+
+// console is the logger of the run, switched to JSON once the flags are
+// parsed.
+var console = &logger{logOutput: &logOutput{w: os.Stdout}}
+
+// forResource returns a logger that attributes its records to the resource.
+func (l *logger) forResource(namespace, name string) *logger {
+	if l == nil {
+		l = console
+	}
+	return &logger{logOutput: l.logOutput, cluster: l.cluster, namespace: namespace, name: name}
+}
+
+// forCluster returns a logger that attributes its records to the cluster,
+// for runs fanning out to several. An empty cluster leaves them unattributed.
+func (l *logger) forCluster(cluster string) *logger {
+	if l == nil {
+		l = console
+	}
+	return &logger{logOutput: l.logOutput, cluster: cluster}
+}
+
+func (l *logger) setPhase(phase string) {
+	if l == nil {
+		l = console
+	}
+	l.mu.Lock()
+	l.phase = phase
+	l.mu.Unlock()
+}
+
+func (l *logger) debugf(format string, args ...any) { l.printf(levelDebug, format, args...) }
+func (l *logger) infof(format string, args ...any)  { l.printf(levelInfo, format, args...) }
+func (l *logger) warnf(format string, args ...any)  { l.printf(levelWarning, format, args...) }
+func (l *logger) errorf(format string, args ...any) { l.printf(levelError, format, args...) }
+
+// printf writes a line. Text lines are written as formatted; JSON records
+// leave out the "Warning: " and "Error: " prefixes their level replaces.
+func (l *logger) printf(level, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	l.write(level, message, func(record *logRecord) {
+		record.Message = strings.TrimPrefix(strings.TrimPrefix(message, "Warning: "), "Error: ")
+	})
+}
+
+// event writes a Kubernetes event of the resource, prefixed by its name in
+// text when prefixName is set, and by its namespace too with
+// prefixNamespace.
+func (l *logger) event(e *corev1.Event, prefixName, prefixNamespace bool) {
+	text := fmt.Sprintf("Event: %s - %s: %s", formatTime(e.LastTimestamp.Time, time.Now()), e.Reason, e.Message)
+	if prefixName {
+		text = "[" + resourceLabel(e.InvolvedObject.Namespace, e.InvolvedObject.Name, prefixNamespace) + "] " + text
+	}
+	level := levelInfo
+	if e.Type == corev1.EventTypeWarning {
+		level = levelWarning
+	}
+	l.forResource(e.InvolvedObject.Namespace, e.InvolvedObject.Name).write(level, text, func(record *logRecord) {
+		record.Message = e.Message
+		record.Reason = e.Reason
+		record.EventType = e.Type
+	})
+}
+
+// config writes the effective configuration, as one record in JSON.
+func (l *logger) config(entries []configEntry) {
+	if l == nil {
+		l = console
+	}
+	if !l.json {
+		printConfig(entries)
+		return
+	}
+	l.write(levelInfo, "", func(record *logRecord) {
+		record.Message = "configuration"
+		record.Config = entries
+	})
+}
+
+// result writes the final result of a resource: the summary in text, a
+// terminal record with the outcome and last conditions in JSON.
+func (l *logger) result(result *checkResult) {
+	if l == nil {
+		l = console
+	}
+	if !l.json {
+		printSummary(result)
+		return
+	}
+	level := levelInfo
+	if !result.Ready() && result.Outcome != outcomeSkipped {
+		level = levelError
+	}
+	l.forResource(result.Namespace, result.Name).write(level, "", func(record *logRecord) {
+		record.Phase = string(result.Outcome)
+		record.Message = resultLine(result)
+		record.Result = newResultRecord(result)
+	})
+	if result.Compared != nil {
+		l.result(result.Compared)
+	}
+}
+
+// write writes text, or the record filled in by fill.
+func (l *logger) write(level, text string, fill func(record *logRecord)) {
+	if l == nil {
+		l = console
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.json {
+		if l.cluster != "" {
+			text = "[" + l.cluster + "] " + text
+		}
+		fmt.Fprintln(l.w, text)
+		return
+	}
+	record := logRecord{
+		SchemaVersion: reportSchemaVersion,
+		Timestamp:     time.Now().UTC().Format(time.RFC3339Nano),
+		Level:         level,
+		Cluster:       l.cluster,
+		Namespace:     l.namespace,
+		Name:          l.name,
+		Phase:         l.phase,
+	}
+	fill(&record)
+	line, err := json.Marshal(record)
+	if err != nil {
+		fmt.Fprintln(l.w, text)
+		return
+	}
+	l.w.Write(append(line, '\n'))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// captureJSONConsole redirects the console to a buffer with -output=json
+// until the test ends.
+func captureJSONConsole(t *testing.T) *lockedBuffer {
+	out := captureConsole(t)
+	console.mu.Lock()
+	console.json = true
+	console.mu.Unlock()
+	return out
+}
+
+// TestJSONOutputSchema writes a log line, a warning, an event and a final
+// result, and checks the fields of their records.
+func TestJSONOutputSchema(t *testing.T) {
+	out := captureJSONConsole(t)
+	log := console.forResource("apps", "db")
+	console.setPhase(phaseWaiting)
+	defer console.setPhase("")
+
+	log.infof("Waiting for ExternalSecret %s", "db")
+	log.warnf("Warning: store %s is not Ready", "vault")
+	log.event(&corev1.Event{
+		InvolvedObject: corev1.ObjectReference{Namespace: "apps", Name: "db"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "UpdateFailed",
+		Message:        "could not get secret data from provider",
+		LastTimestamp:  metav1.NewTime(time.Now()),
+	}, false, false)
+	log.result(&checkResult{
+		Namespace:  "apps",
+		Name:       "db",
+		Outcome:    outcomeTimeout,
+		Waited:     90 * time.Second,
+		Conditions: []Condition{{Type: "Ready", Status: "False", Reason: "SecretSyncedError"}},
+	})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []struct {
+		fields string
+		values map[string]any
+	}{
+		{"level message name namespace phase schemaVersion timestamp", map[string]any{"level": levelInfo, "message": "Waiting for ExternalSecret db", "phase": phaseWaiting}},
+		{"level message name namespace phase schemaVersion timestamp", map[string]any{"level": levelWarning, "message": "store vault is not Ready"}},
+		{"eventType level message name namespace phase reason schemaVersion timestamp", map[string]any{"level": levelWarning, "reason": "UpdateFailed", "eventType": "Warning", "message": "could not get secret data from provider"}},
+		{"level message name namespace phase result schemaVersion timestamp", map[string]any{"level": levelError, "phase": string(outcomeTimeout)}},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("%d lines, want %d:\n%s", len(lines), len(want), out)
+	}
+	for i, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %d is not JSON: %v\n%s", i, err, line)
+		}
+		var fields []string
+		for field := range record {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		if got := strings.Join(fields, " "); got != want[i].fields {
+			t.Errorf("line %d has fields %q, want %q", i, got, want[i].fields)
+		}
+		for field, value := range want[i].values {
+			if record[field] != value {
+				t.Errorf("line %d: %s = %v, want %v", i, field, record[field], value)
+			}
+		}
+		if record["namespace"] != "apps" || record["name"] != "db" || record["schemaVersion"] != float64(reportSchemaVersion) {
+			t.Errorf("line %d is not attributed to apps/db at schema %d: %s", i, reportSchemaVersion, line)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, record["timestamp"].(string)); err != nil {
+			t.Errorf("line %d: %v", i, err)
+		}
+	}
+
+	var last struct {
+		Result struct {
+			Outcome     outcome     `json:"outcome"`
+			WaitSeconds float64     `json:"waitSeconds"`
+			Conditions  []Condition `json:"conditions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(lines[3]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last.Result.Outcome != outcomeTimeout || last.Result.WaitSeconds != 90 || len(last.Result.Conditions) != 1 {
+		t.Errorf("terminal record = %+v, want the outcome, wait and last conditions", last.Result)
+	}
+}
+
+func TestTextOutputPrefixesCluster(t *testing.T) {
+	out := captureConsole(t)
+	console.forCluster("prod").warnf("Warning: store %s is not Ready", "vault")
+	if got := out.String(); got != "[prod] Warning: store vault is not Ready\n" {
+		t.Errorf("text line = %q", got)
+	}
+}
@@ -2,192 +2,282 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
 	"time"
-
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 )
 
 func main() {
-	// Retrieve the namespace and resource name from command-line arguments
-	namespace := flag.String("namespace", "", "Namespace of the ExternalSecret")
-	name := flag.String("name", "", "Name of the ExternalSecret")
-	flag.Parse()
-
-	if *namespace == "" || *name == "" {
-		fmt.Println("Usage: ./external-secret-watcher -namespace=<namespace> -name=<name>")
-		os.Exit(1)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "rbac":
+			os.Exit(runRBAC(os.Args[2:]))
+		case "health":
+			os.Exit(runHealth(os.Args[2:]))
+		case "check-update":
+			os.Exit(runCheckUpdate(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "schema":
+			os.Exit(runSchema(os.Args[2:]))
+		case "version":
+			fmt.Println(currentVersion())
+			os.Exit(0)
+		case "completion":
+			os.Exit(runCompletion(os.Args[2:]))
+		case completeCommand:
+			os.Exit(runComplete(os.Args[2:]))
+		}
 	}
 
-	// Read KUBECONFIG from environment variables or from the home directory
-	kubeconfigEnv := os.Getenv("KUBECONFIG")
-	var kubeconfig string
-	if kubeconfigEnv != "" {
-		kubeconfig = kubeconfigEnv
-	} else if home := homedir.HomeDir(); home != "" {
-		kubeconfig = filepath.Join(home, ".kube", "config")
+	// Retrieve the namespace and resource name from command-line arguments
+	var opts options
+	// Bad flags exit with exitUsage rather than the 2 of flag.ExitOnError,
+	// which is the exit code of a timeout
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	opts.register(flag.CommandLine)
+	if err := flag.CommandLine.Parse(os.Args[1:]); errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitOK)
+	} else if err != nil {
+		exit(exitUsage)
 	}
 
-	var config *rest.Config
-	var err error
-
-	if kubeconfig != "" {
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-	} else {
-		config, err = rest.InClusterConfig()
+	if opts.minVersion != "" {
+		if err := checkMinVersion(opts.minVersion); err != nil {
+			console.errorf("Error: %v", err)
+			exit(exitOutdated)
+		}
 	}
 
-	if err != nil {
-		fmt.Printf("Error building kubeconfig: %v\n", err)
-		os.Exit(1)
+	kind := opts.resourceKind()
+	if opts.fromFile == "" && ((opts.namespace == "" && !opts.allNamespaces && !kind.clusterScoped) || (len(opts.names) == 0 && opts.selector == "")) {
+		console.infof("Usage: ./external-secret-watcher [-kind=<kind>] -namespace=<namespace>[,<namespace>...] | -all-namespaces -name=<name>[,<name>...] | -selector=<selector>")
+		console.infof("       ./external-secret-watcher [-namespace=<namespace>] -from-file=<file>|-")
+		exit(exitUsage)
 	}
-
-	// Create client sets
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		fmt.Printf("Error creating Kubernetes clientset: %v\n", err)
-		os.Exit(1)
+	if len(opts.names) > 0 && opts.selector != "" {
+		console.errorf("Error: -name and -selector are mutually exclusive")
+		exit(exitUsage)
 	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		fmt.Printf("Error creating dynamic client: %v\n", err)
-		os.Exit(1)
+	if err := opts.applyEnv(setFlags(flag.CommandLine)); err != nil {
+		console.errorf("Error: %v", err)
+		exit(exitUsage)
 	}
-
-	// Start watching events in a separate goroutine
-	go watchEvents(clientset, *namespace, *name)
-
-	// Check the status of the ExternalSecret with timeout
-	timeout := 10 * time.Minute
-	err = checkStatusWithTimeout(dynamicClient, *namespace, *name, timeout)
+	if err := opts.validate(); err != nil {
+		console.errorf("Error: %v", err)
+		exit(exitUsage)
+	}
+	// -from-file may have set the kind
+	kind = opts.resourceKind()
+	redactions.patterns = opts.redactPatterns
+	display = displayFormat{time: opts.timeFormat, duration: opts.durationFormat}
+	console.json = opts.output == outputJSON
+	strategy, err := applyResourceLimits(opts.maxMemory)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
+		console.errorf("Error: %v", err)
+		exit(exitUsage)
 	}
-}
-
-func watchEvents(clientset *kubernetes.Clientset, namespace, name string) {
-	fmt.Printf("Watching events for ExternalSecret %s in namespace %s...\n", name, namespace)
-	fieldSelector := fields.AndSelectors(
-		fields.OneTermEqualSelector("involvedObject.kind", "ExternalSecret"),
-		fields.OneTermEqualSelector("involvedObject.name", name),
-	).String()
 
-	listOptions := metav1.ListOptions{
-		FieldSelector: fieldSelector,
+	reports := reportFiles{
+		csvReport:       opts.csvReport,
+		resultFile:      opts.resultFile,
+		metricsTextfile: opts.metricsTextfile,
+		csvTransitions:  opts.csvTransitions,
+		stateFile:       opts.stateFile,
+		enforce:         opts.enforce,
+		logAPICalls:     opts.logAPICalls,
+		verbose:         opts.verbose,
+		captureFile:     opts.captureFile,
+		captures:        &captureBuffer{max: opts.captureTransitions},
+		observers:       &observerHub{},
 	}
-
-	for {
-		watcher, err := clientset.CoreV1().Events(namespace).Watch(context.TODO(), listOptions)
+	reports.observers.subscribe(consoleObserver{verbose: opts.verbose, prefixNames: opts.several(), prefixNamespaces: opts.severalNamespaces()}, strategy.observerBuffer)
+	if opts.notifySocket != "" {
+		// The socket is best effort: the run goes on without it
+		if socket, err := openNotifySocket(opts.notifySocket); err != nil {
+			console.warnf("Warning: -notify-socket: %v", err)
+		} else {
+			reports.observers.subscribe(socket, strategy.observerBuffer)
+		}
+	}
+	if opts.ndjsonFile != "" {
+		// Like the socket, the file is best effort
+		if file, err := openNDJSONFile(opts.ndjsonFile); err != nil {
+			console.warnf("Warning: -ndjson-file: %v", err)
+		} else {
+			reports.observers.subscribe(file, strategy.observerBuffer)
+		}
+	}
+	if opts.record != "" {
+		rec, err := openRecorder(opts.record, opts.recordMaxSize, kind.name)
 		if err != nil {
-			fmt.Printf("Error watching events: %v\n", err)
-			time.Sleep(5 * time.Second)
-			continue
+			console.errorf("Error: -record: %v", err)
+			exit(exitFailure)
+		}
+		reports.recorder = rec
+		reports.observers.subscribe(rec, strategy.observerBuffer)
+	}
+	// Resources found by listing get their results once discovered
+	var results []*checkResult
+	for i, requested := range opts.requested() {
+		if opts.discovers() {
+			break
 		}
+		result := &checkResult{
+			Cluster:        opts.clusterName,
+			Labels:         opts.labels,
+			IdempotencyKey: opts.idempotencyKey,
+			Enforced:       opts.enforce,
+			Namespace:      requested.Namespace,
+			Name:           requested.Name,
+		}
+		if opts.waitList != nil {
+			result.entry = &opts.waitList[i]
+		}
+		results = append(results, result)
+	}
 
-		for event := range watcher.ResultChan() {
-			if e, ok := event.Object.(*corev1.Event); ok {
-				fmt.Printf("Event: %s - %s: %s\n", e.LastTimestamp, e.Reason, e.Message)
+	timeout, timeoutOrigin := opts.timeout, opts.origin(setFlags(flag.CommandLine), "timeout")
+	if opts.adaptiveTimeout {
+		// Resources checked together share the deadline, so the slowest
+		// history decides it
+		state := loadState(opts.stateFile)
+		timeout = 0
+		for _, result := range results {
+			adaptive, basis := adaptiveTimeout(state[stateKey(result.Namespace, result.Name)].Waits, opts.timeout)
+			if adaptive > timeout {
+				timeout = adaptive
 			}
+			console.infof("Adaptive timeout: %s (%s)", formatDuration(adaptive), basis)
 		}
+		timeoutOrigin = originFile
 	}
-}
-
-func checkStatusWithTimeout(dynamicClient dynamic.Interface, namespace, name string, timeout time.Duration) error {
-	// Define the GroupVersionResource for ExternalSecret
-	externalSecretGVR := schema.GroupVersionResource{
-		Group:    "external-secrets.io",
-		Version:  "v1beta1",
-		Resource: "externalsecrets",
+	if opts.simulate != "" {
+		finish(reports, results, runSimulation(opts.simulation, timeout, results[0]))
 	}
 
-	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	var extra []configEntry
+	splay, splaySeed := splayDelay(opts.splay)
+	if opts.splay > 0 {
+		extra = append(extra, configEntry{"splay", fmt.Sprintf("%s of %s (seeded from %s)", formatDuration(splay), formatDuration(opts.splay), splaySeed), originFlag})
+	}
+	extra = append(extra, strategy.configEntries()...)
 
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
+	// Every -cluster context checks its own copy of the results. The
+	// banners are printed one cluster after the other, before any waits.
+	contexts := []string(opts.clusters)
+	if len(contexts) == 0 {
+		contexts = []string{""}
+	}
+	if others := opts.kube.alternatives(); len(others) > 0 {
+		kubeconfig, origin := opts.kube.describe()
+		console.infof("Using kubeconfig %s (%s); also available: %s", kubeconfig, origin, strings.Join(others, ", "))
+	}
+	initEnd := time.Now()
+	targets := make([]*clusterTarget, len(contexts))
+	connectErrs := make([]error, len(contexts))
+	for i, kubeContext := range contexts {
+		clusterResults := results
+		if len(contexts) > 1 {
+			clusterResults = make([]*checkResult, len(results))
+			for j, result := range results {
+				copied := *result
+				clusterResults[j] = &copied
+			}
+		}
+		targets[i], connectErrs[i] = connectCluster(&opts, kubeContext, clusterResults, timeout, timeoutOrigin, extra, initEnd)
+	}
+	if !opts.severalClusters() {
+		if connectErrs[0] != nil {
+			finish(reports, failAll(results, connectErrs[0]), exitCodeFor(connectErrs[0]))
+		}
+		reports.apiCalls = targets[0].apiCalls
+		reports.startup = targets[0].startup
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("timeout reached: ExternalSecret %s did not become Ready within %v", name, timeout)
-		case <-ticker.C:
-			// Get the ExternalSecret resource
-			unstructuredES, err := dynamicClient.Resource(externalSecretGVR).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
-			if err != nil {
-				fmt.Printf("Error getting ExternalSecret: %v\n", err)
-			} else {
-				if isReady(unstructuredES) {
-					fmt.Printf("ExternalSecret %s has reached Ready state.\n", name)
-					return nil
-				} else {
-					fmt.Printf("Waiting... Current status conditions: %v\n", getConditions(unstructuredES))
-				}
+	if opts.dryRun {
+		code := exitOK
+		for i, t := range targets {
+			if connectErrs[i] != nil {
+				code = mergeExitCode(code, exitCodeFor(connectErrs[i]))
+				continue
 			}
+			code = mergeExitCode(code, runDryRun(&opts, t, timeout))
 		}
+		exit(code)
 	}
-}
 
-func isReady(unstructuredES *unstructured.Unstructured) bool {
-	conditions := getConditions(unstructuredES)
-	for _, condition := range conditions {
-		if condition.Type == "Ready" && condition.Status == "True" {
-			return true
+	// SIGINT and SIGTERM end the wait with a summary rather than killing
+	// the run mid-print
+	shutdown, stop := shutdownContext(context.Background())
+	defer stop()
+	for _, t := range targets {
+		t.startup.restart()
+	}
+	sleepSplay(shutdown, splay)
+	if splay > 0 {
+		for _, t := range targets {
+			t.startup.record(startupSplay)
 		}
 	}
-	return false
-}
 
-type Condition struct {
-	Type               string `json:"type"`
-	Status             string `json:"status"`
-	LastTransitionTime string `json:"lastTransitionTime"`
-	Reason             string `json:"reason"`
-	Message            string `json:"message"`
+	var code int
+	if opts.severalClusters() {
+		results, code = checkClusters(shutdown, &opts, reports, targets, connectErrs, timeout)
+	} else {
+		results, code = targets[0].check(shutdown, &opts, reports, timeout)
+	}
+	if sigErr, ok := interruptedBy(shutdown); ok {
+		printInterrupted(sigErr, results)
+		code = sigErr.exitCode()
+	}
+	finish(reports, results, code)
 }
 
-func getConditions(unstructuredES *unstructured.Unstructured) []Condition {
-	status, found, err := unstructured.NestedMap(unstructuredES.Object, "status")
-	if !found || err != nil {
-		return []Condition{}
-	}
+// observerBuffer is how many updates an observer may lag behind before
+// further ones are dropped.
+const observerBuffer = 256
 
-	conditionsInterface, found, err := unstructured.NestedSlice(status, "conditions")
-	if !found || err != nil {
-		return []Condition{}
+// finish writes the requested report files and terminates the process. Every
+// exit path after flag validation goes through here so that reports are never
+// left missing or half-written.
+func finish(reports reportFiles, results []*checkResult, code int) {
+	for _, result := range results {
+		result.ReasonCode = reasonCodeFor(result)
 	}
-
-	var conditions []Condition
-	for _, c := range conditionsInterface {
-		conditionMap, ok := c.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		conditionBytes, err := json.Marshal(conditionMap)
-		if err != nil {
-			continue
-		}
-		var condition Condition
-		err = json.Unmarshal(conditionBytes, &condition)
-		if err != nil {
-			continue
+	if dropped := reports.observers.finish(results); dropped > 0 {
+		console.warnf("Warning: %d progress updates were dropped by slow observers", dropped)
+	}
+	switch {
+	case len(results) > 1 && spansClusters(results):
+		printClusterSummary(results)
+	case len(results) > 0 && results[0].entry != nil:
+		printWaitListSummary(results)
+	case len(results) > 1:
+		printBatchSummary(results)
+	}
+	if err := reports.write(results); err != nil {
+		console.errorf("Error writing reports: %v", err)
+		if code == exitOK {
+			code = exitFailure
 		}
-		conditions = append(conditions, condition)
 	}
-	return conditions
+	if !reports.enforce && code != exitOK {
+		console.errorf("==== WOULD HAVE FAILED with exit code %d; exiting 0 because of -enforce=false ====", code)
+		console.infof("RESULT=%s", exitName(code))
+		os.Exit(exitOK)
+	}
+	exit(code)
+}
+
+// failAll marks every result as failed by err, for errors that happen before
+// any resource is checked.
+func failAll(results []*checkResult, err error) []*checkResult {
+	for _, result := range results {
+		result.failed(err)
+	}
+	return results
 }
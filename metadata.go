@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// controllerMetadataPrefixes are label and annotation prefixes the
+// controller stamps on target Secrets itself; they are never unexpected.
+var controllerMetadataPrefixes = []string{"external-secrets.io/", "reconcile.external-secrets.io/"}
+
+// metadataIssue is one label or annotation of the target Secret that does
+// not match spec.target.template.metadata. Values are included since
+// metadata is not sensitive.
+type metadataIssue struct {
+	Kind     string `json:"kind"` // "label" or "annotation"
+	Key      string `json:"key"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	// Problem is "missing", "mismatched" or "unexpected".
+	Problem string `json:"problem"`
+}
+
+func (i metadataIssue) String() string {
+	switch i.Problem {
+	case "missing":
+		return fmt.Sprintf("%s %s missing (expected %q)", i.Kind, i.Key, i.Expected)
+	case "unexpected":
+		return fmt.Sprintf("%s %s unexpected (%q)", i.Kind, i.Key, i.Actual)
+	default:
+		return fmt.Sprintf("%s %s is %q, expected %q", i.Kind, i.Key, i.Actual, i.Expected)
+	}
+}
+
+// verifyTemplateMetadata compares the labels and annotations of
+// spec.target.template.metadata with the live target Secret. With
+// creationPolicy Merge the Secret is shared with other writers, so only the
+// templated keys are checked and extra keys are allowed.
+func verifyTemplateMetadata(ctx context.Context, clientset kubernetes.Interface, unstructuredES *unstructured.Unstructured, timeout time.Duration) ([]metadataIssue, error) {
+	ctx, cancel, err := phaseContext(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	target := targetSecretName(unstructuredES)
+	secret, err := clientset.CoreV1().Secrets(unstructuredES.GetNamespace()).Get(ctx, target, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not read target Secret %s: %w", target, err)
+	}
+
+	policy, _, _ := unstructured.NestedString(unstructuredES.Object, "spec", "target", "creationPolicy")
+	allowExtra := policy == "Merge"
+	labels, _, _ := unstructured.NestedStringMap(unstructuredES.Object, "spec", "target", "template", "metadata", "labels")
+	annotations, _, _ := unstructured.NestedStringMap(unstructuredES.Object, "spec", "target", "template", "metadata", "annotations")
+
+	issues := diffMetadata("label", labels, secret.Labels, allowExtra)
+	return append(issues, diffMetadata("annotation", annotations, secret.Annotations, allowExtra)...), nil
+}
+
+func diffMetadata(kind string, expected, actual map[string]string, allowExtra bool) []metadataIssue {
+	var issues []metadataIssue
+	for key, want := range expected {
+		got, ok := actual[key]
+		switch {
+		case !ok:
+			issues = append(issues, metadataIssue{Kind: kind, Key: key, Expected: want, Problem: "missing"})
+		case got != want:
+			issues = append(issues, metadataIssue{Kind: kind, Key: key, Expected: want, Actual: got, Problem: "mismatched"})
+		}
+	}
+	if !allowExtra && len(expected) > 0 {
+		for key, got := range actual {
+			if _, ok := expected[key]; !ok && !controllerMetadata(key) {
+				issues = append(issues, metadataIssue{Kind: kind, Key: key, Actual: got, Problem: "unexpected"})
+			}
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Key < issues[j].Key })
+	return issues
+}
+
+func controllerMetadata(key string) bool {
+	for _, prefix := range controllerMetadataPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
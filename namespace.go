@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// waitForNamespace blocks until the namespace exists, bounded by the context
+// deadline. During environment bootstrap the checker can start before the
+// namespace is created, in which case every Get of the ExternalSecret would
+// return a misleading NotFound. If the namespace cannot be read (e.g. no RBAC
+// access to namespaces) the check is skipped.
+func waitForNamespace(ctx context.Context, clientset kubernetes.Interface, apiCalls *apiCallLog, namespace string, perCallTimeout time.Duration) error {
+	callCtx, cancel := context.WithTimeout(ctx, perCallTimeout)
+	ns, err := clientset.CoreV1().Namespaces().Get(callCtx, namespace, metav1.GetOptions{})
+	cancel()
+	if err == nil {
+		return checkNamespacePhase(ns)
+	}
+	if !apierrors.IsNotFound(err) {
+		console.warnf("Warning: could not check namespace %s, continuing: %v", namespace, err)
+		return nil
+	}
+
+	console.infof("Namespace %s does not exist yet, waiting for it to be created...", namespace)
+	start := time.Now()
+	listOptions := metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", namespace).String(),
+	}
+
+	progress := time.NewTicker(30 * time.Second)
+	defer progress.Stop()
+
+	established := false
+	for {
+		watcher, err := clientset.CoreV1().Namespaces().Watch(ctx, listOptions)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("timeout reached: namespace %s was not created within %s", namespace, formatDuration(time.Since(start)))
+			}
+			console.errorf("Error watching namespace: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		if established {
+			apiCalls.reconnected()
+		}
+		established = true
+
+		ns, err := waitForNamespaceEvent(ctx, watcher, progress.C, namespace, start)
+		watcher.Stop()
+		if err != nil {
+			return err
+		}
+		if ns != nil {
+			console.infof("Namespace %s was created after %s.", namespace, formatDuration(time.Since(start)))
+			return checkNamespacePhase(ns)
+		}
+	}
+}
+
+// waitForNamespaceEvent consumes a single watch until the namespace shows up.
+// It returns a nil namespace when the watch was closed and must be restarted.
+func waitForNamespaceEvent(ctx context.Context, watcher watch.Interface, progress <-chan time.Time, namespace string, start time.Time) (*corev1.Namespace, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timeout reached: namespace %s was not created within %s", namespace, formatDuration(time.Since(start)))
+		case <-progress:
+			console.infof("Still waiting for namespace %s to be created (%s elapsed)...", namespace, formatDuration(time.Since(start)))
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil, nil
+			}
+			if event.Type != watch.Added && event.Type != watch.Modified {
+				continue
+			}
+			if ns, ok := event.Object.(*corev1.Namespace); ok {
+				return ns, nil
+			}
+		}
+	}
+}
+
+// namespaceTerminatingError is reported for a namespace that is being
+// deleted.
+type namespaceTerminatingError struct {
+	namespace string
+}
+
+func (e *namespaceTerminatingError) Error() string {
+	return fmt.Sprintf("namespace %s is terminating: it is being deleted, so the ExternalSecret will never become Ready", e.namespace)
+}
+
+// checkNamespacePhase fails fast on a namespace that is being deleted, since
+// nothing created in it will ever become Ready.
+func checkNamespacePhase(ns *corev1.Namespace) error {
+	if ns.Status.Phase == corev1.NamespaceTerminating || ns.DeletionTimestamp != nil {
+		return &namespaceTerminatingError{namespace: ns.Name}
+	}
+	return nil
+}
+
+// namespaceTerminating checks whether the namespace started terminating
+// during the wait. Errors reading it are not conclusive and ignored.
+func namespaceTerminating(ctx context.Context, clientset kubernetes.Interface, namespace string, perCallTimeout time.Duration) error {
+	callCtx, cancel := context.WithTimeout(ctx, perCallTimeout)
+	defer cancel()
+	ns, err := clientset.CoreV1().Namespaces().Get(callCtx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	return checkNamespacePhase(ns)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ndjsonFile is an observer appending the records of -notify-socket to a
+// file as they happen, one NDJSON line each, for pipelines that keep the
+// progress of a run as an artifact. Every line is flushed as written, so a
+// killed run leaves the lines up to its end. Write errors are reported once
+// and stop this observer only.
+type ndjsonFile struct {
+	path string
+
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	failed bool
+}
+
+// openNDJSONFile creates the file, truncating that of a previous run.
+func openNDJSONFile(path string) (*ndjsonFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &ndjsonFile{path: path, file: file, w: bufio.NewWriter(file)}, nil
+}
+
+func (f *ndjsonFile) write(record notifyRecord) {
+	record.Time = time.Now().UTC().Format(time.RFC3339)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failed {
+		return
+	}
+	f.w.Write(append(line, '\n'))
+	if err := f.w.Flush(); err != nil {
+		console.warnf("Warning: -ndjson-file %s: %v (no further records are written to it)", f.path, err)
+		f.failed = true
+	}
+}
+
+func (f *ndjsonFile) OnConditionChange(transition conditionTransition) {
+	f.write(notifyRecord{Type: "condition", Transition: &transition})
+}
+
+func (f *ndjsonFile) OnEvent(event *corev1.Event) {
+	f.write(notifyRecord{Type: "event", Event: &notifyEvent{Type: event.Type, Reason: event.Reason, Message: event.Message}})
+}
+
+func (f *ndjsonFile) OnPhaseChange(phase string) {
+	f.write(notifyRecord{Type: "phase", Phase: phase})
+}
+
+func (f *ndjsonFile) OnResult(result *checkResult) {
+	f.write(notifyRecord{Type: "result", Result: newResultRecord(result)})
+}
+
+func (f *ndjsonFile) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.file.Close()
+}
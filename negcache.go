@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+)
+
+// hopelessLogInterval is how often a failure that keeps repeating is
+// reported again while its attempts are suppressed.
+const hopelessLogInterval = time.Minute
+
+// Classes of failures that repeat identically until someone intervenes.
+const (
+	hopelessDenied      = "RBAC denial"
+	hopelessUnavailable = "resource type not served"
+)
+
+// hopelessCache is a negative cache of the failure class the Gets of the
+// wait keep hitting, such as a missing CRD or an RBAC denial the run waits
+// out. While the same class repeats, the retries back off and the log
+// collapses to a periodic line counting the suppressed attempts. The first
+// successful call clears it.
+type hopelessCache struct {
+	class      string
+	since      time.Time
+	attempts   int
+	suppressed int
+	lastLog    time.Time
+}
+
+// fail records a failed attempt of class and returns the delay before the
+// next one and whether the failure should be logged in full, which it is
+// the first time and after an attempt of another class.
+func (h *hopelessCache) fail(c *checker, class string, err error) (time.Duration, bool) {
+	now := time.Now()
+	if h.class != class {
+		*h = hopelessCache{class: class, since: now, lastLog: now}
+	}
+	h.attempts++
+	delay := retryBackoff(c.pollInterval, h.attempts)
+	if h.attempts == 1 {
+		return delay, true
+	}
+	h.suppressed++
+	if now.Sub(h.lastLog) >= hopelessLogInterval {
+		c.log.errorf("Error getting ExternalSecret: still failing with %s for %s (suppressed %d attempts, retrying every %s): %v",
+			class, formatDuration(now.Sub(h.since)), h.suppressed, formatDuration(delay), err)
+		h.suppressed = 0
+		h.lastLog = now
+	}
+	return delay, false
+}
+
+// clear forgets the failure after a successful call.
+func (h *hopelessCache) clear(c *checker) {
+	if h.class == "" {
+		return
+	}
+	c.log.infof("Recovered from %s after %s (%d attempts)", h.class, formatDuration(time.Since(h.since)), h.attempts)
+	*h = hopelessCache{}
+}
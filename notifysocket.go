@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// notifyRecord is one NDJSON line written to -notify-socket.
+type notifyRecord struct {
+	Type       string               `json:"type"`
+	Time       string               `json:"time"`
+	Phase      string               `json:"phase,omitempty"`
+	Transition *conditionTransition `json:"transition,omitempty"`
+	Event      *notifyEvent         `json:"event,omitempty"`
+	Result     *resultRecord        `json:"result,omitempty"`
+}
+
+type notifyEvent struct {
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Time    string `json:"time,omitempty"`
+}
+
+type resultRecord struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Cluster       string `json:"cluster,omitempty"`
+	Namespace     string `json:"namespace"`
+	Name          string `json:"name"`
+	// Labels are those of -label, attached to every record.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Outcome     outcome           `json:"outcome"`
+	ReasonCode  reasonCode        `json:"reasonCode,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+	WaitSeconds float64           `json:"waitSeconds"`
+	Checks      int               `json:"checks,omitempty"`
+	Ready       bool              `json:"ready"`
+	// ReadyState tells apart Ready resources that were already Ready from
+	// those that became Ready during the wait.
+	ReadyState  string      `json:"readyState,omitempty"`
+	BoundSecret string      `json:"boundSecret,omitempty"`
+	Conditions  []Condition `json:"conditions,omitempty"`
+	// SyncLatencySinceCreationSeconds and SyncLatencyReadyTransitionSeconds
+	// are the sync latency of a Ready resource, from its creationTimestamp
+	// to the moment the run saw it Ready and to the lastTransitionTime of
+	// its Ready condition.
+	SyncLatencySinceCreationSeconds   *float64 `json:"syncLatencySinceCreationSeconds,omitempty"`
+	SyncLatencyReadyTransitionSeconds *float64 `json:"syncLatencyReadyTransitionSeconds,omitempty"`
+	// DuplicateConditions lists the condition types written more than once.
+	DuplicateConditions []string             `json:"duplicateConditions,omitempty"`
+	Requirements        []requirementVerdict `json:"requirements,omitempty"`
+	// Hints diagnose a failed wait, each with a stable code, and
+	// LagAttribution states which of the ExternalSecret status and the
+	// target Secret last changed.
+	Hints          []hint         `json:"hints,omitempty"`
+	LagAttribution string         `json:"lagAttribution,omitempty"`
+	TemplateError  *templateError `json:"templateError,omitempty"`
+	// SLOViolations, MissingKeys and MetadataIssues explain the outcomes
+	// of Ready resources that still failed a check.
+	SLOViolations  []string          `json:"sloViolations,omitempty"`
+	MissingKeys    []string          `json:"missingKeys,omitempty"`
+	MetadataIssues []metadataIssue   `json:"metadataIssues,omitempty"`
+	Comparison     *comparisonRecord `json:"comparison,omitempty"`
+	// SkippedPhases lists the phases after the wait that did not run, with
+	// the reason.
+	SkippedPhases []string `json:"skippedPhases,omitempty"`
+	// Store is the store the resource refers to as kind/name, "unknown"
+	// when it could not be read, for grouping failures by store, and
+	// StoreReady its Ready condition when -check-store read it.
+	Store      string     `json:"store"`
+	StoreReady *Condition `json:"storeReady,omitempty"`
+	// Stats is the API pressure of the cluster of the resource over the
+	// run, as with -verbose. It is only known, and so only set, in the
+	// -result-file written once the run is over.
+	Stats *statsRecord `json:"stats,omitempty"`
+	// APICalls counts the requests by verb and resource, with
+	// -log-api-calls.
+	APICalls map[string]int `json:"apiCalls,omitempty"`
+	// Events are the last events observed.
+	Events []notifyEvent `json:"events,omitempty"`
+	// IdempotencyKey and Duplicate let consumers deduplicate notifications
+	// of retried runs.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	Duplicate      bool   `json:"duplicate,omitempty"`
+	// Redactions counts the messages -redact-pattern masked.
+	Redactions int  `json:"redactions,omitempty"`
+	Simulated  bool `json:"simulated,omitempty"`
+	Enforce    bool `json:"enforce"`
+	// Config is the effective configuration of the run as printed at
+	// startup, credentials masked, so that a report tells how it was made.
+	Config []configEntry `json:"config,omitempty"`
+}
+
+// newResultRecord is the final result of a resource as reported to
+// -notify-socket and by -output=json.
+func newResultRecord(result *checkResult) *resultRecord {
+	record := &resultRecord{
+		SchemaVersion:       reportSchemaVersion,
+		Cluster:             result.Cluster,
+		Namespace:           result.Namespace,
+		Name:                result.Name,
+		Labels:              result.Labels,
+		Outcome:             result.Outcome,
+		ReasonCode:          result.ReasonCode,
+		Reason:              result.Reason,
+		WaitSeconds:         result.Waited.Seconds(),
+		Checks:              result.Checks,
+		Ready:               result.Ready(),
+		ReadyState:          result.ReadyState,
+		BoundSecret:         boundSecret(result),
+		Conditions:          result.Conditions,
+		DuplicateConditions: result.DuplicateConditions,
+		Requirements:        result.Requirements,
+		Hints:               result.Hints,
+		LagAttribution:      result.LagAttribution,
+		TemplateError:       result.TemplateError,
+		SLOViolations:       result.SLOViolations,
+		MissingKeys:         result.MissingKeys,
+		MetadataIssues:      result.MetadataIssues,
+		Comparison:          newComparisonRecord(result),
+		SkippedPhases:       result.SkippedPhases,
+		Store:               storeGroup(result),
+		StoreReady:          result.StoreReady,
+		Stats:               newStatsRecord(result.Stats),
+		APICalls:            result.APICalls,
+		Events:              result.RecentEvents,
+		IdempotencyKey:      result.IdempotencyKey,
+		Duplicate:           result.Duplicate,
+		Redactions:          redactions.count(result.Namespace, result.Name),
+		Simulated:           result.Simulated,
+		Enforce:             result.Enforced,
+		Config:              result.Config,
+	}
+	if latency := result.Latency; latency != nil {
+		sinceCreation := latency.SinceCreation.Seconds()
+		record.SyncLatencySinceCreationSeconds = &sinceCreation
+		if latency.HasReadyTransition {
+			readyTransition := latency.ReadyTransition.Seconds()
+			record.SyncLatencyReadyTransitionSeconds = &readyTransition
+		}
+	}
+	return record
+}
+
+// comparisonRecord is the -compare-with verdict of a result.
+type comparisonRecord struct {
+	// With is the namespace/name of the compared resource.
+	With         string   `json:"with"`
+	Diverged     bool     `json:"diverged"`
+	OnlyInFirst  []string `json:"onlyInFirst,omitempty"`
+	OnlyInSecond []string `json:"onlyInSecond,omitempty"`
+	SameDataHash bool     `json:"sameDataHash"`
+}
+
+func newComparisonRecord(result *checkResult) *comparisonRecord {
+	if result.Comparison == nil {
+		return nil
+	}
+	record := &comparisonRecord{
+		Diverged:     result.Comparison.Diverged(),
+		OnlyInFirst:  result.Comparison.OnlyInFirst,
+		OnlyInSecond: result.Comparison.OnlyInSecond,
+		SameDataHash: result.Comparison.SameDataHash,
+	}
+	if result.Compared != nil {
+		record.With = result.Compared.Namespace + "/" + result.Compared.Name
+	}
+	return record
+}
+
+// statsRecord is apiStats with the latencies in seconds.
+type statsRecord struct {
+	Gets              int     `json:"gets"`
+	Lists             int     `json:"lists"`
+	Watches           int     `json:"watches"`
+	Reconnects        int     `json:"reconnects"`
+	Throttled         int     `json:"throttled"`
+	APFRejected       int     `json:"apfRejected"`
+	LatencyP50Seconds float64 `json:"latencyP50Seconds"`
+	LatencyP90Seconds float64 `json:"latencyP90Seconds"`
+	LatencyP99Seconds float64 `json:"latencyP99Seconds"`
+	// WatchFallback is why the waits polled rather than watched, if they
+	// fell back to it.
+	WatchFallback string `json:"watchFallback,omitempty"`
+}
+
+func newStatsRecord(stats *apiStats) *statsRecord {
+	if stats == nil {
+		return nil
+	}
+	return &statsRecord{
+		Gets:              stats.Gets,
+		Lists:             stats.Lists,
+		Watches:           stats.Watches,
+		Reconnects:        stats.Reconnects,
+		Throttled:         stats.Throttled,
+		APFRejected:       stats.APFRejected,
+		LatencyP50Seconds: stats.LatencyP50.Seconds(),
+		LatencyP90Seconds: stats.LatencyP90.Seconds(),
+		LatencyP99Seconds: stats.LatencyP99.Seconds(),
+		WatchFallback:     stats.WatchFallback,
+	}
+}
+
+// notifySocket is an observer streaming NDJSON updates to readers of a Unix
+// socket or an existing named pipe, for sidecars that wait for the checker.
+// Readers may come and go: each newly connected reader first gets the last
+// phase, or the results once known. Write errors only drop the reader; they
+// never affect the run.
+type notifySocket struct {
+	listener net.Listener
+	fifo     string
+
+	mu      sync.Mutex
+	readers []net.Conn
+	// replay holds the records a newly connected reader starts with: the
+	// last phase, or every result once known.
+	replay        [][]byte
+	replayResults bool
+}
+
+// openNotifySocket listens on path, or writes to it if it is a named pipe.
+// A stale socket file left by a previous run is replaced.
+func openNotifySocket(path string) (*notifySocket, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeNamedPipe != 0 {
+			return &notifySocket{fifo: path}, nil
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is neither a socket nor a named pipe", path)
+		}
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &notifySocket{listener: listener}
+	go s.accept()
+	return s, nil
+}
+
+func (s *notifySocket) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		for _, line := range s.replay {
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			if _, err := conn.Write(line); err != nil {
+				conn.Close()
+				conn = nil
+				break
+			}
+		}
+		if conn != nil {
+			s.readers = append(s.readers, conn)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// write sends a record to every connected reader, dropping those that fail.
+func (s *notifySocket) write(record notifyRecord, replay bool) {
+	record.Time = time.Now().UTC().Format(time.RFC3339)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if replay {
+		result := record.Type == "result"
+		if !result || !s.replayResults {
+			s.replay = s.replay[:0]
+		}
+		s.replay = append(s.replay, line)
+		s.replayResults = result
+	}
+	if s.fifo != "" {
+		s.writeFIFO(line)
+		return
+	}
+	readers := s.readers[:0]
+	for _, conn := range s.readers {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(line); err != nil {
+			conn.Close()
+			continue
+		}
+		readers = append(readers, conn)
+	}
+	s.readers = readers
+}
+
+// writeFIFO writes to the named pipe without blocking while nobody reads it.
+func (s *notifySocket) writeFIFO(line []byte) {
+	f, err := os.OpenFile(s.fifo, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		if !errors.Is(err, syscall.ENXIO) {
+			console.warnf("Warning: -notify-socket: %v", err)
+		}
+		return
+	}
+	defer f.Close()
+	f.Write(line)
+}
+
+func (s *notifySocket) OnConditionChange(transition conditionTransition) {
+	s.write(notifyRecord{Type: "condition", Transition: &transition}, false)
+}
+
+func (s *notifySocket) OnEvent(event *corev1.Event) {
+	s.write(notifyRecord{Type: "event", Event: &notifyEvent{Type: event.Type, Reason: event.Reason, Message: event.Message}}, false)
+}
+
+func (s *notifySocket) OnPhaseChange(phase string) {
+	s.write(notifyRecord{Type: "phase", Phase: phase}, true)
+}
+
+func (s *notifySocket) OnResult(result *checkResult) {
+	s.write(notifyRecord{Type: "result", Result: newResultRecord(result)}, true)
+}
+
+// boundSecret names the Secret a Ready result is bound to, if known.
+func boundSecret(result *checkResult) string {
+	if result.Binding == nil {
+		return ""
+	}
+	return result.Binding.Namespace + "/" + result.Binding.Name
+}
+
+// close disconnects the readers and removes the socket once every result has
+// been written.
+func (s *notifySocket) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.readers {
+		conn.Close()
+	}
+	s.readers = nil
+	if s.listener != nil {
+		s.listener.Close()
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Phases of a run, reported to observers as they are entered.
+const (
+	phaseNamespace = "namespace"
+	phaseWaiting   = "waiting"
+	phaseVerifying = "verifying"
+	phaseDone      = "done"
+)
+
+// observer receives live progress of a check. Updates are delivered in order
+// on a goroutine of the observer's own, so an observer may block without
+// stalling the wait loop; once its buffer is full further updates are
+// dropped and counted instead.
+type observer interface {
+	OnConditionChange(transition conditionTransition)
+	OnEvent(event *corev1.Event)
+	OnPhaseChange(phase string)
+	OnResult(result *checkResult)
+}
+
+// observerHub fans updates out to the subscribed observers, the sinks of a
+// run: the console, -notify-socket, -ndjson-file and -record. Each gets the
+// same updates and the final results. All methods are safe to call on a nil
+// hub.
+type observerHub struct {
+	subscribers []*subscriber
+	wg          sync.WaitGroup
+	dropped     atomic.Int64
+
+	// mu guards finished, so that late updates from background watches are
+	// discarded instead of sent on a closed queue, and delivered, the results
+	// already sent.
+	mu        sync.Mutex
+	finished  bool
+	delivered map[*checkResult]bool
+}
+
+type subscriber struct {
+	updates chan func(observer)
+	// failed is set once the observer panicked; its later updates are
+	// discarded.
+	failed bool
+}
+
+// closingObserver is an observer holding resources that are released once
+// its queue is drained.
+type closingObserver interface {
+	observer
+	close()
+}
+
+// subscribe registers o with room for buffer pending updates. It must be
+// called before any update is published. An observer that panics is cut off
+// with a warning, and never affects the others nor the run.
+func (h *observerHub) subscribe(o observer, buffer int) {
+	s := &subscriber{updates: make(chan func(observer), buffer)}
+	h.subscribers = append(h.subscribers, s)
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		for update := range s.updates {
+			if !s.failed {
+				s.deliver(o, update)
+			}
+		}
+		if c, ok := o.(closingObserver); ok {
+			c.close()
+		}
+	}()
+}
+
+func (s *subscriber) deliver(o observer, update func(observer)) {
+	defer func() {
+		if r := recover(); r != nil {
+			console.warnf("Warning: output %T failed and is disabled: %v", o, r)
+			s.failed = true
+		}
+	}()
+	update(o)
+}
+
+// publish queues update for every observer without blocking.
+func (h *observerHub) publish(update func(observer)) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.finished {
+		return
+	}
+	for _, s := range h.subscribers {
+		select {
+		case s.updates <- update:
+		default:
+			h.dropped.Add(1)
+		}
+	}
+}
+
+func (h *observerHub) conditionChanged(transition conditionTransition) {
+	h.publish(func(o observer) { o.OnConditionChange(transition) })
+}
+
+func (h *observerHub) event(event *corev1.Event) {
+	h.publish(func(o observer) { o.OnEvent(event) })
+}
+
+func (h *observerHub) phase(phase string) {
+	h.publish(func(o observer) { o.OnPhaseChange(phase) })
+}
+
+// result delivers the result of a resource as soon as it is final, for runs
+// checking several. Results are never dropped.
+func (h *observerHub) result(result *checkResult) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.finished {
+		h.deliver(result)
+	}
+}
+
+func (h *observerHub) deliver(result *checkResult) {
+	if h.delivered[result] {
+		return
+	}
+	if h.delivered == nil {
+		h.delivered = map[*checkResult]bool{}
+	}
+	h.delivered[result] = true
+	for _, s := range h.subscribers {
+		s.updates <- func(o observer) { o.OnResult(result) }
+	}
+}
+
+// finish delivers the results not delivered yet, waits for every observer to
+// drain its queue and returns the number of dropped updates. Later updates
+// are discarded.
+func (h *observerHub) finish(results []*checkResult) int64 {
+	if h == nil {
+		return 0
+	}
+	h.phase(phaseDone)
+	h.mu.Lock()
+	h.finished = true
+	for _, result := range results {
+		h.deliver(result)
+	}
+	for _, s := range h.subscribers {
+		close(s.updates)
+	}
+	h.mu.Unlock()
+	h.wg.Wait()
+	return h.dropped.Load()
+}
+
+// consoleObserver is the plain-text output of the CLI.
+type consoleObserver struct {
+	verbose bool
+	// prefixNames labels events with the resource they are about, for runs
+	// checking several, and prefixNamespaces with its namespace too.
+	prefixNames      bool
+	prefixNamespaces bool
+}
+
+// OnConditionChange prints nothing: the wait logs every transition with the
+// state before and after it.
+func (c consoleObserver) OnConditionChange(conditionTransition) {}
+
+func (c consoleObserver) OnEvent(event *corev1.Event) {
+	console.event(event, c.prefixNames, c.prefixNamespaces)
+}
+
+func (c consoleObserver) OnPhaseChange(phase string) {
+	console.setPhase(phase)
+	if c.verbose {
+		printPhase(phase)
+	}
+}
+
+func printPhase(phase string) {
+	console.infof("Phase: %s", phase)
+}
+
+func (consoleObserver) OnResult(result *checkResult) {
+	console.result(result)
+}
@@ -0,0 +1,708 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// options holds everything configurable from the command line. The same set
+// of flags is shared by the normal run and by subcommands such as rbac, which
+// need to know which features a run would enable.
+type options struct {
+	// namespace is one namespace or several comma-separated ones, and
+	// allNamespaces looks in every namespace instead.
+	namespace     string
+	allNamespaces bool
+	kind          string
+	apiVersion    string
+	// refreshDiscovery queries discovery afresh for every lookup.
+	refreshDiscovery bool
+	// minVersion makes the run fail with exitOutdated when the binary is
+	// older.
+	minVersion string
+	// redactPatterns mask sensitive parts of provider messages.
+	redactPatterns regexpListFlag
+	// consecutiveReady is how many Ready observations in a row are
+	// required, smoothing over caching proxies.
+	consecutiveReady int
+	requireExists    bool
+	// minRefreshTime, parsed from minRefreshTimeRaw, requires a refresh
+	// after it on top of Ready.
+	minRefreshTimeRaw string
+	minRefreshTime    time.Time
+	waitForGeneration bool
+	forceSync         bool
+	names             nameListFlag
+	selector          string
+	uid               string
+	onUIDChange       string
+	compareWith       string
+	csvReport         string
+	resultFile        string
+	metricsTextfile   string
+	csvTransitions    string
+	logAPICalls       bool
+	stateFile         string
+	skipAnnotation    string
+	honorSkip         bool
+
+	// fromFile is -from-file, and waitList its entries once validated.
+	fromFile string
+	waitList []waitEntry
+
+	watchTargetSecret bool
+
+	maxWaitForPass time.Duration
+	maxSyncLatency time.Duration
+
+	clusterName string
+	clusters    clusterListFlag
+	kube        kubeconfigSource
+	labels      keyValueFlag
+
+	failOnConditions    conditionMatchFlag
+	requirements        requirementFlag
+	failFast            bool
+	fatalReasons        fatalRuleFlag
+	waitOnTemplateError bool
+	waitOnDenied        bool
+
+	timeout           time.Duration
+	interval          time.Duration
+	adaptiveTimeout   bool
+	perCallTimeout    time.Duration
+	splay             time.Duration
+	unreconciledAfter time.Duration
+	noProgressAfter   time.Duration
+	checkController   bool
+	heartbeat         time.Duration
+	// waitFor is -wait-for: Ready, or the deletion of the resource.
+	waitFor             string
+	includeTargetSecret bool
+	maxConditionAge     time.Duration
+	onOldCondition      string
+	watchIdleTimeout    time.Duration
+	watchMode           string
+	eventHistory        int
+	enforce             bool
+	checkStore          bool
+	revalidateStore     bool
+	startupBudget       time.Duration
+	checkBudgets        checkBudgetFlag
+	strictBudgets       bool
+	// killSwitchConfigMap is the namespace/name of the ConfigMap that
+	// bypasses the gate.
+	killSwitchConfigMap string
+	discoveryWindow     time.Duration
+	// concurrency limits how many resources are checked at once.
+	concurrency int
+	// listChunkSize is how many resources each page of discovery lists.
+	listChunkSize int64
+	// prioritySelector, parsed into priority, selects the discovered
+	// resources checked first.
+	prioritySelector string
+	priority         labels.Selector
+
+	skipFreshness          bool
+	clockSkewTolerance     time.Duration
+	minKeys                int
+	requireKeys            nameListFlag
+	requireNonEmpty        bool
+	verifyTemplateMetadata bool
+
+	verbose          bool
+	output           string
+	timeFormat       string
+	progressTemplate string
+	progress         *template.Template
+	durationFormat   string
+	dryRun           bool
+	// readOnly guarantees that the run cannot mutate the cluster.
+	readOnly bool
+
+	captureTransitions int
+	captureFile        string
+	record             string
+	recordMaxSizeRaw   string
+	recordMaxSize      int64
+	maxMemory          string
+	notifySocket       string
+	ndjsonFile         string
+	// idempotencyKey identifies the logical run across retries, so that a
+	// retried step does not notify the same failure twice.
+	idempotencyKey    string
+	idempotencyWindow time.Duration
+
+	// simulate is the hidden -simulate flag, producing a canned outcome
+	// without cluster access to rehearse pipelines.
+	simulate   string
+	simulation simulation
+
+	// fromEnv holds the flags set through their envFlags variable.
+	fromEnv map[string]bool
+}
+
+// hiddenFlags are accepted but left out of the usage message.
+var hiddenFlags = map[string]bool{"simulate": true}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.namespace, "namespace", "", "Namespace of the ExternalSecret; several comma-separated namespaces are checked together")
+	fs.BoolVar(&o.allNamespaces, "all-namespaces", false, "Check the ExternalSecrets matching -name or -selector in every namespace")
+	fs.StringVar(&o.apiVersion, "api-version", "", "Version of the external-secrets.io API to read, such as v1 or v1beta1 (defaults to the preferred version the cluster serves)")
+	fs.BoolVar(&o.refreshDiscovery, "refresh-discovery", false, "Query API discovery afresh for every version lookup instead of once per run, for API servers whose served groups change while it runs")
+	fs.Var(&o.redactPatterns, "redact-pattern", "Mask matches of this regexp in condition messages, event messages and hints before any output (repeatable)")
+	fs.StringVar(&o.minVersion, "min-version", "", fmt.Sprintf("Exit with code %d if this binary is older than this version, such as v1.4.0", exitOutdated))
+	fs.StringVar(&o.kind, "kind", "ExternalSecret", "Kind of resource to wait for: "+kindNames)
+	fs.StringVar(&o.selector, "selector", "", "Wait for every ExternalSecret in the namespace matching this label selector instead of -name")
+	fs.DurationVar(&o.discoveryWindow, "discovery-window", 30*time.Second, "How long -selector keeps picking up newly created ExternalSecrets before the set is frozen")
+	fs.Int64Var(&o.listChunkSize, "list-chunk-size", 500, "How many resources each request of -selector and -all-namespaces discovery lists, paging through larger namespaces")
+	fs.IntVar(&o.concurrency, "concurrency", 0, "How many resources to check at once in runs checking several, taking turns across namespaces (0 checks them all at once)")
+	fs.StringVar(&o.prioritySelector, "priority-selector", "", "Label selector of the critical resources among those discovered: they are checked first, their results printed as they complete, and with -fail-fast one failing ends the run even where failures are otherwise isolated")
+	fs.Var(&o.names, "name", "Name of the ExternalSecret; several comma-separated or repeated names are waited for together")
+	fs.StringVar(&o.fromFile, "from-file", "", "Wait for the resources listed in this YAML file, or stdin with \"-\", instead of -name: a list of entries with namespace, name and optional kind, requireKeys and timeout, or the lines of kubectl get -o name")
+	fs.StringVar(&o.uid, "uid", "", "UID of the ExternalSecret; a resource with the same name but another UID means the original was replaced")
+	fs.StringVar(&o.onUIDChange, "on-uid-change", uidChangeFail, "What to do when -uid no longer matches: fail, or rebind to the new object")
+	fs.StringVar(&o.compareWith, "compare-with", "", "Also wait for this ExternalSecret (namespace/name) and require both target Secrets to have the same keys")
+	fs.StringVar(&o.csvReport, "csv-report", "", "Write a CSV row per checked resource to this file")
+	fs.StringVar(&o.resultFile, "result-file", "", "Write the result as JSON to this file on exit: an object, or an array when checking several resources")
+	fs.StringVar(&o.metricsTextfile, "metrics-textfile", "", "Write the results in Prometheus textfile collector format to this file on exit")
+	fs.StringVar(&o.csvTransitions, "csv-transitions", "", "Write a CSV row per observed condition transition to this file")
+	fs.BoolVar(&o.logAPICalls, "log-api-calls", false, "Log every API request (method, path, code, latency) and summarize them at the end")
+	fs.StringVar(&o.skipAnnotation, "skip-annotation", "statuschecker.io/skip", "Annotation that exempts a resource from the check when set to \"true\"")
+	fs.BoolVar(&o.honorSkip, "honor-skip", false, "Honor the skip annotation even for a single resource requested by name")
+	fs.BoolVar(&o.watchTargetSecret, "watch-target-secret", false, "Also watch the target Secret to attribute slow readiness to the Secret or the status")
+	fs.DurationVar(&o.maxWaitForPass, "max-wait-for-pass", 0, "Fail with slo-violated if Ready took longer than this to observe (0 disables)")
+	fs.DurationVar(&o.maxSyncLatency, "max-sync-latency", 0, "Fail with slo-violated if the sync latency since creation exceeds this (0 disables)")
+	fs.StringVar(&o.clusterName, "cluster-name", "", "Name of the cluster attached to all reports (defaults to the kubeconfig context or API server host)")
+	o.kube.register(fs)
+	fs.Var(&o.clusters, "cluster", "Kubeconfig context to check in, as context=NAME (repeatable, several are checked concurrently)")
+	o.labels = keyValueFlag{}
+	fs.Var(o.labels, "label", "Label attached to all reports as key=value (repeatable)")
+	fs.Var(&o.requirements, "for", "Condition the wait requires instead of Ready=True, as Type, Type=Status or Type!=Status, optional when suffixed with ? (repeatable, all must hold at once)")
+	fs.Var(&o.failOnConditions, "fail-on-condition", "Abort the wait when a condition has the given status, as Type=Status (repeatable, e.g. Deleted=True)")
+	fs.BoolVar(&o.failFast, "fail-fast", true, "Abort the wait when Ready=False has a reason that never recovers on its own, such as a missing SecretStore")
+	fs.Var(&o.fatalReasons, "fatal-reason", "Ready=False reason treated as fatal by -fail-fast, as Reason or Reason=message-regexp (repeatable, added to the defaults)")
+	fs.BoolVar(&o.waitOnDenied, "wait-on-denied", false, "Keep waiting, with backoff, when the checker is denied access instead of failing right away, for runs that start before their RBAC is applied")
+	fs.BoolVar(&o.waitOnTemplateError, "wait-on-template-error", false, "Keep waiting when a condition reports a template error instead of failing right away")
+	fs.DurationVar(&o.timeout, "timeout", 10*time.Minute, "Overall deadline of the run (env ESC_TIMEOUT)")
+	fs.DurationVar(&o.interval, "interval", defaultPollInterval, "How often the ExternalSecret is checked while waiting (env ESC_INTERVAL)")
+	fs.BoolVar(&o.requireExists, "require-exists", false, fmt.Sprintf("Fail once the ExternalSecret was not found %d times in a row, instead of waiting for it to be created", requireExistsPolls))
+	fs.StringVar(&o.minRefreshTimeRaw, "min-refresh-time", "", "Also require status.refreshTime to be after this RFC 3339 timestamp, or after the start of the checker with \"now\"")
+	fs.BoolVar(&o.forceSync, "force-sync", false, "Set the force-sync annotation before waiting, then wait for a refresh after it on top of Ready")
+	fs.BoolVar(&o.waitForGeneration, "wait-for-generation", false, "Also require the status to be for the current metadata.generation, so unreconciled spec changes do not pass")
+	fs.IntVar(&o.consecutiveReady, "consecutive-ready-polls", 1, "Require Ready on this many consecutive checks, -interval apart, before the wait succeeds")
+	fs.BoolVar(&o.adaptiveTimeout, "adaptive-timeout", false, "Derive the timeout from the waits recorded in -state-file, never exceeding -timeout")
+	fs.DurationVar(&o.perCallTimeout, "per-call-timeout", 10*time.Second, "Timeout of each individual Get/List request")
+	fs.DurationVar(&o.unreconciledAfter, "unreconciled-after", 30*time.Second, "Diagnose the resource as never reconciled when it has no status conditions for this long")
+	fs.DurationVar(&o.noProgressAfter, "no-progress-after", time.Minute, "Warn that the controller may not be running when the resource has had neither status conditions nor events for this long")
+	fs.DurationVar(&o.maxConditionAge, "max-condition-age", 0, "Distrust a Ready condition whose lastTransitionTime, refreshTime and target Secret are all older than this, a status frozen in time (0 disables)")
+	fs.StringVar(&o.onOldCondition, "on-old-condition", oldConditionFail, "What to do with a status older than -max-condition-age: fail, or wait for a fresh sync")
+	fs.StringVar(&o.waitFor, "wait-for", waitForReady, "What to wait for: ready, or deleted for the resource to be gone, such as during a teardown")
+	fs.BoolVar(&o.includeTargetSecret, "include-target-secret", false, "With -wait-for=deleted, also wait for the target Secret to be gone")
+	fs.DurationVar(&o.heartbeat, "heartbeat-interval", 30*time.Second, "Print the progress at least this often while the conditions do not change; changes are printed as they happen")
+	fs.BoolVar(&o.checkController, "check-controller", false, "Then also look for the controller pods ("+controllerSelector+") in every namespace and report whether any is Running")
+	fs.DurationVar(&o.splay, "splay", 0, "Delay the start by a random duration within this window, seeded from POD_UID, POD_NAME or HOSTNAME when set")
+	fs.DurationVar(&o.startupBudget, "startup-budget", 0, "Warn when the startup until the first successful Get takes longer than this, splay aside (0 disables)")
+	o.checkBudgets = checkBudgetFlag{}
+	fs.Var(o.checkBudgets, "check-budget", "Warn when a check takes longer than its budget, as name=duration with name one of "+strings.Join(checkNames, ", ")+" (repeatable)")
+	fs.BoolVar(&o.strictBudgets, "strict-budgets", false, "Fail with slo-violated when a check exceeds its -check-budget, instead of only warning")
+	fs.BoolVar(&o.checkStore, "check-store", false, "Fail right away when the SecretStore or ClusterSecretStore the ExternalSecret refers to is missing or not Ready")
+	fs.BoolVar(&o.revalidateStore, "revalidate-store", false, fmt.Sprintf("With -check-store, have the store re-validated first by setting its %s annotation, waiting up to %s for its Ready condition to be re-evaluated; skipped with a warning before external-secrets %s", storeValidationAnnotation, storeRevalidateTimeout, storeValidationVersion))
+	fs.StringVar(&o.killSwitchConfigMap, "killswitch-configmap", "", "ConfigMap (namespace/name) read at the start and every "+killSwitchInterval.String()+" of the wait; bypass=true in it passes the gate with exit 0. Reading it needs get on it; read failures mean no bypass")
+	fs.BoolVar(&o.enforce, "enforce", true, "Fail the run on failures; with -enforce=false they are reported in full, but the run exits 0")
+	fs.IntVar(&o.eventHistory, "event-history", 10, "How many of the events recorded before the start to print, and of the recent Warning events to print when the wait fails (0 disables both)")
+	fs.StringVar(&o.watchMode, "watch-mode", watchModeAuto, "How the wait follows the resource: auto watches and falls back to polling for the rest of the run once the API server rejects a watch, watch fails instead, and poll never watches")
+	fs.DurationVar(&o.watchIdleTimeout, "watch-idle-timeout", 5*time.Minute, "Re-establish event watches after this long, instead of bounding them by -per-call-timeout")
+	fs.BoolVar(&o.verifyTemplateMetadata, "verify-template-metadata", false, "Fail if the target Secret lacks labels or annotations of spec.target.template.metadata")
+	fs.IntVar(&o.minKeys, "min-keys", 0, "Fail if the target Secret of a Ready resource has fewer data keys than this (0 disables)")
+	fs.Var(&o.requireKeys, "require-keys", "Fail if the target Secret of a Ready resource lacks any of these data keys (comma-separated, repeatable)")
+	fs.BoolVar(&o.requireNonEmpty, "require-non-empty", false, "With -require-keys, also fail when a required key has an empty value")
+	fs.DurationVar(&o.clockSkewTolerance, "clock-skew-tolerance", 10*time.Second, "Clock skew allowed for when comparing cluster timestamps during freshness verification")
+	fs.BoolVar(&o.skipFreshness, "skip-freshness", false, "Accept Ready states without verifying refreshTime and the target Secret")
+	fs.StringVar(&o.output, "output", outputText, "Console output format: text, or json for one JSON object per line")
+	fs.StringVar(&o.timeFormat, "time-format", timeRFC3339, "How timestamps are shown in console output: relative, rfc3339 or unix")
+	fs.StringVar(&o.durationFormat, "duration-format", durationCompact, "How durations are shown in console output: compact (2m14s) or seconds (134s)")
+	fs.StringVar(&o.progressTemplate, "progress-template", defaultProgressTemplate, "Go text/template of the progress line, rendered with .Resource, .Conditions, .Elapsed, .Remaining, .Estimate and .EventCounts")
+	fs.BoolVar(&o.verbose, "verbose", false, "Print additional details such as API request statistics")
+	fs.BoolVar(&o.readOnly, "read-only", false, "Reject every mutating API request, and refuse flags that would need one")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Validate configuration, connectivity and RBAC, evaluate the target once, and exit without waiting")
+	fs.IntVar(&o.captureTransitions, "capture-transitions", 0, "Keep a redacted copy of the ExternalSecret at each of the last N condition transitions and print their differences")
+	fs.StringVar(&o.captureFile, "capture-file", "", "Write the captured transitions as JSON to this file (requires -capture-transitions)")
+	fs.StringVar(&o.record, "record", "", "Record the observed states, events, decisions and results to this gzip file for the replay subcommand")
+	fs.StringVar(&o.recordMaxSizeRaw, "record-max-size", "16Mi", fmt.Sprintf("Size at which the -record file is rotated, keeping %d older files", recordRotations))
+	fs.StringVar(&o.maxMemory, "max-memory", "", "Soft memory limit of the process, e.g. 24Mi; budgets under 32Mi also shrink the progress buffers")
+	fs.StringVar(&o.idempotencyKey, "idempotency-key", "", "Key of the logical run, such as the pipeline run ID, attached to notifications; a failure already notified under it is marked duplicate")
+	fs.DurationVar(&o.idempotencyWindow, "idempotency-window", time.Hour, "How long a failure notified under -idempotency-key suppresses the same failure")
+	fs.StringVar(&o.ndjsonFile, "ndjson-file", "", "Append the NDJSON progress records of -notify-socket and the final results to this file as they happen")
+	fs.StringVar(&o.notifySocket, "notify-socket", "", "Stream NDJSON progress and the final result to readers of this Unix socket, or of an existing named pipe")
+	fs.StringVar(&o.stateFile, "state-file", "", "Persist resource state to this file and report changes since the previous run")
+	fs.StringVar(&o.simulate, "simulate", "", "Skip cluster access and produce the given outcome, as outcome[:after-duration]")
+	fs.Usage = func() { printUsage(fs) }
+}
+
+// validate checks flag values that cannot be expressed by their types alone.
+func (o *options) validate() error {
+	if conflicts := readOnlyConflicts(o); o.readOnly && len(conflicts) > 0 {
+		return fmt.Errorf("-read-only cannot be combined with %s", strings.Join(conflicts, ", "))
+	}
+	if o.timeout <= 0 {
+		return errors.New("-timeout must be positive")
+	}
+	if len(o.fatalReasons) > 0 && !o.failFast {
+		return errors.New("-fatal-reason requires -fail-fast")
+	}
+	if o.interval <= 0 {
+		return errors.New("-interval must be positive")
+	}
+	if o.interval >= o.timeout {
+		return fmt.Errorf("-interval %s must be shorter than -timeout %s", o.interval, o.timeout)
+	}
+	if o.adaptiveTimeout && o.stateFile == "" {
+		return errors.New("-adaptive-timeout requires -state-file")
+	}
+	if o.perCallTimeout <= 0 {
+		return errors.New("-per-call-timeout must be positive")
+	}
+	if o.output != outputText && o.output != outputJSON {
+		return fmt.Errorf("-output must be %s or %s, not %q", outputText, outputJSON, o.output)
+	}
+	if !validTimeFormat(o.timeFormat) {
+		return fmt.Errorf("-time-format must be relative, rfc3339 or unix, not %q", o.timeFormat)
+	}
+	if !validDurationFormat(o.durationFormat) {
+		return fmt.Errorf("-duration-format must be compact or seconds, not %q", o.durationFormat)
+	}
+	if o.heartbeat <= 0 {
+		return errors.New("-heartbeat-interval must be positive")
+	}
+	if o.noProgressAfter <= 0 {
+		return errors.New("-no-progress-after must be positive")
+	}
+	if o.unreconciledAfter <= 0 {
+		return errors.New("-unreconciled-after must be positive")
+	}
+	if o.clockSkewTolerance < 0 {
+		return errors.New("-clock-skew-tolerance must not be negative")
+	}
+	if o.splay < 0 {
+		return errors.New("-splay must not be negative")
+	}
+	progress, err := parseProgressTemplate(o.progressTemplate)
+	if err != nil {
+		return fmt.Errorf("-progress-template: %w", err)
+	}
+	o.progress = progress
+	if o.compareWith != "" {
+		if _, _, err := parseResourceRef(o.compareWith, o.namespace); err != nil {
+			return fmt.Errorf("-compare-with: %w", err)
+		}
+	}
+	if o.killSwitchConfigMap != "" {
+		if _, _, err := parseResourceRef(o.killSwitchConfigMap, ""); err != nil {
+			return fmt.Errorf("-killswitch-configmap: %w", err)
+		}
+	}
+	if o.waitFor != waitForReady && o.waitFor != waitForDeleted {
+		return fmt.Errorf("-wait-for must be %s or %s, not %q", waitForReady, waitForDeleted, o.waitFor)
+	}
+	if o.includeTargetSecret && o.waitFor != waitForDeleted {
+		return errors.New("-include-target-secret requires -wait-for=deleted")
+	}
+	if o.waitFor == waitForDeleted {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"-selector", o.selector != ""},
+			{"-force-sync", o.forceSync},
+			{"-check-store", o.checkStore},
+			{"-compare-with", o.compareWith != ""},
+			{"-min-keys", o.minKeys > 0},
+			{"-require-keys", len(o.requireKeys) > 0},
+			{"-verify-template-metadata", o.verifyTemplateMetadata},
+			{"-max-condition-age", o.maxConditionAge > 0},
+		} {
+			if f.set {
+				return fmt.Errorf("%s does not apply to -wait-for=deleted", f.name)
+			}
+		}
+	}
+	if o.watchMode != watchModeAuto && o.watchMode != watchModeWatch && o.watchMode != watchModePoll {
+		return fmt.Errorf("-watch-mode must be %s, %s or %s, not %q", watchModeAuto, watchModeWatch, watchModePoll, o.watchMode)
+	}
+	if o.onOldCondition != oldConditionFail && o.onOldCondition != oldConditionWait {
+		return fmt.Errorf("-on-old-condition must be %s or %s, not %q", oldConditionFail, oldConditionWait, o.onOldCondition)
+	}
+	if o.maxConditionAge < 0 {
+		return errors.New("-max-condition-age must not be negative")
+	}
+	if o.onUIDChange != uidChangeFail && o.onUIDChange != uidChangeRebind {
+		return fmt.Errorf("-on-uid-change must be %s or %s, not %q", uidChangeFail, uidChangeRebind, o.onUIDChange)
+	}
+	if o.fromFile != "" {
+		switch {
+		case len(o.names) > 0 || o.selector != "":
+			return errors.New("-from-file is mutually exclusive with -name and -selector")
+		case o.allNamespaces:
+			return errors.New("-from-file is mutually exclusive with -all-namespaces")
+		case strings.Contains(o.namespace, ","):
+			return errors.New("-from-file takes a single -namespace, that of the entries naming none")
+		}
+		// The kind of the entries becomes that of the run
+		if err := o.loadWaitList(); err != nil {
+			return err
+		}
+	}
+	kind, ok := resourceKinds[o.kind]
+	if !ok {
+		return fmt.Errorf("-kind must be %s, not %q", kindNames, o.kind)
+	}
+	if kind.clusterScoped && (o.namespace != "" || o.allNamespaces) {
+		return fmt.Errorf("-namespace and -all-namespaces do not apply to the cluster-scoped %s", kind.name)
+	}
+	if o.allNamespaces && o.namespace != "" {
+		return errors.New("-namespace and -all-namespaces are mutually exclusive")
+	}
+	if o.allNamespaces && o.adaptiveTimeout {
+		return errors.New("-adaptive-timeout does not apply to -all-namespaces")
+	}
+	seenNamespaces := map[string]bool{}
+	for _, namespace := range o.namespaces() {
+		if seenNamespaces[namespace] {
+			return fmt.Errorf("-namespace %s is given twice", namespace)
+		}
+		seenNamespaces[namespace] = true
+	}
+	if err := o.kube.validate(); err != nil {
+		return err
+	}
+	if len(o.clusters) > 0 && (o.kube.context != "" || o.kube.inCluster) {
+		return errors.New("-cluster is mutually exclusive with -context and -in-cluster")
+	}
+	if o.severalClusters() {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"-cluster-name", o.clusterName != ""},
+			{"-uid", o.uid != ""},
+			{"-state-file", o.stateFile != ""},
+			{"-record", o.record != ""},
+			{"-capture-transitions", o.captureTransitions > 0},
+			{"-simulate", o.simulate != ""},
+		} {
+			if f.set {
+				return fmt.Errorf("%s does not apply to several -cluster contexts", f.name)
+			}
+		}
+	}
+	if !kind.hasTarget {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"-min-keys", o.minKeys > 0},
+			{"-require-keys", len(o.requireKeys) > 0},
+			{"-verify-template-metadata", o.verifyTemplateMetadata},
+			{"-compare-with", o.compareWith != ""},
+			{"-watch-target-secret", o.watchTargetSecret},
+			{"-force-sync", o.forceSync},
+			{"-include-target-secret", o.includeTargetSecret},
+		} {
+			if f.set {
+				return fmt.Errorf("%s needs a target Secret, which a %s does not have", f.name, kind.name)
+			}
+		}
+	}
+	if o.revalidateStore && !o.checkStore {
+		return errors.New("-revalidate-store requires -check-store")
+	}
+	if o.checkStore && kind.name != "ExternalSecret" {
+		return fmt.Errorf("-check-store applies to ExternalSecrets, not to a %s", kind.name)
+	}
+	if !kind.refreshes && o.maxConditionAge > 0 {
+		return fmt.Errorf("-max-condition-age needs a status.refreshTime, which a %s does not report", kind.name)
+	}
+	if !kind.refreshes && (o.minRefreshTimeRaw != "" || o.waitForGeneration) {
+		return fmt.Errorf("-min-refresh-time and -wait-for-generation need a status.refreshTime, which a %s does not report", kind.name)
+	}
+	if o.minRefreshTimeRaw != "" {
+		t, err := parseMinRefreshTime(o.minRefreshTimeRaw, time.Now())
+		if err != nil {
+			return fmt.Errorf("-min-refresh-time: %w", err)
+		}
+		o.minRefreshTime = t
+	}
+	if o.requireNonEmpty && !o.requiresKeys() {
+		return errors.New("-require-non-empty requires -require-keys")
+	}
+	if o.consecutiveReady < 1 {
+		return errors.New("-consecutive-ready-polls must be at least 1")
+	}
+	if o.idempotencyWindow <= 0 {
+		return errors.New("-idempotency-window must be positive")
+	}
+	if o.minKeys < 0 {
+		return errors.New("-min-keys must not be negative")
+	}
+	if o.captureTransitions < 0 {
+		return errors.New("-capture-transitions must not be negative")
+	}
+	if o.record != "" {
+		q, err := resource.ParseQuantity(o.recordMaxSizeRaw)
+		if err != nil || q.Sign() <= 0 {
+			return fmt.Errorf("-record-max-size must be a positive size such as 16Mi, not %q", o.recordMaxSizeRaw)
+		}
+		o.recordMaxSize = q.Value()
+	}
+	if o.captureFile != "" && o.captureTransitions == 0 {
+		return errors.New("-capture-file requires -capture-transitions")
+	}
+	if o.listChunkSize <= 0 {
+		return errors.New("-list-chunk-size must be positive")
+	}
+	if o.concurrency < 0 {
+		return errors.New("-concurrency must not be negative")
+	}
+	if o.eventHistory < 0 {
+		return errors.New("-event-history must not be negative")
+	}
+	if o.watchIdleTimeout < time.Second {
+		return errors.New("-watch-idle-timeout must be at least 1s")
+	}
+	if o.selector != "" {
+		if _, err := labels.Parse(o.selector); err != nil {
+			return fmt.Errorf("-selector: %w", err)
+		}
+		if o.discoveryWindow < 0 {
+			return errors.New("-discovery-window must not be negative")
+		}
+		if o.adaptiveTimeout {
+			return errors.New("-adaptive-timeout requires -name")
+		}
+	}
+	if o.prioritySelector != "" {
+		if !o.discovers() {
+			return errors.New("-priority-selector requires -selector or -all-namespaces")
+		}
+		priority, err := labels.Parse(o.prioritySelector)
+		if err != nil {
+			return fmt.Errorf("-priority-selector: %w", err)
+		}
+		o.priority = priority
+	}
+	if o.several() {
+		if err := o.singleNameConflicts(); err != nil {
+			return err
+		}
+	}
+	if o.simulate != "" {
+		sim, err := parseSimulation(o.simulate)
+		if err != nil {
+			return fmt.Errorf("-simulate: %w", err)
+		}
+		o.simulation = sim
+	}
+	return nil
+}
+
+// namespaces returns the namespaces of -namespace, or of the -from-file
+// entries, none with -all-namespaces or for cluster-scoped kinds.
+func (o *options) namespaces() []string {
+	var namespaces []string
+	if o.waitList != nil {
+		seen := map[string]bool{}
+		for _, entry := range o.waitList {
+			if entry.Namespace != "" && !seen[entry.Namespace] {
+				seen[entry.Namespace] = true
+				namespaces = append(namespaces, entry.Namespace)
+			}
+		}
+		return namespaces
+	}
+	for _, namespace := range strings.Split(o.namespace, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// severalNamespaces reports whether the run may check resources in more
+// than one namespace.
+func (o *options) severalNamespaces() bool {
+	return o.allNamespaces || len(o.namespaces()) > 1
+}
+
+// severalClusters reports whether the run fans out to several kubeconfig
+// contexts.
+func (o *options) severalClusters() bool {
+	return len(o.clusters) > 1
+}
+
+// several reports whether the run may check more than one resource.
+func (o *options) several() bool {
+	return len(o.names) > 1 || o.selector != "" || o.fromFile != "" || o.severalNamespaces()
+}
+
+// honoredSkipAnnotation returns the skip annotation the run honors: that of
+// -skip-annotation in batch and selector modes, but none for a single
+// resource requested by name, asked for on purpose, unless -honor-skip is
+// given.
+func (o *options) honoredSkipAnnotation() string {
+	if o.several() || o.honorSkip {
+		return o.skipAnnotation
+	}
+	return ""
+}
+
+// requested returns the resources requested up front: every -name in every
+// namespace, or the entries of -from-file.
+func (o *options) requested() []types.NamespacedName {
+	var requested []types.NamespacedName
+	if o.waitList != nil {
+		for _, entry := range o.waitList {
+			requested = append(requested, types.NamespacedName{Namespace: entry.Namespace, Name: entry.Name})
+		}
+		return requested
+	}
+	namespaces := o.namespaces()
+	if o.resourceKind().clusterScoped {
+		namespaces = []string{""}
+	}
+	for _, namespace := range namespaces {
+		for _, name := range o.names {
+			requested = append(requested, types.NamespacedName{Namespace: namespace, Name: name})
+		}
+	}
+	return requested
+}
+
+// discovers reports whether the resources to check are found by listing
+// rather than named up front.
+func (o *options) discovers() bool {
+	return o.selector != "" || o.allNamespaces
+}
+
+// prioritized reports whether a resource with the given labels matches
+// -priority-selector.
+func (o *options) prioritized(resourceLabels map[string]string) bool {
+	return o.priority != nil && o.priority.Matches(labels.Set(resourceLabels))
+}
+
+// scope describes where the run looks for resources, for messages.
+func (o *options) scope() string {
+	namespaces := o.namespaces()
+	switch {
+	case o.allNamespaces:
+		return "all namespaces"
+	case len(namespaces) == 1:
+		return "namespace " + namespaces[0]
+	}
+	return "namespaces " + strings.Join(namespaces, ", ")
+}
+
+// fatalRules are the rules -fail-fast applies, or none when it is off.
+func (o *options) fatalRules() []fatalRule {
+	if !o.failFast {
+		return nil
+	}
+	return append(append([]fatalRule{}, defaultFatalRules...), o.fatalReasons...)
+}
+
+// envFlags are the flags that may also be set through environment
+// variables, for instance from a ConfigMap. Flags on the command line take
+// precedence.
+var envFlags = map[string]string{
+	"timeout":  "ESC_TIMEOUT",
+	"interval": "ESC_INTERVAL",
+}
+
+// applyEnv sets the options of envFlags that are not given on the command
+// line, setFlags, from their environment variables.
+func (o *options) applyEnv(setFlags map[string]bool) error {
+	targets := map[string]*time.Duration{"timeout": &o.timeout, "interval": &o.interval}
+	for name, env := range envFlags {
+		value := os.Getenv(env)
+		if setFlags[name] || value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		*targets[name] = d
+		if o.fromEnv == nil {
+			o.fromEnv = map[string]bool{}
+		}
+		o.fromEnv[name] = true
+	}
+	return nil
+}
+
+// origin tells where the value of the named flag came from.
+func (o *options) origin(setFlags map[string]bool, name string) string {
+	switch {
+	case setFlags[name]:
+		return originFlag
+	case o.fromEnv[name]:
+		return originEnv
+	default:
+		return originDefault
+	}
+}
+
+// singleNameConflicts rejects the flags that only make sense for a single
+// ExternalSecret when several names or a selector are given.
+func (o *options) singleNameConflicts() error {
+	seen := map[string]bool{}
+	for _, name := range o.names {
+		if seen[name] {
+			return fmt.Errorf("-name %s is given twice", name)
+		}
+		seen[name] = true
+	}
+	switch {
+	case o.uid != "":
+		return errors.New("-uid requires a single -name")
+	case o.compareWith != "":
+		return errors.New("-compare-with requires a single -name")
+	case o.captureTransitions > 0:
+		return errors.New("-capture-transitions requires a single -name")
+	case o.simulate != "":
+		return errors.New("-simulate requires a single -name")
+	}
+	return nil
+}
+
+// printUsage prints the flag defaults of fs, leaving out the hidden flags.
+func printUsage(fs *flag.FlagSet) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+	visible.PrintDefaults()
+	fmt.Fprintln(fs.Output())
+	printReasonCodes(fs.Output())
+	fmt.Fprintln(fs.Output())
+	printExitCodes(fs.Output())
+}
+
+// resourceKind returns the kind of -kind, the zero kind if it is unknown.
+func (o *options) resourceKind() resourceKind {
+	return resourceKinds[o.kind]
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHonoredSkipAnnotation(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-namespace=apps", "-name=db"}, ""},
+		{[]string{"-namespace=apps", "-name=db", "-honor-skip"}, "statuschecker.io/skip"},
+		{[]string{"-namespace=apps", "-name=db,cache"}, "statuschecker.io/skip"},
+		{[]string{"-namespace=apps,jobs", "-name=db"}, "statuschecker.io/skip"},
+		{[]string{"-namespace=apps", "-selector=app=db"}, "statuschecker.io/skip"},
+		{[]string{"-all-namespaces", "-selector=app=db", "-skip-annotation=example.com/skip"}, "example.com/skip"},
+	}
+	list := filepath.Join(t.TempDir(), "list.yaml")
+	if err := os.WriteFile(list, []byte("- apps/db\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests = append(tests, struct {
+		args []string
+		want string
+	}{[]string{"-from-file=" + list}, "statuschecker.io/skip"})
+	for _, tt := range tests {
+		if got := parseTestOptions(t, tt.args...).honoredSkipAnnotation(); got != tt.want {
+			t.Errorf("%q: honoredSkipAnnotation() = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestPrioritySelector(t *testing.T) {
+	opts := parseTestOptions(t, "-all-namespaces", "-selector=app", "-priority-selector=tier=critical")
+	if !opts.prioritized(map[string]string{"app": "db", "tier": "critical"}) || opts.prioritized(map[string]string{"app": "web"}) {
+		t.Error("-priority-selector=tier=critical does not select exactly the critical resources")
+	}
+	if parseTestOptions(t, "-namespace=apps", "-selector=app").prioritized(map[string]string{"tier": "critical"}) {
+		t.Error("a resource is prioritized without -priority-selector")
+	}
+	for _, args := range [][]string{
+		{"-namespace=apps", "-name=db,cache", "-priority-selector=tier=critical"},
+		{"-namespace=apps", "-selector=app", "-priority-selector=tier in (critical"},
+	} {
+		if _, err := validateTestOptions(t, args...); err == nil {
+			t.Errorf("%q: validate() succeeded, want an error", args)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import "strings"
+
+// permission is a single RBAC rule the checker needs for one of its features.
+type permission struct {
+	Group         string
+	Resource      string
+	Verbs         []string
+	ClusterScoped bool
+	// Feature names what the permission is used for.
+	Feature string
+	// Namespace and Name, when set, restrict the permission to one object,
+	// rather than to the resource in each namespace of -namespace.
+	Namespace string
+	Name      string
+	// enabled reports whether the feature is active for the given options.
+	enabled func(o *options) bool
+	// object returns the namespace and name of the one object the
+	// permission is needed on, nil for permissions on the whole resource.
+	object func(o *options) (string, string)
+}
+
+func always(*options) bool { return true }
+
+// permissions is the single source of truth for the API access each feature
+// performs. Both the rbac subcommand and the SelfSubjectAccessReview
+// pre-flight derive from this table so that they cannot drift apart; add a
+// row whenever a feature starts calling a new verb or resource.
+var permissions = []permission{
+	{
+		Group:    "external-secrets.io",
+		Resource: "externalsecrets",
+		Verbs:    []string{"get"},
+		Feature:  "readiness check",
+		enabled:  always,
+	},
+	{
+		Group:    "external-secrets.io",
+		Resource: "externalsecrets",
+		Verbs:    []string{"watch"},
+		Feature:  "readiness watch (polls without it)",
+		enabled:  func(o *options) bool { return o.watchMode != watchModePoll },
+	},
+	{
+		Group:    "external-secrets.io",
+		Resource: "externalsecrets",
+		Verbs:    []string{"patch"},
+		Feature:  "notification deduplication",
+		enabled:  func(o *options) bool { return o.idempotencyKey != "" },
+	},
+	{
+		Group:    "external-secrets.io",
+		Resource: "externalsecrets",
+		Verbs:    []string{"patch"},
+		Feature:  "forced sync",
+		enabled:  func(o *options) bool { return o.forceSync },
+	},
+	{
+		Group:    "external-secrets.io",
+		Resource: "externalsecrets",
+		Verbs:    []string{"list"},
+		Feature:  "discovery by label selector or across namespaces",
+		enabled:  func(o *options) bool { return o.discovers() },
+	},
+	{
+		Group:    "external-secrets.io",
+		Resource: "secretstores",
+		Verbs:    []string{"get"},
+		Feature:  "store check",
+		enabled:  func(o *options) bool { return o.checkStore },
+	},
+	{
+		Group:         "external-secrets.io",
+		Resource:      "clustersecretstores",
+		Verbs:         []string{"get"},
+		ClusterScoped: true,
+		Feature:       "store check",
+		enabled:       func(o *options) bool { return o.checkStore },
+	},
+	{
+		Group:    "external-secrets.io",
+		Resource: "secretstores",
+		Verbs:    []string{"patch"},
+		Feature:  "store revalidation",
+		enabled:  func(o *options) bool { return o.revalidateStore },
+	},
+	{
+		Group:         "external-secrets.io",
+		Resource:      "clustersecretstores",
+		Verbs:         []string{"patch"},
+		ClusterScoped: true,
+		Feature:       "store revalidation",
+		enabled:       func(o *options) bool { return o.revalidateStore },
+	},
+	{
+		Resource: "configmaps",
+		Verbs:    []string{"get"},
+		Feature:  "kill switch",
+		enabled:  func(o *options) bool { return o.killSwitchConfigMap != "" },
+		object: func(o *options) (string, string) {
+			namespace, name, _ := parseResourceRef(o.killSwitchConfigMap, "")
+			return namespace, name
+		},
+	},
+	{
+		Resource: "events",
+		Verbs:    []string{"list", "watch"},
+		Feature:  "event streaming",
+		enabled:  always,
+	},
+	{
+		Resource:      "pods",
+		Verbs:         []string{"list"},
+		ClusterScoped: true,
+		Feature:       "controller check",
+		enabled:       func(o *options) bool { return o.checkController },
+	},
+	{
+		Resource:      "pods",
+		Verbs:         []string{"list"},
+		ClusterScoped: true,
+		Feature:       "external-secrets release detection for store revalidation",
+		enabled:       func(o *options) bool { return o.revalidateStore },
+	},
+	{
+		Resource:      "namespaces",
+		Verbs:         []string{"get", "watch"},
+		ClusterScoped: true,
+		Feature:       "namespace wait",
+		enabled:       func(o *options) bool { return !o.resourceKind().clusterScoped },
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"get"},
+		Feature:  "freshness verification",
+		enabled:  func(o *options) bool { return !o.skipFreshness && o.resourceKind().hasTarget },
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"get"},
+		Feature:  "state file data hash",
+		enabled:  func(o *options) bool { return o.stateFile != "" && o.resourceKind().hasTarget },
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"get"},
+		Feature:  "bound secret summary",
+		enabled:  func(o *options) bool { return o.resourceKind().hasTarget },
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"get"},
+		Feature:  "minimum key count",
+		enabled:  func(o *options) bool { return o.minKeys > 0 },
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"get"},
+		Feature:  "required keys",
+		enabled:  func(o *options) bool { return o.requiresKeys() },
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"get"},
+		Feature:  "template metadata verification",
+		enabled:  func(o *options) bool { return o.verifyTemplateMetadata },
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"get"},
+		Feature:  "target Secret comparison",
+		enabled:  func(o *options) bool { return o.compareWith != "" },
+	},
+	{
+		Group:    "external-secrets.io",
+		Resource: "externalsecrets",
+		Verbs:    []string{"get"},
+		Feature:  "compared ExternalSecret wait",
+		enabled:  func(o *options) bool { return o.compareWith != "" },
+		object:   compareObject,
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"get"},
+		Feature:  "compared target Secret",
+		enabled:  func(o *options) bool { return o.compareWith != "" },
+		// The name of the target Secret is only known once the compared
+		// ExternalSecret is read
+		object: func(o *options) (string, string) {
+			namespace, _ := compareObject(o)
+			return namespace, ""
+		},
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"get"},
+		Feature:  "condition age check",
+		enabled:  func(o *options) bool { return o.maxConditionAge > 0 && o.resourceKind().hasTarget },
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"get"},
+		Feature:  "target Secret deletion",
+		enabled:  func(o *options) bool { return o.includeTargetSecret },
+	},
+	{
+		Resource: "secrets",
+		Verbs:    []string{"watch"},
+		Feature:  "target Secret lag attribution",
+		enabled:  func(o *options) bool { return o.watchTargetSecret },
+	},
+}
+
+// compareObject is the ExternalSecret of -compare-with, in the namespace of
+// -namespace unless it names one.
+func compareObject(o *options) (string, string) {
+	namespace, name, _ := parseResourceRef(o.compareWith, o.namespace)
+	return namespace, name
+}
+
+// requiredPermissions returns the permissions used by a run with the given
+// options, merging verbs of rows that share a group and resource. The
+// externalsecrets rows apply to the resource of -kind; for a cluster-scoped
+// kind every permission is granted cluster-wide, the events of such
+// resources living in the default namespace, and so it is with
+// -all-namespaces. Permissions on one object, such as the kill-switch
+// ConfigMap, stay in the namespace of that object.
+func requiredPermissions(o *options) []permission {
+	var required []permission
+	index := map[string]int{}
+	kind := o.resourceKind()
+	for _, p := range permissions {
+		if !p.enabled(o) {
+			continue
+		}
+		if p.Resource == externalSecretGVR.Resource && kind.name != "" {
+			p.Resource = kind.gvr.Resource
+		}
+		if p.object != nil {
+			p.Namespace, p.Name = p.object(o)
+		} else if kind.clusterScoped || o.allNamespaces {
+			p.ClusterScoped = true
+		}
+		key := p.Group + "/" + p.Resource + "/" + p.Namespace + "/" + p.Name
+		if i, ok := index[key]; ok {
+			required[i].Verbs = mergeVerbs(required[i].Verbs, p.Verbs)
+			required[i].Feature += ", " + p.Feature
+			continue
+		}
+		index[key] = len(required)
+		p.Verbs = append([]string(nil), p.Verbs...)
+		required = append(required, p)
+	}
+	return required
+}
+
+func mergeVerbs(verbs, extra []string) []string {
+	for _, verb := range extra {
+		found := false
+		for _, existing := range verbs {
+			if strings.EqualFold(existing, verb) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			verbs = append(verbs, verb)
+		}
+	}
+	return verbs
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// killSwitchPermission returns the kill-switch row of the permissions
+// required by opts, if any.
+func killSwitchPermission(opts *options) (permission, bool) {
+	for _, p := range requiredPermissions(opts) {
+		if p.Resource == "configmaps" {
+			return p, true
+		}
+	}
+	return permission{}, false
+}
+
+func TestKillSwitchPermission(t *testing.T) {
+	if _, ok := killSwitchPermission(parseTestOptions(t, "-namespace=apps", "-name=db")); ok {
+		t.Error("configmaps get is required without -killswitch-configmap")
+	}
+	for _, args := range [][]string{
+		{"-namespace=apps", "-name=db"},
+		{"-all-namespaces", "-selector=app=db"},
+		{"-kind=ClusterExternalSecret", "-name=db"},
+	} {
+		opts := parseTestOptions(t, append(args, "-killswitch-configmap=platform/gate-bypass")...)
+		p, ok := killSwitchPermission(opts)
+		if !ok {
+			t.Errorf("%q: configmaps get is not required", args)
+			continue
+		}
+		if p.ClusterScoped || p.Namespace != "platform" || p.Name != "gate-bypass" || strings.Join(p.Verbs, ",") != "get" {
+			t.Errorf("%q: kill-switch permission = %+v, want get on platform/gate-bypass", args, p)
+		}
+	}
+}
+
+func TestRBACGrantsKillSwitch(t *testing.T) {
+	opts := parseTestOptions(t, "-namespace=apps", "-name=db", "-killswitch-configmap=platform/gate-bypass")
+	var b strings.Builder
+	writeRBAC(&b, requiredPermissions(opts), rbacSubject{
+		roleName:                "checker",
+		namespaces:              opts.namespaces(),
+		serviceAccount:          "default",
+		serviceAccountNamespace: "apps",
+	})
+	var platform string
+	for _, document := range strings.Split(b.String(), "---\n") {
+		if strings.Contains(document, "\nkind: Role\n") && strings.Contains(document, "namespace: platform\n") {
+			platform = document
+		}
+		if strings.Contains(document, "namespace: apps\n") && strings.Contains(document, "configmaps") {
+			t.Errorf("the Role in apps grants configmaps:\n%s", document)
+		}
+	}
+	if !strings.Contains(platform, `resources: ["configmaps"]`+"\n"+`  resourceNames: ["gate-bypass"]`+"\n"+`  verbs: ["get"]`) {
+		t.Errorf("no Role in platform grants get on the kill-switch ConfigMap:\n%s", b.String())
+	}
+}
+
+func TestPreflightChecksKillSwitch(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	var reviewed []authorizationv1.ResourceAttributes
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attributes := *review.Spec.ResourceAttributes
+		reviewed = append(reviewed, attributes)
+		review.Status.Allowed = attributes.Resource != "configmaps"
+		return true, review, nil
+	})
+
+	opts := parseTestOptions(t, "-namespace=apps", "-name=db", "-killswitch-configmap=platform/gate-bypass")
+	problems := checkPermissions(context.Background(), clientset, opts)
+	if len(problems) != 1 || !strings.Contains(problems[0], "get configmaps platform/gate-bypass") {
+		t.Errorf("problems = %q, want the denied kill-switch get", problems)
+	}
+	for _, attributes := range reviewed {
+		if attributes.Resource == "configmaps" && (attributes.Namespace != "platform" || attributes.Name != "gate-bypass") {
+			t.Errorf("kill-switch get reviewed in %q on %q, want platform/gate-bypass", attributes.Namespace, attributes.Name)
+		}
+	}
+}
+
+// TestAllNamespacesDiscoveryPermission checks that -all-namespaces with a
+// name, which lists the resources of that name in every namespace, requires a
+// cluster-wide list, both in the rbac output and in the pre-flight.
+func TestAllNamespacesDiscoveryPermission(t *testing.T) {
+	opts := parseTestOptions(t, "-all-namespaces", "-name=db")
+	var b strings.Builder
+	writeRBAC(&b, requiredPermissions(opts), rbacSubject{
+		roleName:                "checker",
+		namespaces:              opts.namespaces(),
+		serviceAccount:          "default",
+		serviceAccountNamespace: "apps",
+	})
+	var clusterRole string
+	for _, document := range strings.Split(b.String(), "---\n") {
+		if strings.Contains(document, "\nkind: ClusterRole\n") {
+			clusterRole = document
+		}
+	}
+	if !strings.Contains(clusterRole, `resources: ["externalsecrets"]`+"\n"+`  verbs: ["get", "watch", "list"]`) {
+		t.Errorf("no ClusterRole grants list on externalsecrets:\n%s", b.String())
+	}
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = attributes.Resource != "externalsecrets" || attributes.Verb != "list" || attributes.Namespace != ""
+		return true, review, nil
+	})
+	problems := checkPermissions(context.Background(), clientset, opts)
+	if len(problems) != 1 || !strings.Contains(problems[0], "list externalsecrets") {
+		t.Errorf("problems = %q, want the denied cluster-wide list", problems)
+	}
+}
+
+// TestCompareWithPermissions checks that -compare-with requires reading the
+// compared ExternalSecret and the Secrets of its namespace, in that
+// namespace rather than in those of -namespace.
+func TestCompareWithPermissions(t *testing.T) {
+	opts := parseTestOptions(t, "-namespace=apps", "-name=db", "-compare-with=staging/db")
+	var compared []permission
+	for _, p := range requiredPermissions(opts) {
+		if p.Namespace == "staging" {
+			compared = append(compared, p)
+		}
+	}
+	if len(compared) != 2 ||
+		compared[0].Resource != "externalsecrets" || compared[0].Name != "db" || strings.Join(compared[0].Verbs, ",") != "get" ||
+		compared[1].Resource != "secrets" || compared[1].Name != "" || strings.Join(compared[1].Verbs, ",") != "get" {
+		t.Errorf("permissions in staging = %+v, want get on the ExternalSecret db and on secrets", compared)
+	}
+
+	clientset := fake.NewSimpleClientset()
+	var reviewed []string
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		if attributes.Namespace == "staging" {
+			reviewed = append(reviewed, attributes.Verb+" "+attributes.Resource+" "+attributes.Name)
+		}
+		review.Status.Allowed = true
+		return true, review, nil
+	})
+	if problems := checkPermissions(context.Background(), clientset, opts); len(problems) != 0 {
+		t.Errorf("problems = %q, want none", problems)
+	}
+	if got := strings.Join(reviewed, ", "); got != "get externalsecrets db, get secrets " {
+		t.Errorf("reviewed in staging: %q, want the compared ExternalSecret and secrets", got)
+	}
+}
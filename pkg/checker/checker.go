@@ -0,0 +1,414 @@
+// Package checker waits for an ExternalSecret, or another external-secrets
+// resource with a Ready condition, to become Ready, for tools that embed the
+// wait rather than run the CLI. It holds the core the CLI and pkg/health
+// judge resources by: the parsing of status conditions, ParseConditions, and
+// the Ready rule, IsReady. WaitReady is a plain wait built on them: it polls
+// the resource, follows its conditions and collects its events. The CLI runs
+// a wait of its own, with watches, fatal reasons, target Secret
+// verification and reports, which are not part of this package.
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// DefaultInterval is the poll interval when Options leaves it unset.
+const DefaultInterval = 5 * time.Second
+
+// maxEvents is how many of the latest events a Result keeps.
+const maxEvents = 50
+
+// ExternalSecretGVR is the resource waited for when Options leaves it unset.
+var ExternalSecretGVR = schema.GroupVersionResource{
+	Group:    "external-secrets.io",
+	Version:  "v1beta1",
+	Resource: "externalsecrets",
+}
+
+// ErrTimeout is returned, wrapped, when the resource did not become Ready
+// within Options.Timeout.
+var ErrTimeout = errors.New("timed out waiting for Ready")
+
+// ErrNotServed is returned by ServedVersion when no version of the resource
+// is served at all.
+var ErrNotServed = errors.New("the external-secrets CRDs are not installed")
+
+// Options configures a Checker.
+type Options struct {
+	// Timeout bounds each WaitReady. It is required.
+	Timeout time.Duration
+	// Interval is how often the resource is polled, DefaultInterval if
+	// unset.
+	Interval time.Duration
+	// GVR is the resource waited for, ExternalSecretGVR if unset.
+	GVR schema.GroupVersionResource
+	// Kind is the kind of the resource, which its events are found by:
+	// ExternalSecret if unset.
+	Kind string
+	// OnProgress, when set, is called with every change of the conditions
+	// and every event of the resource. It is called from the goroutine of
+	// WaitReady, which waits for it to return; an Observer registered
+	// with WithObserver gets the same updates without stalling the wait.
+	OnProgress func(Progress)
+}
+
+// Condition is a condition of the resource's status, its fields as the
+// controller wrote them.
+type Condition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	LastTransitionTime string `json:"lastTransitionTime"`
+	Reason             string `json:"reason"`
+	Message            string `json:"message"`
+}
+
+// TransitionTime parses LastTransitionTime; unparsable times are zero, and
+// so count as the oldest.
+func (c Condition) TransitionTime() time.Time {
+	t, _ := time.Parse(time.RFC3339, c.LastTransitionTime)
+	return t
+}
+
+// Progress is a change observed while waiting: either new conditions or a
+// Kubernetes event.
+type Progress struct {
+	Time time.Time
+	// Conditions is set when the conditions changed, to all of them.
+	Conditions []Condition
+	// Event is set for an event of the resource.
+	Event *corev1.Event
+}
+
+// Result is the outcome of a WaitReady.
+type Result struct {
+	Ready bool
+	// Conditions are the last conditions seen, none if the resource was
+	// never found.
+	Conditions []Condition
+	// RefreshTime is status.refreshTime as last seen, zero if unset.
+	RefreshTime time.Time
+	Duration    time.Duration
+	// Events are the latest events observed during the wait, oldest first.
+	Events []corev1.Event
+	// DroppedUpdates counts the updates observers missed by falling behind,
+	// as returned by WaitReady.
+	DroppedUpdates int64
+}
+
+// Checker waits for resources of one kind through its clients.
+type Checker struct {
+	dynamicClient dynamic.Interface
+	clientset     kubernetes.Interface
+	opts          Options
+}
+
+// New returns a Checker using the clients of config.
+func New(config *rest.Config, opts Options) (*Checker, error) {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating dynamic client: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating clientset: %w", err)
+	}
+	return NewForClients(dynamicClient, clientset, opts)
+}
+
+// NewForClients returns a Checker using the given clients, such as fakes.
+// Events are not followed when clientset is nil.
+func NewForClients(dynamicClient dynamic.Interface, clientset kubernetes.Interface, opts Options) (*Checker, error) {
+	if opts.Timeout <= 0 {
+		return nil, errors.New("the timeout must be positive")
+	}
+	if opts.Interval < 0 {
+		return nil, errors.New("the interval must not be negative")
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.GVR.Empty() {
+		opts.GVR = ExternalSecretGVR
+	}
+	if opts.Kind == "" {
+		opts.Kind = "ExternalSecret"
+	}
+	return &Checker{dynamicClient: dynamicClient, clientset: clientset, opts: opts}, nil
+}
+
+// WaitReady waits until the resource namespace/name has Ready=True, polling
+// it every Options.Interval. A missing resource is waited for, and errors
+// that may clear up are retried at the next poll; a permission denial ends
+// the wait. The error wraps ErrTimeout when Options.Timeout passes first,
+// and is that of ctx when it is done first. The observers of opts receive
+// the progress of the wait and its result.
+func (c *Checker) WaitReady(ctx context.Context, namespace, name string, opts ...WaitOption) (Result, error) {
+	var options waitOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	hub := startObservers(options.observers)
+	hub.publish(func(o Observer) { o.OnPhaseChange(PhaseWaiting) })
+	result, err := c.wait(ctx, namespace, name, hub)
+	result.DroppedUpdates = hub.finish(result, err)
+	return result, err
+}
+
+func (c *Checker) wait(ctx context.Context, namespace, name string, hub *observers) (Result, error) {
+	start := time.Now()
+	waitCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	var result Result
+	events := make(chan *corev1.Event)
+	if c.clientset != nil {
+		go c.watchEvents(waitCtx, namespace, name, events)
+	}
+
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		obj, err := c.dynamicClient.Resource(c.opts.GVR).Namespace(namespace).Get(waitCtx, name, metav1.GetOptions{})
+		switch {
+		case err == nil:
+			conditions, _ := ParseConditions(obj)
+			if !equalConditions(conditions, result.Conditions) {
+				result.Conditions = conditions
+				c.progress(hub, Progress{Time: time.Now(), Conditions: conditions})
+			}
+			result.RefreshTime = parseTime(obj, "status", "refreshTime")
+			if IsReady(conditions) {
+				result.Ready = true
+				result.Duration = time.Since(start)
+				return result, nil
+			}
+		case apierrors.IsNotFound(err):
+			result.Conditions = nil
+		case apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err):
+			result.Duration = time.Since(start)
+			return result, fmt.Errorf("getting %s %s/%s: %w", c.opts.Kind, namespace, name, err)
+		}
+
+		for polled := false; !polled; {
+			select {
+			case e := <-events:
+				result.Events = append(result.Events, *e)
+				if len(result.Events) > maxEvents {
+					result.Events = result.Events[len(result.Events)-maxEvents:]
+				}
+				c.progress(hub, Progress{Time: time.Now(), Event: e})
+			case <-ticker.C:
+				polled = true
+			case <-waitCtx.Done():
+				result.Duration = time.Since(start)
+				if ctx.Err() != nil {
+					return result, ctx.Err()
+				}
+				return result, fmt.Errorf("%s %s/%s: %w after %s", c.opts.Kind, namespace, name, ErrTimeout, c.opts.Timeout)
+			}
+		}
+	}
+}
+
+func (c *Checker) progress(hub *observers, p Progress) {
+	if c.opts.OnProgress != nil {
+		c.opts.OnProgress(p)
+	}
+	switch {
+	case p.Event != nil:
+		hub.publish(func(o Observer) { o.OnEvent(p.Event) })
+	case p.Conditions != nil:
+		hub.publish(func(o Observer) { o.OnConditionChange(p.Conditions, p.Time) })
+	}
+}
+
+// watchEvents sends the events of the resource that happen from now on until
+// ctx is done. Events are best effort: the wait goes on without them when
+// they cannot be listed or the watch ends.
+func (c *Checker) watchEvents(ctx context.Context, namespace, name string, events chan<- *corev1.Event) {
+	selector := fields.Set{
+		"involvedObject.kind": c.opts.Kind,
+		"involvedObject.name": name,
+	}.AsSelector().String()
+	// Listing first makes the watch start after the events that already
+	// happened
+	list, err := c.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return
+	}
+	w, err := c.clientset.CoreV1().Events(namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector:   selector,
+		ResourceVersion: list.ResourceVersion,
+	})
+	if err != nil {
+		return
+	}
+	defer w.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+			e, isEvent := event.Object.(*corev1.Event)
+			if !isEvent || event.Type == watch.Deleted {
+				continue
+			}
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// ParseConditions returns the status conditions of obj along with the types
+// that appeared more than once. Buggy controllers have been seen writing two
+// Ready conditions, one of them stale; of duplicates only the one with the
+// newest lastTransitionTime is kept, in the position of the first.
+func ParseConditions(obj *unstructured.Unstructured) ([]Condition, []string) {
+	raw, found, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if !found || err != nil {
+		return []Condition{}, nil
+	}
+	var conditions []Condition
+	for _, c := range raw {
+		fields, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// Read fields leniently so that conditions written by other
+		// controllers, or with unexpected value types, pass through with
+		// their raw values instead of being dropped.
+		conditions = append(conditions, Condition{
+			Type:               conditionField(fields, "type"),
+			Status:             conditionField(fields, "status"),
+			LastTransitionTime: conditionField(fields, "lastTransitionTime"),
+			Reason:             conditionField(fields, "reason"),
+			Message:            conditionField(fields, "message"),
+		})
+	}
+	return resolveDuplicates(conditions)
+}
+
+// resolveDuplicates keeps one condition per type, preferring the newest
+// lastTransitionTime and, on ties, the later entry.
+func resolveDuplicates(conditions []Condition) ([]Condition, []string) {
+	index := map[string]int{}
+	reported := map[string]bool{}
+	var resolved []Condition
+	var duplicates []string
+	for _, condition := range conditions {
+		i, seen := index[condition.Type]
+		if !seen {
+			index[condition.Type] = len(resolved)
+			resolved = append(resolved, condition)
+			continue
+		}
+		if !reported[condition.Type] {
+			reported[condition.Type] = true
+			duplicates = append(duplicates, condition.Type)
+		}
+		if !condition.TransitionTime().Before(resolved[i].TransitionTime()) {
+			resolved[i] = condition
+		}
+	}
+	return resolved, duplicates
+}
+
+func conditionField(fields map[string]interface{}, key string) string {
+	switch value := fields[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// FindCondition returns the condition of the given type.
+func FindCondition(conditions []Condition, conditionType string) (Condition, bool) {
+	for _, condition := range conditions {
+		if condition.Type == conditionType {
+			return condition, true
+		}
+	}
+	return Condition{}, false
+}
+
+// IsReady reports whether the conditions, as returned by ParseConditions,
+// have Ready=True.
+func IsReady(conditions []Condition) bool {
+	ready, ok := FindCondition(conditions, "Ready")
+	return ok && ready.Status == "True"
+}
+
+func equalConditions(a, b []Condition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTime returns the RFC 3339 time at the path, zero if unset or invalid.
+func parseTime(obj *unstructured.Unstructured, path ...string) time.Time {
+	raw, _, _ := unstructured.NestedString(obj.Object, path...)
+	t, _ := time.Parse(time.RFC3339, raw)
+	return t
+}
+
+// ServedVersion asks the discovery API which version of gvr's group is
+// preferred and serves gvr's resource, for pinning Options.GVR.
+func ServedVersion(client discovery.DiscoveryInterface, gvr schema.GroupVersionResource) (string, error) {
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return "", err
+	}
+	for _, group := range groups.Groups {
+		if group.Name != gvr.Group {
+			continue
+		}
+		versions := []string{group.PreferredVersion.Version}
+		for _, version := range group.Versions {
+			if version.Version != group.PreferredVersion.Version {
+				versions = append(versions, version.Version)
+			}
+		}
+		for _, version := range versions {
+			resources, err := client.ServerResourcesForGroupVersion(gvr.Group + "/" + version)
+			if err != nil {
+				continue
+			}
+			for _, resource := range resources.APIResources {
+				if resource.Name == gvr.Resource {
+					return version, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: no served version of %s found in group %s", ErrNotServed, gvr.Resource, gvr.Group)
+}
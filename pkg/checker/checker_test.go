@@ -0,0 +1,194 @@
+package checker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"external-secret-watcher/pkg/checker"
+)
+
+func externalSecret(name string, conditions ...map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "external-secrets.io/v1beta1",
+		"kind":       "ExternalSecret",
+		"metadata":   map[string]interface{}{"namespace": "apps", "name": name},
+	}}
+	if len(conditions) > 0 {
+		raw := make([]interface{}, len(conditions))
+		for i, condition := range conditions {
+			raw[i] = condition
+		}
+		obj.Object["status"] = map[string]interface{}{
+			"refreshTime": "2024-05-01T10:00:00Z",
+			"conditions":  raw,
+		}
+	}
+	return obj
+}
+
+func readyCondition(status, since string) map[string]interface{} {
+	return map[string]interface{}{"type": "Ready", "status": status, "reason": "Synced" + status, "lastTransitionTime": since}
+}
+
+func newDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{checker.ExternalSecretGVR: "ExternalSecretList"}, objects...)
+}
+
+func newChecker(t *testing.T, dynamicClient *dynamicfake.FakeDynamicClient, opts checker.Options) *checker.Checker {
+	t.Helper()
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.Interval == 0 {
+		opts.Interval = 10 * time.Millisecond
+	}
+	c, err := checker.NewForClients(dynamicClient, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestWaitReadyAlreadyReady(t *testing.T) {
+	c := newChecker(t, newDynamicClient(externalSecret("db", readyCondition("True", "2024-05-01T10:00:00Z"))), checker.Options{})
+	result, err := c.WaitReady(context.Background(), "apps", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Ready || len(result.Conditions) != 1 || result.Conditions[0].Reason != "SyncedTrue" {
+		t.Errorf("result = %+v, want Ready with the Ready condition", result)
+	}
+	if want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC); !result.RefreshTime.Equal(want) {
+		t.Errorf("RefreshTime = %v, want %v", result.RefreshTime, want)
+	}
+}
+
+func TestWaitReadyFollowsChanges(t *testing.T) {
+	dynamicClient := newDynamicClient(externalSecret("db", readyCondition("False", "2024-05-01T10:00:00Z")))
+	var progress []checker.Progress
+	c := newChecker(t, dynamicClient, checker.Options{OnProgress: func(p checker.Progress) {
+		progress = append(progress, p)
+		if len(progress) == 1 {
+			update := externalSecret("db", readyCondition("True", "2024-05-01T10:01:00Z"))
+			if _, err := dynamicClient.Resource(checker.ExternalSecretGVR).Namespace("apps").Update(context.Background(), update, metav1.UpdateOptions{}); err != nil {
+				t.Error(err)
+			}
+		}
+	}})
+	result, err := c.WaitReady(context.Background(), "apps", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Ready {
+		t.Fatalf("result = %+v, want Ready", result)
+	}
+	if len(progress) != 2 || progress[0].Conditions[0].Status != "False" || progress[1].Conditions[0].Status != "True" {
+		t.Errorf("progress = %+v, want the Ready=False then Ready=True conditions", progress)
+	}
+}
+
+func TestWaitReadyTimesOutOnMissingResource(t *testing.T) {
+	c := newChecker(t, newDynamicClient(), checker.Options{Timeout: 50 * time.Millisecond})
+	result, err := c.WaitReady(context.Background(), "apps", "db")
+	if !errors.Is(err, checker.ErrTimeout) {
+		t.Fatalf("err = %v, want ErrTimeout", err)
+	}
+	if result.Ready || result.Conditions != nil {
+		t.Errorf("result = %+v, want not Ready without conditions", result)
+	}
+}
+
+func TestWaitReadyStopsOnDenial(t *testing.T) {
+	dynamicClient := newDynamicClient()
+	dynamicClient.PrependReactor("get", "externalsecrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(checker.ExternalSecretGVR.GroupResource(), "db", errors.New("denied"))
+	})
+	c := newChecker(t, dynamicClient, checker.Options{})
+	_, err := c.WaitReady(context.Background(), "apps", "db")
+	if !apierrors.IsForbidden(err) || errors.Is(err, checker.ErrTimeout) {
+		t.Fatalf("err = %v, want the denial", err)
+	}
+}
+
+func TestWaitReadyCollectsEvents(t *testing.T) {
+	dynamicClient := newDynamicClient(externalSecret("db", readyCondition("False", "2024-05-01T10:00:00Z")))
+	clientset := fake.NewSimpleClientset()
+	events := watch.NewFake()
+	clientset.PrependWatchReactor("events", k8stesting.DefaultWatchReactor(events, nil))
+	c, err := checker.NewForClients(dynamicClient, clientset, checker.Options{
+		Timeout:  5 * time.Second,
+		Interval: 10 * time.Millisecond,
+		OnProgress: func(p checker.Progress) {
+			if p.Event == nil {
+				return
+			}
+			update := externalSecret("db", readyCondition("True", "2024-05-01T10:01:00Z"))
+			if _, err := dynamicClient.Resource(checker.ExternalSecretGVR).Namespace("apps").Update(context.Background(), update, metav1.UpdateOptions{}); err != nil {
+				t.Error(err)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go events.Add(&corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "apps", Name: "db.1"},
+		InvolvedObject: corev1.ObjectReference{Kind: "ExternalSecret", Namespace: "apps", Name: "db"},
+		Reason:         "Updated",
+	})
+	result, err := c.WaitReady(context.Background(), "apps", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Ready || len(result.Events) != 1 || result.Events[0].Reason != "Updated" {
+		t.Errorf("result = %+v, want Ready with the Updated event", result)
+	}
+}
+
+func TestNewForClientsValidatesOptions(t *testing.T) {
+	for _, opts := range []checker.Options{{}, {Timeout: time.Second, Interval: -time.Second}} {
+		if _, err := checker.NewForClients(newDynamicClient(), nil, opts); err == nil {
+			t.Errorf("NewForClients(%+v) succeeded, want an error", opts)
+		}
+	}
+}
+
+func TestParseConditions(t *testing.T) {
+	obj := externalSecret("db",
+		readyCondition("True", "2024-05-01T10:00:00Z"),
+		map[string]interface{}{"type": "Deleted", "status": false, "observedGeneration": int64(3)},
+		readyCondition("False", "2024-05-01T10:05:00Z"),
+		readyCondition("True", "not a time"),
+	)
+	conditions, duplicates := checker.ParseConditions(obj)
+	if len(conditions) != 2 || len(duplicates) != 1 || duplicates[0] != "Ready" {
+		t.Fatalf("conditions, duplicates = %+v, %q, want Ready and Deleted with Ready duplicated", conditions, duplicates)
+	}
+	if conditions[0].Type != "Ready" || conditions[0].Status != "False" {
+		t.Errorf("Ready = %+v, want the newest, False", conditions[0])
+	}
+	if conditions[1].Status != "false" {
+		t.Errorf("Deleted status = %q, want the raw value printed", conditions[1].Status)
+	}
+	if checker.IsReady(conditions) {
+		t.Error("IsReady = true with the newest Ready condition False")
+	}
+
+	if conditions, _ := checker.ParseConditions(externalSecret("db")); conditions == nil || len(conditions) != 0 {
+		t.Errorf("conditions without a status = %#v, want empty", conditions)
+	}
+}
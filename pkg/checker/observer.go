@@ -0,0 +1,113 @@
+package checker
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Phases of a WaitReady, reported to observers as they are entered.
+const (
+	PhaseWaiting = "waiting"
+	PhaseDone    = "done"
+)
+
+// DefaultObserverBuffer is how many updates an observer registered with a
+// buffer of zero may fall behind by.
+const DefaultObserverBuffer = 64
+
+// Observer receives the progress of a WaitReady as it happens, such as to
+// push it to users. Updates are delivered in order on a goroutine of the
+// observer's own, so a slow observer never stalls the wait: once its buffer
+// is full further updates are dropped, and counted in
+// Result.DroppedUpdates. OnResult is never dropped, and WaitReady returns
+// once every observer has received it.
+type Observer interface {
+	// OnConditionChange is called with all the conditions whenever they
+	// change.
+	OnConditionChange(conditions []Condition, at time.Time)
+	OnEvent(event *corev1.Event)
+	OnPhaseChange(phase string)
+	OnResult(result Result, err error)
+}
+
+// WaitOption configures a single WaitReady.
+type WaitOption func(*waitOptions)
+
+type waitOptions struct {
+	observers []registration
+}
+
+type registration struct {
+	observer Observer
+	buffer   int
+}
+
+// WithObserver registers o for the updates of the wait, with room for buffer
+// pending ones, DefaultObserverBuffer if zero.
+func WithObserver(o Observer, buffer int) WaitOption {
+	if buffer <= 0 {
+		buffer = DefaultObserverBuffer
+	}
+	return func(opts *waitOptions) {
+		opts.observers = append(opts.observers, registration{observer: o, buffer: buffer})
+	}
+}
+
+// observers fans the updates of one wait out to its observers. All methods
+// are safe to call on nil, a wait without observers.
+type observers struct {
+	queues  []chan func(Observer)
+	wg      sync.WaitGroup
+	dropped atomic.Int64
+}
+
+func startObservers(registered []registration) *observers {
+	if len(registered) == 0 {
+		return nil
+	}
+	h := &observers{}
+	for _, r := range registered {
+		queue := make(chan func(Observer), r.buffer)
+		h.queues = append(h.queues, queue)
+		h.wg.Add(1)
+		go func(o Observer) {
+			defer h.wg.Done()
+			for update := range queue {
+				update(o)
+			}
+		}(r.observer)
+	}
+	return h
+}
+
+// publish queues update for every observer without blocking.
+func (h *observers) publish(update func(Observer)) {
+	if h == nil {
+		return
+	}
+	for _, queue := range h.queues {
+		select {
+		case queue <- update:
+		default:
+			h.dropped.Add(1)
+		}
+	}
+}
+
+// finish delivers the result, waits for every observer to drain its queue
+// and returns the number of dropped updates.
+func (h *observers) finish(result Result, err error) int64 {
+	if h == nil {
+		return 0
+	}
+	h.publish(func(o Observer) { o.OnPhaseChange(PhaseDone) })
+	for _, queue := range h.queues {
+		queue <- func(o Observer) { o.OnResult(result, err) }
+		close(queue)
+	}
+	h.wg.Wait()
+	return h.dropped.Load()
+}
@@ -0,0 +1,118 @@
+package checker_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+
+	"external-secret-watcher/pkg/checker"
+)
+
+// recorder is an Observer that records what it receives, blocking on each
+// update until hold is closed when set.
+type recorder struct {
+	hold chan struct{}
+
+	mu         sync.Mutex
+	phases     []string
+	conditions [][]checker.Condition
+	results    []checker.Result
+}
+
+func (r *recorder) wait() {
+	if r.hold != nil {
+		<-r.hold
+	}
+}
+
+func (r *recorder) OnConditionChange(conditions []checker.Condition, _ time.Time) {
+	r.wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conditions = append(r.conditions, conditions)
+}
+
+func (r *recorder) OnEvent(*corev1.Event) { r.wait() }
+
+func (r *recorder) OnPhaseChange(phase string) {
+	r.wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.phases = append(r.phases, phase)
+}
+
+func (r *recorder) OnResult(result checker.Result, _ error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, result)
+}
+
+func TestObserverReceivesTheWait(t *testing.T) {
+	dynamicClient := newDynamicClient()
+	gets := 0
+	dynamicClient.PrependReactor("get", "externalsecrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets < 3 {
+			return true, externalSecret("db", readyCondition("False", fmt.Sprintf("2024-05-01T10:0%d:00Z", gets))), nil
+		}
+		return true, externalSecret("db", readyCondition("True", "2024-05-01T10:05:00Z")), nil
+	})
+	c := newChecker(t, dynamicClient, checker.Options{})
+	observer := &recorder{}
+	result, err := c.WaitReady(context.Background(), "apps", "db", checker.WithObserver(observer, 0))
+	if err != nil || !result.Ready {
+		t.Fatalf("result = %+v, %v, want Ready", result, err)
+	}
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if fmt.Sprint(observer.phases) != "[waiting done]" {
+		t.Errorf("phases = %v, want waiting then done", observer.phases)
+	}
+	if len(observer.conditions) != 3 || observer.conditions[2][0].Status != "True" {
+		t.Errorf("condition changes = %v, want the 3 changes ending Ready=True", observer.conditions)
+	}
+	if len(observer.results) != 1 || !observer.results[0].Ready || result.DroppedUpdates != 0 {
+		t.Errorf("results = %+v with %d dropped updates, want the Ready result and none dropped", observer.results, result.DroppedUpdates)
+	}
+}
+
+// TestSlowObserverDoesNotStallTheWait registers an observer that blocks
+// until after the resource is Ready: the wait ends on time, the updates
+// past its buffer are dropped and counted, and the result still reaches it.
+func TestSlowObserverDoesNotStallTheWait(t *testing.T) {
+	dynamicClient := newDynamicClient()
+	gets := 0
+	dynamicClient.PrependReactor("get", "externalsecrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets < 10 {
+			return true, externalSecret("db", readyCondition("False", fmt.Sprintf("2024-05-01T10:%02d:00Z", gets))), nil
+		}
+		return true, externalSecret("db", readyCondition("True", "2024-05-01T11:00:00Z")), nil
+	})
+	c := newChecker(t, dynamicClient, checker.Options{Interval: time.Millisecond})
+	observer := &recorder{hold: make(chan struct{})}
+	const held = 300 * time.Millisecond
+	time.AfterFunc(held, func() { close(observer.hold) })
+
+	result, err := c.WaitReady(context.Background(), "apps", "db", checker.WithObserver(observer, 2))
+	if err != nil || !result.Ready {
+		t.Fatalf("result = %+v, %v, want Ready", result, err)
+	}
+	if result.Duration >= held {
+		t.Errorf("the wait took %s, stalled by the observer held for %s", result.Duration, held)
+	}
+	if result.DroppedUpdates == 0 {
+		t.Error("no update was dropped for the held observer")
+	}
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if len(observer.results) != 1 {
+		t.Errorf("the held observer got %d results, want 1", len(observer.results))
+	}
+}
@@ -0,0 +1,143 @@
+// Package health evaluates the health of a single ExternalSecret at one
+// point in time, for use in the health checks of other tools such as Argo CD
+// exec plugins. Unlike the checker it never waits: Check makes a single Get,
+// after a discovery of the served version unless it is pinned, and returns
+// within the given timeout, whatever the API server does.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	"external-secret-watcher/pkg/checker"
+)
+
+// Status is the health of an ExternalSecret.
+type Status string
+
+const (
+	// Healthy is a Ready ExternalSecret that is being kept in sync.
+	Healthy Status = "Healthy"
+	// Progressing is an ExternalSecret that has not synced yet.
+	Progressing Status = "Progressing"
+	// Degraded is an ExternalSecret whose sync failed, that is missing, or
+	// whose Ready state is stale.
+	Degraded Status = "Degraded"
+)
+
+// ExitCode maps the status to the exit code of the health subcommand:
+// 0 for Healthy, 1 for Progressing and 2 for Degraded.
+func (s Status) ExitCode() int {
+	switch s {
+	case Healthy:
+		return 0
+	case Progressing:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Result is the evaluated health and a human-readable reason.
+type Result struct {
+	Status  Status
+	Message string
+}
+
+// refreshGrace is how much later than spec.refreshInterval a refresh may
+// happen before a Ready status is considered stale.
+const refreshGrace = time.Minute
+
+// Check returns the health of the ExternalSecret namespace/name, read in
+// version, or in the version the API server prefers when it is empty. It
+// returns within timeout or the deadline of ctx, whichever comes first; an
+// API server that does not answer in time yields Progressing.
+func Check(ctx context.Context, config *rest.Config, namespace, name, version string, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	config = rest.CopyConfig(config)
+	config.Timeout = timeout
+	gvr := checker.ExternalSecretGVR
+	if version == "" {
+		client, err := discovery.NewDiscoveryClientForConfig(config)
+		if err != nil {
+			return Result{Degraded, fmt.Sprintf("cannot create discovery client: %v", err)}
+		}
+		served, err := checker.ServedVersion(client, gvr)
+		switch {
+		case errors.Is(err, checker.ErrNotServed):
+			return Result{Degraded, err.Error()}
+		case ctx.Err() != nil:
+			return Result{Progressing, fmt.Sprintf("no answer from the API server within %v", timeout)}
+		case err != nil:
+			return Result{Degraded, fmt.Sprintf("cannot discover the served version of %s: %v", gvr.Resource, err)}
+		}
+		version = served
+	}
+	gvr.Version = version
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return Result{Degraded, fmt.Sprintf("cannot create client: %v", err)}
+	}
+	obj, err := client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return Result{Degraded, fmt.Sprintf("ExternalSecret %s/%s not found", namespace, name)}
+	case ctx.Err() != nil:
+		return Result{Progressing, fmt.Sprintf("no answer from the API server within %v", timeout)}
+	case err != nil:
+		return Result{Degraded, fmt.Sprintf("cannot get ExternalSecret %s/%s: %v", namespace, name, err)}
+	}
+	return Evaluate(obj, time.Now())
+}
+
+// Evaluate derives the health from the Ready condition of an ExternalSecret
+// and the age of its last refresh, as observed at now. Of duplicate Ready
+// conditions the one with the newest lastTransitionTime counts, as
+// checker.ParseConditions resolves them.
+func Evaluate(obj *unstructured.Unstructured, now time.Time) Result {
+	conditions, _ := checker.ParseConditions(obj)
+	if ready, ok := checker.FindCondition(conditions, "Ready"); ok {
+		switch ready.Status {
+		case "True":
+			if stale := staleRefresh(obj, now); stale != "" {
+				return Result{Degraded, "Ready but stale: " + stale}
+			}
+			return Result{Healthy, "Ready: " + ready.Reason}
+		case "False":
+			return Result{Degraded, fmt.Sprintf("%s: %s", ready.Reason, ready.Message)}
+		default:
+			return Result{Progressing, fmt.Sprintf("Ready is %s: %s", ready.Status, ready.Reason)}
+		}
+	}
+	return Result{Progressing, "no Ready condition yet"}
+}
+
+// staleRefresh checks status.refreshTime against spec.refreshInterval.
+func staleRefresh(obj *unstructured.Unstructured, now time.Time) string {
+	raw, _, _ := unstructured.NestedString(obj.Object, "spec", "refreshInterval")
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval <= 0 {
+		return ""
+	}
+	refreshTimeRaw, _, _ := unstructured.NestedString(obj.Object, "status", "refreshTime")
+	refreshTime, err := time.Parse(time.RFC3339, refreshTimeRaw)
+	if err != nil {
+		return ""
+	}
+	if age := now.Sub(refreshTime); age > interval+refreshGrace {
+		return fmt.Sprintf("last refresh was %v ago but refreshInterval is %v", age.Round(time.Second), interval)
+	}
+	return ""
+}
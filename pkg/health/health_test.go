@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+)
+
+// v1Server serves the ExternalSecret API in v1 only, as after an upgrade
+// that dropped v1beta1, with the Ready ExternalSecret apps/db.
+func v1Server(t *testing.T) *rest.Config {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api":
+			fmt.Fprint(w, `{"kind":"APIVersions","versions":["v1"]}`)
+		case "/apis":
+			fmt.Fprint(w, `{"kind":"APIGroupList","apiVersion":"v1","groups":[{"name":"external-secrets.io",`+
+				`"versions":[{"groupVersion":"external-secrets.io/v1","version":"v1"}],"preferredVersion":{"groupVersion":"external-secrets.io/v1","version":"v1"}}]}`)
+		case "/apis/external-secrets.io/v1":
+			fmt.Fprint(w, `{"kind":"APIResourceList","apiVersion":"v1","groupVersion":"external-secrets.io/v1",`+
+				`"resources":[{"name":"externalsecrets","namespaced":true,"kind":"ExternalSecret","verbs":["get","list","watch"]}]}`)
+		case "/apis/external-secrets.io/v1/namespaces/apps/externalsecrets/db":
+			fmt.Fprint(w, `{"kind":"ExternalSecret","apiVersion":"external-secrets.io/v1","metadata":{"namespace":"apps","name":"db"},`+
+				`"status":{"conditions":[{"type":"Ready","status":"True","reason":"SecretSynced"}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return &rest.Config{Host: server.URL}
+}
+
+// TestCheckResolvesTheServedVersion probes a server that no longer serves
+// v1beta1: the served version is discovered unless one is pinned.
+func TestCheckResolvesTheServedVersion(t *testing.T) {
+	config := v1Server(t)
+	if result := Check(context.Background(), config, "apps", "db", "", 5*time.Second); result.Status != Healthy {
+		t.Errorf("discovered version: %s: %s, want %s", result.Status, result.Message, Healthy)
+	}
+	if result := Check(context.Background(), config, "apps", "db", "v1", 5*time.Second); result.Status != Healthy {
+		t.Errorf("pinned v1: %s: %s, want %s", result.Status, result.Message, Healthy)
+	}
+	if result := Check(context.Background(), config, "apps", "db", "v1beta1", 5*time.Second); result.Status != Degraded || !strings.Contains(result.Message, "not found") {
+		t.Errorf("pinned v1beta1: %s: %s, want %s as not found", result.Status, result.Message, Degraded)
+	}
+}
+
+// externalSecret returns an ExternalSecret with the given spec and status.
+func externalSecret(spec, status map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "external-secrets.io/v1beta1",
+		"kind":       "ExternalSecret",
+		"metadata":   map[string]any{"namespace": "apps", "name": "db"},
+	}}
+	if spec != nil {
+		obj.Object["spec"] = spec
+	}
+	if status != nil {
+		obj.Object["status"] = status
+	}
+	return obj
+}
+
+func ready(status, reason string) map[string]any {
+	return map[string]any{"type": "Ready", "status": status, "reason": reason, "message": reason + " message", "lastTransitionTime": "2024-05-01T10:00:00Z"}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	hourly := map[string]any{"refreshInterval": "1h"}
+	for _, test := range []struct {
+		name    string
+		obj     *unstructured.Unstructured
+		want    Status
+		message string
+	}{
+		{"ready", externalSecret(hourly, map[string]any{"refreshTime": "2024-05-01T11:30:00Z", "conditions": []any{ready("True", "SecretSynced")}}), Healthy, "Ready: SecretSynced"},
+		{"not ready", externalSecret(hourly, map[string]any{"conditions": []any{ready("False", "SecretSyncedError")}}), Degraded, "SecretSyncedError: SecretSyncedError message"},
+		{"unknown", externalSecret(nil, map[string]any{"conditions": []any{ready("Unknown", "Syncing")}}), Progressing, "Ready is Unknown: Syncing"},
+		{"stale refresh", externalSecret(hourly, map[string]any{"refreshTime": "2024-05-01T10:00:00Z", "conditions": []any{ready("True", "SecretSynced")}}), Degraded, "Ready but stale: last refresh was 2h0m0s ago but refreshInterval is 1h0m0s"},
+		{"missing status", externalSecret(hourly, nil), Progressing, "no Ready condition yet"},
+		{"no Ready condition", externalSecret(nil, map[string]any{"conditions": []any{map[string]any{"type": "Deleted", "status": "False"}}}), Progressing, "no Ready condition yet"},
+	} {
+		if got := Evaluate(test.obj, now); got.Status != test.want || got.Message != test.message {
+			t.Errorf("%s: Evaluate = %s %q, want %s %q", test.name, got.Status, got.Message, test.want, test.message)
+		}
+	}
+}
+
+func TestStaleRefresh(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name            string
+		refreshInterval any
+		refreshTime     any
+		stale           bool
+	}{
+		{"recent", "1h", "2024-05-01T11:30:00Z", false},
+		{"within the grace", "1h", now.Add(-time.Hour - refreshGrace + time.Second).Format(time.RFC3339), false},
+		{"past the grace", "1h", now.Add(-time.Hour - refreshGrace - time.Second).Format(time.RFC3339), true},
+		{"refresh disabled", "0", "2024-04-01T10:00:00Z", false},
+		{"no refresh interval", nil, "2024-04-01T10:00:00Z", false},
+		{"unparsable refresh interval", "hourly", "2024-04-01T10:00:00Z", false},
+		{"no refresh time", "1h", nil, false},
+		{"unparsable refresh time", "1h", "yesterday", false},
+	} {
+		spec, status := map[string]any{}, map[string]any{}
+		if test.refreshInterval != nil {
+			spec["refreshInterval"] = test.refreshInterval
+		}
+		if test.refreshTime != nil {
+			status["refreshTime"] = test.refreshTime
+		}
+		if got := staleRefresh(externalSecret(spec, status), now); (got != "") != test.stale {
+			t.Errorf("%s: staleRefresh = %q, want stale %t", test.name, got, test.stale)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	for status, want := range map[Status]int{Healthy: 0, Progressing: 1, Degraded: 2, Status("Unknown"): 2} {
+		if got := status.ExitCode(); got != want {
+			t.Errorf("%s.ExitCode() = %d, want %d", status, got, want)
+		}
+	}
+}
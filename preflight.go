@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// checkPermissions asks the API server, through SelfSubjectAccessReviews,
+// whether the current identity holds every permission the enabled features
+// need, namespaced permissions in each namespace of -namespace and those on
+// one object in its namespace. It returns one problem per denied or
+// unverifiable verb.
+func checkPermissions(ctx context.Context, clientset kubernetes.Interface, opts *options) []string {
+	var problems []string
+	for _, p := range requiredPermissions(opts) {
+		namespaces := []string{""}
+		switch {
+		case p.Namespace != "":
+			namespaces = []string{p.Namespace}
+		case !p.ClusterScoped:
+			namespaces = opts.namespaces()
+		}
+		for _, namespace := range namespaces {
+			problems = append(problems, checkPermission(ctx, clientset, opts, p, namespace)...)
+		}
+	}
+	return problems
+}
+
+// checkPermission reviews the verbs of p in namespace, or cluster-wide when
+// it is empty.
+func checkPermission(ctx context.Context, clientset kubernetes.Interface, opts *options, p permission, namespace string) []string {
+	var problems []string
+	resource := permissionResource(p)
+	switch {
+	case p.Name != "":
+		resource += " " + namespace + "/" + p.Name
+	case namespace != "" && opts.severalNamespaces():
+		resource += " in namespace " + namespace
+	}
+	for _, verb := range p.Verbs {
+		attributes := &authorizationv1.ResourceAttributes{
+			Verb:      verb,
+			Group:     p.Group,
+			Resource:  p.Resource,
+			Namespace: namespace,
+			Name:      p.Name,
+		}
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: attributes},
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, opts.perCallTimeout)
+		response, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(callCtx, review, metav1.CreateOptions{})
+		cancel()
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("cannot verify %s %s (%s): %v", verb, resource, p.Feature, err))
+		case !response.Status.Allowed:
+			problems = append(problems, fmt.Sprintf("not allowed to %s %s (needed for %s)", verb, resource, p.Feature))
+		}
+	}
+	return problems
+}
+
+func permissionResource(p permission) string {
+	if p.Group == "" {
+		return p.Resource
+	}
+	return p.Resource + "." + p.Group
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// progressEstimate is a heuristic view of how far along a wait is. Both values
+// are estimates: Percent is derived from elapsed time against the deadline,
+// not from any controller-reported progress, and NextReconcile assumes the
+// controller keeps to spec.refreshInterval.
+type progressEstimate struct {
+	// Percent of the deadline that has elapsed, 0-100.
+	Percent int
+	// NextReconcile is the estimated time until the controller reconciles the
+	// resource again. Only valid when HasNextReconcile is set.
+	NextReconcile    time.Duration
+	HasNextReconcile bool
+}
+
+func (p progressEstimate) String() string {
+	s := fmt.Sprintf("~%d%% of deadline elapsed", p.Percent)
+	if p.HasNextReconcile {
+		s += fmt.Sprintf(", next reconcile expected in ~%s", formatDuration(p.NextReconcile))
+	}
+	return s + " (estimates)"
+}
+
+// estimateProgress computes the progress estimate for a wait that started at
+// start and is bounded by the deadline of ctx.
+func estimateProgress(ctx context.Context, start, now time.Time, unstructuredES *unstructured.Unstructured) progressEstimate {
+	var estimate progressEstimate
+	if deadline, ok := ctx.Deadline(); ok {
+		if total := deadline.Sub(start); total > 0 {
+			estimate.Percent = int(100 * now.Sub(start) / total)
+			estimate.Percent = min(max(estimate.Percent, 0), 100)
+		}
+	}
+
+	if unstructuredES != nil {
+		estimate.NextReconcile, estimate.HasNextReconcile = estimateNextReconcile(unstructuredES, now)
+	}
+	return estimate
+}
+
+// estimateNextReconcile guesses when a resource that has not completed its
+// first sync will be reconciled again, by stepping spec.refreshInterval
+// forward from its creation. It gives up on missing, zero or unparsable
+// intervals and on resources that already synced once.
+func estimateNextReconcile(unstructuredES *unstructured.Unstructured, now time.Time) (time.Duration, bool) {
+	if refreshTime, _, _ := unstructured.NestedString(unstructuredES.Object, "status", "refreshTime"); refreshTime != "" {
+		return 0, false
+	}
+	raw, _, _ := unstructured.NestedString(unstructuredES.Object, "spec", "refreshInterval")
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval <= 0 {
+		return 0, false
+	}
+
+	created := unstructuredES.GetCreationTimestamp().Time
+	if created.IsZero() || created.After(now) {
+		return 0, false
+	}
+	elapsed := now.Sub(created)
+	next := interval - elapsed%interval
+	return next.Round(time.Second), true
+}
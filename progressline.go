@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultProgressTemplate renders the standard progress line.
+const defaultProgressTemplate = `Waiting... [{{.Estimate}}] Current status conditions: {{.Conditions}}`
+
+// progressContext is what -progress-template is rendered against.
+type progressContext struct {
+	// Resource is namespace/name of the ExternalSecret.
+	Resource   string
+	Namespace  string
+	Name       string
+	Conditions []Condition
+	Elapsed    time.Duration
+	// Remaining is the time left until the deadline.
+	Remaining   time.Duration
+	Estimate    progressEstimate
+	EventCounts eventCounts
+}
+
+// eventCounts are the events seen so far.
+type eventCounts struct {
+	Total    int
+	Warnings int
+}
+
+// progressFuncs are available to progress templates.
+var progressFuncs = template.FuncMap{
+	"duration": formatDuration,
+	"join":     strings.Join,
+}
+
+// parseProgressTemplate parses a -progress-template and renders it once
+// against an empty context, so that references to unknown fields fail at
+// startup rather than in the middle of the wait.
+func parseProgressTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("progress").Funcs(progressFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, progressContext{}); err != nil {
+		return nil, fmt.Errorf("%w (available fields: .Resource, .Namespace, .Name, .Conditions, .Elapsed, .Remaining, .Estimate, .EventCounts.Total, .EventCounts.Warnings)", err)
+	}
+	return tmpl, nil
+}
+
+// renderProgress renders the progress line, falling back to the default
+// format if the template fails on this particular context.
+func renderProgress(tmpl *template.Template, ctx progressContext) string {
+	if tmpl != nil {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, ctx); err == nil {
+			return b.String()
+		}
+	}
+	return fmt.Sprintf("Waiting... [%s] Current status conditions: %v", ctx.Estimate, ctx.Conditions)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const rbacUsage = "Usage: ./external-secret-watcher rbac -namespace=<namespace> | -service-account-namespace=<namespace> [-service-account=<name>] [flags of a normal run]"
+
+// runRBAC implements the rbac subcommand, which prints the Role/ClusterRole
+// and bindings a service account needs for a run with the same flags.
+func runRBAC(args []string) int {
+	var opts options
+	fs := flag.NewFlagSet("rbac", flag.ContinueOnError)
+	opts.register(fs)
+	serviceAccount := fs.String("service-account", "default", "Name of the service account the checker runs as")
+	serviceAccountNamespace := fs.String("service-account-namespace", "", "Namespace of the service account (defaults to the first -namespace)")
+	roleName := fs.String("role-name", "external-secret-watcher", "Name of the generated roles and bindings")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	namespaces := opts.namespaces()
+	if *serviceAccountNamespace == "" && len(namespaces) > 0 {
+		*serviceAccountNamespace = namespaces[0]
+	}
+	// Cluster-scoped kinds and -all-namespaces take no -namespace, but the
+	// service account still lives in one
+	if *serviceAccountNamespace == "" {
+		fmt.Println(rbacUsage)
+		return 1
+	}
+
+	writeRBAC(os.Stdout, requiredPermissions(&opts), rbacSubject{
+		roleName:                *roleName,
+		namespaces:              namespaces,
+		serviceAccount:          *serviceAccount,
+		serviceAccountNamespace: *serviceAccountNamespace,
+	})
+	return 0
+}
+
+type rbacSubject struct {
+	roleName                string
+	namespaces              []string
+	serviceAccount          string
+	serviceAccountNamespace string
+}
+
+// writeRBAC renders the permissions as ready-to-apply YAML documents: a Role
+// and RoleBinding in each namespace for namespaced resources, and in that of
+// the object for permissions on one object, and a ClusterRole and
+// ClusterRoleBinding for cluster-scoped ones.
+func writeRBAC(w io.Writer, required []permission, subject rbacSubject) {
+	var namespaced, clusterScoped []permission
+	for _, p := range required {
+		switch {
+		case p.ClusterScoped:
+			clusterScoped = append(clusterScoped, p)
+		case p.Namespace == "":
+			namespaced = append(namespaced, p)
+		}
+	}
+	var namespaces []string
+	rules := map[string][]permission{}
+	if len(namespaced) > 0 {
+		for _, namespace := range subject.namespaces {
+			namespaces = append(namespaces, namespace)
+			rules[namespace] = append([]permission(nil), namespaced...)
+		}
+	}
+	for _, p := range required {
+		if p.ClusterScoped || p.Namespace == "" {
+			continue
+		}
+		if _, ok := rules[p.Namespace]; !ok {
+			namespaces = append(namespaces, p.Namespace)
+		}
+		rules[p.Namespace] = append(rules[p.Namespace], p)
+	}
+
+	var documents []string
+	for _, namespace := range namespaces {
+		documents = append(documents,
+			fmt.Sprintf("apiVersion: rbac.authorization.k8s.io/v1\nkind: Role\nmetadata:\n  name: %s\n  namespace: %s\nrules:\n%s",
+				subject.roleName, namespace, rbacRules(rules[namespace])),
+			fmt.Sprintf("apiVersion: rbac.authorization.k8s.io/v1\nkind: RoleBinding\nmetadata:\n  name: %s\n  namespace: %s\nroleRef:\n  apiGroup: rbac.authorization.k8s.io\n  kind: Role\n  name: %s\n%s",
+				subject.roleName, namespace, subject.roleName, rbacSubjects(subject)))
+	}
+	if len(clusterScoped) > 0 {
+		documents = append(documents,
+			fmt.Sprintf("apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: %s\nrules:\n%s",
+				subject.roleName, rbacRules(clusterScoped)),
+			fmt.Sprintf("apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRoleBinding\nmetadata:\n  name: %s\nroleRef:\n  apiGroup: rbac.authorization.k8s.io\n  kind: ClusterRole\n  name: %s\n%s",
+				subject.roleName, subject.roleName, rbacSubjects(subject)))
+	}
+	fmt.Fprint(w, strings.Join(documents, "---\n"))
+}
+
+func rbacRules(required []permission) string {
+	var b strings.Builder
+	for _, p := range required {
+		fmt.Fprintf(&b, "# %s\n", p.Feature)
+		fmt.Fprintf(&b, "- apiGroups: [%q]\n", p.Group)
+		fmt.Fprintf(&b, "  resources: [%q]\n", p.Resource)
+		if p.Name != "" {
+			fmt.Fprintf(&b, "  resourceNames: [%q]\n", p.Name)
+		}
+		quoted := make([]string, len(p.Verbs))
+		for i, verb := range p.Verbs {
+			quoted[i] = fmt.Sprintf("%q", verb)
+		}
+		fmt.Fprintf(&b, "  verbs: [%s]\n", strings.Join(quoted, ", "))
+	}
+	return b.String()
+}
+
+func rbacSubjects(subject rbacSubject) string {
+	return fmt.Sprintf("subjects:\n- kind: ServiceAccount\n  name: %s\n  namespace: %s\n", subject.serviceAccount, subject.serviceAccountNamespace)
+}
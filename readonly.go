@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// mutatingVerbs are the RBAC verbs that change cluster state.
+var mutatingVerbs = map[string]bool{
+	"create": true, "update": true, "patch": true, "delete": true, "deletecollection": true,
+}
+
+// readOnlyConflicts returns the enabled features that would mutate the
+// cluster, derived from the permissions table so that a new mutating
+// feature cannot slip past -read-only.
+func readOnlyConflicts(o *options) []string {
+	var conflicts []string
+	for _, p := range permissions {
+		if !p.enabled(o) {
+			continue
+		}
+		for _, verb := range p.Verbs {
+			// A feature may mutate several resources
+			if mutatingVerbs[verb] && !slices.Contains(conflicts, p.Feature) {
+				conflicts = append(conflicts, p.Feature)
+				break
+			}
+		}
+	}
+	return conflicts
+}
+
+// readOnlyTransport rejects every request that could mutate the cluster
+// before it leaves the process. SelfSubjectAccessReviews are POSTs but only
+// ask the API server a question, so they pass.
+type readOnlyTransport struct {
+	next http.RoundTripper
+}
+
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.next.RoundTrip(req)
+	case http.MethodPost:
+		if strings.HasSuffix(req.URL.Path, "/selfsubjectaccessreviews") {
+			return t.next.RoundTrip(req)
+		}
+	}
+	return nil, fmt.Errorf("-read-only: refusing %s %s", req.Method, req.URL.Path)
+}
+
+// wrapReadOnly is meant to be used as rest.Config.WrapTransport.
+func wrapReadOnly(rt http.RoundTripper) http.RoundTripper {
+	return &readOnlyTransport{next: rt}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// verbMethods is the HTTP method of the API requests of each RBAC verb.
+var verbMethods = map[string]string{
+	"get":              http.MethodGet,
+	"list":             http.MethodGet,
+	"watch":            http.MethodGet,
+	"create":           http.MethodPost,
+	"update":           http.MethodPut,
+	"patch":            http.MethodPatch,
+	"delete":           http.MethodDelete,
+	"deletecollection": http.MethodDelete,
+}
+
+// recordingTransport stands for the API server, recording what reaches it.
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+// TestReadOnlyTransportCoversEveryPermission sends the request of every verb
+// of every row of the permissions table through the -read-only transport:
+// reads reach the server, mutations never do.
+func TestReadOnlyTransportCoversEveryPermission(t *testing.T) {
+	for _, p := range permissions {
+		for _, verb := range p.Verbs {
+			method, ok := verbMethods[verb]
+			if !ok {
+				t.Fatalf("%s: no HTTP method known for verb %q", p.Feature, verb)
+			}
+			server := &recordingTransport{}
+			path := "/apis/" + p.Group + "/v1/namespaces/apps/" + p.Resource + "/name"
+			if p.Group == "" {
+				path = "/api/v1/namespaces/apps/" + p.Resource + "/name"
+			}
+			_, err := wrapReadOnly(server).RoundTrip(httptest.NewRequest(method, path, nil))
+			if mutatingVerbs[verb] {
+				if err == nil || len(server.requests) > 0 {
+					t.Errorf("%s: %s %s reached the server under -read-only", p.Feature, verb, p.Resource)
+				}
+			} else if err != nil || len(server.requests) != 1 {
+				t.Errorf("%s: %s %s was refused under -read-only: %v", p.Feature, verb, p.Resource, err)
+			}
+		}
+	}
+
+	server := &recordingTransport{}
+	review := httptest.NewRequest(http.MethodPost, "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", nil)
+	if _, err := wrapReadOnly(server).RoundTrip(review); err != nil || len(server.requests) != 1 {
+		t.Errorf("the pre-flight SelfSubjectAccessReview was refused under -read-only: %v", err)
+	}
+}
+
+// TestReadOnlyConflicts enables the features of the permissions table and
+// checks that -read-only refuses exactly those with a mutating verb. Every
+// mutating row must be enabled by one of the cases, so that a new one
+// cannot go untested.
+func TestReadOnlyConflicts(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-name=db"}, nil},
+		{[]string{"-selector=app=db", "-check-store", "-check-controller", "-killswitch-configmap=platform/gate-bypass"}, nil},
+		{[]string{"-name=db", "-force-sync"}, []string{"forced sync"}},
+		{[]string{"-name=db", "-idempotency-key=run-42"}, []string{"notification deduplication"}},
+		{[]string{"-name=db", "-force-sync", "-idempotency-key=run-42"}, []string{"notification deduplication", "forced sync"}},
+		{[]string{"-name=db", "-check-store", "-revalidate-store"}, []string{"store revalidation"}},
+	}
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		args := append([]string{"-namespace=apps"}, tt.args...)
+		opts := parseTestOptions(t, args...)
+		conflicts := readOnlyConflicts(opts)
+		if strings.Join(conflicts, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("%q: readOnlyConflicts = %q, want %q", tt.args, conflicts, tt.want)
+		}
+		for _, feature := range conflicts {
+			covered[feature] = true
+		}
+
+		if _, err := validateTestOptions(t, append(args, "-read-only")...); (err != nil) != (len(tt.want) > 0) {
+			t.Errorf("%q -read-only: validate() = %v, want an error only with %q", tt.args, err, tt.want)
+		}
+	}
+	for _, p := range permissions {
+		for _, verb := range p.Verbs {
+			if mutatingVerbs[verb] && !covered[p.Feature] {
+				t.Errorf("no case enables %s, which needs %s", p.Feature, verb)
+			}
+		}
+	}
+}
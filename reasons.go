@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// reasonCode is a stable, machine-readable code attached to every failed
+// result, meant for automation to branch on instead of the messages.
+type reasonCode string
+
+const (
+	reasonReadyTimeout         reasonCode = "ReadyTimeout"
+	reasonFatalCondition       reasonCode = "FatalCondition"
+	reasonStoreNotFound        reasonCode = "StoreNotFound"
+	reasonStoreUnhealthy       reasonCode = "StoreUnhealthy"
+	reasonProviderDenied       reasonCode = "ProviderAccessDenied"
+	reasonCRDMissing           reasonCode = "CRDMissing"
+	reasonRBACDenied           reasonCode = "RBACDenied"
+	reasonResourceNotFound     reasonCode = "ResourceNotFound"
+	reasonTargetSecretMissing  reasonCode = "TargetSecretMissing"
+	reasonKeysMissing          reasonCode = "KeysMissing"
+	reasonSLAViolated          reasonCode = "SLAViolated"
+	reasonUnreconciled         reasonCode = "Unreconciled"
+	reasonObjectReplaced       reasonCode = "ObjectReplaced"
+	reasonSecretsDiverged      reasonCode = "SecretsDiverged"
+	reasonMetadataMismatch     reasonCode = "TemplateMetadataMismatch"
+	reasonCanceled             reasonCode = "Canceled"
+	reasonNamespaceTerminating reasonCode = "NamespaceTerminating"
+	reasonFrozenStatus         reasonCode = "FrozenStatus"
+	reasonInternalError        reasonCode = "InternalError"
+)
+
+// reasonCodes is the single source of truth of the reason codes and their
+// meaning; the usage message is generated from it.
+var reasonCodes = []struct {
+	Code        reasonCode
+	Description string
+}{
+	{reasonReadyTimeout, "the resource did not become Ready before the timeout"},
+	{reasonFatalCondition, "a condition matched -fail-on-condition or -fatal-reason, or reported a template error"},
+	{reasonStoreNotFound, "the referenced SecretStore or ClusterSecretStore does not exist"},
+	{reasonStoreUnhealthy, "the referenced store is not Ready"},
+	{reasonProviderDenied, "the provider rejected the credentials of the store"},
+	{reasonCRDMissing, "the ExternalSecret resource type is not served by the cluster"},
+	{reasonRBACDenied, "the API server refused access to a required resource"},
+	{reasonResourceNotFound, "the ExternalSecret does not exist"},
+	{reasonTargetSecretMissing, "the resource is Ready but its target Secret does not exist"},
+	{reasonKeysMissing, "the target Secret has fewer data keys than -min-keys, or lacks keys of -require-keys"},
+	{reasonSLAViolated, "the resource became Ready, but slower than -max-wait-for-pass or -max-sync-latency"},
+	{reasonUnreconciled, "the controller never reconciled the resource"},
+	{reasonObjectReplaced, "the object requested by -uid was replaced by another one"},
+	{reasonSecretsDiverged, "the target Secrets of the resource and its -compare-with counterpart have different keys"},
+	{reasonMetadataMismatch, "the target Secret lacks labels or annotations of spec.target.template.metadata"},
+	{reasonCanceled, "the run was canceled before a result was reached"},
+	{reasonNamespaceTerminating, "the namespace of the resource is being deleted"},
+	{reasonFrozenStatus, "the resource is Ready, but its condition, refreshTime and target Secret are all older than -max-condition-age"},
+	{reasonInternalError, "any other failure, such as an unreachable API server"},
+}
+
+// reasonCodeFor classifies a finished result. Successful and skipped
+// results have no code.
+func reasonCodeFor(r *checkResult) reasonCode {
+	switch r.Outcome {
+	case outcomeReady, outcomeSkipped, outcomeBypassed, outcomeDeleted, "":
+		return ""
+	case outcomeSLOViolated:
+		return reasonSLAViolated
+	case outcomeFatalCondition:
+		if r.fatalCode != "" {
+			return r.fatalCode
+		}
+		return reasonFatalCondition
+	case outcomeUnreconciled:
+		return reasonUnreconciled
+	case outcomeTooFewKeys, outcomeMissingKeys:
+		return reasonKeysMissing
+	case outcomeReplaced:
+		return reasonObjectReplaced
+	case outcomeDiverged:
+		return reasonSecretsDiverged
+	case outcomeMetadataMismatch:
+		return reasonMetadataMismatch
+	case outcomeCanceled:
+		return reasonCanceled
+	case outcomeNamespaceTerminating:
+		return reasonNamespaceTerminating
+	}
+
+	switch err := r.lastErr; {
+	case errors.Is(err, context.Canceled):
+		return reasonCanceled
+	case errors.Is(err, errNotServed):
+		return reasonCRDMissing
+	case apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err):
+		return reasonRBACDenied
+	case isResourceUnavailable(err):
+		return reasonCRDMissing
+	case apierrors.IsNotFound(err):
+		return reasonResourceNotFound
+	case r.targetMissing:
+		return reasonTargetSecretMissing
+	case r.Outcome == outcomeTimeout:
+		return reasonReadyTimeout
+	default:
+		return reasonInternalError
+	}
+}
+
+// printReasonCodes documents the reason codes in the usage message.
+func printReasonCodes(w io.Writer) {
+	fmt.Fprintln(w, "Reason codes of failed results:")
+	for _, rc := range reasonCodes {
+		fmt.Fprintf(w, "  %-20s %s\n", rc.Code, rc.Description)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TestReasonCodeMapping pins the code of every outcome, and of every error a
+// timed out or failed wait can end with. It fails when an outcome is added
+// without a code, or when a documented code can no longer be produced.
+func TestReasonCodeMapping(t *testing.T) {
+	byOutcome := map[outcome]reasonCode{
+		outcomeReady:                "",
+		outcomeSkipped:              "",
+		outcomeBypassed:             "",
+		outcomeDeleted:              "",
+		outcomeTimeout:              reasonReadyTimeout,
+		outcomeError:                reasonInternalError,
+		outcomeFatalCondition:       reasonFatalCondition,
+		outcomeSLOViolated:          reasonSLAViolated,
+		outcomeTooFewKeys:           reasonKeysMissing,
+		outcomeMissingKeys:          reasonKeysMissing,
+		outcomeUnreconciled:         reasonUnreconciled,
+		outcomeReplaced:             reasonObjectReplaced,
+		outcomeDiverged:             reasonSecretsDiverged,
+		outcomeMetadataMismatch:     reasonMetadataMismatch,
+		outcomeCanceled:             reasonCanceled,
+		outcomeNamespaceTerminating: reasonNamespaceTerminating,
+	}
+	esResource := schema.GroupResource{Group: externalSecretGVR.Group, Resource: externalSecretGVR.Resource}
+	cases := []struct {
+		name   string
+		result *checkResult
+		want   reasonCode
+	}{
+		{"missing store", &checkResult{Outcome: outcomeFatalCondition, fatalCode: reasonStoreNotFound}, reasonStoreNotFound},
+		{"unhealthy store", &checkResult{Outcome: outcomeFatalCondition, fatalCode: reasonStoreUnhealthy}, reasonStoreUnhealthy},
+		{"provider denied", &checkResult{Outcome: outcomeFatalCondition, fatalCode: reasonProviderDenied}, reasonProviderDenied},
+		{"frozen status", &checkResult{Outcome: outcomeFatalCondition, fatalCode: reasonFrozenStatus}, reasonFrozenStatus},
+		{"interrupted", &checkResult{Outcome: outcomeError, lastErr: fmt.Errorf("waiting: %w", context.Canceled)}, reasonCanceled},
+		{"not served", &checkResult{Outcome: outcomeError, lastErr: errNotServed}, reasonCRDMissing},
+		{"resource unavailable", &checkResult{Outcome: outcomeTimeout, lastErr: apierrors.NewNotFound(esResource, "")}, reasonCRDMissing},
+		{"forbidden", &checkResult{Outcome: outcomeError, lastErr: apierrors.NewForbidden(esResource, "db", errors.New("no"))}, reasonRBACDenied},
+		{"unauthorized", &checkResult{Outcome: outcomeTimeout, lastErr: apierrors.NewUnauthorized("expired token")}, reasonRBACDenied},
+		{"not found", &checkResult{Outcome: outcomeTimeout, lastErr: apierrors.NewNotFound(esResource, "db")}, reasonResourceNotFound},
+		{"target missing", &checkResult{Outcome: outcomeTimeout, targetMissing: true}, reasonTargetSecretMissing},
+		{"unreachable", &checkResult{Outcome: outcomeError, lastErr: errors.New("connection refused")}, reasonInternalError},
+	}
+	for _, o := range outcomes {
+		want, ok := byOutcome[o]
+		if !ok {
+			t.Errorf("outcome %s has no expected reason code", o)
+			continue
+		}
+		cases = append(cases, struct {
+			name   string
+			result *checkResult
+			want   reasonCode
+		}{string(o), &checkResult{Outcome: o}, want})
+	}
+
+	documented := map[reasonCode]bool{}
+	for _, rc := range reasonCodes {
+		documented[rc.Code] = true
+	}
+	produced := map[reasonCode]bool{}
+	for _, test := range cases {
+		got := reasonCodeFor(test.result)
+		if got != test.want {
+			t.Errorf("%s: reason code = %q, want %q", test.name, got, test.want)
+		}
+		if got != "" && !documented[got] {
+			t.Errorf("%s: reason code %s is not documented", test.name, got)
+		}
+		produced[got] = true
+	}
+	for code := range documented {
+		if !produced[code] {
+			t.Errorf("documented reason code %s is never produced", code)
+		}
+	}
+}
+
+func TestUsageDocumentsReasonCodes(t *testing.T) {
+	var usage strings.Builder
+	printReasonCodes(&usage)
+	for _, rc := range reasonCodes {
+		if !strings.Contains(usage.String(), fmt.Sprintf("  %-20s %s\n", rc.Code, rc.Description)) {
+			t.Errorf("the usage lacks %s:\n%s", rc.Code, usage.String())
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// recordRotations is how many rotated -record files are kept besides the
+// current one, as path.1 (the newest) to path.N.
+const recordRotations = 2
+
+// Types of replayRecord.
+const (
+	recordHeader    = "header"
+	recordObject    = "object"
+	recordEvent     = "event"
+	recordPhase     = "phase"
+	recordForceSync = "force-sync"
+	recordResult    = "result"
+)
+
+// replayRecord is one NDJSON line of a -record file. Every file starts with
+// a header, so that each one can be replayed on its own once the older ones
+// rotated away.
+type replayRecord struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	// Kind, Version and Started are those of the run, in headers.
+	Kind    string     `json:"kind,omitempty"`
+	Version string     `json:"version,omitempty"`
+	Started *time.Time `json:"started,omitempty"`
+	// Object is a redacted snapshot and Decision what the run judged it.
+	Object   json.RawMessage `json:"object,omitempty"`
+	Decision string          `json:"decision,omitempty"`
+	Event    *notifyEvent    `json:"event,omitempty"`
+	Phase    string          `json:"phase,omitempty"`
+	// RefreshedAfter is the refreshTime a forced sync must advance past.
+	RefreshedAfter *time.Time    `json:"refreshedAfter,omitempty"`
+	Result         *resultRecord `json:"result,omitempty"`
+}
+
+// recorder writes what the run saw to -record for the replay subcommand:
+// the object snapshots with the decision taken on each, the events and the
+// results. The output is gzip-compressed NDJSON, rotated once the current
+// file reaches maxSize. Snapshots go through redactObject and events and
+// results carry messages already masked by -redact-pattern; ExternalSecrets
+// never contain secret values, and Secrets are never recorded. Recording is
+// best effort: the first write error is warned about and ends it. All
+// methods are safe to call on a nil recorder.
+type recorder struct {
+	path    string
+	maxSize int64
+	header  replayRecord
+
+	mu      sync.Mutex
+	file    *os.File
+	written *countingWriter
+	gz      *gzip.Writer
+	failed  bool
+	// decisions is the last recorded resourceVersion and decision of each
+	// resource, so that re-evaluations of the same state are not repeated.
+	decisions map[string]string
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// openRecorder starts recording to path for a run waiting for kind.
+func openRecorder(path string, maxSize int64, kind string) (*recorder, error) {
+	now := time.Now().UTC()
+	r := &recorder{
+		path:      path,
+		maxSize:   maxSize,
+		header:    replayRecord{Type: recordHeader, Kind: kind, Version: currentVersion(), Started: &now},
+		decisions: map[string]string{},
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *recorder) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.written = &countingWriter{w: file}
+	r.gz = gzip.NewWriter(r.written)
+	header := r.header
+	header.Time = time.Now().UTC()
+	return r.encode(header)
+}
+
+// encode writes a record and flushes it, so that the size is known and a
+// crash loses nothing already recorded.
+func (r *recorder) encode(record replayRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := r.gz.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return r.gz.Flush()
+}
+
+// rotate moves the current file to path.1, shifting the older ones, and
+// starts a new one.
+func (r *recorder) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+	for i := recordRotations - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *recorder) closeFile() error {
+	err := r.gz.Close()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (r *recorder) write(record replayRecord) {
+	if r == nil {
+		return
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed {
+		return
+	}
+	err := r.encode(record)
+	if err == nil && r.written.n >= r.maxSize {
+		err = r.rotate()
+	}
+	if err != nil {
+		r.failed = true
+		console.warnf("Warning: -record %s: %v, recording stopped", r.path, err)
+	}
+}
+
+// object records a snapshot of the resource and the decision taken on it,
+// unless it is the same state and decision as last recorded.
+func (r *recorder) object(unstructuredES *unstructured.Unstructured, decision string, observedAt time.Time) {
+	if r == nil {
+		return
+	}
+	key := unstructuredES.GetNamespace() + "/" + unstructuredES.GetName()
+	state := unstructuredES.GetResourceVersion() + "\x00" + decision
+	r.mu.Lock()
+	repeated := r.decisions[key] == state
+	r.decisions[key] = state
+	r.mu.Unlock()
+	if repeated {
+		return
+	}
+	object, err := json.Marshal(redactObject(unstructuredES))
+	if err != nil {
+		return
+	}
+	r.write(replayRecord{
+		Type:      recordObject,
+		Time:      observedAt.UTC(),
+		Namespace: unstructuredES.GetNamespace(),
+		Name:      unstructuredES.GetName(),
+		Object:    object,
+		Decision:  decision,
+	})
+}
+
+// forceSync records the refreshTime a forced sync of the resource must
+// advance past.
+func (r *recorder) forceSync(namespace, name string, refreshedAfter time.Time) {
+	refreshedAfter = refreshedAfter.UTC()
+	r.write(replayRecord{Type: recordForceSync, Namespace: namespace, Name: name, RefreshedAfter: &refreshedAfter})
+}
+
+func (r *recorder) OnConditionChange(conditionTransition) {
+	// Transitions are replayed from the object snapshots
+}
+
+func (r *recorder) OnEvent(e *corev1.Event) {
+	event := notifyEvent{Type: e.Type, Reason: e.Reason, Message: e.Message}
+	if !e.LastTimestamp.IsZero() {
+		event.Time = e.LastTimestamp.UTC().Format(time.RFC3339)
+	}
+	r.write(replayRecord{Type: recordEvent, Namespace: e.InvolvedObject.Namespace, Name: e.InvolvedObject.Name, Event: &event})
+}
+
+func (r *recorder) OnPhaseChange(phase string) {
+	r.write(replayRecord{Type: recordPhase, Phase: phase})
+}
+
+func (r *recorder) OnResult(result *checkResult) {
+	r.write(replayRecord{Type: recordResult, Namespace: result.Namespace, Name: result.Name, Result: newResultRecord(result)})
+}
+
+func (r *recorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.closeFile(); err != nil && !r.failed {
+		console.warnf("Warning: -record %s: %v", r.path, err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"hash/fnv"
+	"regexp"
+	"sync"
+)
+
+// redactionMask replaces the parts of messages matching -redact-pattern.
+const redactionMask = "[REDACTED]"
+
+// redactor masks the parts of condition messages, event messages and hints
+// matching -redact-pattern before they reach any output or notification,
+// such as ARNs, vault paths or tokens embedded in provider errors. It counts
+// the distinct messages it masked per resource, keeping only their hashes.
+type redactor struct {
+	patterns []*regexp.Regexp
+
+	mu     sync.Mutex
+	masked map[string]map[uint64]bool
+}
+
+// redactions is the redactor of the run, set up once the flags are parsed.
+var redactions = &redactor{}
+
+// redact returns text with every match masked, counting it against the
+// resource when anything was.
+func (r *redactor) redact(namespace, name, text string) string {
+	if len(r.patterns) == 0 || text == "" {
+		return text
+	}
+	redacted := text
+	for _, re := range r.patterns {
+		redacted = re.ReplaceAllLiteralString(redacted, redactionMask)
+	}
+	if redacted == text {
+		return text
+	}
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.masked == nil {
+		r.masked = map[string]map[uint64]bool{}
+	}
+	key := namespace + "/" + name
+	if r.masked[key] == nil {
+		r.masked[key] = map[uint64]bool{}
+	}
+	r.masked[key][h.Sum64()] = true
+	return redacted
+}
+
+// count returns how many distinct messages of the resource were masked.
+func (r *redactor) count(namespace, name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.masked[namespace+"/"+name])
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Structured parts of SecretSyncedError messages, as written by the
+// controller and the providers: the spec.data index, the remoteRef key,
+// property and version.
+var (
+	remoteRefIndex    = regexp.MustCompile(`spec\.data\[(\d+)\]`)
+	remoteRefKey      = regexp.MustCompile(`\(key: ([^),]+)`)
+	remoteRefProperty = regexp.MustCompile(`(?:property[:=] ?|cannot find secret data for key: )"?([^\s",)]+)`)
+	remoteRefVersion  = regexp.MustCompile(`version[:=] ?"?([^\s",)]+)`)
+)
+
+// remoteRef is a spec.data entry of an ExternalSecret.
+type remoteRef struct {
+	SecretKey string
+	Key       string
+	Property  string
+	Version   string
+	// Missing is set when the sync error names the entry.
+	Missing bool
+}
+
+func (r remoteRef) String() string {
+	s := "remoteRef key=" + r.Key
+	if r.Property != "" {
+		s += " property=" + r.Property
+	}
+	if r.Version != "" {
+		s += " version=" + r.Version
+	}
+	return s
+}
+
+// remoteRefStatus correlates a sync error with the spec.data entries.
+type remoteRefStatus struct {
+	Entries []remoteRef
+}
+
+func (s *remoteRefStatus) String() string {
+	var missing []string
+	for _, entry := range s.Entries {
+		if entry.Missing {
+			missing = append(missing, entry.String())
+		}
+	}
+	return fmt.Sprintf("%d/%d keys resolvable; missing: %s", len(s.Entries)-len(missing), len(s.Entries), strings.Join(missing, ", "))
+}
+
+// parseRemoteRefFailure finds the spec.data entries a SecretSyncedError on
+// Ready=False names. It returns nil when the message has no structured part
+// that matches an entry, so that the raw message is shown as before.
+func parseRemoteRefFailure(unstructuredES *unstructured.Unstructured, conditions []Condition) *remoteRefStatus {
+	var message string
+	for _, condition := range conditions {
+		if condition.Type == "Ready" && condition.Status == "False" && condition.Reason == "SecretSyncedError" {
+			message = condition.Message
+		}
+	}
+	if message == "" {
+		return nil
+	}
+	entries := specDataEntries(unstructuredES)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	index := -1
+	if m := remoteRefIndex.FindStringSubmatch(message); m != nil {
+		index, _ = strconv.Atoi(m[1])
+	}
+	key, property, version := submatch(remoteRefKey, message), submatch(remoteRefProperty, message), submatch(remoteRefVersion, message)
+	found := false
+	for i := range entries {
+		entry := &entries[i]
+		switch {
+		case index >= 0:
+			entry.Missing = i == index
+		case key != "":
+			entry.Missing = entry.Key == key && (property == "" || entry.Property == property) && (version == "" || entry.Version == version)
+		}
+		found = found || entry.Missing
+	}
+	if !found {
+		return nil
+	}
+	return &remoteRefStatus{Entries: entries}
+}
+
+// specDataEntries returns the spec.data entries of the ExternalSecret.
+func specDataEntries(unstructuredES *unstructured.Unstructured) []remoteRef {
+	data, _, _ := unstructured.NestedSlice(unstructuredES.Object, "spec", "data")
+	var entries []remoteRef
+	for _, item := range data {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		ref := remoteRef{}
+		ref.SecretKey, _, _ = unstructured.NestedString(entry, "secretKey")
+		ref.Key, _, _ = unstructured.NestedString(entry, "remoteRef", "key")
+		ref.Property, _, _ = unstructured.NestedString(entry, "remoteRef", "property")
+		ref.Version, _, _ = unstructured.NestedString(entry, "remoteRef", "version")
+		entries = append(entries, ref)
+	}
+	return entries
+}
+
+func submatch(re *regexp.Regexp, s string) string {
+	if m := re.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// printRemoteRefs prints the per-entry status table under the progress line.
+func (c *checker) printRemoteRefs(status *remoteRefStatus) {
+	c.log.infof("  Remote refs: %s", status)
+	for _, entry := range status.Entries {
+		state := "ok"
+		if entry.Missing {
+			state = "missing"
+		}
+		c.log.infof("    %-7s %s: %s", state, entry.SecretKey, entry)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// hintBeingDeleted diagnoses a wait that timed out on an object being
+// deleted.
+const hintBeingDeleted = "BeingDeleted"
+
+// followObject keeps the wait on one object: that of -uid, else the first
+// one observed. An object recreated under the same name, as when a GitOps
+// tool replaces it, starts the wait over, so that the last status of the old
+// object cannot pass it; with -uid and -on-uid-change=fail, it fails the
+// wait instead.
+func (c *checker) followObject(state *waitState, name string, unstructuredES *unstructured.Unstructured, result *checkResult) error {
+	uid := string(unstructuredES.GetUID())
+	followed := state.uid
+	if followed == "" {
+		followed = c.uid
+	}
+	if followed != "" && uid != followed {
+		if c.uid != "" && !c.rebindOnUIDChange {
+			result.Outcome = outcomeReplaced
+			result.Reason = "uid " + uid
+			return fmt.Errorf("ExternalSecret %s was replaced: expected uid %s, found %s", name, c.uid, uid)
+		}
+		c.log.infof("*** ExternalSecret %s was recreated (uid %s -> %s), waiting for the new object to become Ready on its own ***", name, followed, uid)
+		if c.uid != "" {
+			c.uid = uid
+		}
+		state.restart()
+	}
+	state.uid = uid
+	return nil
+}
+
+// restart forgets what the wait observed of an object that was replaced.
+func (s *waitState) restart() {
+	s.previous = nil
+	s.readyStreak = 0
+	s.lastReadyAt = time.Time{}
+	s.unreconciled = nil
+	s.noProgress = nil
+	s.remoteRefs = ""
+	s.frozen = ""
+	s.terminating = nil
+	s.lastReport = time.Time{}
+}
+
+// beingDeleted reports whether the object has a deletionTimestamp. Its
+// status then no longer counts, Ready or not, and the wait goes on for the
+// object recreated in its place, if any. It is reported once rather than
+// printing the last conditions of the object at every change.
+func (c *checker) beingDeleted(state *waitState, name string, unstructuredES *unstructured.Unstructured) bool {
+	deleted := unstructuredES.GetDeletionTimestamp()
+	if deleted == nil {
+		return false
+	}
+	if state.terminating == nil {
+		held := ""
+		if finalizers := unstructuredES.GetFinalizers(); len(finalizers) > 0 {
+			held = ", held by finalizers " + strings.Join(finalizers, ", ")
+		}
+		c.log.warnf("Warning: %sExternalSecret %s is being deleted since %s%s; its status no longer counts, waiting for it to be recreated", c.prefix, name, formatTime(deleted.Time, time.Now()), held)
+	}
+	state.terminating = deleted
+	state.firstPoll = false
+	state.readyStreak = 0
+	return true
+}
+
+// beingDeletedHint explains a timeout on an object that was being deleted
+// since the given time.
+func beingDeletedHint(since *metav1.Time) hint {
+	return hint{
+		Code:    hintBeingDeleted,
+		Message: fmt.Sprintf("the ExternalSecret was being deleted since %s and no new object replaced it; the status of an object being deleted does not count", formatTime(since.Time, time.Now())),
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// objectState is one state of the ExternalSecret db across replacements.
+type objectState struct {
+	uid      string
+	ready    string
+	deleting bool
+}
+
+// replacedCluster serves the states in turn, one per Get, the last one from
+// then on.
+func replacedCluster(states ...objectState) *testCluster {
+	c := newTestCluster()
+	var mu sync.Mutex
+	c.dynamicClient.PrependReactor("get", "externalsecrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		state := states[0]
+		if len(states) > 1 {
+			states = states[1:]
+		}
+		object := newTestObject(action.GetResource(), "ExternalSecret", "apps", "db", readyCondition(state.ready, "SecretSynced"))
+		object.SetUID(types.UID(state.uid))
+		if state.deleting {
+			object.SetDeletionTimestamp(&metav1.Time{Time: time.Now().Add(-time.Second)})
+			object.SetFinalizers([]string{"argocd.argoproj.io/finalizer"})
+		}
+		return true, object, nil
+	})
+	return c
+}
+
+// TestWaitRequiresTheRecreatedObjectReady replaces the ExternalSecret mid-wait,
+// the old object turning Ready while being deleted: only the new object
+// becoming Ready ends the wait.
+func TestWaitRequiresTheRecreatedObjectReady(t *testing.T) {
+	out := captureConsole(t)
+	c := replacedCluster(
+		objectState{uid: "old", ready: "False"},
+		objectState{uid: "old", ready: "True", deleting: true},
+		objectState{uid: "old", ready: "True", deleting: true},
+		objectState{uid: "new", ready: "False"},
+		objectState{uid: "new", ready: "True"},
+	)
+	results, code := c.check(t, 10*time.Second, "-namespace=apps", "-name=db", "-interval=20ms", "-watch-mode=poll", "-skip-freshness")
+	if code != exitOK || !results[0].Ready() || results[0].Checks != 5 {
+		t.Fatalf("exit code %d, outcome %s after %d checks, want Ready at the fifth:\n%s", code, results[0].Outcome, results[0].Checks, out)
+	}
+	if state := newResultRecord(results[0]).ReadyState; state != readyDuringWait {
+		t.Errorf("readyState = %q, want %q", state, readyDuringWait)
+	}
+	if n := strings.Count(out.String(), "ExternalSecret db is being deleted"); n != 1 {
+		t.Errorf("the deletion was reported %d times, want once:\n%s", n, out)
+	}
+	if !strings.Contains(out.String(), "held by finalizers argocd.argoproj.io/finalizer") {
+		t.Errorf("the finalizers holding the deletion were not reported:\n%s", out)
+	}
+	if !strings.Contains(out.String(), "ExternalSecret db was recreated (uid old -> new)") {
+		t.Errorf("the replacement was not reported:\n%s", out)
+	}
+}
+
+// TestWaitOnObjectBeingDeleted times out on an object being deleted that
+// nothing replaces, explaining why.
+func TestWaitOnObjectBeingDeleted(t *testing.T) {
+	captureConsole(t)
+	c := replacedCluster(objectState{uid: "old", ready: "True", deleting: true})
+	results, code := c.check(t, 300*time.Millisecond, "-namespace=apps", "-name=db", "-interval=20ms", "-watch-mode=poll", "-skip-freshness")
+	if code != exitTimeout || results[0].Ready() {
+		t.Fatalf("exit code %d, outcome %s, want a timeout", code, results[0].Outcome)
+	}
+	found := false
+	for _, h := range results[0].Hints {
+		found = found || h.Code == hintBeingDeleted
+	}
+	if !found {
+		t.Errorf("hints = %+v, want %s", results[0].Hints, hintBeingDeleted)
+	}
+}
+
+// TestPinnedUIDFailsOnReplacement checks that -uid fails on a replaced
+// object, unless -on-uid-change=rebind follows the new one.
+func TestPinnedUIDFailsOnReplacement(t *testing.T) {
+	out := captureConsole(t)
+	c := replacedCluster(objectState{uid: "new", ready: "True"})
+	results, code := c.check(t, 5*time.Second, "-namespace=apps", "-name=db", "-uid=old", "-watch-mode=poll", "-skip-freshness")
+	if results[0].Outcome != outcomeReplaced || !failing(code) {
+		t.Errorf("exit code %d, outcome %s, want replaced:\n%s", code, results[0].Outcome, out)
+	}
+
+	c = replacedCluster(objectState{uid: "new", ready: "True"})
+	results, code = c.check(t, 5*time.Second, "-namespace=apps", "-name=db", "-uid=old", "-on-uid-change=rebind", "-watch-mode=poll", "-skip-freshness")
+	if code != exitOK || !results[0].Ready() {
+		t.Errorf("rebind: exit code %d, outcome %s, want Ready:\n%s", code, results[0].Outcome, out)
+	}
+}
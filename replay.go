@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const replayUsage = "Usage: ./external-secret-watcher replay [flags] <record-file>"
+
+// runReplay implements the replay subcommand: it re-runs the judgement of
+// the wait on the states a -record file holds, entirely offline, and prints
+// the timeline with the events and the recorded results. The flags of a
+// normal run are accepted, so that what-if changes such as another -for,
+// -fail-on-condition or -fatal-reason can be tried against what the run saw;
+// -kind defaults to the recorded one. Checks that need the cluster, such as
+// the freshness of the target Secret, are not replayed. It exits 0 when
+// every replayed resource ends up ready, 1 otherwise.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	var opts options
+	opts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 1 {
+		fmt.Println(replayUsage)
+		return 1
+	}
+	path := fs.Arg(0)
+	kindSet := false
+	fs.Visit(func(f *flag.Flag) { kindSet = kindSet || f.Name == "kind" })
+
+	records, err := readRecords(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(records) == 0 || records[0].Type != recordHeader {
+		fmt.Printf("Error: %s is not a -record file\n", path)
+		return 1
+	}
+	header := records[0]
+	if !kindSet {
+		opts.kind = header.Kind
+	}
+	kind, ok := resourceKinds[opts.kind]
+	if !ok {
+		fmt.Printf("Error: -kind must be %s, not %q\n", kindNames, opts.kind)
+		return 1
+	}
+	c := judgingChecker(&opts, kind)
+	if opts.minRefreshTimeRaw != "" {
+		// "now" is the start of the recorded run
+		started := header.Time
+		if header.Started != nil {
+			started = *header.Started
+		}
+		if c.minRefreshTime, err = parseMinRefreshTime(opts.minRefreshTimeRaw, started); err != nil {
+			fmt.Printf("Error: -min-refresh-time: %v\n", err)
+			return 1
+		}
+	}
+	fmt.Printf("Replaying %s of %s (recorded by %s)\n", path, kind.name, header.Version)
+
+	// The replayed and recorded verdicts of each resource, in the order
+	// they first appear. The replayed wait of a resource ends on the first
+	// state that ends it; later states are still shown.
+	var order []string
+	replayed := map[string]judgement{}
+	ended := map[string]bool{}
+	recorded := map[string]*resultRecord{}
+	refreshedAfter := map[string]time.Time{}
+	for _, record := range records {
+		key := record.Namespace + "/" + record.Name
+		stamp := record.Time.Format(time.RFC3339)
+		switch record.Type {
+		case recordObject:
+			object := &unstructured.Unstructured{}
+			if err := object.UnmarshalJSON(record.Object); err != nil {
+				fmt.Printf("%s %s: unreadable object: %v\n", stamp, key, err)
+				continue
+			}
+			rc := c
+			if after, ok := refreshedAfter[key]; ok && after.After(rc.minRefreshTime) {
+				rc.minRefreshTime = after
+			}
+			conditions, _ := parseConditions(object)
+			j := rc.judge(object, conditions)
+			if _, seen := replayed[key]; !seen {
+				order = append(order, key)
+			}
+			line := fmt.Sprintf("%s %s (resourceVersion %s): %s", stamp, key, object.GetResourceVersion(), j)
+			if j.String() != record.Decision {
+				line += fmt.Sprintf(" [recorded: %s]", record.Decision)
+			}
+			if ended[key] {
+				line += " (after the replayed wait ended)"
+			} else {
+				replayed[key] = j
+				ended[key] = j.verdict != "" || (j.ready && j.pending == "")
+			}
+			fmt.Println(line)
+		case recordEvent:
+			fmt.Printf("%s %s Event: %s - %s: %s\n", stamp, key, record.Event.Type, record.Event.Reason, record.Event.Message)
+		case recordForceSync:
+			if record.RefreshedAfter != nil {
+				refreshedAfter[key] = *record.RefreshedAfter
+				fmt.Printf("%s %s forced a sync, requiring a refresh after %s\n", stamp, key, record.RefreshedAfter.Format(time.RFC3339))
+			}
+		case recordPhase:
+			fmt.Printf("%s phase %s\n", stamp, record.Phase)
+		case recordResult:
+			recorded[key] = record.Result
+			fmt.Printf("%s %s recorded outcome: %s\n", stamp, key, describeRecordedResult(record.Result))
+		}
+	}
+
+	code := 0
+	fmt.Println("Replay summary:")
+	for _, key := range order {
+		j := replayed[key]
+		line := fmt.Sprintf("  %s: replayed %s", key, j)
+		if result := recorded[key]; result != nil {
+			line += ", recorded " + describeRecordedResult(result)
+		}
+		fmt.Println(line)
+		if !j.ready || j.pending != "" {
+			code = 1
+		}
+	}
+	if len(order) == 0 {
+		fmt.Println("  no object states were recorded")
+		code = 1
+	}
+	return code
+}
+
+func describeRecordedResult(result *resultRecord) string {
+	if result == nil {
+		return "none"
+	}
+	s := string(result.Outcome)
+	if result.Reason != "" {
+		s += " (" + result.Reason + ")"
+	}
+	return s
+}
+
+// readRecords reads a -record file along with the files rotated from it,
+// oldest first. Headers of the rotated files after the first are dropped.
+func readRecords(path string) ([]replayRecord, error) {
+	paths := []string{path}
+	for i := 1; i <= recordRotations; i++ {
+		paths = append([]string{fmt.Sprintf("%s.%d", path, i)}, paths...)
+	}
+	var records []replayRecord
+	found := false
+	for _, p := range paths {
+		file, err := os.Open(p)
+		if errors.Is(err, os.ErrNotExist) && p != path {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		fileRecords, err := decodeRecords(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", p, err)
+		}
+		if len(records) > 0 && len(fileRecords) > 0 && fileRecords[0].Type == recordHeader {
+			fileRecords = fileRecords[1:]
+		}
+		records = append(records, fileRecords...)
+	}
+	if !found {
+		return nil, fmt.Errorf("%s does not exist", path)
+	}
+	return records, nil
+}
+
+// decodeRecords reads the records of one file. A file cut short by a crash
+// yields the records written before.
+func decodeRecords(r io.Reader) ([]replayRecord, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	var records []replayRecord
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var record replayRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return records, err
+	}
+	return records, nil
+}
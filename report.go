@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// reportFiles holds the paths of the optional report artifacts. Empty paths
+// are skipped.
+type reportFiles struct {
+	csvReport       string
+	csvTransitions  string
+	stateFile       string
+	resultFile      string
+	metricsTextfile string
+
+	// enforce is -enforce; without it every exit code becomes 0.
+	enforce bool
+
+	// apiCalls and startup are set once the client configuration has been
+	// built.
+	apiCalls    *apiCallLog
+	startup     *startupTimer
+	logAPICalls bool
+	verbose     bool
+
+	captureFile string
+	captures    *captureBuffer
+	recorder    *recorder
+
+	observers *observerHub
+}
+
+// attachStats stamps the API calls and startup breakdown of a cluster on its
+// results, which all share them, and prints them as requested to log, with
+// the check durations of each result.
+func (f reportFiles) attachStats(calls *apiCallLog, startup *startupTimer, results []*checkResult, log *logger) {
+	stats := calls.Stats()
+	phases := startup.breakdown()
+	for _, result := range results {
+		result.Stats = &stats
+		result.Startup = phases
+	}
+	if f.verbose {
+		log.infof("Stats: %s", stats)
+		log.infof("Startup: %s", phases)
+		for _, result := range results {
+			if len(result.CheckTimings) > 0 {
+				log.infof("Checks of %s: %s", resourceLabel(result.Namespace, result.Name, true), result.CheckTimings)
+			}
+		}
+	}
+	if f.logAPICalls {
+		summary := calls.Summary()
+		for _, result := range results {
+			result.APICalls = summary
+		}
+		log.infof("API calls: %s", calls)
+	}
+}
+
+// write writes every requested report file. Each is written on its own:
+// one that fails is reported, but never keeps the others from being written.
+func (f reportFiles) write(results []*checkResult) error {
+	var all []*checkResult
+	for _, result := range results {
+		all = append(all, result.withCompared()...)
+	}
+	if f.apiCalls != nil {
+		f.attachStats(f.apiCalls, f.startup, results, console)
+	}
+	if f.captures != nil && len(f.captures.captures) > 1 {
+		printCaptureDiffs(f.captures.captures)
+	}
+	var errs []error
+	if f.captureFile != "" {
+		if err := writeFileAtomic(f.captureFile, func(w io.Writer) error {
+			return writeCaptures(w, f.captures.captures)
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("writing captures %s: %w", f.captureFile, err))
+		}
+	}
+	if f.stateFile != "" && len(results) > 0 && results[0].Simulated {
+		console.infof("Simulated run: state file %s left untouched", f.stateFile)
+	} else if f.stateFile != "" {
+		previous := loadState(f.stateFile)
+		for _, result := range results {
+			if result.UID == "" || result.Outcome == outcomeSkipped {
+				continue
+			}
+			entry, found := previous[stateKey(result.Namespace, result.Name)]
+			result.Change = compareState(entry, found, result.stateEntry())
+			if len(results) > 1 {
+				console.infof("Change since last run of %s: %s", resourceLabel(result.Namespace, result.Name, true), result.Change)
+			} else {
+				console.infof("Change since last run: %s", result.Change)
+			}
+			if found {
+				if drop := keyCountDrop(entry, result.stateEntry()); drop != "" {
+					console.warnf("Warning: %s", drop)
+				}
+			}
+		}
+		if err := saveState(f.stateFile, previous, all); err != nil {
+			errs = append(errs, fmt.Errorf("writing state file %s: %w", f.stateFile, err))
+		}
+	}
+	if f.resultFile != "" {
+		if err := writeFileAtomic(f.resultFile, func(w io.Writer) error {
+			return writeResultFile(w, all)
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("writing result file %s: %w", f.resultFile, err))
+		}
+	}
+	if f.metricsTextfile != "" {
+		if err := writeFileAtomic(f.metricsTextfile, func(w io.Writer) error {
+			return writeMetricsTextfile(w, all)
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("writing metrics textfile %s: %w", f.metricsTextfile, err))
+		}
+	}
+	if f.csvReport != "" {
+		if err := writeFileAtomic(f.csvReport, func(w io.Writer) error {
+			return writeCSVReport(w, all)
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("writing CSV report %s: %w", f.csvReport, err))
+		}
+	}
+	if f.csvTransitions != "" {
+		if err := writeFileAtomic(f.csvTransitions, func(w io.Writer) error {
+			return writeCSVTransitions(w, all)
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("writing CSV transitions %s: %w", f.csvTransitions, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func writeCSVReport(w io.Writer, results []*checkResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"cluster", "labels", "namespace", "name", "outcome", "reason", "wait_seconds", "sync_latency_seconds", "warning_events", "refresh_time", "change", "reason_code", "redactions", "simulated"})
+	for _, r := range results {
+		latency := ""
+		if r.Latency != nil {
+			latency = formatSeconds(r.Latency.Latency())
+		}
+		cw.Write([]string{
+			r.Cluster,
+			keyValueFlag(r.Labels).String(),
+			r.Namespace,
+			r.Name,
+			string(r.Outcome),
+			r.Reason,
+			formatSeconds(r.Waited),
+			latency,
+			strconv.Itoa(r.WarningEvents),
+			r.RefreshTime,
+			string(r.Change),
+			string(r.ReasonCode),
+			strconv.Itoa(redactions.count(r.Namespace, r.Name)),
+			strconv.FormatBool(r.Simulated),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeCSVTransitions(w io.Writer, results []*checkResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"cluster", "namespace", "name", "observed_at", "type", "from_status", "to_status", "reason", "message"})
+	for _, r := range results {
+		for _, t := range r.Transitions {
+			cw.Write([]string{
+				r.Cluster,
+				r.Namespace,
+				r.Name,
+				t.ObservedAt.UTC().Format(time.RFC3339),
+				t.Type,
+				t.FromStatus,
+				t.ToStatus,
+				t.Reason,
+				t.Message,
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
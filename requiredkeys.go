@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// errTargetSecretMissing is returned by checkRequiredKeys when the target
+// Secret does not exist.
+type errTargetSecretMissing struct {
+	name string
+}
+
+func (e *errTargetSecretMissing) Error() string {
+	return fmt.Sprintf("target Secret %s does not exist", e.name)
+}
+
+// checkRequiredKeys reads the target Secret of the ExternalSecret and returns
+// the required keys it lacks. With requireNonEmpty, keys whose value is empty
+// count as missing too. The read is time-boxed by timeout within ctx.
+func checkRequiredKeys(ctx context.Context, clientset kubernetes.Interface, unstructuredES *unstructured.Unstructured, keys []string, requireNonEmpty bool, timeout time.Duration) ([]string, error) {
+	target := targetSecretName(unstructuredES)
+	ctx, cancel, err := phaseContext(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	secret, err := clientset.CoreV1().Secrets(unstructuredES.GetNamespace()).Get(ctx, target, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, &errTargetSecretMissing{name: target}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read target Secret %s: %w", target, err)
+	}
+	var missing []string
+	for _, key := range keys {
+		value, ok := secret.Data[key]
+		if !ok || (requireNonEmpty && len(value) == 0) {
+			missing = append(missing, key)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// conditionRequirement is one -for requirement on a condition:
+// Type=Status, Type!=Status or Type alone for Type=True. A trailing ? makes
+// it optional: it only applies when the condition is present.
+type conditionRequirement struct {
+	Type     string
+	Status   string
+	Negated  bool
+	Optional bool
+}
+
+func (r conditionRequirement) String() string {
+	op := "="
+	if r.Negated {
+		op = "!="
+	}
+	s := r.Type + op + r.Status
+	if r.Optional {
+		s += "?"
+	}
+	return s
+}
+
+// parseRequirement parses a -for value.
+func parseRequirement(value string) (conditionRequirement, error) {
+	r := conditionRequirement{Status: "True"}
+	value, r.Optional = strings.CutSuffix(value, "?")
+	if conditionType, status, ok := strings.Cut(value, "!="); ok {
+		r.Type, r.Status, r.Negated = conditionType, status, true
+	} else if conditionType, status, ok := strings.Cut(value, "="); ok {
+		r.Type, r.Status = conditionType, status
+	} else {
+		r.Type = value
+	}
+	if r.Type == "" || r.Status == "" {
+		return conditionRequirement{}, fmt.Errorf("expected Type, Type=Status or Type!=Status with an optional trailing ?, got %q", value)
+	}
+	return r, nil
+}
+
+// requirementVerdict is how a requirement fared against the last observed
+// conditions.
+type requirementVerdict struct {
+	Requirement string `json:"requirement"`
+	Satisfied   bool   `json:"satisfied"`
+	// Observed is the status of the condition, empty when it is absent.
+	Observed string `json:"observed,omitempty"`
+}
+
+func (v requirementVerdict) String() string {
+	state := "pending"
+	if v.Satisfied {
+		state = "satisfied"
+	}
+	observed := v.Observed
+	if observed == "" {
+		observed = "absent"
+	}
+	return fmt.Sprintf("%s %s (%s)", v.Requirement, state, observed)
+}
+
+// checkRequirements evaluates every requirement against the same set of
+// conditions and reports whether all of them are satisfied.
+func checkRequirements(conditions []Condition, requirements []conditionRequirement) ([]requirementVerdict, bool) {
+	verdicts := make([]requirementVerdict, len(requirements))
+	all := true
+	for i, r := range requirements {
+		verdict := requirementVerdict{Requirement: r.String()}
+		present := false
+		for _, condition := range conditions {
+			if condition.Type == r.Type {
+				present = true
+				verdict.Observed = condition.Status
+				break
+			}
+		}
+		switch {
+		case !present:
+			// An absent condition has no status, which satisfies a
+			// negated requirement
+			verdict.Satisfied = r.Optional || r.Negated
+		case r.Negated:
+			verdict.Satisfied = verdict.Observed != r.Status
+		default:
+			verdict.Satisfied = verdict.Observed == r.Status
+		}
+		all = all && verdict.Satisfied
+		verdicts[i] = verdict
+	}
+	return verdicts, all
+}
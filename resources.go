@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// lightMemoryBudget is the -max-memory below which the lighter strategies
+// are used.
+const lightMemoryBudget = 32 << 20
+
+// lightObserverBuffer replaces observerBuffer under a light memory budget.
+const lightObserverBuffer = 16
+
+// The CPU quota files of cgroup v2 and v1.
+const (
+	cgroupV2CPUMax = "/sys/fs/cgroup/cpu.max"
+	cgroupV1Quota  = "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"
+	cgroupV1Period = "/sys/fs/cgroup/cpu/cpu.cfs_period_us"
+)
+
+// resourceStrategy is how the run fits its CPU and memory limits.
+type resourceStrategy struct {
+	maxProcs       int
+	maxProcsOrigin string
+	memoryLimit    int64
+	observerBuffer int
+}
+
+// applyResourceLimits sizes GOMAXPROCS to the container CPU quota unless
+// GOMAXPROCS is set, and applies -max-memory as the soft memory limit of
+// the runtime. A low budget also shrinks the observer buffers.
+func applyResourceLimits(maxMemory string) (resourceStrategy, error) {
+	strategy := resourceStrategy{maxProcs: runtime.GOMAXPROCS(0), maxProcsOrigin: originDefault, observerBuffer: observerBuffer}
+	if os.Getenv("GOMAXPROCS") != "" {
+		strategy.maxProcsOrigin = originEnv
+	} else if quota, ok := cgroupCPUQuota(); ok && quota < strategy.maxProcs {
+		runtime.GOMAXPROCS(quota)
+		strategy.maxProcs = quota
+		strategy.maxProcsOrigin = "cgroup"
+	}
+
+	if maxMemory == "" {
+		return strategy, nil
+	}
+	q, err := resource.ParseQuantity(maxMemory)
+	if err != nil {
+		return strategy, fmt.Errorf("-max-memory: %w", err)
+	}
+	if q.Sign() <= 0 {
+		return strategy, fmt.Errorf("-max-memory must be positive, not %s", maxMemory)
+	}
+	strategy.memoryLimit = q.Value()
+	debug.SetMemoryLimit(strategy.memoryLimit)
+	if strategy.memoryLimit < lightMemoryBudget {
+		strategy.observerBuffer = lightObserverBuffer
+	}
+	return strategy, nil
+}
+
+// cgroupCPUQuota returns the CPU quota of the container, rounded up to whole
+// CPUs, if one is set.
+func cgroupCPUQuota() (int, bool) {
+	var quota, period float64
+	if raw, err := os.ReadFile(cgroupV2CPUMax); err == nil {
+		fields := strings.Fields(string(raw))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		quota, _ = strconv.ParseFloat(fields[0], 64)
+		period, _ = strconv.ParseFloat(fields[1], 64)
+	} else {
+		rawQuota, err := os.ReadFile(cgroupV1Quota)
+		if err != nil {
+			return 0, false
+		}
+		rawPeriod, err := os.ReadFile(cgroupV1Period)
+		if err != nil {
+			return 0, false
+		}
+		quota, _ = strconv.ParseFloat(strings.TrimSpace(string(rawQuota)), 64)
+		period, _ = strconv.ParseFloat(strings.TrimSpace(string(rawPeriod)), 64)
+	}
+	if quota <= 0 || period <= 0 {
+		return 0, false
+	}
+	return int(math.Max(1, math.Ceil(quota/period))), true
+}
+
+// configEntries describes the strategy for the startup banner.
+func (s resourceStrategy) configEntries() []configEntry {
+	entries := []configEntry{{"GOMAXPROCS", strconv.Itoa(s.maxProcs), s.maxProcsOrigin}}
+	if s.memoryLimit > 0 {
+		mode := "standard buffers"
+		if s.observerBuffer < observerBuffer {
+			mode = "light buffers"
+		}
+		entries = append(entries, configEntry{"memory", fmt.Sprintf("%s soft limit, %s", resource.NewQuantity(s.memoryLimit, resource.BinarySI), mode), originFlag})
+	}
+	return entries
+}
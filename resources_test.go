@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// keepRuntimeLimits restores GOMAXPROCS and the memory limit once the test
+// ends, and sets GOMAXPROCS in the environment so that the cgroup quota of
+// the machine running the tests is left out.
+func keepRuntimeLimits(t *testing.T) {
+	maxProcs := runtime.GOMAXPROCS(0)
+	memoryLimit := debug.SetMemoryLimit(-1)
+	t.Setenv("GOMAXPROCS", strconv.Itoa(maxProcs))
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(maxProcs)
+		debug.SetMemoryLimit(memoryLimit)
+	})
+}
+
+func TestApplyResourceLimits(t *testing.T) {
+	keepRuntimeLimits(t)
+	for _, test := range []struct {
+		maxMemory string
+		buffer    int
+		banner    string
+		err       string
+	}{
+		{"", observerBuffer, "", ""},
+		{"64Mi", observerBuffer, "64Mi soft limit, standard buffers", ""},
+		{"24Mi", lightObserverBuffer, "24Mi soft limit, light buffers", ""},
+		{"0", 0, "", "must be positive"},
+		{"lots", 0, "", "-max-memory"},
+	} {
+		strategy, err := applyResourceLimits(test.maxMemory)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: error = %v, want %q", test.maxMemory, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", test.maxMemory, err)
+		}
+		if strategy.observerBuffer != test.buffer || strategy.maxProcsOrigin != originEnv {
+			t.Errorf("%q: buffer %d, GOMAXPROCS from %s, want %d from %s", test.maxMemory, strategy.observerBuffer, strategy.maxProcsOrigin, test.buffer, originEnv)
+		}
+		banner := fmt.Sprint(strategy.configEntries())
+		if test.banner != "" && !strings.Contains(banner, test.banner) {
+			t.Errorf("%q: banner entries %s, want %q", test.maxMemory, banner, test.banner)
+		}
+		if test.maxMemory != "" && debug.SetMemoryLimit(-1) != strategy.memoryLimit {
+			t.Errorf("%q: the runtime memory limit was not set", test.maxMemory)
+		}
+	}
+}
+
+// stalledObserver blocks on its first update until released.
+type stalledObserver struct{ release chan struct{} }
+
+func (o stalledObserver) OnConditionChange(conditionTransition) { <-o.release }
+func (o stalledObserver) OnEvent(*corev1.Event)                 {}
+func (o stalledObserver) OnPhaseChange(string)                  {}
+func (o stalledObserver) OnResult(*checkResult)                 {}
+
+// TestLightBuffersBoundPendingUpdates publishes the transitions of thousands
+// of synthetic resources to a stalled observer: what is kept pending never
+// exceeds its buffer, the light one keeping a fraction of the standard one.
+func TestLightBuffersBoundPendingUpdates(t *testing.T) {
+	const resources = 5000
+	pending := map[int]int{}
+	for _, buffer := range []int{observerBuffer, lightObserverBuffer} {
+		hub := &observerHub{}
+		o := stalledObserver{release: make(chan struct{})}
+		hub.subscribe(o, buffer)
+		for i := 0; i < resources; i++ {
+			hub.conditionChanged(conditionTransition{Type: "Ready", ToStatus: "True", Reason: fmt.Sprintf("es-%d", i)})
+		}
+		pending[buffer] = len(hub.subscribers[0].updates)
+		if pending[buffer] > buffer {
+			t.Errorf("buffer %d: %d updates pending", buffer, pending[buffer])
+		}
+		close(o.release)
+		if dropped := hub.finish(nil); dropped < resources-int64(buffer)-1 {
+			t.Errorf("buffer %d: %d updates dropped, want at least %d", buffer, dropped, resources-buffer-1)
+		}
+	}
+	if pending[lightObserverBuffer] >= pending[observerBuffer] {
+		t.Errorf("light buffers keep %d updates pending, standard ones %d", pending[lightObserverBuffer], pending[observerBuffer])
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type outcome string
+
+const (
+	outcomeReady   outcome = "ready"
+	outcomeTimeout outcome = "timeout"
+	outcomeError   outcome = "error"
+	outcomeSkipped outcome = "skipped"
+	// outcomeFatalCondition is a resource whose conditions show that waiting
+	// longer will not help.
+	outcomeFatalCondition outcome = "fatal-condition"
+	// outcomeSLOViolated is a resource that became Ready, but too slowly.
+	outcomeSLOViolated outcome = "slo-violated"
+	// outcomeTooFewKeys is a Ready resource whose target Secret has fewer
+	// data keys than -min-keys.
+	outcomeTooFewKeys outcome = "too-few-keys"
+	// outcomeMissingKeys is a Ready resource whose target Secret lacks keys
+	// of -require-keys.
+	outcomeMissingKeys outcome = "missing-keys"
+	// outcomeUnreconciled is a resource the controller never reconciled: it
+	// still has no status conditions when the wait ends.
+	outcomeUnreconciled outcome = "unreconciled"
+	// outcomeReplaced is a resource requested by -uid that was deleted and
+	// recreated: the original object is gone.
+	outcomeReplaced outcome = "replaced"
+	// outcomeDiverged is a resource whose target Secret has other keys than
+	// that of its -compare-with counterpart.
+	outcomeDiverged outcome = "diverged"
+	// outcomeMetadataMismatch is a Ready resource whose target Secret lacks
+	// labels or annotations of spec.target.template.metadata.
+	outcomeMetadataMismatch outcome = "metadata-mismatch"
+	// outcomeCanceled is a resource whose wait was abandoned because
+	// another resource of the same run failed.
+	outcomeCanceled outcome = "canceled"
+	// outcomeNamespaceTerminating is a resource whose namespace is being
+	// deleted.
+	outcomeNamespaceTerminating outcome = "namespace-terminating"
+	// outcomeBypassed is a resource that was not Ready when the
+	// -killswitch-configmap bypassed the gate.
+	outcomeBypassed outcome = "bypassed"
+	// outcomeDeleted is a resource that is gone, as -wait-for=deleted
+	// waits for.
+	outcomeDeleted outcome = "deleted"
+)
+
+// outcomes lists every outcome, for the schema subcommand.
+var outcomes = []outcome{
+	outcomeReady, outcomeTimeout, outcomeError, outcomeSkipped, outcomeFatalCondition,
+	outcomeSLOViolated, outcomeTooFewKeys, outcomeMissingKeys, outcomeUnreconciled,
+	outcomeReplaced, outcomeDiverged, outcomeMetadataMismatch, outcomeCanceled,
+	outcomeNamespaceTerminating, outcomeBypassed, outcomeDeleted,
+}
+
+// checkResult is the final state of a single checked ExternalSecret. It is
+// filled in progressively by the wait loop so that whatever was observed is
+// still available when the run ends early.
+type checkResult struct {
+	Cluster   string
+	Labels    map[string]string
+	Namespace string
+	Name      string
+	Outcome   outcome
+	// ReasonCode classifies failed results for automation.
+	ReasonCode reasonCode
+	// ReadyState tells apart resources that were already Ready from those
+	// that became Ready during the wait.
+	ReadyState    string
+	Reason        string
+	Waited        time.Duration
+	Latency       *syncLatency
+	WarningEvents int
+	RefreshTime   string
+	UID           string
+	DataHash      string
+	// SecretKeys is the number of data keys of the target Secret, when read.
+	SecretKeys int
+	// MissingKeys lists the keys of -require-keys the target Secret lacks.
+	MissingKeys []string
+	// Binding is the Secret that satisfied the wait, for Ready results.
+	Binding  *secretBinding
+	Change   stateDelta
+	APICalls map[string]int
+	Stats    *apiStats
+	// Startup is the startup breakdown of the cluster.
+	Startup startupPhases
+	// CheckTimings are the durations of the timed checks of the resource.
+	CheckTimings checkTimings
+	// CallTimeouts counts requests that hit the per-call timeout.
+	CallTimeouts int
+
+	// LagAttribution states which of the ExternalSecret status and the
+	// target Secret last changed, when the target Secret is watched.
+	LagAttribution string
+	Hints          []hint
+
+	// SLOViolations lists the thresholds exceeded by an otherwise Ready
+	// resource, keeping "slow" distinguishable from "broken".
+	SLOViolations []string
+	Conditions    []Condition
+	// DuplicateConditions lists condition types the controller wrote more
+	// than once, an anomaly worth reporting.
+	DuplicateConditions []string
+	Transitions         []conditionTransition
+	// TemplateError is the template failure reported by the conditions.
+	TemplateError *templateError
+
+	// ClockSkewNote is set when the clock skew tolerance decided the
+	// freshness verdict.
+	ClockSkewNote string
+
+	// SkippedPhases lists the phases after the wait that did not run, with
+	// the reason.
+	SkippedPhases []string
+
+	// Requirements are the verdicts of the -for requirements on the last
+	// observed conditions.
+	Requirements []requirementVerdict
+	// Checks counts the observations of the resource during the wait: the
+	// Gets and the evaluations of watched or cached states.
+	Checks int
+	// RecentEvents are the last events of the resource.
+	RecentEvents []notifyEvent
+	// RemoteRefs correlates the last sync error with the spec.data entries,
+	// when its message names one.
+	RemoteRefs *remoteRefStatus
+	// MetadataIssues lists the differences found by
+	// -verify-template-metadata.
+	MetadataIssues []metadataIssue
+	// Store is the store the ExternalSecret refers to, nil until it was
+	// read or for resources without one, and StoreReady the Ready
+	// condition of the store when -check-store read it.
+	Store      *storeRef
+	StoreReady *Condition
+
+	// Compared is the result of the -compare-with resource, and Comparison
+	// the verdict of comparing both target Secrets.
+	Compared   *checkResult
+	Comparison *secretComparison
+
+	// IdempotencyKey is -idempotency-key, attached to the notifications.
+	IdempotencyKey string
+	// Duplicate marks a failure already notified under the same
+	// IdempotencyKey, which consumers should not notify again.
+	Duplicate bool
+	// Simulated marks results produced by -simulate.
+	Simulated bool
+	// Enforced is -enforce: the failures of a run that does not enforce
+	// are reported in full but do not fail it.
+	Enforced bool
+
+	// Config is the effective configuration of the run, printed at startup.
+	Config []configEntry
+
+	// object is the last fetched ExternalSecret, if any.
+	object *unstructured.Unstructured
+	// lastErr is the error of the last failed request or the run, if any.
+	lastErr error
+	// fatalCode is the reason code of the fatal reason rule the resource
+	// failed on, if any.
+	fatalCode reasonCode
+	// targetMissing is set while the target Secret of a Ready resource is
+	// found missing.
+	targetMissing bool
+	// entry is the -from-file entry of the resource, if any.
+	entry *waitEntry
+	// priority is set for resources matching -priority-selector.
+	priority bool
+}
+
+// observe records the latest fetched state of the ExternalSecret.
+func (r *checkResult) observe(unstructuredES *unstructured.Unstructured, conditions []Condition) {
+	r.object = unstructuredES
+	r.UID = string(unstructuredES.GetUID())
+	r.Conditions = conditions
+	r.RefreshTime, _, _ = unstructured.NestedString(unstructuredES.Object, "status", "refreshTime")
+	r.Store = nil
+	if ref, ok := secretStoreRef(unstructuredES); ok {
+		r.Store = &ref
+	}
+	r.Reason = ""
+	for _, condition := range conditions {
+		if condition.Type == "Ready" {
+			r.Reason = condition.Reason
+			break
+		}
+	}
+}
+
+// Ready reports whether the resource passed the wait: it is functionally
+// Ready, including when it violated an SLO on the way, or it is gone under
+// -wait-for=deleted.
+func (r *checkResult) Ready() bool {
+	return r.Outcome == outcomeReady || r.Outcome == outcomeSLOViolated || r.Outcome == outcomeDeleted
+}
+
+// skipPhase records that a phase after the wait did not run.
+func (r *checkResult) skipPhase(phase string, err error) {
+	r.SkippedPhases = append(r.SkippedPhases, fmt.Sprintf("%s: %v", phase, err))
+}
+
+// failed marks the result as an error that happened before or outside of the
+// readiness evaluation.
+func (r *checkResult) failed(err error) *checkResult {
+	r.Outcome = outcomeError
+	r.Reason = err.Error()
+	r.lastErr = err
+	return r
+}
+
+// withCompared returns the result followed by that of the -compare-with
+// resource, if any.
+func (r *checkResult) withCompared() []*checkResult {
+	if r.Compared == nil {
+		return []*checkResult{r}
+	}
+	return []*checkResult{r, r.Compared}
+}
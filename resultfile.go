@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// writeResultFile writes the result as a JSON object, or the results of a
+// run checking several resources as an array, for pipeline integration.
+func writeResultFile(w io.Writer, results []*checkResult) error {
+	records := make([]*resultRecord, len(results))
+	for i, result := range results {
+		records[i] = newResultRecord(result)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if len(records) == 1 {
+		return encoder.Encode(records[0])
+	}
+	return encoder.Encode(records)
+}
+
+// writeMetricsTextfile writes the results in the Prometheus textfile
+// collector format, for node-exporter or a sidecar to scrape.
+func writeMetricsTextfile(w io.Writer, results []*checkResult) error {
+	var b strings.Builder
+	b.WriteString("# HELP external_secret_ready_duration_seconds How long the run waited for the ExternalSecret, until Ready or until it gave up.\n")
+	b.WriteString("# TYPE external_secret_ready_duration_seconds gauge\n")
+	for _, r := range results {
+		fmt.Fprintf(&b, "external_secret_ready_duration_seconds{%s,outcome=\"%s\"} %g\n", metricLabels(r), escapeLabelValue(string(r.Outcome)), r.Waited.Seconds())
+	}
+	b.WriteString("# HELP external_secret_ready Whether the ExternalSecret became Ready, by status.\n")
+	b.WriteString("# TYPE external_secret_ready gauge\n")
+	for _, r := range results {
+		ready, notReady := 0, 1
+		if r.Ready() {
+			ready, notReady = 1, 0
+		}
+		fmt.Fprintf(&b, "external_secret_ready{%s,status=\"true\"} %d\n", metricLabels(r), ready)
+		fmt.Fprintf(&b, "external_secret_ready{%s,status=\"false\"} %d\n", metricLabels(r), notReady)
+	}
+	b.WriteString("# HELP external_secret_checks How many times the run observed the ExternalSecret.\n")
+	b.WriteString("# TYPE external_secret_checks gauge\n")
+	for _, r := range results {
+		fmt.Fprintf(&b, "external_secret_checks{%s} %d\n", metricLabels(r), r.Checks)
+	}
+	// Only Ready resources have a sync latency
+	latencyWritten := false
+	for _, r := range results {
+		if r.Latency == nil {
+			continue
+		}
+		if !latencyWritten {
+			b.WriteString("# HELP external_secret_sync_latency_seconds How long the controller took to bring the ExternalSecret to Ready after its creation.\n")
+			b.WriteString("# TYPE external_secret_sync_latency_seconds gauge\n")
+			latencyWritten = true
+		}
+		fmt.Fprintf(&b, "external_secret_sync_latency_seconds{%s} %g\n", metricLabels(r), r.Latency.Latency().Seconds())
+	}
+	// The startup is that of the cluster, shared by its resources
+	startupWritten := map[string]bool{}
+	for _, r := range results {
+		if len(r.Startup) == 0 || startupWritten[r.Cluster] {
+			continue
+		}
+		if len(startupWritten) == 0 {
+			b.WriteString("# HELP external_secret_checker_startup_seconds How long each startup phase of the checker took, until the first successful Get.\n")
+			b.WriteString("# TYPE external_secret_checker_startup_seconds gauge\n")
+		}
+		startupWritten[r.Cluster] = true
+		labels := ""
+		if r.Cluster != "" {
+			labels = fmt.Sprintf("cluster=\"%s\",", escapeLabelValue(r.Cluster))
+		}
+		for _, phase := range r.Startup {
+			fmt.Fprintf(&b, "external_secret_checker_startup_seconds{%sphase=\"%s\"} %g\n", labels, phase.Name, phase.Duration.Seconds())
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// metricLabels identifies the resource of a result in metric samples,
+// marking those of -simulate so that they cannot pass for real ones. The
+// labels of -label follow as label_<key>, as kube-state-metrics names
+// Kubernetes labels, so that they never clash with those of the samples.
+func metricLabels(r *checkResult) string {
+	labels := fmt.Sprintf("namespace=\"%s\",name=\"%s\"", escapeLabelValue(r.Namespace), escapeLabelValue(r.Name))
+	if r.Cluster != "" {
+		labels += fmt.Sprintf(",cluster=\"%s\"", escapeLabelValue(r.Cluster))
+	}
+	keys := make([]string, 0, len(r.Labels))
+	for key := range r.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		labels += fmt.Sprintf(",label_%s=\"%s\"", metricLabelName.ReplaceAllString(key, "_"), escapeLabelValue(r.Labels[key]))
+	}
+	if r.Simulated {
+		labels += ",simulated=\"true\""
+	}
+	return labels
+}
+
+// metricLabelName matches the characters label names cannot contain.
+var metricLabelName = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// escapeLabelValue escapes a label value of the text exposition format.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
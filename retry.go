@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// maxRetryBackoff caps the delay between retries after transient errors.
+const maxRetryBackoff = 30 * time.Second
+
+// requireExistsPolls is how many NotFound responses in a row fail a run
+// with -require-exists.
+const requireExistsPolls = 3
+
+// isTransient reports whether err is one that clears up on its own, such as
+// the API server being restarted during a control plane upgrade.
+func isTransient(err error) bool {
+	switch {
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsTooManyRequests(err),
+		apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err), apierrors.IsUnexpectedServerError(err):
+		return true
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code >= 500 {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isDenied reports whether the API server refused the credentials or the
+// request, which retrying does not fix.
+func isDenied(err error) bool {
+	return apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err)
+}
+
+// retryBackoff is the delay before the next attempt after failures
+// consecutive transient errors: base, doubling with every further failure,
+// capped at maxRetryBackoff unless base itself is longer.
+func retryBackoff(base time.Duration, failures int) time.Duration {
+	delay := base
+	for i := 1; i < failures && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff && base < maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return delay
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// storeValidationAnnotation is the annotation the store controller of the
+// external-secrets operator re-validates a SecretStore or ClusterSecretStore
+// on whenever its value changes, from storeValidationVersion on.
+const (
+	storeValidationAnnotation = "external-secrets.io/force-validation"
+	storeValidationVersion    = "v0.10.0"
+)
+
+// storeRevalidateTimeout bounds the wait for the store controller to
+// re-evaluate a store after -revalidate-store patched it.
+const storeRevalidateTimeout = 30 * time.Second
+
+// controllerVersionLabel is the label the Helm chart sets on the controller
+// pods to the release of the operator.
+const controllerVersionLabel = "app.kubernetes.io/version"
+
+// storeRevalidation is the -revalidate-store state of a cluster, shared by
+// its waits: whether the operator supports the annotation, detected once, and
+// the stores already revalidated, so that the ExternalSecrets of a store
+// patch it once and the others wait for that one revalidation.
+type storeRevalidation struct {
+	clientset kubernetes.Interface
+
+	detect      sync.Once
+	unsupported string
+
+	mu     sync.Mutex
+	stores map[string]*sync.Once
+}
+
+func newStoreRevalidation(clientset kubernetes.Interface) *storeRevalidation {
+	return &storeRevalidation{clientset: clientset, stores: map[string]*sync.Once{}}
+}
+
+// unsupportedReason returns why the operator cannot revalidate stores on the
+// annotation, empty when it can. An operator whose release cannot be told
+// is treated as lacking it, since the patch would then wait for nothing.
+func (s *storeRevalidation) unsupportedReason(ctx context.Context, perCallTimeout time.Duration) string {
+	s.detect.Do(func() {
+		release, err := controllerVersion(ctx, s.clientset, perCallTimeout)
+		if err != nil {
+			s.unsupported = fmt.Sprintf("the external-secrets release could not be detected: %v", err)
+			return
+		}
+		parsed, err := parseVersion(release)
+		if err != nil {
+			s.unsupported = fmt.Sprintf("the external-secrets release could not be detected: %v", err)
+			return
+		}
+		if required, _ := parseVersion(storeValidationVersion); olderThan(parsed, required) {
+			s.unsupported = fmt.Sprintf("external-secrets %s predates %s, whose store controller re-validates on %s", release, storeValidationVersion, storeValidationAnnotation)
+		}
+	})
+	return s.unsupported
+}
+
+// once returns the sync.Once revalidating the given store.
+func (s *storeRevalidation) once(key string) *sync.Once {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stores[key] == nil {
+		s.stores[key] = &sync.Once{}
+	}
+	return s.stores[key]
+}
+
+// controllerVersion returns the release of the external-secrets operator,
+// from the version label of its controller pods or else the image tag of
+// their first container.
+func controllerVersion(ctx context.Context, clientset kubernetes.Interface, perCallTimeout time.Duration) (string, error) {
+	ctx, cancel, err := phaseContext(ctx, perCallTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{LabelSelector: controllerSelector})
+	if err != nil {
+		return "", fmt.Errorf("listing the controller pods (%s): %w", controllerSelector, err)
+	}
+	for _, pod := range pods.Items {
+		if release := pod.Labels[controllerVersionLabel]; release != "" {
+			return release, nil
+		}
+		if len(pod.Spec.Containers) == 0 {
+			continue
+		}
+		image := pod.Spec.Containers[0].Image
+		image, _, _ = strings.Cut(image, "@")
+		if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i:], "/") {
+			return image[i+1:], nil
+		}
+	}
+	return "", fmt.Errorf("no controller pod (%s) carries %s or a tagged image", controllerSelector, controllerVersionLabel)
+}
+
+// revalidateStore patches the store the ExternalSecret refers to with
+// storeValidationAnnotation and waits, at most storeRevalidateTimeout, for
+// the store controller to write the store back, so that -check-store reads
+// a Ready condition evaluated after the patch rather than a stale one. It
+// never fails the wait: when the store cannot be revalidated, -check-store
+// goes on with its current state.
+func (c *checker) revalidateStore(ctx context.Context, unstructuredES *unstructured.Unstructured) {
+	ref, ok := secretStoreRef(unstructuredES)
+	if !ok {
+		return
+	}
+	gvr, clusterScoped, err := storeGVR(c.gvr, ref.Kind)
+	if err != nil {
+		return
+	}
+	namespace := unstructuredES.GetNamespace()
+	if clusterScoped {
+		namespace = ""
+	}
+	c.revalidation.once(namespace + "/" + ref.String()).Do(func() {
+		if reason := c.revalidation.unsupportedReason(ctx, c.perCallTimeout); reason != "" {
+			c.log.warnf("Warning: not revalidating %s: %s", ref, reason)
+			return
+		}
+		if err := c.patchAndAwaitStore(ctx, gvr, namespace, ref); err != nil {
+			c.log.warnf("Warning: %v; checking its current state", err)
+		}
+	})
+}
+
+func (c *checker) patchAndAwaitStore(ctx context.Context, gvr schema.GroupVersionResource, namespace string, ref storeRef) error {
+	resource := c.dynamicClient.Resource(gvr).Namespace(namespace)
+	patch, _ := json.Marshal(map[string]any{"metadata": map[string]any{
+		"annotations": map[string]string{storeValidationAnnotation: strconv.FormatInt(time.Now().Unix(), 10)},
+	}})
+	callCtx, cancel, err := phaseContext(ctx, c.perCallTimeout)
+	if err != nil {
+		return fmt.Errorf("could not revalidate %s: %w", ref, err)
+	}
+	patched, err := resource.Patch(callCtx, ref.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	cancel()
+	if err != nil {
+		return fmt.Errorf("could not revalidate %s: %w", ref, err)
+	}
+	c.log.infof("Requested a revalidation of %s, waiting up to %s for it", ref, formatDuration(storeRevalidateTimeout))
+
+	// The controller writing the status back moves the resource version
+	// past that of the patch.
+	waitCtx, cancelWait := context.WithTimeout(ctx, storeRevalidateTimeout)
+	defer cancelWait()
+	for {
+		sleepContext(waitCtx, c.pollInterval)
+		if waitCtx.Err() != nil {
+			return fmt.Errorf("%s was not revalidated within %s", ref, formatDuration(storeRevalidateTimeout))
+		}
+		callCtx, cancel, err := phaseContext(waitCtx, c.perCallTimeout)
+		if err != nil {
+			continue
+		}
+		store, err := resource.Get(callCtx, ref.Name, metav1.GetOptions{})
+		cancel()
+		if err == nil && store.GetResourceVersion() != patched.GetResourceVersion() {
+			c.log.infof("%s was revalidated", ref)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func controllerPod(name string, labels map[string]string, image string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "external-secrets", Name: name, Labels: map[string]string{"app.kubernetes.io/name": "external-secrets"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "external-secrets", Image: image}}},
+	}
+	for key, value := range labels {
+		pod.Labels[key] = value
+	}
+	return pod
+}
+
+func TestControllerVersion(t *testing.T) {
+	for _, test := range []struct {
+		pod  *corev1.Pod
+		want string
+	}{
+		{controllerPod("labeled", map[string]string{controllerVersionLabel: "v0.10.4"}, "ghcr.io/external-secrets/external-secrets:v0.9.0"), "v0.10.4"},
+		{controllerPod("tagged", nil, "ghcr.io/external-secrets/external-secrets:v0.9.11@sha256:0123"), "v0.9.11"},
+		{controllerPod("untagged", nil, "registry.local:5000/external-secrets"), ""},
+	} {
+		got, err := controllerVersion(context.Background(), fake.NewSimpleClientset(test.pod), 5*time.Second)
+		if got != test.want || (err != nil) != (test.want == "") {
+			t.Errorf("%s: controllerVersion = %q, %v, want %q", test.pod.Name, got, err, test.want)
+		}
+	}
+}
+
+// TestRevalidateStoreSkipsOlderReleases runs against a release predating the
+// annotation: the store is left alone, with a warning.
+func TestRevalidateStoreSkipsOlderReleases(t *testing.T) {
+	out := captureConsole(t)
+	storeGVR := externalSecretGVR.GroupVersion().WithResource(secretStoresResource)
+	dynamicClient := newFakeDynamicClient(newTestObject(storeGVR, secretStoreKind, "apps", "vault", readyCondition("False", "InvalidProviderConfig")))
+	c := &checker{
+		dynamicClient:  dynamicClient,
+		gvr:            externalSecretGVR,
+		perCallTimeout: 5 * time.Second,
+		pollInterval:   10 * time.Millisecond,
+		log:            console,
+		revalidation:   newStoreRevalidation(fake.NewSimpleClientset(controllerPod("eso", map[string]string{controllerVersionLabel: "v0.9.20"}, ""))),
+	}
+	c.revalidateStore(context.Background(), externalSecretWithStore("apps", "db", "", "vault"))
+	for _, action := range dynamicClient.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("the store was patched: %v", action)
+		}
+	}
+	if !strings.Contains(out.String(), "Warning: not revalidating SecretStore vault: external-secrets v0.9.20 predates v0.10.0") {
+		t.Errorf("no warning about the release:\n%s", out)
+	}
+}
+
+// TestRevalidateStorePatchesOnce revalidates the store of two ExternalSecrets
+// at once: it is patched once, and both wait for the controller to write it
+// back before checking it.
+func TestRevalidateStorePatchesOnce(t *testing.T) {
+	out := captureConsole(t)
+	storeGVR := externalSecretGVR.GroupVersion().WithResource(secretStoresResource)
+	dynamicClient := newFakeDynamicClient(newTestObject(storeGVR, secretStoreKind, "apps", "vault", readyCondition("False", "InvalidProviderConfig")))
+	var mu sync.Mutex
+	patched := false
+	dynamicClient.PrependReactor("patch", "secretstores", func(k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		patched = true
+		return false, nil, nil
+	})
+	dynamicClient.PrependReactor("get", "secretstores", func(k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !patched {
+			return false, nil, nil
+		}
+		// The controller re-evaluated the store
+		store := newTestObject(storeGVR, secretStoreKind, "apps", "vault", readyCondition("True", "Valid"))
+		store.SetResourceVersion("2")
+		return true, store, nil
+	})
+	c := &checker{
+		dynamicClient:  dynamicClient,
+		gvr:            externalSecretGVR,
+		perCallTimeout: 5 * time.Second,
+		pollInterval:   10 * time.Millisecond,
+		log:            console,
+		revalidation:   newStoreRevalidation(fake.NewSimpleClientset(controllerPod("eso", map[string]string{controllerVersionLabel: "v0.10.2"}, ""))),
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"db", "cache"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			es := externalSecretWithStore("apps", name, "", "vault")
+			c.revalidateStore(context.Background(), es)
+			if condition, err := c.verifyStore(context.Background(), es); err != nil || condition.Status != "True" {
+				t.Errorf("%s: verifyStore = %+v, %v after the revalidation, want Ready=True", name, condition, err)
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	patches := 0
+	for _, action := range dynamicClient.Actions() {
+		if action.GetVerb() == "patch" {
+			patches++
+		}
+	}
+	if patches != 1 {
+		t.Errorf("%d patches, want 1", patches)
+	}
+	if !strings.Contains(out.String(), "SecretStore vault was revalidated") {
+		t.Errorf("no revalidation logged:\n%s", out)
+	}
+}
+
+func TestRevalidateStoreRequiresCheckStore(t *testing.T) {
+	if _, err := validateTestOptions(t, "-name=db", "-revalidate-store"); err == nil || !strings.Contains(err.Error(), "requires -check-store") {
+		t.Errorf("validate = %v, want -check-store required", err)
+	}
+	if _, err := validateTestOptions(t, "-name=db", "-check-store", "-revalidate-store"); err != nil {
+		t.Errorf("validate = %v", err)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+)
+
+// run checks the ExternalSecrets requested on the command line. Each one is
+// checked by its own copy of the checker, so that several can be waited for
+// concurrently.
+type run struct {
+	opts      *options
+	clientset kubernetes.Interface
+	checker   checker
+	observers *observerHub
+	stateFile string
+	// metadataClient lists the resources of discovery.
+	metadataClient metadata.Interface
+	// prefixNames labels the progress lines with the resource name, for
+	// runs checking several.
+	prefixNames bool
+	// cluster attributes the output to the cluster, for runs fanning out to
+	// several.
+	cluster string
+	// isolateDenied keeps an RBAC denial in one namespace from canceling the
+	// checks in the others.
+	isolateDenied bool
+}
+
+// resourceLabel names a resource in the output of runs checking several: by
+// name, or by namespace/name when they span namespaces.
+func resourceLabel(namespace, name string, withNamespace bool) string {
+	if withNamespace && namespace != "" {
+		return namespace + "/" + name
+	}
+	return name
+}
+
+// checkAll checks every result's resource concurrently and returns the
+// results in the order they completed with the exit code of the run: the
+// first permanent failure cancels the other waits.
+func (r *run) checkAll(ctx context.Context, results []*checkResult) ([]*checkResult, int) {
+	if len(results) == 1 {
+		code := r.check(ctx, results[0])
+		r.dedupeNotification(results[0])
+		return results, code
+	}
+	g := r.group(ctx)
+	for _, result := range results {
+		g.start(result)
+	}
+	return g.wait()
+}
+
+// checkGroup checks resources concurrently, canceling the others once one
+// fails for good. Resources may be added while others are being checked.
+// Each result is handed to the observers as soon as it is final. With
+// -concurrency, checks beyond the limit are queued and started fairly
+// across namespaces as slots free up, those of -priority-selector first.
+type checkGroup struct {
+	run    *run
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// checkOne checks a single resource, run.check outside of tests.
+	checkOne func(ctx context.Context, result *checkResult) int
+	// limit is how many checks run at once, 0 for no limit.
+	limit int
+
+	mu      sync.Mutex
+	running int
+	// prioritized holds the queued checks of -priority-selector, started
+	// before those of queued.
+	prioritized fairQueue
+	queued      fairQueue
+	codes       []int
+	completed   []*checkResult
+}
+
+func (r *run) group(ctx context.Context) *checkGroup {
+	ctx, cancel := context.WithCancel(ctx)
+	return &checkGroup{run: r, ctx: ctx, cancel: cancel, checkOne: r.check, limit: r.opts.concurrency}
+}
+
+// start checks the resource of result in the background, once a slot is
+// free.
+func (g *checkGroup) start(result *checkResult) {
+	g.wg.Add(1)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if result.priority {
+		g.prioritized.push(result)
+	} else {
+		g.queued.push(result)
+	}
+	g.dispatch()
+}
+
+// dispatch starts queued checks while slots are free, and every one once
+// the group is canceled, so that they end right away as canceled. g.mu must
+// be held.
+func (g *checkGroup) dispatch() {
+	for g.limit == 0 || g.running < g.limit || g.ctx.Err() != nil {
+		result := g.prioritized.pop()
+		if result == nil {
+			result = g.queued.pop()
+		}
+		if result == nil {
+			return
+		}
+		g.running++
+		go g.check(result)
+	}
+}
+
+func (g *checkGroup) check(result *checkResult) {
+	defer g.wg.Done()
+	code := g.checkOne(g.ctx, result)
+	g.run.dedupeNotification(result)
+	result.ReasonCode = reasonCodeFor(result)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.codes = append(g.codes, code)
+	g.completed = append(g.completed, result)
+	g.run.observers.result(result)
+	g.running--
+	if result.priority {
+		console.forCluster(g.run.cluster).infof("Priority result: %s", resultLine(result))
+	}
+	// A denial in one namespace is reported with its result instead of
+	// stopping the checks in the others, unless -fail-fast is given.
+	// Neither does the timeout of a -from-file entry, the others having
+	// time left. A priority resource failing ends the run all the same
+	// under -fail-fast.
+	entryTimeout := result.entry != nil && result.entry.timeout > 0 && code == exitTimeout
+	isolated := g.run.isolateDenied && isDenied(result.lastErr) || entryTimeout
+	if failing(code) && (!isolated || result.priority && g.run.opts.failFast) {
+		g.cancel()
+	}
+	g.dispatch()
+}
+
+// wait waits for every started check and returns the results in the order
+// they completed with the exit code of the group, the most severe of the
+// checks.
+func (g *checkGroup) wait() ([]*checkResult, int) {
+	g.wg.Wait()
+	g.cancel()
+	code := exitOK
+	for _, c := range g.codes {
+		code = mergeExitCode(code, c)
+	}
+	return g.completed, code
+}
+
+// check waits for a single resource and runs the verifications after the
+// wait, returning the exit code for it.
+func (r *run) check(ctx context.Context, result *checkResult) int {
+	return r.checkBudgets(result, r.checkResource(ctx, result))
+}
+
+// checkResource is check without the -check-budget verdict.
+func (r *run) checkResource(ctx context.Context, result *checkResult) int {
+	opts := r.opts
+	namespace, name := result.Namespace, result.Name
+	log := console.forCluster(r.cluster).forResource(namespace, name)
+
+	// Start watching events in a separate goroutine
+	events := &eventStats{}
+	// Events are filtered by -uid unless the wait may re-bind to a new object
+	eventsUID := opts.uid
+	if opts.onUIDChange == uidChangeRebind {
+		eventsUID = ""
+	}
+	// The events are shared with the wait, which tells a resource nothing
+	// happens to by them; the watcher is done before the check returns, so
+	// it never outlives the result it feeds
+	eventsCtx, stopEvents := context.WithCancel(ctx)
+	eventsDone := make(chan struct{})
+	go func() {
+		defer close(eventsDone)
+		watchEvents(eventsCtx, r.clientset, r.checker.apiCalls, namespace, r.checker.kind.name, name, eventsUID, opts.eventHistory, opts.watchIdleTimeout, events, r.observers)
+	}()
+	defer func() {
+		stopEvents()
+		<-eventsDone
+	}()
+
+	c := r.checker
+	c.events = events
+	c.log = log
+	if r.prefixNames {
+		c.prefix = "[" + resourceLabel(namespace, name, r.opts.severalNamespaces()) + "] "
+	}
+	// A -from-file entry adds its keys, and its timeout bounds the wait
+	// within the shared deadline
+	requireKeys := []string(opts.requireKeys)
+	if entry := result.entry; entry != nil {
+		requireKeys = append(requireKeys[:len(requireKeys):len(requireKeys)], entry.RequireKeys...)
+		if entry.timeout > 0 && entry.timeout < c.timeout {
+			c.timeout = entry.timeout
+		}
+	}
+	if opts.waitFor == waitForDeleted {
+		err := c.waitForDeletion(ctx, namespace, name, result)
+		result.WarningEvents = events.Warnings()
+		result.RecentEvents = events.recent()
+		if err != nil {
+			log.errorf("Error: %v", err)
+			return exitCodeFor(err)
+		}
+		return exitOK
+	}
+	var err error
+	if opts.forceSync {
+		var before time.Time
+		if before, err = c.forceSync(ctx, namespace, name); before.After(c.minRefreshTime) {
+			c.minRefreshTime = before
+		}
+	}
+	if err == nil {
+		err = c.checkStatusWithTimeout(ctx, namespace, name, result)
+	} else {
+		result.failed(err)
+	}
+	result.WarningEvents = events.Warnings()
+	result.RecentEvents = events.recent()
+	r.observers.phase(phaseVerifying)
+	if (r.stateFile != "" || opts.minKeys > 0) && result.object != nil && r.checker.kind.hasTarget {
+		var targetErr error
+		start := time.Now()
+		result.DataHash, result.SecretKeys, targetErr = fetchTargetState(ctx, r.clientset, result.object, opts.perCallTimeout)
+		result.timeCheck(checkNameTargetState, start)
+		if errors.Is(targetErr, errDeadlineExhausted) {
+			result.skipPhase("target Secret state", targetErr)
+		} else if targetErr != nil {
+			log.warnf("Warning: %v", targetErr)
+		}
+		if targetErr != nil && err == nil && opts.minKeys > 0 {
+			result.failed(targetErr)
+			err = targetErr
+		}
+	}
+	if err != nil {
+		log.errorf("Error: %v", err)
+		return exitCodeFor(err)
+	}
+	if result.Ready() && r.checker.kind.hasTarget {
+		start := time.Now()
+		binding, err := resolveBinding(ctx, r.clientset, result.object, opts.perCallTimeout)
+		result.timeCheck(checkNameBoundSecret, start)
+		if errors.Is(err, errDeadlineExhausted) {
+			result.skipPhase("bound Secret", err)
+		} else if err != nil {
+			log.warnf("Warning: %v", err)
+		}
+		result.Binding = binding
+	}
+	if opts.minKeys > 0 && result.SecretKeys < opts.minKeys {
+		result.Outcome = outcomeTooFewKeys
+		result.Reason = fmt.Sprintf("%d keys", result.SecretKeys)
+		log.errorf("Error: target Secret %s has %d data keys, fewer than -min-keys=%d", targetSecretName(result.object), result.SecretKeys, opts.minKeys)
+		return exitFailure
+	}
+	if len(requireKeys) > 0 && result.Ready() {
+		start := time.Now()
+		missing, err := checkRequiredKeys(ctx, r.clientset, result.object, requireKeys, opts.requireNonEmpty, opts.perCallTimeout)
+		result.timeCheck(checkNameRequiredKeys, start)
+		var missingTarget *errTargetSecretMissing
+		switch {
+		case errors.Is(err, errDeadlineExhausted):
+			result.skipPhase("required keys", err)
+		case errors.As(err, &missingTarget):
+			log.errorf("Error: %v", err)
+			result.Outcome = outcomeError
+			result.Reason = "target Secret missing"
+			result.targetMissing = true
+			return exitFailure
+		case err != nil:
+			log.errorf("Error: %v", err)
+			result.failed(err)
+			return exitCodeFor(err)
+		case len(missing) > 0:
+			result.MissingKeys = missing
+			result.Outcome = outcomeMissingKeys
+			result.Reason = "missing " + strings.Join(missing, ", ")
+			log.errorf("Error: target Secret %s is missing required keys %s", targetSecretName(result.object), strings.Join(missing, ", "))
+			return exitFailure
+		}
+	}
+
+	if opts.verifyTemplateMetadata {
+		start := time.Now()
+		issues, err := verifyTemplateMetadata(ctx, r.clientset, result.object, opts.perCallTimeout)
+		result.timeCheck(checkNameTemplateMetadata, start)
+		switch {
+		case errors.Is(err, errDeadlineExhausted):
+			result.skipPhase("template metadata verification", err)
+		case err != nil:
+			log.errorf("Error: %v", err)
+			result.failed(err)
+			return exitCodeFor(err)
+		case len(issues) > 0:
+			result.MetadataIssues = issues
+			result.Outcome = outcomeMetadataMismatch
+			result.Reason = fmt.Sprintf("%d metadata issues", len(issues))
+			for _, issue := range issues {
+				log.infof("Template metadata: %s", issue)
+			}
+			return exitFailure
+		}
+	}
+
+	if opts.compareWith != "" {
+		compareNamespace, compareName, _ := parseResourceRef(opts.compareWith, namespace)
+		start := time.Now()
+		err := c.waitAndCompare(ctx, compareNamespace, compareName, result)
+		result.timeCheck(checkNameCompareWith, start)
+		if err != nil {
+			log.errorf("Error: %v", err)
+			return exitCodeFor(err)
+		}
+	}
+
+	result.checkSLO(opts.maxWaitForPass, opts.maxSyncLatency)
+	if result.Outcome == outcomeSLOViolated {
+		for _, violation := range result.SLOViolations {
+			log.infof("SLO violated: %s", violation)
+		}
+		return exitSLOViolated
+	}
+	return exitOK
+}
@@ -0,0 +1,44 @@
+package main
+
+// fairQueue holds the checks waiting for a slot of -concurrency. It hands
+// them out round-robin across namespaces, in the order each namespace was
+// first queued, so that a namespace with many resources cannot take every
+// slot while those of the others wait. The order only depends on the order
+// the checks were queued in.
+type fairQueue struct {
+	// namespaces are those with queued checks, served in turn from next.
+	namespaces []string
+	next       int
+	pending    map[string][]*checkResult
+}
+
+func (q *fairQueue) push(result *checkResult) {
+	if q.pending == nil {
+		q.pending = map[string][]*checkResult{}
+	}
+	if _, queued := q.pending[result.Namespace]; !queued {
+		q.namespaces = append(q.namespaces, result.Namespace)
+	}
+	q.pending[result.Namespace] = append(q.pending[result.Namespace], result)
+}
+
+// pop returns the next check to start, nil when none is queued.
+func (q *fairQueue) pop() *checkResult {
+	if len(q.namespaces) == 0 {
+		return nil
+	}
+	if q.next >= len(q.namespaces) {
+		q.next = 0
+	}
+	namespace := q.namespaces[q.next]
+	queue := q.pending[namespace]
+	if len(queue) == 1 {
+		// The namespace leaves the rotation, the next one taking its turn
+		delete(q.pending, namespace)
+		q.namespaces = append(q.namespaces[:q.next], q.namespaces[q.next+1:]...)
+	} else {
+		q.pending[namespace] = queue[1:]
+		q.next++
+	}
+	return queue[0]
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func queuedResults(refs ...string) []*checkResult {
+	results := make([]*checkResult, len(refs))
+	for i, ref := range refs {
+		namespace, name, _ := strings.Cut(ref, "/")
+		results[i] = &checkResult{Namespace: namespace, Name: name}
+	}
+	return results
+}
+
+func popAll(q *fairQueue) []string {
+	var order []string
+	for result := q.pop(); result != nil; result = q.pop() {
+		order = append(order, result.Namespace+"/"+result.Name)
+	}
+	return order
+}
+
+func TestFairQueueTakesTurnsAcrossNamespaces(t *testing.T) {
+	var q fairQueue
+	for _, result := range queuedResults("big/1", "big/2", "big/3", "big/4", "small/1", "tiny/1", "small/2") {
+		q.push(result)
+	}
+	got := strings.Join(popAll(&q), " ")
+	if want := "big/1 small/1 tiny/1 big/2 small/2 big/3 big/4"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+// TestFairQueueInterleavesLateArrivals queues resources while others are
+// taken, as discovery does: a new namespace takes the next turn.
+func TestFairQueueInterleavesLateArrivals(t *testing.T) {
+	var q fairQueue
+	for _, result := range queuedResults("big/1", "big/2", "big/3") {
+		q.push(result)
+	}
+	var order []string
+	order = append(order, q.pop().Name)
+	for _, result := range queuedResults("late/1", "late/2") {
+		q.push(result)
+	}
+	order = append(order, popAll(&q)...)
+	if got, want := strings.Join(order, " "), "1 late/1 big/2 late/2 big/3"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+// TestCheckGroupHonorsConcurrency checks that no more checks than
+// -concurrency run at once, and that every queued one still completes.
+func TestCheckGroupHonorsConcurrency(t *testing.T) {
+	r := &run{opts: &options{concurrency: 2}}
+	g := r.group(context.Background())
+	var mu sync.Mutex
+	running, most := 0, 0
+	g.checkOne = func(context.Context, *checkResult) int {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return exitOK
+	}
+	for _, result := range queuedResults("a/1", "a/2", "a/3", "a/4", "b/1", "c/1") {
+		g.start(result)
+	}
+	completed, code := g.wait()
+	if len(completed) != 6 || code != exitOK {
+		t.Fatalf("completed %d checks with code %d, want 6 with %d", len(completed), code, exitOK)
+	}
+	if most != 2 {
+		t.Errorf("at most %d checks ran at once, want 2", most)
+	}
+}
+
+// TestCheckGroupStartsQueuedChecksCanceled fails the first check: the ones
+// still queued are started at once, canceled, instead of waiting for slots.
+func TestCheckGroupStartsQueuedChecksCanceled(t *testing.T) {
+	r := &run{opts: &options{concurrency: 1}}
+	g := r.group(context.Background())
+	g.checkOne = func(ctx context.Context, result *checkResult) int {
+		if result.Name == "broken" {
+			return exitFatal
+		}
+		if ctx.Err() == nil {
+			t.Errorf("%s started before the group was canceled", result.Name)
+		}
+		return exitTimeout
+	}
+	for _, result := range queuedResults("a/broken", "a/1", "b/1") {
+		g.start(result)
+	}
+	completed, code := g.wait()
+	if len(completed) != 3 || completed[0].Name != "broken" || code != exitFatal {
+		t.Errorf("completed %d checks, first %s, with code %d, want 3, broken first, with %d", len(completed), completed[0].Name, code, exitFatal)
+	}
+}
+
+// TestCheckGroupStartsPriorityChecksFirst queues checks behind one holding
+// the only slot: the priority ones start first.
+func TestCheckGroupStartsPriorityChecksFirst(t *testing.T) {
+	out := captureConsole(t)
+	r := &run{opts: &options{concurrency: 1}}
+	g := r.group(context.Background())
+	release := make(chan struct{})
+	var order []string
+	g.checkOne = func(_ context.Context, result *checkResult) int {
+		if result.Name == "first" {
+			<-release
+		}
+		order = append(order, result.Namespace+"/"+result.Name)
+		return exitOK
+	}
+	results := queuedResults("a/first", "a/1", "a/2", "b/1", "c/critical", "a/critical")
+	results[4].priority, results[5].priority = true, true
+	for _, result := range results {
+		g.start(result)
+	}
+	close(release)
+	g.wait()
+	if got, want := strings.Join(order, " "), "a/first c/critical a/critical a/1 b/1 a/2"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+	if !strings.Contains(out.String(), "Priority result: ExternalSecret a/critical") {
+		t.Errorf("no result line printed for a/critical:\n%s", out)
+	}
+}
+
+// TestCheckGroupPriorityFailureEndsRun denies two resources in a run that
+// isolates denials: only the priority one cancels the others.
+func TestCheckGroupPriorityFailureEndsRun(t *testing.T) {
+	captureConsole(t)
+	for _, priority := range []bool{false, true} {
+		r := &run{opts: &options{concurrency: 1, failFast: true}, isolateDenied: true}
+		g := r.group(context.Background())
+		var canceled atomic.Int32
+		g.checkOne = func(ctx context.Context, result *checkResult) int {
+			if result.Name == "denied" {
+				result.lastErr = apierrors.NewForbidden(externalSecretGVR.GroupResource(), result.Name, errors.New("denied"))
+				return exitDenied
+			}
+			if ctx.Err() != nil {
+				canceled.Add(1)
+			}
+			return exitOK
+		}
+		results := queuedResults("a/denied", "b/1", "c/1")
+		results[0].priority = priority
+		for _, result := range results {
+			g.start(result)
+		}
+		g.wait()
+		if want := map[bool]int32{false: 0, true: 2}[priority]; canceled.Load() != want {
+			t.Errorf("priority %v: %d checks canceled by the denial, want %d", priority, canceled.Load(), want)
+		}
+	}
+}
+
+func TestBatchSummaryAggregatesNamespaces(t *testing.T) {
+	out := captureConsole(t)
+	printBatchSummary([]*checkResult{
+		{Namespace: "apps", Name: "db", Outcome: outcomeReady, Waited: 2 * time.Second},
+		{Namespace: "apps", Name: "cache", Outcome: outcomeTimeout, Waited: 10 * time.Second},
+		{Namespace: "web", Name: "tls", Outcome: outcomeReady, Waited: 4 * time.Second},
+	})
+	for _, want := range []string{
+		"Namespace apps: 1 of 2 [db]; not ready: cache (timeout); waited 10s at most, 6s on average\n",
+		"Namespace web: 1 of 1 [tls]; waited 4s at most, 4s on average\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary lacks %q:\n%s", want, out)
+		}
+	}
+}
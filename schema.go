@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// reportSchemaVersion is the version of the records of -output=json,
+// -notify-socket and -result-file. Bump it whenever logRecord, resultRecord
+// or a type they contain changes.
+const reportSchemaVersion = 16
+
+const schemaUsage = "Usage: ./external-secret-watcher schema [-document=output|result]"
+
+// runSchema implements the schema subcommand, which prints the JSON Schema
+// (draft 2020-12) of a line of -output=json, or of a -result-file result.
+// The schema is generated from the Go types, so it cannot drift from them.
+func runSchema(args []string) int {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	document := fs.String("document", "output", "Document to describe: output for a line of -output=json, result for a -result-file result")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	var root reflect.Type
+	var title string
+	switch *document {
+	case "output":
+		root, title = reflect.TypeOf(logRecord{}), "external-secret-watcher -output=json record"
+	case "result":
+		root, title = reflect.TypeOf(resultRecord{}), "external-secret-watcher result"
+	default:
+		fmt.Println(schemaUsage)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(documentSchema(root, title)); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// documentSchema returns the JSON Schema of the document described by root.
+func documentSchema(root reflect.Type, title string) map[string]any {
+	g := &schemaGenerator{defs: map[string]any{}}
+	schema := g.schemaFor(root)
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = title
+	schema["$defs"] = g.defs
+	return schema
+}
+
+// schemaEnums are the closed sets of values of string types.
+func schemaEnums() map[reflect.Type][]string {
+	outcomeValues := make([]string, len(outcomes))
+	for i, o := range outcomes {
+		outcomeValues[i] = string(o)
+	}
+	codes := make([]string, len(reasonCodes))
+	for i, c := range reasonCodes {
+		codes[i] = string(c.Code)
+	}
+	return map[reflect.Type][]string{
+		reflect.TypeOf(outcome("")):    outcomeValues,
+		reflect.TypeOf(reasonCode("")): codes,
+	}
+}
+
+// schemaGenerator derives JSON Schemas from Go types through their json
+// tags. Nested structs are described once in defs.
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) map[string]any {
+	if values, ok := schemaEnums()[t]; ok {
+		return map[string]any{"type": "string", "enum": values}
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaFor(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+	return map[string]any{}
+}
+
+// structSchema describes a struct, top-level ones in place and nested ones
+// as a reference to defs.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		if name == "schemaVersion" {
+			properties[name] = map[string]any{"const": reportSchemaVersion}
+		} else {
+			properties[name] = g.reference(field.Type)
+		}
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// reference returns a $ref to the schema of a nested struct, or the schema
+// of other types.
+func (g *schemaGenerator) reference(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{}):
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = map[string]any{}
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case t.Kind() == reflect.Slice:
+		return map[string]any{"type": "array", "items": g.reference(t.Elem())}
+	}
+	return g.schemaFor(t)
+}
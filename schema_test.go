@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// emittedSchema returns the schema of root as the schema subcommand prints
+// it, decoded the way a consumer would.
+func emittedSchema(t *testing.T, root reflect.Type) map[string]any {
+	raw, err := json.Marshal(documentSchema(root, "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// schemaViolations validates value against the subset of JSON Schema the
+// generator emits, returning what does not conform.
+func schemaViolations(root, schema map[string]any, value any, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		def, ok := root["$defs"].(map[string]any)[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: unresolved %s", path, ref)}
+		}
+		return schemaViolations(root, def, value, path)
+	}
+	if want, ok := schema["const"]; ok && value != want {
+		return []string{fmt.Sprintf("%s: %v, want the constant %v", path, value, want)}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, allowed := range enum {
+			found = found || value == allowed
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s: %v is not one of %v", path, value, enum)}
+		}
+	}
+
+	var violations []string
+	switch schema["type"] {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %#v is not a string", path, value)}
+		}
+		if _, err := time.Parse(time.RFC3339Nano, s); schema["format"] == "date-time" && err != nil {
+			violations = append(violations, fmt.Sprintf("%s: %v", path, err))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s: %#v is not a boolean", path, value)}
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || schema["type"] == "integer" && n != float64(int64(n)) {
+			return []string{fmt.Sprintf("%s: %#v is not an %s", path, value, schema["type"])}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %#v is not an array", path, value)}
+		}
+		for i, item := range items {
+			violations = append(violations, schemaViolations(root, schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %#v is not an object", path, value)}
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				violations = append(violations, fmt.Sprintf("%s: %s is required", path, name))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, field := range object {
+			fieldSchema, ok := properties[name].(map[string]any)
+			if !ok {
+				if fieldSchema, ok = schema["additionalProperties"].(map[string]any); !ok {
+					violations = append(violations, fmt.Sprintf("%s: %s is not in the schema", path, name))
+					continue
+				}
+			}
+			violations = append(violations, schemaViolations(root, fieldSchema, field, path+"."+name)...)
+		}
+	}
+	sort.Strings(violations)
+	return violations
+}
+
+// validateDocument checks that document conforms to the schema of root.
+func validateDocument(t *testing.T, root reflect.Type, document []byte) {
+	t.Helper()
+	var value any
+	if err := json.Unmarshal(document, &value); err != nil {
+		t.Fatalf("%v:\n%s", err, document)
+	}
+	schema := emittedSchema(t, root)
+	for _, violation := range schemaViolations(schema, schema, value, "$") {
+		t.Errorf("%s does not conform: %s", root.Name(), violation)
+	}
+}
+
+// TestSchemaValidatesRealReports runs checks ending Ready and failing fast,
+// and validates their -result-file results and -output=json lines against
+// the emitted schemas.
+func TestSchemaValidatesRealReports(t *testing.T) {
+	out := captureJSONConsole(t)
+	missingStore := `{"type":"Ready","status":"False","reason":"SecretSyncedError","message":"could not get SecretStore \"vault\": not found","lastTransitionTime":"2024-05-01T10:00:00Z"}`
+	for _, object := range []*unstructured.Unstructured{
+		newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", readyCondition("True", "SecretSynced")),
+		readyPayload(t, missingStore),
+	} {
+		c := newTestCluster(object)
+		results, _ := c.check(t, 5*time.Second, "-namespace=apps", "-name=db", "-watch-mode=poll", "-skip-freshness")
+		for _, result := range results {
+			console.result(result)
+		}
+		var file bytes.Buffer
+		if err := writeResultFile(&file, results); err != nil {
+			t.Fatal(err)
+		}
+		validateDocument(t, reflect.TypeOf(resultRecord{}), file.Bytes())
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for _, line := range lines {
+		validateDocument(t, reflect.TypeOf(logRecord{}), []byte(line))
+	}
+	if !strings.Contains(out.String(), `"result":{`) {
+		t.Errorf("no terminal record among the %d lines", len(lines))
+	}
+}
+
+// TestSchemaRejectsNonConformingReports checks that the validation catches
+// what the schema rules out.
+func TestSchemaRejectsNonConformingReports(t *testing.T) {
+	schema := emittedSchema(t, reflect.TypeOf(resultRecord{}))
+	for _, document := range []string{
+		`{"schemaVersion":1,"namespace":"apps","name":"db","outcome":"ready","waitSeconds":1,"ready":true,"store":""}`,
+		`{"schemaVersion":` + fmt.Sprint(reportSchemaVersion) + `,"namespace":"apps","name":"db","outcome":"pending","waitSeconds":1,"ready":true,"store":""}`,
+		`{"schemaVersion":` + fmt.Sprint(reportSchemaVersion) + `,"namespace":"apps","name":"db","outcome":"ready","waitSeconds":1,"ready":true,"store":"","unknown":1}`,
+		`{"schemaVersion":` + fmt.Sprint(reportSchemaVersion) + `,"namespace":"apps","outcome":"ready","waitSeconds":1,"ready":true,"store":""}`,
+	} {
+		var value any
+		if err := json.Unmarshal([]byte(document), &value); err != nil {
+			t.Fatal(err)
+		}
+		if len(schemaViolations(schema, schema, value, "$")) == 0 {
+			t.Errorf("%s conforms", document)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+)
+
+// discoveryInterval is how often -selector re-lists the namespace during the
+// discovery window.
+const discoveryInterval = 5 * time.Second
+
+// discoveredResource is a resource found by discovery, with its labels.
+type discoveredResource struct {
+	types.NamespacedName
+	labels map[string]string
+}
+
+// lister lists the resources discovery looks for a page at a time, as
+// metadata only: discovery needs the names and labels, never the status,
+// which is read when each resource is checked. This keeps listing
+// namespaces with thousands of resources fast and light on memory.
+type lister struct {
+	metadataClient metadata.Interface
+	// dynamicClient lists full objects when the API server cannot serve
+	// metadata only.
+	dynamicClient  dynamic.Interface
+	gvr            schema.GroupVersionResource
+	chunkSize      int64
+	perCallTimeout time.Duration
+}
+
+func (r *run) lister() *lister {
+	return newLister(r.opts, r.metadataClient, r.checker.dynamicClient, r.checker.gvr)
+}
+
+func newLister(opts *options, metadataClient metadata.Interface, dynamicClient dynamic.Interface, gvr schema.GroupVersionResource) *lister {
+	return &lister{
+		metadataClient: metadataClient,
+		dynamicClient:  dynamicClient,
+		gvr:            gvr,
+		chunkSize:      opts.listChunkSize,
+		perCallTimeout: opts.perCallTimeout,
+	}
+}
+
+// listSelected returns the ExternalSecrets in namespace, or in every
+// namespace when it is empty, that match selector or, without one, are
+// named one of names.
+func (l *lister) listSelected(ctx context.Context, namespace, selector string, names []string) ([]discoveredResource, error) {
+	queries := []metav1.ListOptions{{LabelSelector: selector}}
+	if selector == "" {
+		queries = queries[:0]
+		for _, name := range names {
+			queries = append(queries, metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String()})
+		}
+	}
+	var found []discoveredResource
+	for _, query := range queries {
+		var err error
+		if found, err = l.list(ctx, namespace, query, found); err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+// list appends the resources of query to found, a page of -list-chunk-size
+// at a time, each page within the per-call timeout. A listing whose
+// continue token expires before its last page starts over.
+func (l *lister) list(ctx context.Context, namespace string, query metav1.ListOptions, found []discoveredResource) ([]discoveredResource, error) {
+	start := len(found)
+	query.Limit = l.chunkSize
+	for {
+		callCtx, cancel := context.WithTimeout(ctx, l.perCallTimeout)
+		page, err := l.page(callCtx, namespace, query)
+		cancel()
+		switch {
+		case isExpired(err) && query.Continue != "":
+			console.warnf("Warning: the listing of %s in %s expired, listing again: %v", l.gvr.Resource, orAll(namespace), err)
+			found, query.Continue = found[:start], ""
+			continue
+		case err != nil:
+			return found, err
+		}
+		found = append(found, page.items...)
+		query.Continue = page.Continue
+		if query.Continue == "" {
+			return found, nil
+		}
+		listed := len(found) - start
+		if page.RemainingItemCount != nil {
+			console.infof("Listed %d/%d %s in %s", listed, int64(listed)+*page.RemainingItemCount, l.gvr.Resource, orAll(namespace))
+		} else {
+			console.infof("Listed %d %s in %s so far", listed, l.gvr.Resource, orAll(namespace))
+		}
+	}
+}
+
+// listPage is a page of a listing.
+type listPage struct {
+	metav1.ListMeta
+	items []discoveredResource
+}
+
+// page lists a single page, as metadata unless the API server does not
+// accept it, in which case every later page is listed as full objects.
+func (l *lister) page(ctx context.Context, namespace string, query metav1.ListOptions) (listPage, error) {
+	var page listPage
+	if l.metadataClient != nil {
+		list, err := l.metadataClient.Resource(l.gvr).Namespace(namespace).List(ctx, query)
+		switch {
+		case apierrors.IsNotAcceptable(err) || apierrors.IsUnsupportedMediaType(err):
+			console.warnf("Warning: the API server cannot list %s as metadata, listing full objects: %v", l.gvr.Resource, err)
+			l.metadataClient = nil
+		case err != nil:
+			return page, err
+		default:
+			page.ListMeta = list.ListMeta
+			for _, item := range list.Items {
+				page.items = append(page.items, newDiscoveredResource(&item))
+			}
+			return page, nil
+		}
+	}
+	list, err := l.dynamicClient.Resource(l.gvr).Namespace(namespace).List(ctx, query)
+	if err != nil {
+		return page, err
+	}
+	page.Continue, page.RemainingItemCount = list.GetContinue(), list.GetRemainingItemCount()
+	for i := range list.Items {
+		page.items = append(page.items, newDiscoveredResource(&list.Items[i]))
+	}
+	return page, nil
+}
+
+func newDiscoveredResource(obj metav1.Object) discoveredResource {
+	return discoveredResource{
+		NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()},
+		labels:         obj.GetLabels(),
+	}
+}
+
+// listScope returns the namespaces to list for discovery: those of
+// -namespace, or every namespace at once with -all-namespaces.
+func listScope(opts *options) []string {
+	if opts.allNamespaces {
+		return []string{metav1.NamespaceAll}
+	}
+	return opts.namespaces()
+}
+
+// orAll names namespace for messages, the empty one being every namespace.
+func orAll(namespace string) string {
+	if namespace == metav1.NamespaceAll {
+		return "all namespaces"
+	}
+	return "namespace " + namespace
+}
+
+// discoveryTarget describes what discovery looks for, for messages.
+func discoveryTarget(opts *options) string {
+	if opts.selector != "" {
+		return fmt.Sprintf("matching %q", opts.selector)
+	}
+	return "named " + strings.Join(opts.names, ", ")
+}
+
+// checkSelected checks every ExternalSecret matching -selector, or named by
+// -name across all namespaces. The scope is re-listed until the discovery
+// window closes, so that resources created
+// shortly after the start are checked as well; each one is checked as soon
+// as it is discovered. Results are based on template and returned in the
+// order they completed. Matching nothing by the end of the window is an
+// error.
+func (r *run) checkSelected(ctx context.Context, template checkResult) ([]*checkResult, int) {
+	opts := r.opts
+	g := r.group(ctx)
+	window := time.NewTimer(opts.discoveryWindow)
+	defer window.Stop()
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+
+	l := r.lister()
+	discovered := 0
+	var listErr error
+	seen := map[types.NamespacedName]bool{}
+discover:
+	for {
+		for _, namespace := range listScope(opts) {
+			found, err := l.listSelected(g.ctx, namespace, opts.selector, opts.names)
+			listErr = err
+			if err != nil {
+				// One namespace failing to list does not hide the others
+				console.errorf("Error listing ExternalSecrets %s in %s: %v", discoveryTarget(opts), orAll(namespace), err)
+			}
+			// The priority resources of a listing take the first slots
+			sort.SliceStable(found, func(i, j int) bool {
+				return opts.prioritized(found[i].labels) && !opts.prioritized(found[j].labels)
+			})
+			for _, resource := range found {
+				ref := resource.NamespacedName
+				if seen[ref] {
+					continue
+				}
+				seen[ref] = true
+				result := template
+				result.Namespace = ref.Namespace
+				result.Name = ref.Name
+				result.priority = opts.prioritized(resource.labels)
+				if result.priority {
+					console.infof("Discovered ExternalSecret %s (priority)", ref)
+				} else {
+					console.infof("Discovered ExternalSecret %s", ref)
+				}
+				discovered++
+				g.start(&result)
+			}
+		}
+
+		select {
+		case <-window.C:
+			break discover
+		case <-g.ctx.Done():
+			break discover
+		case <-ticker.C:
+		}
+	}
+
+	if discovered == 0 {
+		g.wait()
+		err := fmt.Errorf("no ExternalSecret %s found in %s after %s", discoveryTarget(opts), opts.scope(), formatDuration(opts.discoveryWindow))
+		if listErr != nil {
+			err = fmt.Errorf("%w (last list error: %v)", err, listErr)
+		}
+		console.errorf("Error: %v", err)
+		// Nothing matched, unless the listing was not allowed to tell
+		if isDenied(listErr) {
+			return nil, exitCodeFor(listErr)
+		}
+		return nil, exitNotFound
+	}
+	console.infof("Discovery window closed: waiting for %d ExternalSecrets %s", discovered, discoveryTarget(opts))
+	return g.wait()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+)
+
+// pagingServer serves a listing of externalsecrets in pages of the
+// requested limit, each continue token being the offset of the next page.
+type pagingServer struct {
+	total int
+	// expireAt, when set, expires the continue token of this offset once.
+	expireAt int
+	// refuseMetadata answers requests for metadata only with 406.
+	refuseMetadata bool
+	// deny answers every request with 403.
+	deny bool
+
+	requests   []string
+	fullObject bool
+}
+
+func (s *pagingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.requests = append(s.requests, query.Get("continue"))
+	if s.deny {
+		writeStatus(w, http.StatusForbidden, metav1.StatusReasonForbidden)
+		return
+	}
+	if s.refuseMetadata && strings.Contains(r.Header.Get("Accept"), "as=PartialObjectMetadataList") {
+		writeStatus(w, http.StatusNotAcceptable, metav1.StatusReasonNotAcceptable)
+		return
+	}
+	s.fullObject = !strings.Contains(r.Header.Get("Accept"), "as=PartialObjectMetadataList")
+	offset, _ := strconv.Atoi(query.Get("continue"))
+	if offset > 0 && offset == s.expireAt {
+		s.expireAt = 0
+		writeStatus(w, http.StatusGone, metav1.StatusReasonExpired)
+		return
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	end := min(offset+limit, s.total)
+	var items []map[string]any
+	for i := offset; i < end; i++ {
+		items = append(items, map[string]any{
+			"apiVersion": "external-secrets.io/v1beta1",
+			"kind":       "ExternalSecret",
+			"metadata":   map[string]any{"namespace": "apps", "name": fmt.Sprintf("es-%d", i), "labels": map[string]string{"index": strconv.Itoa(i)}},
+		})
+	}
+	listMeta := map[string]any{"resourceVersion": "100"}
+	if end < s.total {
+		listMeta["continue"] = strconv.Itoa(end)
+		listMeta["remainingItemCount"] = s.total - end
+	}
+	kind := "ExternalSecretList"
+	if !s.fullObject {
+		kind = "PartialObjectMetadataList"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"apiVersion": "v1", "kind": kind, "metadata": listMeta, "items": items})
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(metav1.Status{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+		Status:   metav1.StatusFailure,
+		Code:     int32(code),
+		Reason:   reason,
+	})
+}
+
+func newPagingClients(t *testing.T, server *pagingServer) (metadata.Interface, dynamic.Interface) {
+	t.Helper()
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	config := &rest.Config{Host: ts.URL}
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadataClient, dynamicClient
+}
+
+func newPagingLister(t *testing.T, server *pagingServer, chunkSize int64) *lister {
+	metadataClient, dynamicClient := newPagingClients(t, server)
+	return newLister(&options{listChunkSize: chunkSize, perCallTimeout: 5 * time.Second}, metadataClient, dynamicClient, externalSecretGVR)
+}
+
+func TestListerPagesThroughContinueTokens(t *testing.T) {
+	out := captureConsole(t)
+	server := &pagingServer{total: 7}
+	found, err := newPagingLister(t, server, 3).listSelected(context.Background(), "apps", "app=db", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 7 || found[6].Name != "es-6" || found[6].labels["index"] != "6" {
+		t.Fatalf("found %+v, want es-0 to es-6 with their labels", found)
+	}
+	if got := strings.Join(server.requests, ","); got != ",3,6" {
+		t.Errorf("continue tokens sent = %q, want none, then 3 and 6", got)
+	}
+	if server.fullObject {
+		t.Error("the listing asked for full objects instead of metadata")
+	}
+	for _, want := range []string{"Listed 3/7 externalsecrets in namespace apps", "Listed 6/7 externalsecrets in namespace apps"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestListerRestartsExpiredListing(t *testing.T) {
+	captureConsole(t)
+	server := &pagingServer{total: 5, expireAt: 4}
+	found, err := newPagingLister(t, server, 2).listSelected(context.Background(), "apps", "app=db", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 5 {
+		t.Errorf("found %d resources, want each of the 5 once", len(found))
+	}
+	if got := strings.Join(server.requests, ","); got != ",2,4,,2,4" {
+		t.Errorf("continue tokens sent = %q, want the listing started over once 4 expired", got)
+	}
+}
+
+func TestListerFallsBackToFullObjects(t *testing.T) {
+	captureConsole(t)
+	server := &pagingServer{total: 3, refuseMetadata: true}
+	l := newPagingLister(t, server, 2)
+	found, err := l.listSelected(context.Background(), "apps", "app=db", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 || !server.fullObject || l.metadataClient != nil {
+		t.Errorf("found %d resources, full objects %v, want the 3 as full objects from then on", len(found), server.fullObject)
+	}
+}
+
+// TestCheckSelectedMatchingNothing closes the discovery window on an empty
+// listing, which is not found, and on a denied one, which is denied.
+func TestCheckSelectedMatchingNothing(t *testing.T) {
+	captureConsole(t)
+	for _, test := range []struct {
+		server *pagingServer
+		want   int
+	}{
+		{&pagingServer{}, exitNotFound},
+		{&pagingServer{deny: true}, exitDenied},
+	} {
+		metadataClient, dynamicClient := newPagingClients(t, test.server)
+		r := &run{
+			opts:           parseTestOptions(t, "-namespace=apps", "-selector=app=db", "-discovery-window=0s"),
+			checker:        checker{dynamicClient: dynamicClient, gvr: externalSecretGVR},
+			metadataClient: metadataClient,
+		}
+		if results, code := r.checkSelected(context.Background(), checkResult{}); len(results) != 0 || code != test.want {
+			t.Errorf("deny %v: checkSelected = %d results, code %d, want none with %d", test.server.deny, len(results), code, test.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// signalError is the cancellation cause of a run stopped by a signal.
+type signalError struct {
+	signal os.Signal
+}
+
+func (e *signalError) Error() string {
+	return "received " + e.signal.String()
+}
+
+// exitCode follows the shell convention of 128 plus the signal number: 130
+// for SIGINT and 143 for SIGTERM.
+func (e *signalError) exitCode() int {
+	if s, ok := e.signal.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// shutdownContext returns a context canceled with a *signalError on the
+// first SIGINT or SIGTERM, such as Kubernetes sends when it deletes the pod.
+// Unlike signal.NotifyContext it keeps which signal it was, for the exit
+// code. Later signals get their default behavior again, so that a second one
+// stops a run that hangs while shutting down.
+func shutdownContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			cancel(&signalError{signal: sig})
+		case <-ctx.Done():
+			signal.Stop(signals)
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// interruptedBy returns the signal that stopped the run, if any.
+func interruptedBy(ctx context.Context) (*signalError, bool) {
+	var sigErr *signalError
+	ok := errors.As(context.Cause(ctx), &sigErr)
+	return sigErr, ok
+}
+
+// printInterrupted tells what the run was waiting for when the signal came,
+// with the last conditions seen of each resource that was not done yet.
+func printInterrupted(sigErr *signalError, results []*checkResult) {
+	for _, result := range results {
+		if result.Outcome != outcomeCanceled && result.Outcome != "" {
+			continue
+		}
+		conditions := make([]string, len(result.Conditions))
+		for i, condition := range result.Conditions {
+			conditions[i] = condition.Type + "=" + condition.Status
+			if condition.Reason != "" {
+				conditions[i] += " (" + condition.Reason + ")"
+			}
+			if condition.Message != "" {
+				conditions[i] += ": " + condition.Message
+			}
+		}
+		last := "none seen"
+		if len(conditions) > 0 {
+			last = strings.Join(conditions, "; ")
+		}
+		console.forResource(result.Namespace, result.Name).infof("Interrupted (%s) while waiting for ExternalSecret %s/%s; last known conditions: %s", sigErr.signal, result.Namespace, result.Name, last)
+	}
+}
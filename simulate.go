@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// simulatedReason marks every reason and message produced by -simulate so
+// that simulated results cannot be mistaken for real ones in any output.
+const simulatedReason = "Simulated"
+
+// simulation is a requested -simulate outcome, produced after a delay
+// without contacting the cluster.
+type simulation struct {
+	outcome  outcome
+	notFound bool
+	after    time.Duration
+}
+
+// parseSimulation parses outcome[:after-duration], where outcome is one of
+// ready, timeout, fatal-condition, not-found, error or slo-violated.
+func parseSimulation(value string) (simulation, error) {
+	name, after, hasAfter := strings.Cut(value, ":")
+	var sim simulation
+	switch name {
+	case "not-found":
+		sim.outcome = outcomeError
+		sim.notFound = true
+	case string(outcomeReady), string(outcomeTimeout), string(outcomeFatalCondition), string(outcomeError), string(outcomeSLOViolated):
+		sim.outcome = outcome(name)
+	default:
+		return sim, fmt.Errorf("unknown outcome %q", name)
+	}
+	if hasAfter {
+		d, err := time.ParseDuration(after)
+		if err != nil || d < 0 {
+			return sim, fmt.Errorf("invalid delay %q", after)
+		}
+		sim.after = d
+	}
+	return sim, nil
+}
+
+// runSimulation fills result as if the check had produced the simulated
+// outcome and returns the exit code of such a run.
+func runSimulation(sim simulation, timeout time.Duration, result *checkResult) int {
+	console.infof("*** SIMULATED run: no cluster access, producing outcome %q after %v ***", sim.outcome, sim.after)
+	result.Simulated = true
+	if result.Cluster == "" {
+		result.Cluster = "simulated"
+	}
+
+	start := time.Now()
+	time.Sleep(sim.after)
+	now := time.Now()
+	result.Waited = now.Sub(start)
+
+	pending := []Condition{{Type: "Ready", Status: "False", Reason: simulatedReason + "Pending", Message: "simulated: waiting for the provider"}}
+	result.Transitions = diffConditions(nil, pending, start)
+	setConditions := func(conditions []Condition) {
+		result.Transitions = append(result.Transitions, diffConditions(result.Conditions, conditions, now)...)
+		result.Conditions = conditions
+		result.Reason = conditions[0].Reason
+	}
+	result.Conditions = pending
+	result.Reason = pending[0].Reason
+
+	var err error
+	switch {
+	case sim.notFound:
+		result.Conditions, result.Transitions, result.Reason = nil, nil, simulatedReason+"NotFound"
+		err = fmt.Errorf("simulated: externalsecrets.external-secrets.io %q not found: %w", result.Name, errNotFound)
+	case sim.outcome == outcomeReady || sim.outcome == outcomeSLOViolated:
+		setConditions([]Condition{{Type: "Ready", Status: "True", Reason: simulatedReason + "Synced", Message: "simulated: secret synced"}})
+		result.ReadyState = readyDuringWait
+		result.RefreshTime = now.UTC().Format(time.RFC3339)
+		result.Latency = &syncLatency{SinceCreation: result.Waited, ReadyTransition: result.Waited, HasReadyTransition: true}
+		if sim.outcome == outcomeSLOViolated {
+			result.SLOViolations = []string{"simulated: sync latency above threshold"}
+		}
+	case sim.outcome == outcomeTimeout:
+		err = fmt.Errorf("simulated: %w: ExternalSecret %s did not become Ready within %v", errTimeout, result.Name, timeout)
+	case sim.outcome == outcomeFatalCondition:
+		setConditions([]Condition{{Type: "Ready", Status: "False", Reason: simulatedReason + "SecretSyncedError", Message: "simulated: could not get secret data from provider"}})
+		err = &conditionError{Reason: result.Reason, err: fmt.Errorf("simulated: ExternalSecret %s has condition Ready=False (%s)", result.Name, result.Reason)}
+	default:
+		err = fmt.Errorf("simulated: error getting ExternalSecret %s", result.Name)
+	}
+	result.Outcome = sim.outcome
+
+	if err != nil {
+		console.errorf("Error: %v", err)
+		return exitCodeFor(err)
+	}
+	if sim.outcome == outcomeSLOViolated {
+		for _, violation := range result.SLOViolations {
+			console.infof("SLO violated: %s", violation)
+		}
+		return exitSLOViolated
+	}
+	console.infof("ExternalSecret %s has reached Ready state.", result.Name)
+	return exitOK
+}
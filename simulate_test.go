@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+// TestSimulationExitCodes runs every -simulate outcome: each exits as a real
+// run with that outcome would.
+func TestSimulationExitCodes(t *testing.T) {
+	captureConsole(t)
+	for value, want := range map[string]int{
+		"ready":           exitOK,
+		"timeout":         exitTimeout,
+		"fatal-condition": exitFatal,
+		"not-found":       exitNotFound,
+		"error":           exitFailure,
+		"slo-violated":    exitSLOViolated,
+	} {
+		sim, err := parseSimulation(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := &checkResult{Namespace: "apps", Name: "db"}
+		if code := runSimulation(sim, 0, result); code != want || !result.Simulated {
+			t.Errorf("%s: exit code %d, simulated %v, want %d", value, code, result.Simulated, want)
+		}
+	}
+}
+
+// TestSimulatedResultsAreMarked checks that simulated results cannot pass
+// for real ones in the CSV report and the metrics.
+func TestSimulatedResultsAreMarked(t *testing.T) {
+	captureConsole(t)
+	sim, _ := parseSimulation("timeout")
+	simulated := &checkResult{Namespace: "apps", Name: "db"}
+	runSimulation(sim, 0, simulated)
+	real := &checkResult{Cluster: "prod", Namespace: "apps", Name: "cache", Outcome: outcomeReady}
+
+	var b strings.Builder
+	if err := writeCSVReport(&b, []*checkResult{simulated, real}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	column := len(rows[0]) - 1
+	if rows[0][column] != "simulated" || rows[1][column] != "true" || rows[2][column] != "false" {
+		t.Errorf("simulated column = %q, %q, %q, want simulated, true, false", rows[0][column], rows[1][column], rows[2][column])
+	}
+
+	b.Reset()
+	if err := writeMetricsTextfile(&b, []*checkResult{simulated, real}); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if marked := strings.Contains(line, `simulated="true"`); marked != strings.Contains(line, `name="db"`) {
+			t.Errorf("sample %q is marked simulated: %v", line, marked)
+		}
+	}
+}
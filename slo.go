@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// exitSLOViolated is the exit code of a run whose resource became Ready, but
+// only after exceeding a configured SLO threshold.
+const exitSLOViolated = 7
+
+// checkSLO downgrades a Ready result to slo-violated when the wait or the sync
+// latency exceeded the given thresholds. Zero thresholds are disabled. The
+// resource is still functionally Ready; Ready() keeps reporting true.
+func (r *checkResult) checkSLO(maxWait, maxLatency time.Duration) {
+	if r.Outcome != outcomeReady {
+		return
+	}
+	if maxWait > 0 && r.Waited > maxWait {
+		r.SLOViolations = append(r.SLOViolations,
+			fmt.Sprintf("waited %s for Ready, more than the allowed %s", formatDuration(r.Waited), formatDuration(maxWait)))
+	}
+	if maxLatency > 0 && r.Latency != nil && r.Latency.Latency() > maxLatency {
+		r.SLOViolations = append(r.SLOViolations,
+			fmt.Sprintf("sync latency %s exceeds the allowed %s", formatDuration(r.Latency.Latency()), formatDuration(maxLatency)))
+	}
+	if len(r.SLOViolations) > 0 {
+		r.Outcome = outcomeSLOViolated
+	}
+}
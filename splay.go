@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// splayIdentityEnv are the environment variables tried, in order, to seed
+// the splay. Seeding from the pod identity spreads the pods of one rollout
+// evenly while keeping each pod's delay reproducible.
+var splayIdentityEnv = []string{"POD_UID", "POD_NAME", "HOSTNAME"}
+
+// splayDelay picks the start delay within window. It returns the delay and
+// what it was seeded from.
+func splayDelay(window time.Duration) (time.Duration, string) {
+	if window <= 0 {
+		return 0, ""
+	}
+	for _, env := range splayIdentityEnv {
+		if identity := os.Getenv(env); identity != "" {
+			h := fnv.New64a()
+			h.Write([]byte(identity))
+			return time.Duration(h.Sum64() % uint64(window)), env
+		}
+	}
+	return time.Duration(rand.Int63n(int64(window))), "random"
+}
+
+// pollJitter is the random offset of the poll ticker within interval, so
+// that checkers started at the same moment do not poll in lockstep. The first
+// poll still happens right away.
+func pollJitter(interval time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(interval)))
+}
+
+// sleepSplay waits for the splay delay. It happens before the deadline
+// starts, so it never shortens the wait.
+func sleepSplay(ctx context.Context, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	console.infof("Delaying start by %s (-splay)", formatDuration(delay))
+	sleepContext(ctx, delay)
+}
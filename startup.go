@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// processStart approximates when the process started, for the first startup
+// phase.
+var processStart = time.Now()
+
+// The startup phases, in the order they happen. Splay is a deliberate delay
+// and the only one not counted against -startup-budget.
+const (
+	startupInit      = "init"
+	startupConfig    = "config"
+	startupClients   = "clients"
+	startupSplay     = "splay"
+	startupDiscovery = "api-discovery"
+	startupNamespace = "namespace"
+	startupFirstGet  = "first-get"
+)
+
+// startupPhase is how long one phase of the startup took.
+type startupPhase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// startupPhases is the startup breakdown of a cluster.
+type startupPhases []startupPhase
+
+func (p startupPhases) String() string {
+	parts := make([]string, len(p))
+	for i, phase := range p {
+		parts[i] = fmt.Sprintf("%s=%v", phase.Name, phase.Duration.Round(time.Millisecond))
+	}
+	return strings.Join(parts, " ")
+}
+
+// budgeted returns the time the phases took, leaving out the splay.
+func (p startupPhases) budgeted() time.Duration {
+	var total time.Duration
+	for _, phase := range p {
+		if phase.Name != startupSplay {
+			total += phase.Duration
+		}
+	}
+	return total
+}
+
+// startupTimer measures the startup of a cluster's checks phase by phase,
+// until the first successful Get of a resource. It is safe for concurrent
+// use, and a nil startupTimer measures nothing.
+type startupTimer struct {
+	log     *logger
+	verbose bool
+	budget  time.Duration
+
+	mu     sync.Mutex
+	last   time.Time
+	phases startupPhases
+	// done is set once the first Get succeeded.
+	done bool
+}
+
+// newStartupTimer starts measuring at now, with the time from the process
+// start to initEnd as the init phase.
+func newStartupTimer(log *logger, verbose bool, budget time.Duration, initEnd time.Time) *startupTimer {
+	t := &startupTimer{log: log, verbose: verbose, budget: budget, last: time.Now()}
+	t.phases = startupPhases{{startupInit, initEnd.Sub(processStart)}}
+	return t
+}
+
+// restart starts the next phase now, leaving the time since the last one
+// unaccounted for.
+func (t *startupTimer) restart() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.last = time.Now()
+	t.mu.Unlock()
+}
+
+// record ends the phase that started with the last one.
+func (t *startupTimer) record(phase string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recordLocked(phase)
+}
+
+func (t *startupTimer) recordLocked(phase string) {
+	now := time.Now()
+	took := now.Sub(t.last)
+	t.phases = append(t.phases, startupPhase{phase, took})
+	t.last = now
+	if t.verbose {
+		t.log.debugf("Startup phase %s took %v", phase, took.Round(time.Millisecond))
+	}
+}
+
+// firstGet ends the startup at the first successful Get of the cluster's
+// checks, warning when it took longer than the budget.
+func (t *startupTimer) firstGet() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	t.recordLocked(startupFirstGet)
+	if total := t.phases.budgeted(); t.budget > 0 && total > t.budget {
+		t.log.warnf("Warning: startup took %v, over -startup-budget %v: %s", total.Round(time.Millisecond), t.budget, t.phases)
+	}
+}
+
+// breakdown returns the phases measured so far.
+func (t *startupTimer) breakdown() startupPhases {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append(startupPhases(nil), t.phases...)
+}
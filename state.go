@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// stateSchemaVersion is bumped whenever the layout of the state file changes.
+// Files with a different version are discarded rather than misinterpreted.
+const stateSchemaVersion = 1
+
+// dataHashAnnotation is set by the external-secrets controller on the target
+// Secret and changes whenever the synced data changes.
+const dataHashAnnotation = "reconcile.external-secrets.io/data-hash"
+
+type stateDelta string
+
+const (
+	deltaNew         stateDelta = "new"
+	deltaUnchanged   stateDelta = "unchanged"
+	deltaRotated     stateDelta = "rotated"
+	deltaNewlyBroken stateDelta = "newly-broken"
+	deltaRecovered   stateDelta = "recovered"
+	deltaRecreated   stateDelta = "recreated"
+)
+
+type stateEntry struct {
+	UID         string `json:"uid"`
+	RefreshTime string `json:"refreshTime,omitempty"`
+	DataHash    string `json:"dataHash,omitempty"`
+	Ready       bool   `json:"ready"`
+	// Keys is the number of data keys of the target Secret, when known.
+	Keys int `json:"keys,omitempty"`
+	// Waits holds how long recent runs waited for Ready, in seconds.
+	Waits []float64 `json:"waits,omitempty"`
+}
+
+type stateFile struct {
+	Version   int                   `json:"version"`
+	Resources map[string]stateEntry `json:"resources"`
+}
+
+func stateKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// loadState reads the state written by a previous run. A missing file yields
+// an empty state; a corrupt or incompatible one is reported and ignored so it
+// gets rewritten at the end of this run.
+func loadState(path string) map[string]stateEntry {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			console.warnf("Warning: ignoring state file %s: %v", path, err)
+		}
+		return map[string]stateEntry{}
+	}
+
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		console.warnf("Warning: ignoring corrupt state file %s: %v", path, err)
+		return map[string]stateEntry{}
+	}
+	if state.Version != stateSchemaVersion || state.Resources == nil {
+		console.warnf("Warning: ignoring state file %s with unsupported schema version %d", path, state.Version)
+		return map[string]stateEntry{}
+	}
+	return state.Resources
+}
+
+// saveState merges the given results into the previous state and writes it.
+// Entries for resources not checked in this run are kept.
+func saveState(path string, previous map[string]stateEntry, results []*checkResult) error {
+	state := stateFile{Version: stateSchemaVersion, Resources: make(map[string]stateEntry, len(previous))}
+	for key, entry := range previous {
+		state.Resources[key] = entry
+	}
+	for _, r := range results {
+		if r.UID == "" || r.Outcome == outcomeSkipped {
+			continue
+		}
+		key := stateKey(r.Namespace, r.Name)
+		entry := r.stateEntry()
+		entry.Waits = recordWait(previous[key].Waits, r)
+		state.Resources[key] = entry
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(state)
+	})
+}
+
+func (r *checkResult) stateEntry() stateEntry {
+	return stateEntry{
+		UID:         r.UID,
+		RefreshTime: r.RefreshTime,
+		DataHash:    r.DataHash,
+		Ready:       r.Ready(),
+		Keys:        r.SecretKeys,
+	}
+}
+
+// compareState classifies how a resource changed since the previous run.
+func compareState(previous stateEntry, found bool, current stateEntry) stateDelta {
+	switch {
+	case !found:
+		return deltaNew
+	case previous.UID != current.UID:
+		return deltaRecreated
+	case previous.Ready && !current.Ready:
+		return deltaNewlyBroken
+	case !previous.Ready && current.Ready:
+		return deltaRecovered
+	case previous.RefreshTime != current.RefreshTime || previous.DataHash != current.DataHash:
+		return deltaRotated
+	default:
+		return deltaUnchanged
+	}
+}
+
+// keyDropRatio is the fraction of the previous run's key count below which
+// a shrinking target Secret is warned about.
+const keyDropRatio = 0.5
+
+// keyCountDrop describes a large drop of the target Secret's key count since
+// the previous run, or returns an empty string.
+func keyCountDrop(previous, current stateEntry) string {
+	if previous.Keys == 0 || current.Keys == 0 || float64(current.Keys) >= float64(previous.Keys)*keyDropRatio {
+		return ""
+	}
+	return fmt.Sprintf("target Secret key count dropped from %d to %d since the last run", previous.Keys, current.Keys)
+}
+
+// fetchTargetState returns the data-hash annotation and the number of data
+// keys of the ExternalSecret's target Secret, time-boxed by timeout within
+// ctx.
+func fetchTargetState(ctx context.Context, clientset kubernetes.Interface, unstructuredES *unstructured.Unstructured, timeout time.Duration) (string, int, error) {
+	target := targetSecretName(unstructuredES)
+	ctx, cancel, err := phaseContext(ctx, timeout)
+	if err != nil {
+		return "", 0, err
+	}
+	defer cancel()
+
+	secret, err := clientset.CoreV1().Secrets(unstructuredES.GetNamespace()).Get(ctx, target, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, fmt.Errorf("could not read target Secret %s: %w", target, err)
+	}
+	return secret.Annotations[dataHashAnnotation], len(secret.Data), nil
+}
+
+// targetSecretName returns spec.target.name, which defaults to the name of
+// the ExternalSecret itself.
+func targetSecretName(unstructuredES *unstructured.Unstructured) string {
+	if name, _, _ := unstructured.NestedString(unstructuredES.Object, "spec", "target", "name"); name != "" {
+		return name
+	}
+	return unstructuredES.GetName()
+}
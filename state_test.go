@@ -0,0 +1,26 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStateChangeNamesTheNamespace writes the state file for resources of
+// the same name in two namespaces: each change line tells them apart.
+func TestStateChangeNamesTheNamespace(t *testing.T) {
+	out := captureConsole(t)
+	reports := reportFiles{stateFile: filepath.Join(t.TempDir(), "state.json")}
+	results := []*checkResult{
+		{Namespace: "apps", Name: "db", UID: "uid-apps-db", Outcome: outcomeReady},
+		{Namespace: "staging", Name: "db", UID: "uid-staging-db", Outcome: outcomeReady},
+	}
+	if err := reports.write(results); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Change since last run of apps/db: ", "Change since last run of staging/db: "} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("the output lacks %q:\n%s", want, out)
+		}
+	}
+}
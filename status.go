@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// minRefreshNow is the -min-refresh-time value standing for the start of the
+// checker.
+const minRefreshNow = "now"
+
+// resourceStatus is what the status of a resource says about the sync it
+// reports, beyond its conditions.
+type resourceStatus struct {
+	// Generation is metadata.generation, the version of the spec.
+	Generation int64
+	// RefreshTimeRaw is status.refreshTime as written, RefreshTime its
+	// parsed value when valid.
+	RefreshTimeRaw   string
+	RefreshTime      time.Time
+	RefreshTimeValid bool
+	// ReconciledGeneration is the generation the status was written for,
+	// from status.observedGeneration or the generation prefix of
+	// status.syncedResourceVersion, when either is set.
+	ReconciledGeneration int64
+	HasReconciled        bool
+}
+
+// parseStatus decodes the status of a resource. Odd values, written by
+// other controllers or older versions, leave the fields they fill unset.
+func parseStatus(unstructuredES *unstructured.Unstructured) resourceStatus {
+	status := resourceStatus{Generation: unstructuredES.GetGeneration()}
+	switch raw := unstructuredES.Object["status"].(type) {
+	case map[string]any:
+		status.RefreshTimeRaw = conditionField(raw, "refreshTime")
+		status.RefreshTime, status.RefreshTimeValid = parseRefreshTime(status.RefreshTimeRaw)
+		if generation, ok := observedGeneration(raw["observedGeneration"]); ok {
+			status.ReconciledGeneration, status.HasReconciled = generation, true
+		} else if version, ok := raw["syncedResourceVersion"].(string); ok {
+			status.ReconciledGeneration, status.HasReconciled = syncedGeneration(version)
+		}
+	}
+	return status
+}
+
+// parseRefreshTime accepts RFC 3339 timestamps with or without fractional
+// seconds. Empty, zero and otherwise malformed values are not valid.
+func parseRefreshTime(raw string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(raw))
+	if err != nil || t.IsZero() {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// observedGeneration reads status.observedGeneration, which decodes as an
+// int64 from the API server and as a float64 from JSON fixtures.
+func observedGeneration(value any) (int64, bool) {
+	switch value := value.(type) {
+	case int64:
+		return value, true
+	case float64:
+		return int64(value), true
+	}
+	return 0, false
+}
+
+// syncedGeneration reads the generation from status.syncedResourceVersion,
+// which the controller writes as <generation>-<hash of the metadata>.
+func syncedGeneration(version string) (int64, bool) {
+	prefix, _, _ := strings.Cut(version, "-")
+	generation, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return generation, true
+}
+
+// parseMinRefreshTime parses -min-refresh-time as of start.
+func parseMinRefreshTime(value string, start time.Time) (time.Time, error) {
+	if value == minRefreshNow {
+		return start, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 timestamp or %q, got %q", minRefreshNow, value)
+	}
+	return t, nil
+}
+
+// pending describes why a Ready status does not yet satisfy -min-refresh-time
+// and -wait-for-generation, or returns an empty string when it does.
+func (s resourceStatus) pending(minRefresh time.Time, waitForGeneration bool) string {
+	if waitForGeneration {
+		switch {
+		case !s.HasReconciled:
+			return fmt.Sprintf("the status does not report which generation it reconciled (generation %d)", s.Generation)
+		case s.ReconciledGeneration < s.Generation:
+			return fmt.Sprintf("generation %d is not reconciled yet, the status is for generation %d", s.Generation, s.ReconciledGeneration)
+		}
+	}
+	if !minRefresh.IsZero() {
+		switch {
+		case s.RefreshTimeRaw == "":
+			return "status.refreshTime is not set yet"
+		case !s.RefreshTimeValid:
+			return fmt.Sprintf("status.refreshTime %q is not a valid timestamp", s.RefreshTimeRaw)
+		case !s.RefreshTime.After(minRefresh):
+			return fmt.Sprintf("last refresh was at %s, not after %s", s.RefreshTime.Format(time.RFC3339), minRefresh.Format(time.RFC3339))
+		}
+	}
+	return ""
+}
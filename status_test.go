@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func withStatus(generation int64, status map[string]any) *unstructured.Unstructured {
+	object := newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db")
+	object.SetGeneration(generation)
+	object.Object["status"] = status
+	return object
+}
+
+func TestParseStatusRefreshTime(t *testing.T) {
+	for _, test := range []struct {
+		refreshTime any
+		want        string
+	}{
+		{"2024-05-01T10:00:00Z", "2024-05-01T10:00:00Z"},
+		{"2024-05-01T10:00:00.123456Z", "2024-05-01T10:00:00.123456Z"},
+		{"2024-05-01T12:00:00+02:00", "2024-05-01T10:00:00Z"},
+		{" 2024-05-01T10:00:00Z\n", "2024-05-01T10:00:00Z"},
+		{nil, ""},
+		{"", ""},
+		{"0001-01-01T00:00:00Z", ""},
+		{"2024-05-01 10:00:00", ""},
+		{"1714557600", ""},
+		{int64(1714557600), ""},
+	} {
+		status := map[string]any{}
+		if test.refreshTime != nil {
+			status["refreshTime"] = test.refreshTime
+		}
+		parsed := parseStatus(withStatus(1, status))
+		got := ""
+		if parsed.RefreshTimeValid {
+			got = parsed.RefreshTime.UTC().Format(time.RFC3339Nano)
+		}
+		if got != test.want {
+			t.Errorf("refreshTime %#v parsed as %q, want %q", test.refreshTime, got, test.want)
+		}
+	}
+
+	// A status that is not an object is left unparsed
+	object := newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db")
+	object.Object["status"] = "pending"
+	if parsed := parseStatus(object); parsed.RefreshTimeRaw != "" || parsed.HasReconciled {
+		t.Errorf("status %q parsed as %+v", "pending", parsed)
+	}
+}
+
+func TestParseStatusGeneration(t *testing.T) {
+	for _, test := range []struct {
+		status map[string]any
+		want   int64
+		ok     bool
+	}{
+		{map[string]any{"observedGeneration": int64(3)}, 3, true},
+		{map[string]any{"observedGeneration": float64(3)}, 3, true},
+		{map[string]any{"syncedResourceVersion": "3-4f1b2c"}, 3, true},
+		{map[string]any{"observedGeneration": int64(2), "syncedResourceVersion": "3-4f1b2c"}, 2, true},
+		{map[string]any{"syncedResourceVersion": "4f1b2c"}, 0, false},
+		{map[string]any{"observedGeneration": "3"}, 0, false},
+		{map[string]any{}, 0, false},
+	} {
+		parsed := parseStatus(withStatus(3, test.status))
+		if parsed.ReconciledGeneration != test.want || parsed.HasReconciled != test.ok {
+			t.Errorf("%v: reconciled generation %d, %v, want %d, %v", test.status, parsed.ReconciledGeneration, parsed.HasReconciled, test.want, test.ok)
+		}
+	}
+}
+
+func TestStatusPending(t *testing.T) {
+	minRefresh := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name              string
+		status            map[string]any
+		minRefresh        time.Time
+		waitForGeneration bool
+		want              string
+	}{
+		{"no requirement", map[string]any{}, time.Time{}, false, ""},
+		{"refreshed after", map[string]any{"refreshTime": "2024-05-01T10:00:01Z"}, minRefresh, false, ""},
+		{"refreshed at", map[string]any{"refreshTime": "2024-05-01T10:00:00Z"}, minRefresh, false, "not after 2024-05-01T10:00:00Z"},
+		{"not refreshed", map[string]any{}, minRefresh, false, "not set yet"},
+		{"odd refreshTime", map[string]any{"refreshTime": "yesterday"}, minRefresh, false, `"yesterday" is not a valid timestamp`},
+		{"reconciled", map[string]any{"observedGeneration": int64(3)}, time.Time{}, true, ""},
+		{"behind", map[string]any{"syncedResourceVersion": "2-4f1b2c"}, time.Time{}, true, "generation 3 is not reconciled yet"},
+		{"unknown generation", map[string]any{}, time.Time{}, true, "does not report which generation"},
+		{"generation first", map[string]any{"observedGeneration": int64(2)}, minRefresh, true, "generation 3 is not reconciled yet"},
+	} {
+		got := parseStatus(withStatus(3, test.status)).pending(test.minRefresh, test.waitForGeneration)
+		if (got == "") != (test.want == "") || !strings.Contains(got, test.want) {
+			t.Errorf("%s: pending = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseMinRefreshTime(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if got, err := parseMinRefreshTime("now", start); err != nil || !got.Equal(start) {
+		t.Errorf("now = %s, %v, want the start", got, err)
+	}
+	if got, err := parseMinRefreshTime("2024-05-01T12:30:00+02:00", start); err != nil || !got.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("timestamp = %s, %v", got, err)
+	}
+	for _, value := range []string{"", "today", "2024-05-01"} {
+		if _, err := parseMinRefreshTime(value, start); err == nil {
+			t.Errorf("parseMinRefreshTime(%q) succeeded", value)
+		}
+	}
+}
+
+// TestWaitRequiresRefreshAfterMinRefreshTime checks that a resource that is
+// Ready from an earlier sync does not pass -min-refresh-time=now.
+func TestWaitRequiresRefreshAfterMinRefreshTime(t *testing.T) {
+	out := captureConsole(t)
+	object := newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", readyCondition("True", "SecretSynced"))
+	object.Object["status"].(map[string]any)["refreshTime"] = time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	c := newTestCluster(object)
+	results, code := c.check(t, 300*time.Millisecond, "-namespace=apps", "-name=db", "-interval=50ms", "-watch-mode=poll", "-skip-freshness", "-min-refresh-time=now")
+	if code != exitTimeout || results[0].Ready() {
+		t.Errorf("exit code %d, outcome %s, want a timeout", code, results[0].Outcome)
+	}
+	if !strings.Contains(out.String(), "not after") {
+		t.Errorf("the stale refresh was not explained:\n%s", out)
+	}
+}
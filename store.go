@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The stores an ExternalSecret syncs from, in the API group and version of
+// the ExternalSecret.
+const (
+	secretStoreKind             = "SecretStore"
+	clusterSecretStoreKind      = "ClusterSecretStore"
+	secretStoresResource        = "secretstores"
+	clusterSecretStoresResource = "clustersecretstores"
+)
+
+// storeRef is spec.secretStoreRef of an ExternalSecret.
+type storeRef struct {
+	Kind string
+	Name string
+}
+
+func (r storeRef) String() string {
+	return r.Kind + " " + r.Name
+}
+
+// secretStoreRef returns the store the ExternalSecret refers to, the kind
+// defaulting to SecretStore as in the controller. It reports false for
+// ExternalSecrets without a store reference, such as those reading from
+// generators only.
+func secretStoreRef(unstructuredES *unstructured.Unstructured) (storeRef, bool) {
+	name, _, _ := unstructured.NestedString(unstructuredES.Object, "spec", "secretStoreRef", "name")
+	if name == "" {
+		return storeRef{}, false
+	}
+	kind, _, _ := unstructured.NestedString(unstructuredES.Object, "spec", "secretStoreRef", "kind")
+	if kind == "" {
+		kind = secretStoreKind
+	}
+	return storeRef{Kind: kind, Name: name}, true
+}
+
+// storeGVR returns the resource of the store kind, served under the group
+// and version of the ExternalSecret gvr, and whether it is cluster-scoped.
+func storeGVR(es schema.GroupVersionResource, kind string) (schema.GroupVersionResource, bool, error) {
+	switch kind {
+	case secretStoreKind:
+		return es.GroupVersion().WithResource(secretStoresResource), false, nil
+	case clusterSecretStoreKind:
+		return es.GroupVersion().WithResource(clusterSecretStoresResource), true, nil
+	}
+	return schema.GroupVersionResource{}, false, fmt.Errorf("unknown store kind %q", kind)
+}
+
+// storeError is a store that is missing or not Ready, which the
+// ExternalSecret cannot sync from until someone fixes the store.
+type storeError struct {
+	ref       storeRef
+	namespace string
+	missing   bool
+	condition *Condition
+}
+
+func (e *storeError) Error() string {
+	where := e.ref.String()
+	if e.namespace != "" {
+		where += " in namespace " + e.namespace
+	}
+	switch {
+	case e.missing:
+		return where + " does not exist"
+	case e.condition == nil:
+		return where + " has no Ready condition"
+	}
+	return fmt.Sprintf("%s is not Ready: Ready=%s (%s): %s", where, e.condition.Status, e.condition.Reason, e.condition.Message)
+}
+
+// code is the reason code of a result failed by the store.
+func (e *storeError) code() reasonCode {
+	if e.missing {
+		return reasonStoreNotFound
+	}
+	return reasonStoreUnhealthy
+}
+
+// verifyStore checks that the store the ExternalSecret refers to exists and
+// is Ready, time-boxed by the per-call timeout, and returns its Ready
+// condition, if it has one. It returns a *storeError when it is not; other
+// errors mean the store could not be checked.
+func (c *checker) verifyStore(ctx context.Context, unstructuredES *unstructured.Unstructured) (*Condition, error) {
+	ref, ok := secretStoreRef(unstructuredES)
+	if !ok {
+		c.log.infof("ExternalSecret %s refers to no store, skipping the store check", unstructuredES.GetName())
+		return nil, nil
+	}
+	gvr, clusterScoped, err := storeGVR(c.gvr, ref.Kind)
+	if err != nil {
+		return nil, err
+	}
+	namespace := unstructuredES.GetNamespace()
+	if clusterScoped {
+		namespace = ""
+	}
+	ctx, cancel, err := phaseContext(ctx, c.perCallTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	store, err := c.dynamicClient.Resource(gvr).Namespace(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err) && !isResourceUnavailable(err):
+		return nil, &storeError{ref: ref, namespace: namespace, missing: true}
+	case err != nil:
+		return nil, fmt.Errorf("reading %s: %w", ref, err)
+	}
+	for _, condition := range getConditions(store) {
+		if condition.Type != "Ready" {
+			continue
+		}
+		if condition.Status == "True" {
+			c.log.infof("%s is Ready", ref)
+			return &condition, nil
+		}
+		return &condition, &storeError{ref: ref, namespace: namespace, condition: &condition}
+	}
+	return nil, &storeError{ref: ref, namespace: namespace}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func externalSecretWithStore(namespace, name, storeKind, storeName string) *unstructured.Unstructured {
+	es := newTestObject(externalSecretGVR, "ExternalSecret", namespace, name)
+	ref := map[string]any{"name": storeName}
+	if storeKind != "" {
+		ref["kind"] = storeKind
+	}
+	es.Object["spec"] = map[string]any{"secretStoreRef": ref}
+	return es
+}
+
+func TestVerifyStoreReturnsReadyCondition(t *testing.T) {
+	captureConsole(t)
+	storeGVR := externalSecretGVR.GroupVersion().WithResource(clusterSecretStoresResource)
+	dynamicClient := newFakeDynamicClient(
+		newTestObject(storeGVR, clusterSecretStoreKind, "", "vault-prod", readyCondition("False", "InvalidProviderConfig")),
+		newTestObject(storeGVR, clusterSecretStoreKind, "", "vault-dev", readyCondition("True", "Valid")),
+	)
+	c := &checker{dynamicClient: dynamicClient, gvr: externalSecretGVR, perCallTimeout: 5 * time.Second}
+
+	condition, err := c.verifyStore(context.Background(), externalSecretWithStore("apps", "db", clusterSecretStoreKind, "vault-prod"))
+	var storeErr *storeError
+	if !errors.As(err, &storeErr) || condition == nil || condition.Reason != "InvalidProviderConfig" {
+		t.Errorf("verifyStore = %+v, %v, want the Ready=False condition with a store error", condition, err)
+	}
+	condition, err = c.verifyStore(context.Background(), externalSecretWithStore("apps", "db", clusterSecretStoreKind, "vault-dev"))
+	if err != nil || condition == nil || condition.Status != "True" {
+		t.Errorf("verifyStore = %+v, %v, want the Ready=True condition", condition, err)
+	}
+	condition, err = c.verifyStore(context.Background(), externalSecretWithStore("apps", "db", clusterSecretStoreKind, "gone"))
+	if !errors.As(err, &storeErr) || !storeErr.missing || condition != nil {
+		t.Errorf("verifyStore = %+v, %v, want a missing store", condition, err)
+	}
+}
+
+func TestObserveRecordsStore(t *testing.T) {
+	var result checkResult
+	result.observe(externalSecretWithStore("apps", "db", "", "vault"), nil)
+	if result.Store == nil || *result.Store != (storeRef{Kind: secretStoreKind, Name: "vault"}) {
+		t.Errorf("Store = %+v, want the SecretStore vault", result.Store)
+	}
+	result.observe(newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db"), nil)
+	if result.Store != nil || storeGroup(&result) != storeUnknown {
+		t.Errorf("Store = %+v, want none once the reference is gone", result.Store)
+	}
+}
+
+func TestBatchSummaryGroupsFailuresByStore(t *testing.T) {
+	out := captureConsole(t)
+	vault := &storeRef{Kind: clusterSecretStoreKind, Name: "vault-prod"}
+	local := &storeRef{Kind: secretStoreKind, Name: "local"}
+	notReady := &Condition{Type: "Ready", Status: "False", Reason: "InvalidProviderConfig"}
+	printBatchSummary([]*checkResult{
+		{Namespace: "apps", Name: "db", Outcome: outcomeFatalCondition, Store: vault, StoreReady: notReady},
+		{Namespace: "web", Name: "tls", Outcome: outcomeTimeout, Store: vault},
+		{Namespace: "apps", Name: "cache", Outcome: outcomeTimeout, Store: vault},
+		{Namespace: "apps", Name: "queue", Outcome: outcomeTimeout, Store: local},
+		{Namespace: "web", Name: "cdn", Outcome: outcomeError, Store: local},
+		{Namespace: "apps", Name: "legacy", Outcome: outcomeError},
+		{Namespace: "apps", Name: "api", Outcome: outcomeReady, Store: vault},
+		{Namespace: "apps", Name: "later", Outcome: outcomeCanceled, Store: vault},
+	})
+	want := []string{
+		"3 of 6 failures reference ClusterSecretStore vault-prod (store Ready=False, InvalidProviderConfig)",
+		"1 of 6 failures reference SecretStore local in namespace apps",
+		"1 of 6 failures reference SecretStore local in namespace web",
+		"1 of 6 failures reference an unknown store",
+		"Ready: ",
+	}
+	last := -1
+	for _, line := range want {
+		i := strings.Index(out.String(), line)
+		if i <= last {
+			t.Fatalf("summary lacks %q after the previous line:\n%s", line, out)
+		}
+		last = i
+	}
+}
+
+func TestBatchSummaryOmitsStoresOfASingleFailure(t *testing.T) {
+	out := captureConsole(t)
+	printBatchSummary([]*checkResult{
+		{Namespace: "apps", Name: "db", Outcome: outcomeTimeout, Store: &storeRef{Kind: secretStoreKind, Name: "vault"}},
+		{Namespace: "apps", Name: "api", Outcome: outcomeReady},
+	})
+	if strings.Contains(out.String(), "failures reference") {
+		t.Errorf("summary groups a single failure by store:\n%s", out)
+	}
+}
+
+func TestResultRecordCarriesStore(t *testing.T) {
+	record := newResultRecord(&checkResult{
+		Store:      &storeRef{Kind: clusterSecretStoreKind, Name: "vault-prod"},
+		StoreReady: &Condition{Type: "Ready", Status: "False"},
+	})
+	if record.Store != "ClusterSecretStore/vault-prod" || record.StoreReady == nil {
+		t.Errorf("store, storeReady = %q, %+v, want the store and its condition", record.Store, record.StoreReady)
+	}
+	if record := newResultRecord(&checkResult{}); record.Store != storeUnknown {
+		t.Errorf("store = %q, want %q without a store reference", record.Store, storeUnknown)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// printSummary prints the final plain-text summary of a run.
+func printSummary(result *checkResult) {
+	header := "Summary"
+	if result.Simulated {
+		header = "SIMULATED " + header
+	}
+	if result.Cluster != "" {
+		header += fmt.Sprintf(" [cluster %s]", result.Cluster)
+	}
+	if len(result.Labels) > 0 {
+		header += fmt.Sprintf(" [%s]", keyValueFlag(result.Labels))
+	}
+	console.infof("%s: %s", header, resultLine(result))
+	if result.Binding != nil {
+		console.infof("  bound secret: %s", result.Binding)
+	}
+	for _, verdict := range result.Requirements {
+		console.infof("  requirement: %s", verdict)
+	}
+	if result.RemoteRefs != nil && !result.Ready() {
+		console.infof("  remote refs: %s", result.RemoteRefs)
+	}
+	if n := redactions.count(result.Namespace, result.Name); n > 0 {
+		console.infof("  redactions: %d messages masked by -redact-pattern", n)
+	}
+	if len(result.DuplicateConditions) > 0 {
+		console.infof("  anomaly: duplicate conditions of type %s", strings.Join(result.DuplicateConditions, ", "))
+	}
+	if result.ClockSkewNote != "" {
+		console.infof("  clock skew: %s", result.ClockSkewNote)
+	}
+	for _, skipped := range result.SkippedPhases {
+		console.infof("  %s", skipped)
+	}
+	if result.Comparison != nil {
+		console.infof("  comparison: %s", result.Comparison)
+	}
+	if result.Compared != nil {
+		printSummary(result.Compared)
+	}
+}
+
+// resultLine describes the outcome of a single resource on one line. The
+// summaries of runs checking several resources repeat the line printed as
+// each one completed.
+func resultLine(result *checkResult) string {
+	outcome := string(result.Outcome)
+	if result.ReadyState != "" {
+		outcome += " (" + result.ReadyState + ")"
+	}
+	if result.ReasonCode != "" {
+		outcome += " [" + string(result.ReasonCode) + "]"
+	}
+	return fmt.Sprintf("ExternalSecret %s/%s %s after %s", result.Namespace, result.Name, outcome, formatDuration(result.Waited))
+}
+
+// printBatchSummary prints the results of a run checking several resources
+// in the order they completed, then which became Ready and which did not,
+// by namespace with how long they waited when they span several, and the
+// stores the failures refer to.
+func printBatchSummary(results []*checkResult) {
+	console.infof("Results in order of completion:")
+	var namespaces []string
+	byNamespace := map[string][]*checkResult{}
+	for _, result := range results {
+		console.infof("  %s", resultLine(result))
+		if _, seen := byNamespace[result.Namespace]; !seen {
+			namespaces = append(namespaces, result.Namespace)
+		}
+		byNamespace[result.Namespace] = append(byNamespace[result.Namespace], result)
+	}
+	if len(namespaces) > 1 {
+		// Across namespaces every instance is listed under its namespace
+		sort.Strings(namespaces)
+		for _, namespace := range namespaces {
+			console.infof("Namespace %s: %s; %s", namespace, readyLine(byNamespace[namespace], false), waitedLine(byNamespace[namespace]))
+		}
+	}
+	printStoreGroups(results)
+	console.infof("Ready: %s", readyLine(results, len(namespaces) > 1))
+}
+
+// storeUnknown is the store group of resources whose store reference could
+// not be read.
+const storeUnknown = "unknown"
+
+// storeGroup names the store a result refers to as kind/name, for reports.
+func storeGroup(result *checkResult) string {
+	if result.Store == nil {
+		return storeUnknown
+	}
+	return result.Store.Kind + "/" + result.Store.Name
+}
+
+// printStoreGroups groups the failures of a run checking several resources
+// by the store they refer to, the largest group first: when many fail at
+// once, one shared store is usually what is broken. Namespaced stores of
+// the same name in different namespaces are different stores.
+func printStoreGroups(results []*checkResult) {
+	type group struct {
+		store string
+		count int
+		ready *Condition
+	}
+	var groups []*group
+	index := map[string]*group{}
+	failures := 0
+	for _, result := range results {
+		if result.Ready() || result.Outcome == outcomeSkipped || result.Outcome == outcomeCanceled {
+			continue
+		}
+		failures++
+		key, store := storeUnknown, "an unknown store"
+		if ref := result.Store; ref != nil {
+			key, store = storeGroup(result), ref.String()
+			if ref.Kind == secretStoreKind {
+				key += "/" + result.Namespace
+				store += " in namespace " + result.Namespace
+			}
+		}
+		g := index[key]
+		if g == nil {
+			g = &group{store: store}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		g.count++
+		if g.ready == nil {
+			g.ready = result.StoreReady
+		}
+	}
+	if failures < 2 {
+		return
+	}
+	unknown := index[storeUnknown]
+	sort.SliceStable(groups, func(i, j int) bool {
+		if (groups[i] == unknown) != (groups[j] == unknown) {
+			return groups[j] == unknown
+		}
+		return groups[i].count > groups[j].count
+	})
+	for _, g := range groups {
+		line := fmt.Sprintf("%d of %d failures reference %s", g.count, failures, g.store)
+		if g.ready != nil {
+			line += fmt.Sprintf(" (store Ready=%s, %s)", g.ready.Status, g.ready.Reason)
+		}
+		console.infof("%s", line)
+	}
+}
+
+// waitedLine sums up how long the results waited: the longest wait and the
+// average.
+func waitedLine(results []*checkResult) string {
+	var longest, total time.Duration
+	for _, result := range results {
+		total += result.Waited
+		if result.Waited > longest {
+			longest = result.Waited
+		}
+	}
+	return fmt.Sprintf("waited %s at most, %s on average", formatDuration(longest), formatDuration(total/time.Duration(len(results))))
+}
+
+// readyLine counts the Ready results and names those that are and are not,
+// with their namespace when withNamespace is set.
+func readyLine(results []*checkResult, withNamespace bool) string {
+	var ready, notReady []string
+	for _, result := range results {
+		label := resourceLabel(result.Namespace, result.Name, withNamespace)
+		if result.Ready() {
+			ready = append(ready, label)
+		} else {
+			notReady = append(notReady, fmt.Sprintf("%s (%s)", label, result.Outcome))
+		}
+	}
+	line := fmt.Sprintf("%d of %d", len(ready), len(results))
+	if len(ready) > 0 {
+		line += fmt.Sprintf(" [%s]", strings.Join(ready, ", "))
+	}
+	if len(notReady) > 0 {
+		line += fmt.Sprintf("; not ready: %s", strings.Join(notReady, ", "))
+	}
+	return line
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// templateError is a Go template failure from spec.target.template, as
+// reported in a condition message. Waiting never fixes one.
+type templateError struct {
+	Template string `json:"template,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+// templateErrorPattern matches the location text/template puts in front of
+// its errors, as in `template: name:12:5: executing "name" at <.x>: ...`.
+var templateErrorPattern = regexp.MustCompile(`template: ([^:\s]+):(\d+)(?::(\d+))?: ((?s).*)`)
+
+// templateErrorSignatures are phrases ESO uses around template failures
+// whose message does not carry a location.
+var templateErrorSignatures = []string{
+	"unable to execute template",
+	"error parsing template",
+	"could not apply template",
+}
+
+// parseTemplateError extracts a template error from a condition message.
+func parseTemplateError(message string) (*templateError, bool) {
+	if m := templateErrorPattern.FindStringSubmatch(message); m != nil {
+		te := &templateError{Template: m[1], Detail: strings.TrimSpace(m[4])}
+		te.Line, _ = strconv.Atoi(m[2])
+		te.Column, _ = strconv.Atoi(m[3])
+		return te, true
+	}
+	lower := strings.ToLower(message)
+	for _, signature := range templateErrorSignatures {
+		if strings.Contains(lower, signature) {
+			return &templateError{Detail: strings.TrimSpace(message)}, true
+		}
+	}
+	return nil, false
+}
+
+// findTemplateError returns the template error reported by a condition that
+// is not True, if any, together with that condition.
+func findTemplateError(conditions []Condition) (*templateError, Condition, bool) {
+	for _, condition := range conditions {
+		if condition.Status == "True" {
+			continue
+		}
+		if te, ok := parseTemplateError(condition.Message); ok {
+			return te, condition, true
+		}
+	}
+	return nil, Condition{}, false
+}
+
+// String returns the location of the error, such as "name:12:5".
+func (te *templateError) String() string {
+	switch {
+	case te.Template == "":
+		return "unknown location"
+	case te.Column > 0:
+		return fmt.Sprintf("%s:%d:%d", te.Template, te.Line, te.Column)
+	default:
+		return fmt.Sprintf("%s:%d", te.Template, te.Line)
+	}
+}
+
+// printTemplateError prints the template error as a readable block, keeping
+// every line of multi-line messages.
+func printTemplateError(te *templateError) {
+	console.infof("Template error:")
+	console.infof("  location: %s", te)
+	for _, line := range strings.Split(te.Detail, "\n") {
+		console.infof("  | %s", line)
+	}
+}
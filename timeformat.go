@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Display formats of timestamps, selected by -time-format.
+const (
+	timeRelative = "relative"
+	timeRFC3339  = "rfc3339"
+	timeUnix     = "unix"
+)
+
+// Display formats of durations, selected by -duration-format.
+const (
+	durationCompact = "compact"
+	durationSeconds = "seconds"
+)
+
+// displayFormat selects how times and durations are shown in console
+// output. Structured outputs such as the CSV reports always use RFC3339 and
+// seconds regardless.
+type displayFormat struct {
+	time     string
+	duration string
+}
+
+// display is the format of all console output, set once from the flags.
+var display = displayFormat{time: timeRFC3339, duration: durationCompact}
+
+func validTimeFormat(format string) bool {
+	return format == timeRelative || format == timeRFC3339 || format == timeUnix
+}
+
+func validDurationFormat(format string) bool {
+	return format == durationCompact || format == durationSeconds
+}
+
+// formatDuration formats d for display, rounded to the second.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if display.duration == durationSeconds {
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+	return d.String()
+}
+
+// formatTime formats t for display. Relative times are relative to now.
+func formatTime(t, now time.Time) string {
+	switch display.time {
+	case timeRelative:
+		if t.After(now) {
+			return "in " + formatDuration(t.Sub(now))
+		}
+		return formatDuration(now.Sub(t)) + " ago"
+	case timeUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	default:
+		return t.UTC().Format(time.RFC3339)
+	}
+}
+
+// formatPeriod formats the time since t for display: the duration when
+// times are relative, the start of the period otherwise.
+func formatPeriod(t, now time.Time) string {
+	if display.time == timeRelative {
+		return "for " + formatDuration(now.Sub(t))
+	}
+	return fmt.Sprintf("since %s", formatTime(t, now))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// useDisplay sets the display format until the test ends.
+func useDisplay(t *testing.T, timeFormat, durationFormat string) {
+	previous := display
+	display = displayFormat{time: timeFormat, duration: durationFormat}
+	t.Cleanup(func() { display = previous })
+}
+
+func TestDisplayFormats(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 2, 14, 0, time.UTC)
+	past := now.Add(-134 * time.Second)
+	for _, test := range []struct {
+		timeFormat, durationFormat     string
+		duration, time, future, period string
+	}{
+		{timeRFC3339, durationCompact, "2m14s", "2024-05-01T10:00:00Z", "2024-05-01T10:04:28Z", "since 2024-05-01T10:00:00Z"},
+		{timeRelative, durationCompact, "2m14s", "2m14s ago", "in 2m14s", "for 2m14s"},
+		{timeUnix, durationSeconds, "134s", "1714557600", "1714557868", "since 1714557600"},
+		{timeRelative, durationSeconds, "134s", "134s ago", "in 134s", "for 134s"},
+	} {
+		useDisplay(t, test.timeFormat, test.durationFormat)
+		got := []string{
+			formatDuration(134*time.Second + 400*time.Millisecond),
+			formatTime(past, now),
+			formatTime(now.Add(134*time.Second), now),
+			formatPeriod(past, now),
+		}
+		want := []string{test.duration, test.time, test.future, test.period}
+		if strings.Join(got, " | ") != strings.Join(want, " | ") {
+			t.Errorf("%s/%s: got %q, want %q", test.timeFormat, test.durationFormat, got, want)
+		}
+	}
+}
+
+// TestStructuredOutputsIgnoreDisplay checks that the CSV reports keep
+// canonical seconds and RFC3339 timestamps whatever the display format.
+func TestStructuredOutputsIgnoreDisplay(t *testing.T) {
+	useDisplay(t, timeRelative, durationSeconds)
+	result := &checkResult{
+		Namespace: "apps",
+		Name:      "db",
+		Outcome:   outcomeReady,
+		Waited:    134*time.Second + 500*time.Millisecond,
+		Transitions: []conditionTransition{{
+			ObservedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			Type:       "Ready",
+			ToStatus:   "True",
+		}},
+	}
+	var report, transitions strings.Builder
+	if err := writeCSVReport(&report, []*checkResult{result}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCSVTransitions(&transitions, []*checkResult{result}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), ",134.500,") {
+		t.Errorf("the report lacks the wait in seconds:\n%s", report.String())
+	}
+	if !strings.Contains(transitions.String(), ",2024-05-01T10:00:00Z,") {
+		t.Errorf("the transitions lack the RFC3339 time:\n%s", transitions.String())
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// conditionTransition is a single observed change of a status condition.
+type conditionTransition struct {
+	ObservedAt time.Time `json:"observedAt"`
+	Type       string    `json:"type"`
+	FromStatus string    `json:"fromStatus"`
+	ToStatus   string    `json:"toStatus"`
+	Reason     string    `json:"reason"`
+	Message    string    `json:"message"`
+}
+
+// diffConditions returns the transitions between two consecutive
+// observations of the status conditions. A condition counts as changed when
+// its status, reason, message or lastTransitionTime differs; conditions that
+// disappear are reported with an empty target status.
+func diffConditions(previous, current []Condition, observedAt time.Time) []conditionTransition {
+	before := make(map[string]Condition, len(previous))
+	for _, condition := range previous {
+		before[condition.Type] = condition
+	}
+
+	var transitions []conditionTransition
+	for _, condition := range current {
+		old, existed := before[condition.Type]
+		delete(before, condition.Type)
+		if existed && old == condition {
+			continue
+		}
+		transitions = append(transitions, conditionTransition{
+			ObservedAt: observedAt,
+			Type:       condition.Type,
+			FromStatus: old.Status,
+			ToStatus:   condition.Status,
+			Reason:     condition.Reason,
+			Message:    condition.Message,
+		})
+	}
+	for _, condition := range previous {
+		if _, removed := before[condition.Type]; !removed {
+			continue
+		}
+		transitions = append(transitions, conditionTransition{
+			ObservedAt: observedAt,
+			Type:       condition.Type,
+			FromStatus: condition.Status,
+		})
+	}
+	return transitions
+}
+
+// transitionLine describes a transition with the state before and after it,
+// and how long the state before lasted: since its lastTransitionTime, or at
+// least since start, the start of the wait, when it has none.
+func transitionLine(previous []Condition, t conditionTransition, start time.Time) string {
+	var old *Condition
+	for i := range previous {
+		if previous[i].Type == t.Type {
+			old = &previous[i]
+			break
+		}
+	}
+	after := "(removed)"
+	if t.ToStatus != "" {
+		after = conditionState(t.ToStatus, t.Reason)
+		if old == nil || old.Message != t.Message {
+			after += ": " + t.Message
+		}
+	}
+	if old == nil {
+		return fmt.Sprintf("Condition %s appeared: %s", t.Type, after)
+	}
+	lasted := "at least " + formatDuration(t.ObservedAt.Sub(start))
+	if since := old.TransitionTime(); !since.IsZero() {
+		lasted = formatDuration(t.ObservedAt.Sub(since))
+	}
+	return fmt.Sprintf("Condition %s: %s -> %s (previous state lasted %s)", t.Type, conditionState(old.Status, old.Reason), after, lasted)
+}
+
+func conditionState(status, reason string) string {
+	if reason == "" {
+		return status
+	}
+	return status + " (" + reason + ")"
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffConditions(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ready := Condition{Type: "Ready", Status: "False", Reason: "SecretSyncedError", Message: "provider unavailable", LastTransitionTime: "2024-05-01T09:00:00Z"}
+	deleted := Condition{Type: "Deleted", Status: "False"}
+	with := func(change func(c *Condition)) Condition {
+		c := ready
+		change(&c)
+		return c
+	}
+	for _, test := range []struct {
+		name              string
+		previous, current []Condition
+		want              string
+	}{
+		{"no change", []Condition{ready, deleted}, []Condition{deleted, ready}, ""},
+		{"first observation", nil, []Condition{ready}, "Ready:->False"},
+		{"added", []Condition{ready}, []Condition{ready, deleted}, "Deleted:->False"},
+		{"removed", []Condition{ready, deleted}, []Condition{ready}, "Deleted:False->"},
+		{"status", []Condition{ready}, []Condition{with(func(c *Condition) { c.Status = "True" })}, "Ready:False->True"},
+		{"reason", []Condition{ready}, []Condition{with(func(c *Condition) { c.Reason = "SecretSynced" })}, "Ready:False->False"},
+		{"message", []Condition{ready}, []Condition{with(func(c *Condition) { c.Message = "provider timed out" })}, "Ready:False->False"},
+		{"lastTransitionTime", []Condition{ready}, []Condition{with(func(c *Condition) { c.LastTransitionTime = "2024-05-01T09:30:00Z" })}, "Ready:False->False"},
+		{"all gone", []Condition{ready, deleted}, nil, "Ready:False-> Deleted:False->"},
+	} {
+		var got []string
+		for _, transition := range diffConditions(test.previous, test.current, now) {
+			if !transition.ObservedAt.Equal(now) {
+				t.Errorf("%s: observed at %s", test.name, transition.ObservedAt)
+			}
+			got = append(got, transition.Type+":"+transition.FromStatus+"->"+transition.ToStatus)
+		}
+		if strings.Join(got, " ") != test.want {
+			t.Errorf("%s: transitions %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTransitionLine(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	observedAt := start.Add(5 * time.Minute)
+	previous := []Condition{
+		{Type: "Ready", Status: "False", Reason: "SecretSyncedError", Message: "provider unavailable", LastTransitionTime: "2024-05-01T09:58:00Z"},
+		{Type: "Deleted", Status: "False"},
+	}
+	for _, test := range []struct {
+		transition conditionTransition
+		want       string
+	}{
+		{conditionTransition{Type: "Ready", ToStatus: "True", Reason: "SecretSynced", Message: "Secret was synced"},
+			"Condition Ready: False (SecretSyncedError) -> True (SecretSynced): Secret was synced (previous state lasted 7m0s)"},
+		{conditionTransition{Type: "Ready", ToStatus: "False", Reason: "SecretSyncedError", Message: "provider unavailable"},
+			"Condition Ready: False (SecretSyncedError) -> False (SecretSyncedError) (previous state lasted 7m0s)"},
+		{conditionTransition{Type: "Deleted", FromStatus: "False"},
+			"Condition Deleted: False -> (removed) (previous state lasted at least 5m0s)"},
+		{conditionTransition{Type: "Synced", ToStatus: "True", Message: "synced"},
+			"Condition Synced appeared: True: synced"},
+	} {
+		test.transition.ObservedAt = observedAt
+		if got := transitionLine(previous, test.transition, start); got != test.want {
+			t.Errorf("transitionLine = %q\nwant             %q", got, test.want)
+		}
+	}
+}
+
+// TestProgressOnChangesAndHeartbeat follows a resource whose conditions
+// never change: after the first observation, the progress is only printed on
+// the heartbeat.
+func TestProgressOnChangesAndHeartbeat(t *testing.T) {
+	out := captureConsole(t)
+	c := newTestCluster(newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", readyCondition("False", "SecretSyncedError")))
+	results, _ := c.check(t, 1500*time.Millisecond, "-namespace=apps", "-name=db", "-interval=20ms", "-watch-mode=poll", "-heartbeat-interval=500ms")
+	if results[0].Checks < 20 {
+		t.Fatalf("%d checks, want many more than progress lines", results[0].Checks)
+	}
+	// The first observation and at most one line per heartbeat
+	if lines := strings.Count(out.String(), "Current status conditions"); lines < 2 || lines > 4 {
+		t.Errorf("%d progress lines over %d checks, want the first one and one per heartbeat:\n%s", lines, results[0].Checks, out)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const hintUnreconciled = "Unreconciled"
+
+// unreconciledFor returns how long an ExternalSecret without any status
+// condition has gone unreconciled: since its creation, but at most since
+// the wait started. It returns 0 once the resource has conditions.
+func unreconciledFor(unstructuredES *unstructured.Unstructured, conditions []Condition, start, now time.Time) time.Duration {
+	if len(conditions) > 0 {
+		return 0
+	}
+	since := unstructuredES.GetCreationTimestamp().Time
+	if since.Before(start) {
+		since = start
+	}
+	return now.Sub(since)
+}
+
+// unreconciledHint tells a resource the controller never touched apart from
+// one whose sync is failing.
+func unreconciledHint(unstructuredES *unstructured.Unstructured, age time.Duration) hint {
+	storeKind, _, _ := unstructured.NestedString(unstructuredES.Object, "spec", "secretStoreRef", "kind")
+	storeName, _, _ := unstructured.NestedString(unstructuredES.Object, "spec", "secretStoreRef", "name")
+	if storeKind == "" {
+		storeKind = "SecretStore"
+	}
+	return hint{
+		Code: hintUnreconciled,
+		Message: fmt.Sprintf("no status conditions after %s: the controller has not reconciled this resource; check the controller class of %s %s and whether the operator watches namespace %s",
+			formatDuration(age), storeKind, storeName, unstructuredES.GetNamespace()),
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is the release of the binary, set at build time with
+// -ldflags "-X main.version=v1.2.3". Builds without it fall back to the
+// module version recorded by the Go toolchain.
+var version = "dev"
+
+// exitOutdated is the exit code of a run whose binary is older than
+// -min-version, and of check-update when a newer release exists.
+const exitOutdated = 8
+
+// maxUpdateMetadata bounds the metadata document check-update reads.
+const maxUpdateMetadata = 1 << 20
+
+const checkUpdateUsage = "Usage: ./external-secret-watcher check-update -url=https://<metadata> [-timeout=10s]"
+
+// currentVersion returns the version of the binary.
+func currentVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
+// parseVersion parses v1.2.3 or 1.2, ignoring pre-release and build
+// suffixes.
+func parseVersion(v string) ([3]int, error) {
+	var parsed [3]int
+	core, _, _ := strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	core, _, _ = strings.Cut(core, "+")
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return parsed, fmt.Errorf("version %q is not of the form v1.2.3", v)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed, fmt.Errorf("version %q is not of the form v1.2.3", v)
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+// olderThan reports whether version a is older than b.
+func olderThan(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// checkMinVersion fails when the binary is older than minimum, or when its
+// version is unknown and cannot be compared.
+func checkMinVersion(minimum string) error {
+	required, err := parseVersion(minimum)
+	if err != nil {
+		return fmt.Errorf("-min-version: %w", err)
+	}
+	current, err := parseVersion(currentVersion())
+	if err != nil {
+		return fmt.Errorf("-min-version=%s: this build has no comparable version (%s)", minimum, currentVersion())
+	}
+	if olderThan(current, required) {
+		return fmt.Errorf("-min-version=%s: this binary is %s", minimum, currentVersion())
+	}
+	return nil
+}
+
+// updateMetadata is the document served at the check-update URL. GitHub
+// release documents work as well, through tag_name.
+type updateMetadata struct {
+	Version string `json:"version"`
+	TagName string `json:"tag_name"`
+	URL     string `json:"url"`
+	HTMLURL string `json:"html_url"`
+}
+
+// runCheckUpdate implements the check-update subcommand. It only contacts
+// the URL it is given; nothing is downloaded. It exits 0 when the binary is
+// current, exitOutdated when a newer release exists and 1 on errors.
+func runCheckUpdate(args []string) int {
+	fs := flag.NewFlagSet("check-update", flag.ContinueOnError)
+	metadataURL := fs.String("url", "", "HTTPS URL of the release metadata, a JSON document with version and url fields")
+	timeout := fs.Duration("timeout", 10*time.Second, "Upper bound of the request")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if *metadataURL == "" || *timeout <= 0 {
+		fmt.Println(checkUpdateUsage)
+		return 1
+	}
+
+	latest, err := fetchUpdateMetadata(*metadataURL, *timeout)
+	if err != nil {
+		fmt.Printf("Error: check-update: %v\n", err)
+		return 1
+	}
+	release := latest.Version
+	if release == "" {
+		release = latest.TagName
+	}
+	link := latest.URL
+	if link == "" {
+		link = latest.HTMLURL
+	}
+	newest, err := parseVersion(release)
+	if err != nil {
+		fmt.Printf("Error: check-update: metadata: %v\n", err)
+		return 1
+	}
+	current, err := parseVersion(currentVersion())
+	if err != nil {
+		fmt.Printf("Latest release is %s; this build (%s) has no comparable version\n", release, currentVersion())
+		return 1
+	}
+	if !olderThan(current, newest) {
+		fmt.Printf("Up to date: %s (latest release %s)\n", currentVersion(), release)
+		return 0
+	}
+	fmt.Printf("Newer release available: %s (this binary is %s)\n", release, currentVersion())
+	if link != "" {
+		fmt.Printf("  %s\n", link)
+	}
+	return exitOutdated
+}
+
+// fetchUpdateMetadata reads the metadata document, refusing anything but
+// HTTPS.
+func fetchUpdateMetadata(rawURL string, timeout time.Duration) (*updateMetadata, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return nil, errors.New("-url must be an https URL")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "external-secret-watcher/"+currentVersion())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u.Redacted(), resp.Status)
+	}
+	var metadata updateMetadata
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxUpdateMetadata)).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", u.Redacted(), err)
+	}
+	if metadata.Version == "" && metadata.TagName == "" {
+		return nil, fmt.Errorf("%s has no version", u.Redacted())
+	}
+	return &metadata, nil
+}
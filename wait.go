@@ -0,0 +1,670 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	escheck "external-secret-watcher/pkg/checker"
+)
+
+// externalSecretGVR is the GroupVersionResource of the ExternalSecret CRD.
+var externalSecretGVR = escheck.ExternalSecretGVR
+
+// checker waits for a single ExternalSecret to become Ready.
+type checker struct {
+	dynamicClient dynamic.Interface
+	clientset     kubernetes.Interface
+	discovery     *memoDiscovery
+	kind          resourceKind
+	// pinnedVersion is set when -api-version fixes the version of gvr.
+	pinnedVersion bool
+	// requirements replace the readiness rule of the kind when set.
+	requirements []conditionRequirement
+	// consecutiveReady is how many Ready observations in a row end the
+	// wait.
+	consecutiveReady int
+	// requireExists fails the wait once the resource was not found
+	// requireExistsPolls times in a row.
+	requireExists bool
+	// gvr is the ExternalSecret resource being read. It may change mid-run
+	// when the served API version changes.
+	gvr     schema.GroupVersionResource
+	timeout time.Duration
+	// pollInterval is how often the ExternalSecret is fetched, or its last
+	// watched state re-evaluated.
+	pollInterval time.Duration
+	// perCallTimeout bounds every single request so that one hung call
+	// cannot eat the whole deadline.
+	perCallTimeout time.Duration
+	// apiCalls, when set, provides the server's Retry-After advice, and
+	// tells whether the waits of the cluster fell back to polling.
+	apiCalls *apiCallLog
+	// watchMode is -watch-mode: how the wait follows the resource.
+	watchMode string
+	// uid, when set, is the only object the wait accepts under the name.
+	uid string
+	// rebindOnUIDChange follows a recreated object instead of failing.
+	rebindOnUIDChange bool
+	// skipAnnotation, when set, makes resources annotated with it set to
+	// "true" be skipped instead of checked.
+	skipAnnotation string
+	// watchTargetSecret also watches the target Secret so that slow
+	// readiness can be attributed to the controller or the status update.
+	watchTargetSecret bool
+	// failOn lists condition states that abort the wait.
+	failOn []conditionMatch
+	// fatalRules classify Ready=False reasons that abort the wait.
+	fatalRules []fatalRule
+	// unreconciledAfter is how long a resource may go without any status
+	// condition before it is diagnosed as never reconciled.
+	unreconciledAfter time.Duration
+	// noProgressAfter is how long a resource may go without conditions and
+	// events before the controller is suspected not to run, and
+	// checkController looks for its pods then.
+	noProgressAfter time.Duration
+	checkController bool
+	// maxConditionAge is -max-condition-age, and failOnOldCondition fails
+	// a frozen Ready state rather than waiting for a fresh sync.
+	maxConditionAge    time.Duration
+	failOnOldCondition bool
+	// includeTargetSecret also waits for the target Secret to be gone
+	// under -wait-for=deleted.
+	includeTargetSecret bool
+	// heartbeat is how often the progress is printed while the conditions
+	// do not change.
+	heartbeat time.Duration
+	// failOnTemplate aborts the wait on template errors, which waiting
+	// never fixes.
+	failOnTemplate bool
+	// log writes the output of the wait, attributed to the resource.
+	log *logger
+	// progress renders the progress line.
+	progress *template.Template
+	// prefix starts the progress line, naming the resource when several are
+	// checked at once.
+	prefix string
+	// events counts the events seen by the event watch.
+	events *eventStats
+	// eventHistory is how many recent Warning events a failed wait prints.
+	eventHistory int
+	// startup measures the startup until the first successful Get.
+	startup *startupTimer
+	// checkStore verifies the store of the ExternalSecret on the first
+	// evaluation.
+	checkStore bool
+	// revalidation, with -revalidate-store, has the store patched for
+	// revalidation before it is checked.
+	revalidation *storeRevalidation
+	// observers receive live progress.
+	observers *observerHub
+	// captures, when set, records the object at every condition transition.
+	captures *captureBuffer
+	// clockSkewTolerance is allowed for between cluster timestamps and the
+	// clock when judging freshness.
+	clockSkewTolerance time.Duration
+	// verifyFreshness rejects Ready states that look stale, such as those
+	// left behind by a controller that stopped running.
+	verifyFreshness bool
+	// minRefreshTime and waitForGeneration require the Ready state to come
+	// from a refresh after the instant, and for the current spec.
+	minRefreshTime    time.Time
+	waitForGeneration bool
+	// waitOnDenied keeps waiting when the checker is denied access, for
+	// runs that start before their RBAC is applied.
+	waitOnDenied bool
+	// recorder, when set, records the states judged for replay.
+	recorder *recorder
+}
+
+// Values of -on-uid-change.
+const (
+	uidChangeFail   = "fail"
+	uidChangeRebind = "rebind"
+)
+
+// defaultPollInterval is how often the ExternalSecret is fetched unless
+// -interval says otherwise.
+const defaultPollInterval = time.Second
+
+// namespaceCheckFailures is how many Gets in a row must fail before the
+// namespace phase is checked, to tell a namespace being deleted from other
+// failures.
+const namespaceCheckFailures = 3
+
+// resolveInterval limits how often discovery is queried while the resource
+// type is unavailable.
+const resolveInterval = 10 * time.Second
+
+// reresolveVersion switches to the currently served API version of the
+// ExternalSecret resource if it differs from the one in use, after a request
+// started at failedAt found it unavailable. The wait itself carries on with
+// the same deadline.
+func (c *checker) reresolveVersion(failedAt time.Time) {
+	if c.discovery == nil || c.pinnedVersion {
+		return
+	}
+	c.discovery.refresh(failedAt)
+	version, err := servedVersion(c.discovery, c.gvr)
+	if err != nil {
+		c.log.errorf("Error re-resolving ExternalSecret API version: %v", err)
+		return
+	}
+	if version == c.gvr.Version {
+		return
+	}
+	c.log.infof("*** ExternalSecret API version changed from %s to %s, switching and continuing the wait ***", c.gvr.Version, version)
+	c.gvr.Version = version
+}
+
+// waitState is what the wait loop carries from one poll to the next.
+type waitState struct {
+	start       time.Time
+	firstPoll   bool
+	working     bool
+	lastResolve time.Time
+	// failures counts the Gets that failed in a row, and lastNamespaceCheck
+	// is when they last led to a check of the namespace phase. notFound
+	// counts those that found no resource, and retryAt is when polling
+	// resumes after transient errors.
+	failures           int
+	notFound           int
+	retryAt            time.Time
+	lastNamespaceCheck time.Time
+	lag                *lagTracker
+	previous           []Condition
+	// unreconciled is set once the resource was diagnosed as never
+	// reconciled.
+	unreconciled *hint
+	// noProgress is set once the controller was suspected not to run.
+	noProgress *hint
+	// remoteRefs is the last per-entry status printed for a sync error.
+	remoteRefs string
+	// frozen is the last reason the Ready state looked frozen in time.
+	frozen string
+	// uid is that of the object the wait follows, and terminating its
+	// deletionTimestamp once it is being deleted.
+	uid         string
+	terminating *metav1.Time
+	// lastReport is when the progress was last printed: on changes of the
+	// conditions, and every heartbeat while nothing changes.
+	lastReport time.Time
+	// lastTriggered is when a sync event last made the wait poll out of
+	// band, at most once per eventTriggerInterval.
+	lastTriggered time.Time
+	// readyStreak counts the Ready observations in a row, the last one
+	// counted at lastReadyAt.
+	readyStreak int
+	lastReadyAt time.Time
+	// hopeless is the failure class the Gets keep hitting, if any.
+	hopeless hopelessCache
+}
+
+func (c *checker) checkStatusWithTimeout(ctx context.Context, namespace, name string, result *checkResult) error {
+	// The wait leaves part of the deadline of rootCtx to the phases after it
+	rootCtx := ctx
+	ctx, cancel := c.waitContext(rootCtx)
+	defer cancel()
+
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	c.observers.phase(phaseWaiting)
+	state := &waitState{start: time.Now(), firstPoll: true}
+	// The initial poll stands for a trigger, so that the events listed at
+	// the start do not repeat it
+	state.lastTriggered = state.start
+	defer func() { result.Waited = time.Since(state.start) }()
+
+	// Changes are followed through a watch, which reacts as soon as the
+	// resource changes; the ticker only re-evaluates the last seen state
+	// for time-based checks, or polls when the watch is unavailable
+	rw := &resourceWatch{checker: c, namespace: namespace, name: name}
+	defer rw.stop()
+
+	// Poll right away so an already Ready resource passes without delay, then
+	// offset the ticker so that checkers started together spread out. The
+	// watch and sync events are followed during the offset already
+	jitter := time.NewTimer(pollJitter(c.pollInterval))
+	defer jitter.Stop()
+	if done, err := c.poll(ctx, state, namespace, name, result); done {
+		return err
+	}
+	if result.object != nil {
+		rw.resourceVersion = result.object.GetResourceVersion()
+	}
+	for {
+		if err := rw.ensure(ctx); err != nil {
+			result.failed(err)
+			return err
+		}
+		c.honorRetryAfter(ctx)
+
+		var done bool
+		var err error
+		select {
+		case event, ok := <-rw.events():
+			var object *unstructured.Unstructured
+			if object, ok = rw.handle(event, ok); ok {
+				state.working = true
+				state.hopeless.clear(c)
+				result.lastErr = nil
+				done, err = c.evaluate(ctx, state, namespace, name, object, result)
+			}
+		case <-c.events.syncs():
+			// The event of a sync usually comes before the next tick, and
+			// may come before the watch event; bounded so that an event
+			// storm cannot flood the API server
+			if time.Since(state.lastTriggered) >= eventTriggerInterval && !time.Now().Before(state.retryAt) {
+				state.lastTriggered = time.Now()
+				c.log.debugf("Sync event received, checking ExternalSecret %s now", name)
+				done, err = c.poll(ctx, state, namespace, name, result)
+			}
+		case <-jitter.C:
+			ticker.Reset(c.pollInterval)
+		case <-ticker.C:
+			switch {
+			case rw.current() && result.object != nil:
+				done, err = c.evaluate(ctx, state, namespace, name, result.object, result)
+			case time.Now().Before(state.retryAt):
+				// Backing off after transient errors
+			default:
+				done, err = c.poll(ctx, state, namespace, name, result)
+			}
+		case <-ctx.Done():
+			if errors.Is(rootCtx.Err(), context.Canceled) {
+				// A signal arrived, or another resource of the run failed
+				// for good
+				result.Outcome = outcomeCanceled
+				result.lastErr = rootCtx.Err()
+				if sigErr, ok := interruptedBy(rootCtx); ok {
+					return fmt.Errorf("ExternalSecret %s: wait interrupted, %v", name, sigErr)
+				}
+				return fmt.Errorf("ExternalSecret %s: wait canceled", name)
+			}
+			result.Outcome = outcomeTimeout
+			if state.unreconciled != nil && len(result.Conditions) == 0 {
+				result.Outcome = outcomeUnreconciled
+				result.Hints = append(result.Hints, *state.unreconciled)
+			}
+			if state.noProgress != nil && len(result.Conditions) == 0 {
+				result.Hints = append(result.Hints, *state.noProgress)
+			}
+			if state.terminating != nil {
+				result.Hints = append(result.Hints, beingDeletedHint(state.terminating))
+			}
+			if state.lag != nil {
+				result.LagAttribution = state.lag.describe(time.Now())
+				result.Hints = append(result.Hints, state.lag.hints(time.Now())...)
+			}
+			result.Hints = append(result.Hints, c.targetHints(rootCtx, result)...)
+			c.printFailureEvents(rootCtx, result)
+			if result.TemplateError != nil {
+				printTemplateError(result.TemplateError)
+			}
+			printHints(result)
+			if result.object == nil && state.notFound > 0 {
+				return fmt.Errorf("%w: ExternalSecret %s %w after %s", errTimeout, name, errNotFound, formatDuration(c.timeout))
+			}
+			return fmt.Errorf("%w: ExternalSecret %s did not become Ready within %s", errTimeout, name, c.waitWithin(ctx, state.start))
+		}
+		if done {
+			return err
+		}
+	}
+}
+
+// eventTriggerInterval bounds the out-of-band polls triggered by sync
+// events.
+const eventTriggerInterval = time.Second
+
+// honorRetryAfter delays the next poll while the API server has asked us to
+// back off through Retry-After, bounded by the deadline.
+func (c *checker) honorRetryAfter(ctx context.Context) {
+	if c.apiCalls == nil {
+		return
+	}
+	notBefore := c.apiCalls.RetryNotBefore()
+	if notBefore.IsZero() {
+		return
+	}
+	delay := time.Until(notBefore) - c.pollInterval
+	if delay <= 0 {
+		return
+	}
+	c.log.infof("API server asked to retry later, delaying the next poll by %s", formatDuration(delay))
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
+	}
+}
+
+// retryHopeless schedules the next poll after a failure that repeats until
+// someone intervenes, logging it in full only when it starts.
+func (c *checker) retryHopeless(state *waitState, class string, err error) {
+	delay, logFull := state.hopeless.fail(c, class, err)
+	state.retryAt = time.Now().Add(delay)
+	if logFull {
+		c.log.errorf("Error getting ExternalSecret: %v (%s, retrying with backoff and reporting every %s)", err, class, formatDuration(hopelessLogInterval))
+	}
+}
+
+// backOff schedules the next poll after a transient error and returns the
+// delay.
+func (s *waitState) backOff(interval time.Duration) time.Duration {
+	delay := retryBackoff(interval, s.failures)
+	s.retryAt = time.Now().Add(delay)
+	return delay
+}
+
+// poll fetches and evaluates the ExternalSecret once. It returns true when
+// the wait is over, with the error to return from the wait if any.
+func (c *checker) poll(ctx context.Context, state *waitState, namespace, name string, result *checkResult) (bool, error) {
+	// Get the ExternalSecret resource
+	start := time.Now()
+	callCtx, cancelCall := context.WithTimeout(ctx, c.perCallTimeout)
+	unstructuredES, err := c.dynamicClient.Resource(c.gvr).Namespace(namespace).Get(callCtx, name, metav1.GetOptions{})
+	callExpired := callCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+	cancelCall()
+	result.lastErr = err
+	if err != nil && callExpired {
+		result.Checks++
+		result.CallTimeouts++
+		state.failures++
+		delay := state.backOff(c.pollInterval)
+		c.log.errorf("Error getting ExternalSecret: request timed out after %v (transient, retrying in %s)", c.perCallTimeout, formatDuration(delay))
+		return false, nil
+	}
+	if err != nil {
+		result.Checks++
+		state.failures++
+		switch {
+		case isDenied(err) && c.waitOnDenied:
+			c.retryHopeless(state, hopelessDenied, err)
+		case isResourceUnavailable(err):
+			c.retryHopeless(state, hopelessUnavailable, err)
+		case isDenied(err):
+			c.log.errorf("Error getting ExternalSecret: %v", err)
+			result.Outcome = outcomeError
+			result.Reason = err.Error()
+			result.lastErr = err
+			result.Hints = append(result.Hints, hint{
+				Code:    hintRBACDenied,
+				Message: fmt.Sprintf("the checker may not get %s in namespace %s; the rbac subcommand prints the Role it needs", c.gvr.Resource, namespace),
+			})
+			printHints(result)
+			return true, fmt.Errorf("not allowed to read ExternalSecret %s: %w", name, err)
+		case apierrors.IsNotFound(err) && !isResourceUnavailable(err):
+			state.notFound++
+			if c.requireExists && state.notFound >= requireExistsPolls {
+				result.Outcome = outcomeError
+				result.Reason = "not found"
+				return true, fmt.Errorf("ExternalSecret %s %w (%d NotFound responses in a row, -require-exists)", name, errNotFound, state.notFound)
+			}
+			c.log.infof("ExternalSecret %s not found (%d in a row), waiting for it to be created", name, state.notFound)
+		case isTransient(err):
+			delay := state.backOff(c.pollInterval)
+			c.log.errorf("Error getting ExternalSecret: %v (transient, retrying in %s)", err, formatDuration(delay))
+		default:
+			c.log.errorf("Error getting ExternalSecret: %v", err)
+		}
+		if state.failures >= namespaceCheckFailures && c.clientset != nil && namespace != "" && time.Since(state.lastNamespaceCheck) > resolveInterval {
+			state.lastNamespaceCheck = time.Now()
+			if nsErr := namespaceTerminating(ctx, c.clientset, namespace, c.perCallTimeout); nsErr != nil {
+				result.Outcome = outcomeNamespaceTerminating
+				result.lastErr = nsErr
+				return true, nsErr
+			}
+		}
+		if state.working && isResourceUnavailable(err) && time.Since(state.lastResolve) > resolveInterval {
+			state.lastResolve = time.Now()
+			c.reresolveVersion(start)
+		}
+		return false, nil
+	}
+
+	c.startup.firstGet()
+	state.working = true
+	state.failures = 0
+	state.notFound = 0
+	state.retryAt = time.Time{}
+	state.hopeless.clear(c)
+	return c.evaluate(ctx, state, namespace, name, unstructuredES, result)
+}
+
+// evaluate judges a fetched or watched state of the ExternalSecret. It
+// returns true when the wait is over, with the error to return from the wait
+// if any.
+func (c *checker) evaluate(ctx context.Context, state *waitState, namespace, name string, unstructuredES *unstructured.Unstructured, result *checkResult) (bool, error) {
+	result.Checks++
+	if err := c.followObject(state, name, unstructuredES, result); err != nil {
+		return true, err
+	}
+	conditions, duplicates := parseConditions(unstructuredES)
+	if len(duplicates) > 0 && len(result.DuplicateConditions) == 0 {
+		c.log.warnf("Warning: ExternalSecret %s has duplicate conditions of type %s, using the newest of each", name, strings.Join(duplicates, ", "))
+	}
+	if len(duplicates) > 0 {
+		result.DuplicateConditions = duplicates
+	}
+	refreshTime := result.RefreshTime
+	result.observe(unstructuredES, conditions)
+	if c.beingDeleted(state, name, unstructuredES) {
+		return false, nil
+	}
+	transitions := diffConditions(state.previous, conditions, time.Now())
+	result.Transitions = append(result.Transitions, transitions...)
+	for _, transition := range transitions {
+		c.observers.conditionChanged(transition)
+		// The first observation is printed whole by the progress line
+		if !state.firstPoll {
+			c.log.infof("%s%s", c.prefix, transitionLine(state.previous, transition, state.start))
+		}
+	}
+	state.previous = conditions
+	if len(transitions) > 0 {
+		c.captures.add(unstructuredES, time.Now())
+	}
+
+	firstPoll := state.firstPoll
+	state.firstPoll = false
+
+	if c.watchTargetSecret {
+		if state.lag == nil {
+			state.lag = &lagTracker{secretName: targetSecretName(unstructuredES)}
+			state.lag.statusUpdated(lastStatusUpdate(unstructuredES))
+			go watchTargetSecret(ctx, c.clientset, c.apiCalls, namespace, state.lag)
+		} else if len(transitions) > 0 || refreshTime != result.RefreshTime {
+			state.lag.statusUpdated(time.Now())
+		}
+	}
+
+	if c.skipAnnotation != "" && unstructuredES.GetAnnotations()[c.skipAnnotation] == "true" {
+		c.log.infof("ExternalSecret %s is skipped (annotation %s=true).", name, c.skipAnnotation)
+		result.Outcome = outcomeSkipped
+		result.Reason = "skipped (annotation)"
+		return true, nil
+	}
+
+	if c.checkStore && firstPoll {
+		var storeErr *storeError
+		start := time.Now()
+		if c.revalidation != nil {
+			c.revalidateStore(ctx, unstructuredES)
+		}
+		storeReady, err := c.verifyStore(ctx, unstructuredES)
+		result.timeCheck(checkNameStore, start)
+		result.StoreReady = storeReady
+		switch {
+		case errors.As(err, &storeErr):
+			result.Outcome = outcomeFatalCondition
+			result.Reason = storeErr.Error()
+			result.fatalCode = storeErr.code()
+			return true, &conditionError{Reason: string(storeErr.code()), err: fmt.Errorf("ExternalSecret %s cannot sync: %w", name, err)}
+		case err != nil:
+			c.log.warnf("Warning: could not check the store of ExternalSecret %s: %v", name, err)
+		}
+	}
+
+	result.RemoteRefs = parseRemoteRefFailure(unstructuredES, conditions)
+	if result.RemoteRefs != nil && result.RemoteRefs.String() != state.remoteRefs {
+		state.remoteRefs = result.RemoteRefs.String()
+		c.printRemoteRefs(result.RemoteRefs)
+	}
+
+	j := c.judge(unstructuredES, conditions)
+	c.recorder.object(unstructuredES, j.String(), time.Now())
+	result.TemplateError = j.templateError
+	condition := j.condition
+	switch j.verdict {
+	case verdictFailOn:
+		result.Outcome = outcomeFatalCondition
+		result.Reason = condition.Reason
+		result.Hints = append(result.Hints, c.targetHints(ctx, result)...)
+		c.printFailureEvents(ctx, result)
+		printHints(result)
+		return true, &conditionError{Reason: condition.Reason, err: fmt.Errorf("ExternalSecret %s has condition %s=%s (%s): %s",
+			name, condition.Type, condition.Status, condition.Reason, condition.Message)}
+	case verdictTemplateError:
+		result.Outcome = outcomeFatalCondition
+		result.Reason = condition.Reason
+		c.printFailureEvents(ctx, result)
+		printTemplateError(j.templateError)
+		return true, &conditionError{Reason: condition.Reason, err: fmt.Errorf("ExternalSecret %s has a template error at %s (condition %s=%s)",
+			name, j.templateError, condition.Type, condition.Status)}
+	case verdictFatal:
+		result.Outcome = outcomeFatalCondition
+		result.Reason = condition.Reason
+		result.fatalCode = j.rule.Code
+		result.Hints = append(result.Hints, c.targetHints(ctx, result)...)
+		c.printFailureEvents(ctx, result)
+		printHints(result)
+		return true, &conditionError{Reason: condition.Reason, err: fmt.Errorf("ExternalSecret %s will not become Ready without intervention [%s]: Ready=False (%s): %s",
+			name, j.rule.Code, condition.Reason, condition.Message)}
+	}
+
+	result.Requirements = j.requirements
+	if j.ready {
+		readyState := readyDuringWait
+		if firstPoll {
+			readyState = readyAlready
+		}
+		if j.pending != "" {
+			c.log.infof("%sReady, but %s", c.prefix, j.pending)
+			state.readyStreak = 0
+			return false, nil
+		}
+		if c.verifyFreshness {
+			stale, note := c.checkFreshness(ctx, unstructuredES, result)
+			if note != "" && note != result.ClockSkewNote {
+				c.log.infof("Note: %s", note)
+				result.ClockSkewNote = note
+			}
+			if stale != "" {
+				c.log.infof("ExternalSecret %s is Ready but looks stale, waiting for a fresh sync: %s", name, stale)
+				state.readyStreak = 0
+				return false, nil
+			}
+			if firstPoll {
+				readyState = readyAlreadyVerified
+			}
+		}
+		if frozen := c.frozenReady(ctx, unstructuredES, conditions); frozen != "" {
+			if c.failOnOldCondition {
+				result.Outcome = outcomeFatalCondition
+				result.Reason = "frozen status"
+				result.fatalCode = reasonFrozenStatus
+				return true, &conditionError{Reason: string(reasonFrozenStatus), err: fmt.Errorf("ExternalSecret %s is Ready, but %s", name, frozen)}
+			}
+			if frozen != state.frozen {
+				c.log.infof("ExternalSecret %s is Ready, but %s; waiting for a fresh sync", name, frozen)
+			}
+			state.frozen = frozen
+			state.readyStreak = 0
+			return false, nil
+		}
+
+		if c.consecutiveReady > 1 {
+			// Bursts of watch events count as one observation per half
+			// interval, so the streak spans about as long as when polling
+			if now := time.Now(); state.readyStreak == 0 || now.Sub(state.lastReadyAt) >= c.pollInterval/2 {
+				state.readyStreak++
+				state.lastReadyAt = now
+			}
+			if state.readyStreak < c.consecutiveReady {
+				c.log.infof("%sReady %d/%d consecutive checks", c.prefix, state.readyStreak, c.consecutiveReady)
+				return false, nil
+			}
+		}
+		c.log.infof("ExternalSecret %s has reached Ready state.", name)
+		latency := measureSyncLatency(unstructuredES, conditions, c.now(), firstPoll)
+		c.log.infof("Sync latency: %s", latency)
+		result.Outcome = outcomeReady
+		result.ReadyState = readyState
+		result.Latency = &latency
+		return true, nil
+	}
+
+	state.readyStreak = 0
+
+	if age := unreconciledFor(unstructuredES, conditions, state.start, time.Now()); age >= c.unreconciledAfter && state.unreconciled == nil {
+		h := unreconciledHint(unstructuredES, age)
+		state.unreconciled = &h
+		c.log.infof("Diagnosis [%s]: %s", h.Code, h.Message)
+	}
+	if quiet := quietFor(conditions, c.events, state.start, time.Now()); quiet >= c.noProgressAfter && state.noProgress == nil {
+		controller := ""
+		if c.checkController {
+			controller = c.describeController(ctx)
+		}
+		h := noProgressHint(quiet, controller)
+		state.noProgress = &h
+		c.log.warnf("Warning: ==== %s ====", h.Message)
+	}
+
+	now := time.Now()
+	if !firstPoll && len(transitions) == 0 && now.Sub(state.lastReport) < c.heartbeat {
+		return false, nil
+	}
+	state.lastReport = now
+	progress := progressContext{
+		Resource:    namespace + "/" + name,
+		Namespace:   namespace,
+		Name:        name,
+		Conditions:  conditions,
+		Elapsed:     now.Sub(state.start),
+		Estimate:    estimateProgress(ctx, state.start, now, unstructuredES),
+		EventCounts: c.events.counts(),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		progress.Remaining = deadline.Sub(now)
+	}
+	c.log.infof("%s", c.prefix+renderProgress(c.progress, progress))
+	if others := otherTrueConditions(conditions); len(others) > 0 {
+		c.log.infof("  Other true conditions: %s", strings.Join(others, ", "))
+	}
+	if len(result.Requirements) > 0 {
+		verdicts := make([]string, len(result.Requirements))
+		for i, verdict := range result.Requirements {
+			verdicts[i] = verdict.String()
+		}
+		c.log.infof("  Requirements: %s", strings.Join(verdicts, ", "))
+	}
+	if failed := failedNamespaces(unstructuredES); len(failed) > 0 {
+		c.log.infof("  Failed namespaces: %s", strings.Join(failed, ", "))
+	}
+	if state.lag != nil {
+		c.log.infof("  %s", state.lag.describe(time.Now()))
+	}
+	return false, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestHonorRetryAfterWithoutRetryAfter(t *testing.T) {
+	c := &checker{apiCalls: newAPICallLog(false)}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	c.honorRetryAfter(ctx)
+	if waited := time.Since(start); waited > time.Second {
+		t.Fatalf("honorRetryAfter waited %v although the server never sent Retry-After", waited)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"7", 7 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		delay, ok := parseRetryAfter(tt.value, now)
+		if delay != tt.delay || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, delay, ok, tt.delay, tt.ok)
+		}
+	}
+}
+
+// TestWaitFollowsServedVersionChange upgrades the operator mid-wait: once
+// v1beta1 is no longer served, discovery lists v1 and the wait carries on
+// with it.
+func TestWaitFollowsServedVersionChange(t *testing.T) {
+	out := captureConsole(t)
+	c := newTestCluster(newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", readyCondition("False", "SecretSyncedError")))
+	var mu sync.Mutex
+	gets := 0
+	c.dynamicClient.PrependReactor("get", "externalsecrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		gets++
+		switch {
+		case gets == 2:
+			// The upgrade lands between two polls
+			c.serve("v1")
+		case gets < 2:
+			return false, nil, nil
+		}
+		if version := action.GetResource().Version; version != "v1" {
+			return true, nil, apierrors.NewNotFound(action.GetResource().GroupResource(), "")
+		}
+		object := newTestObject(action.GetResource(), "ExternalSecret", "apps", "db", readyCondition("True", "SecretSynced"))
+		return true, object, nil
+	})
+
+	results, code := c.check(t, 10*time.Second, "-namespace=apps", "-name=db", "-interval=50ms", "-watch-mode=poll", "-skip-freshness")
+	if code != exitOK || !results[0].Ready() {
+		t.Fatalf("exit code %d, outcome %s, want Ready:\n%s", code, results[0].Outcome, out)
+	}
+	if !strings.Contains(out.String(), "ExternalSecret API version changed from v1beta1 to v1") {
+		t.Errorf("the version switch was not logged:\n%s", out)
+	}
+}
+
+// duplicateReadyPayload is the status a buggy controller wrote: the stale
+// Ready condition of the last failure left in place above the current one.
+// order lists which of them comes first.
+func duplicateReadyPayload(t *testing.T, order ...string) *unstructured.Unstructured {
+	conditions := map[string]string{
+		"stale":   `{"type":"Ready","status":"True","reason":"SecretSynced","message":"Secret was synced","lastTransitionTime":"2024-05-01T09:00:00Z"}`,
+		"current": `{"type":"Ready","status":"False","reason":"SecretSyncedError","message":"could not get secret data from provider","lastTransitionTime":"2024-05-01T10:00:00Z"}`,
+	}
+	var listed []string
+	for _, which := range order {
+		listed = append(listed, conditions[which])
+	}
+	payload := `{
+		"apiVersion": "external-secrets.io/v1beta1",
+		"kind": "ExternalSecret",
+		"metadata": {"namespace": "apps", "name": "db", "resourceVersion": "41"},
+		"spec": {"refreshInterval": "1h", "target": {"name": "db"}},
+		"status": {"refreshTime": "2024-05-01T10:00:00Z", "conditions": [` + strings.Join(listed, ",") + `]}
+	}`
+	object := &unstructured.Unstructured{}
+	if err := object.UnmarshalJSON([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return object
+}
+
+// TestDuplicateReadyConditions pins the resolution of duplicate Ready
+// conditions to the newest lastTransitionTime, wherever it is listed, and
+// checks that the anomaly is warned about once and reported.
+func TestDuplicateReadyConditions(t *testing.T) {
+	for _, order := range [][]string{{"stale", "current"}, {"current", "stale"}} {
+		out := captureConsole(t)
+		c := newTestCluster(duplicateReadyPayload(t, order...))
+		results, code := c.check(t, 300*time.Millisecond, "-namespace=apps", "-name=db", "-interval=50ms", "-watch-mode=poll", "-skip-freshness")
+		result := results[0]
+		if result.Ready() || !failing(code) {
+			t.Errorf("%v: exit code %d, outcome %s, want the current Ready=False to win", order, code, result.Outcome)
+		}
+		if got := strings.Join(result.DuplicateConditions, ","); got != "Ready" {
+			t.Errorf("%v: duplicate conditions = %q, want Ready", order, got)
+		}
+		if n := strings.Count(out.String(), "duplicate conditions of type Ready"); n != 1 {
+			t.Errorf("%v: %d warnings about the duplicates, want 1:\n%s", order, n, out)
+		}
+		var file strings.Builder
+		if err := writeResultFile(&file, results); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(file.String(), `"duplicateConditions": [`) {
+			t.Errorf("%v: the result file lacks the anomaly:\n%s", order, file.String())
+		}
+	}
+}
+
+// syncEventAfterPoll serves an ExternalSecret that becomes Ready as the
+// controller records the sync event, some time after the first Get.
+func syncEventAfterPoll(t *testing.T, after time.Duration) (*testCluster, func() int) {
+	c := newTestCluster(newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", readyCondition("False", "SecretSyncedError")))
+	events := watch.NewFake()
+	watched := false
+	c.clientset.PrependWatchReactor("events", func(k8stesting.Action) (bool, watch.Interface, error) {
+		if watched {
+			return true, nil, apierrors.NewForbidden(corev1.Resource("events"), "", errors.New("watched once"))
+		}
+		watched = true
+		return true, events, nil
+	})
+	var mu sync.Mutex
+	gets := 0
+	synced := false
+	c.dynamicClient.PrependReactor("get", "externalsecrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		gets++
+		if gets == 1 {
+			go func() {
+				time.Sleep(after)
+				mu.Lock()
+				synced = true
+				mu.Unlock()
+				events.Add(&corev1.Event{
+					ObjectMeta:     metav1.ObjectMeta{Namespace: "apps", Name: "db.1", UID: "1", ResourceVersion: "1"},
+					InvolvedObject: corev1.ObjectReference{Namespace: "apps", Name: "db"},
+					Type:           corev1.EventTypeNormal,
+					Reason:         "Updated",
+					Message:        "Updated Secret",
+				})
+				events.Stop()
+			}()
+		}
+		if !synced {
+			return false, nil, nil
+		}
+		return true, newTestObject(action.GetResource(), "ExternalSecret", "apps", "db", readyCondition("True", "SecretSynced")), nil
+	})
+	return c, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return gets
+	}
+}
+
+// TestSyncEventTriggersCheck delivers the sync event right after the first
+// poll, long before the next tick: the wait checks the resource at once.
+func TestSyncEventTriggersCheck(t *testing.T) {
+	out := captureConsole(t)
+	c, gets := syncEventAfterPoll(t, eventTriggerInterval+200*time.Millisecond)
+	start := time.Now()
+	results, code := c.check(t, 20*time.Second, "-namespace=apps", "-name=db", "-interval=10s", "-watch-mode=poll", "-skip-freshness")
+	if code != exitOK || !results[0].Ready() {
+		t.Fatalf("exit code %d, outcome %s, want Ready:\n%s", code, results[0].Outcome, out)
+	}
+	if elapsed := time.Since(start); elapsed > eventTriggerInterval+3*time.Second {
+		t.Errorf("Ready noticed after %s, want right after the event", elapsed)
+	}
+	if got := gets(); got != 2 {
+		t.Errorf("%d gets, want the initial poll and the triggered one", got)
+	}
+}
+
+// TestSyncLatencyUsesTheResolvedReadyCondition serves two Ready=True
+// conditions: the sync latency is measured to the transition of the newest
+// one, which the wait judged by, whatever their order.
+func TestSyncLatencyUsesTheResolvedReadyCondition(t *testing.T) {
+	for _, newestFirst := range []bool{false, true} {
+		out := captureConsole(t)
+		older := readyCondition("True", "SecretSynced")
+		older["lastTransitionTime"] = "2024-05-01T09:30:00Z"
+		newer := readyCondition("True", "SecretSynced")
+		newer["lastTransitionTime"] = "2024-05-01T11:00:00Z"
+		conditions := []map[string]any{older, newer}
+		if newestFirst {
+			conditions = []map[string]any{newer, older}
+		}
+		object := newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", conditions...)
+		object.SetCreationTimestamp(metav1.NewTime(time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)))
+		results, code := newTestCluster(object).check(t, 5*time.Second, "-namespace=apps", "-name=db", "-watch-mode=poll", "-skip-freshness")
+		if code != exitOK || results[0].Latency == nil {
+			t.Fatalf("newest first %t: exit code %d, latency %v, want Ready with a latency:\n%s", newestFirst, code, results[0].Latency, out)
+		}
+		if latency := results[0].Latency; !latency.HasReadyTransition || latency.ReadyTransition != 2*time.Hour {
+			t.Errorf("newest first %t: Ready transition %s after creation, want the 2h of the newest condition", newestFirst, latency.ReadyTransition)
+		}
+	}
+}
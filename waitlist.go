@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// waitEntry is one resource of a -from-file wait list. Its kind, keys and
+// timeout add to those of the flags.
+type waitEntry struct {
+	Namespace   string   `json:"namespace"`
+	Name        string   `json:"name"`
+	Kind        string   `json:"kind"`
+	RequireKeys []string `json:"requireKeys"`
+	Timeout     string   `json:"timeout"`
+
+	// timeout is Timeout parsed, bounding the wait of the entry within the
+	// shared deadline of the run.
+	timeout time.Duration
+	// line is where the entry starts in the file, 0 when unknown, and
+	// index its position in the list.
+	line  int
+	index int
+	// source names the file, or stdin.
+	source string
+}
+
+// label names the entry in messages: by line when known.
+func (e waitEntry) label() string {
+	if e.line > 0 {
+		return fmt.Sprintf("line %d", e.line)
+	}
+	return fmt.Sprintf("entry %d", e.index)
+}
+
+// entryProblem is what is wrong with an entry, at its index in the list.
+type entryProblem struct {
+	index   int
+	message string
+}
+
+// problemAt describes err of entry.
+func problemAt(entry waitEntry, err error) entryProblem {
+	return entryProblem{entry.index, entry.label() + ": " + strings.TrimPrefix(err.Error(), "json: ")}
+}
+
+// readWaitList reads the -from-file file, or stdin for "-".
+func readWaitList(path string) ([]byte, string, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return data, "stdin", err
+	}
+	data, err := os.ReadFile(path)
+	return data, path, err
+}
+
+// parseWaitList parses a wait list: a YAML list of entries, each a mapping
+// or a reference, or else one reference per line as printed by kubectl get
+// -o name. References are name, namespace/name or resource.group/name.
+func parseWaitList(data []byte) ([]waitEntry, []entryProblem) {
+	raw, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, []entryProblem{{0, err.Error()}}
+	}
+	var document any
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, []entryProblem{{0, err.Error()}}
+	}
+	switch document.(type) {
+	case []any:
+	case string, nil:
+		// Lines of references fold into a single YAML string
+		return parseReferenceLines(data)
+	default:
+		return nil, []entryProblem{{0, "expected a list of entries"}}
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, []entryProblem{{0, err.Error()}}
+	}
+	lines := listItemLines(data)
+	if len(lines) != len(items) {
+		// Flow-style lists have no line per item
+		lines = nil
+	}
+	var entries []waitEntry
+	var problems []entryProblem
+	for i, item := range items {
+		entry := waitEntry{index: i + 1}
+		if lines != nil {
+			entry.line = lines[i]
+		}
+		var ref string
+		if json.Unmarshal(item, &ref) == nil {
+			err = entry.setReference(ref)
+		} else {
+			decoder := json.NewDecoder(bytes.NewReader(item))
+			decoder.DisallowUnknownFields()
+			err = decoder.Decode(&entry)
+		}
+		if err != nil {
+			problems = append(problems, problemAt(entry, err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, problems
+}
+
+// parseReferenceLines parses one reference per line, skipping blank lines
+// and comments.
+func parseReferenceLines(data []byte) ([]waitEntry, []entryProblem) {
+	var entries []waitEntry
+	var problems []entryProblem
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry := waitEntry{line: i + 1, index: len(entries) + len(problems) + 1}
+		if err := entry.setReference(line); err != nil {
+			problems = append(problems, problemAt(entry, err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, problems
+}
+
+// listItemLines returns the lines of the items of a top-level YAML block
+// list, those starting with "-" at the indentation of the first one.
+func listItemLines(data []byte) []int {
+	var lines []int
+	indent := -1
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed != "-" && !strings.HasPrefix(trimmed, "- ") {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n == indent {
+			indent = n
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+// setReference fills in the entry from a reference: name, namespace/name, or
+// the resource.group/name of kubectl get -o name, which names the kind.
+func (e *waitEntry) setReference(ref string) error {
+	prefix, name, found := strings.Cut(strings.TrimSpace(ref), "/")
+	if !found {
+		e.Name = prefix
+		return nil
+	}
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("%q is neither namespace/name nor resource.group/name", ref)
+	}
+	e.Name = name
+	for _, kind := range resourceKinds {
+		singular := strings.TrimSuffix(kind.gvr.Resource, "s")
+		for _, resource := range []string{singular, kind.gvr.Resource} {
+			if prefix == resource || prefix == resource+"."+kind.gvr.Group {
+				e.Kind = kind.name
+				return nil
+			}
+		}
+	}
+	if strings.Contains(prefix, ".") {
+		return fmt.Errorf("unknown resource type %s, must be that of %s", prefix, kindNames)
+	}
+	e.Namespace = prefix
+	return nil
+}
+
+// loadWaitList reads and validates -from-file, reporting every invalid entry
+// at once. The entries are resolved against the flags: -namespace is the
+// namespace of those naming none and -kind their kind, and all of them must
+// be of the same kind, which becomes that of the run.
+func (o *options) loadWaitList() error {
+	data, source, err := readWaitList(o.fromFile)
+	if err != nil {
+		return fmt.Errorf("-from-file: %w", err)
+	}
+	entries, problems := parseWaitList(data)
+	if len(problems) == 0 && len(entries) == 0 {
+		return fmt.Errorf("-from-file: %s lists no resources", source)
+	}
+
+	var kind, kindEntry string
+	seen := map[string]waitEntry{}
+	for i := range entries {
+		entry := &entries[i]
+		problem := func(format string, args ...any) {
+			problems = append(problems, problemAt(*entry, fmt.Errorf(format, args...)))
+		}
+		if entry.Name == "" {
+			problem("name is required")
+			continue
+		}
+		if entry.Kind == "" {
+			entry.Kind = o.kind
+		}
+		entryKind, ok := resourceKinds[entry.Kind]
+		if !ok {
+			problem("kind must be %s, not %q", kindNames, entry.Kind)
+			continue
+		}
+		if kind == "" {
+			kind, kindEntry = entry.Kind, entry.label()
+		} else if entry.Kind != kind {
+			problem("%s is a %s, unlike the %s of %s; check each kind in its own run", entry.Name, entry.Kind, kind, kindEntry)
+			continue
+		}
+		switch {
+		case entryKind.clusterScoped && entry.Namespace != "":
+			problem("a %s is cluster-scoped and takes no namespace", entryKind.name)
+			continue
+		case !entryKind.clusterScoped && entry.Namespace == "":
+			if entry.Namespace = o.namespace; entry.Namespace == "" {
+				problem("namespace of %s is required without -namespace", entry.Name)
+				continue
+			}
+		}
+		key := entry.Namespace + "/" + entry.Name
+		if previous, ok := seen[key]; ok {
+			problem("%s is already listed on %s", strings.TrimPrefix(key, "/"), previous.label())
+			continue
+		}
+		seen[key] = *entry
+		if entry.Timeout != "" {
+			if entry.timeout, err = time.ParseDuration(entry.Timeout); err != nil || entry.timeout <= 0 {
+				problem("timeout must be a positive duration such as 2m, not %q", entry.Timeout)
+			} else if entry.timeout > o.timeout {
+				problem("timeout %s exceeds -timeout %s", entry.Timeout, o.timeout)
+			}
+		}
+		if len(entry.RequireKeys) > 0 {
+			switch {
+			case !entryKind.hasTarget:
+				problem("requireKeys needs a target Secret, which a %s does not have", entryKind.name)
+			case o.waitFor == waitForDeleted:
+				problem("requireKeys does not apply to -wait-for=deleted")
+			}
+		}
+		for _, key := range entry.RequireKeys {
+			if key == "" {
+				problem("requireKeys lists an empty key")
+				break
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool { return problems[i].index < problems[j].index })
+		messages := make([]string, len(problems))
+		for i, p := range problems {
+			messages[i] = p.message
+		}
+		return fmt.Errorf("-from-file %s has invalid entries:\n  %s", source, strings.Join(messages, "\n  "))
+	}
+	for i := range entries {
+		entries[i].source = source
+	}
+	o.kind = kind
+	o.waitList = entries
+	return nil
+}
+
+// requiresKeys reports whether -require-keys or an entry of -from-file
+// requires keys of target Secrets.
+func (o *options) requiresKeys() bool {
+	if len(o.requireKeys) > 0 {
+		return true
+	}
+	for _, entry := range o.waitList {
+		if len(entry.RequireKeys) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// summaryRow is the result of one entry in the -from-file summary.
+type summaryRow struct {
+	Line        int        `json:"line,omitempty"`
+	Namespace   string     `json:"namespace,omitempty"`
+	Name        string     `json:"name"`
+	Outcome     outcome    `json:"outcome"`
+	ReasonCode  reasonCode `json:"reasonCode,omitempty"`
+	WaitSeconds float64    `json:"waitSeconds"`
+}
+
+// printWaitListSummary prints the results of a -from-file run in the order
+// of the file, as a table of entry, result and duration, or as a single
+// record with -output=json.
+func printWaitListSummary(results []*checkResult) {
+	source := results[0].entry.source
+	sorted := append([]*checkResult(nil), results...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].entry.index < sorted[j].entry.index })
+	rows := make([]summaryRow, len(sorted))
+	for i, result := range sorted {
+		rows[i] = summaryRow{
+			Line:        result.entry.line,
+			Namespace:   result.Namespace,
+			Name:        result.Name,
+			Outcome:     result.Outcome,
+			ReasonCode:  result.ReasonCode,
+			WaitSeconds: result.Waited.Seconds(),
+		}
+	}
+	if console.json {
+		console.write(levelInfo, "", func(record *logRecord) {
+			record.Message = "summary of " + source
+			record.Summary = rows
+		})
+		return
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tENTRY\tRESULT\tDURATION")
+	withNamespace := false
+	for _, result := range sorted {
+		withNamespace = withNamespace || result.Namespace != sorted[0].Namespace
+	}
+	for i, result := range sorted {
+		line := "-"
+		if rows[i].Line > 0 {
+			line = fmt.Sprint(rows[i].Line)
+		}
+		outcome := string(result.Outcome)
+		if result.ReasonCode != "" {
+			outcome += " [" + string(result.ReasonCode) + "]"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", line, resourceLabel(result.Namespace, result.Name, withNamespace), outcome, formatDuration(result.Waited))
+	}
+	w.Flush()
+	console.infof("Results of %s:", source)
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n") {
+		console.infof("  %s", line)
+	}
+	printStoreGroups(results)
+	console.infof("Ready: %s", readyLine(results, withNamespace))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// rewatchInterval limits how often the watch is established, so that a watch
+// failing or closed right away is not retried in a busy loop. Polling covers
+// the time in between.
+const rewatchInterval = 10 * time.Second
+
+// Values of -watch-mode.
+const (
+	watchModeAuto  = "auto"
+	watchModeWatch = "watch"
+	watchModePoll  = "poll"
+)
+
+// resourceWatch follows a single ExternalSecret by name for the wait loop.
+// The watch is re-established when the server closes it, restarting from
+// scratch when the resource version it resumes from is too old. When the
+// watch is not permitted the wait polls instead, which only needs get: some
+// managed clusters and aggregated API layers reject watches with 403 or 405
+// while allowing gets. The first such rejection switches every wait of the
+// cluster to polling for the rest of the run.
+type resourceWatch struct {
+	checker   *checker
+	namespace string
+	name      string
+
+	w               watch.Interface
+	resourceVersion string
+	// deleted is set when the watched object was deleted, until it is
+	// created again.
+	deleted bool
+	// disabled is set once the watch turned out not to be permitted.
+	disabled    bool
+	lastAttempt time.Time
+	// established is set once a watch was, so that the next ones count as
+	// reconnects.
+	established bool
+}
+
+// ensure establishes the watch unless it is running, disabled or was
+// established too recently. The watch lives as long as ctx, so unlike other
+// calls it is not bounded by the per-call timeout. It only fails the wait
+// with -watch-mode=watch, on a watch that is not permitted.
+func (rw *resourceWatch) ensure(ctx context.Context) error {
+	c := rw.checker
+	if c.watchMode == watchModePoll || c.watchMode != watchModeWatch && c.apiCalls.pollingFallback() != "" {
+		rw.disabled = true
+	}
+	if rw.w != nil || rw.disabled || time.Since(rw.lastAttempt) < rewatchInterval {
+		return nil
+	}
+	rw.lastAttempt = time.Now()
+	w, err := c.dynamicClient.Resource(c.gvr).Namespace(rw.namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector:       fields.OneTermEqualSelector("metadata.name", rw.name).String(),
+		ResourceVersion:     rw.resourceVersion,
+		AllowWatchBookmarks: true,
+	})
+	switch {
+	case (apierrors.IsForbidden(err) || apierrors.IsMethodNotSupported(err)) && c.watchMode == watchModeWatch:
+		return fmt.Errorf("cannot watch ExternalSecret %s, as -watch-mode=%s requires: %w", rw.name, watchModeWatch, err)
+	case apierrors.IsForbidden(err) || apierrors.IsMethodNotSupported(err):
+		rw.disabled = true
+		if c.apiCalls.fallBackToPolling(fmt.Sprintf("watch of %s rejected: %s", c.gvr.Resource, apierrors.ReasonForError(err))) {
+			c.log.infof("The API server does not allow watching %s (%v); polling every %s instead for the rest of the run", c.gvr.Resource, err, formatDuration(c.pollInterval))
+		}
+	case isExpired(err):
+		// Start over from the current state
+		rw.resourceVersion = ""
+		rw.lastAttempt = time.Time{}
+	case err != nil:
+		rw.checker.log.errorf("Error watching ExternalSecret %s: %v (polling until the watch is re-established)", rw.name, err)
+	default:
+		if rw.established {
+			c.apiCalls.reconnected()
+		}
+		rw.w = w
+		rw.established = true
+	}
+	return nil
+}
+
+// events returns the channel of the running watch, or nil, which blocks
+// forever in a select, when there is none.
+func (rw *resourceWatch) events() <-chan watch.Event {
+	if rw.w == nil {
+		return nil
+	}
+	return rw.w.ResultChan()
+}
+
+// handle processes an event received from events, ok being false once the
+// channel is closed. It returns the new state of the ExternalSecret to
+// evaluate, if the event carries one.
+func (rw *resourceWatch) handle(event watch.Event, ok bool) (*unstructured.Unstructured, bool) {
+	if !ok {
+		// The server ended the watch: resume from the last seen version
+		rw.stop()
+		return nil, false
+	}
+	switch event.Type {
+	case watch.Error:
+		err := apierrors.FromObject(event.Object)
+		if isExpired(err) {
+			// Start over from the current state right away
+			rw.resourceVersion = ""
+			rw.lastAttempt = time.Time{}
+		} else {
+			rw.checker.log.errorf("Error watching ExternalSecret %s: %v", rw.name, err)
+		}
+		rw.stop()
+		return nil, false
+	}
+
+	object, isObject := event.Object.(*unstructured.Unstructured)
+	if !isObject {
+		return nil, false
+	}
+	rw.resourceVersion = object.GetResourceVersion()
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		rw.deleted = false
+		return object, true
+	case watch.Deleted:
+		rw.checker.log.infof("ExternalSecret %s was deleted, waiting for it to be recreated", rw.name)
+		rw.deleted = true
+	}
+	// Bookmarks only advance the resource version
+	return nil, false
+}
+
+// current reports whether the watch is running and the last state it
+// delivered is still that of an existing object.
+func (rw *resourceWatch) current() bool {
+	return rw.w != nil && !rw.deleted
+}
+
+func (rw *resourceWatch) stop() {
+	if rw.w != nil {
+		rw.w.Stop()
+		rw.w = nil
+	}
+}
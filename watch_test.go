@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// scriptedWatch is one watch the API server serves: the events it delivers
+// before the server closes it, or the error establishing it fails with.
+type scriptedWatch struct {
+	events []watch.Event
+	err    error
+}
+
+// scriptedWatches serves the scripted watches in turn, recording the
+// resource version each one was requested from.
+func scriptedWatches(t *testing.T, script ...scriptedWatch) (*checker, *[]string) {
+	dynamicClient := newFakeDynamicClient()
+	var resumedFrom []string
+	dynamicClient.PrependWatchReactor("externalsecrets", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		resumedFrom = append(resumedFrom, action.(k8stesting.WatchActionImpl).WatchRestrictions.ResourceVersion)
+		if len(script) == 0 {
+			t.Error("watch requested beyond the script")
+			return true, nil, apierrors.NewServiceUnavailable("end of the script")
+		}
+		next := script[0]
+		script = script[1:]
+		if next.err != nil {
+			return true, nil, next.err
+		}
+		w := watch.NewFakeWithChanSize(len(next.events), false)
+		for _, event := range next.events {
+			w.Action(event.Type, event.Object)
+		}
+		w.Stop()
+		return true, w, nil
+	})
+	c := &checker{dynamicClient: dynamicClient, gvr: externalSecretGVR, watchMode: watchModeAuto, apiCalls: newAPICallLog(false), log: console}
+	return c, &resumedFrom
+}
+
+func watchedObject(resourceVersion string, ready string) *unstructured.Unstructured {
+	object := newTestObject(externalSecretGVR, "ExternalSecret", "apps", "db", readyCondition(ready, "SecretSynced"))
+	object.SetResourceVersion(resourceVersion)
+	return object
+}
+
+func bookmark(resourceVersion string) watch.Event {
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion(externalSecretGVR.GroupVersion().String())
+	object.SetKind("ExternalSecret")
+	object.SetResourceVersion(resourceVersion)
+	return watch.Event{Type: watch.Bookmark, Object: object}
+}
+
+func gone() watch.Event {
+	status := apierrors.NewResourceExpired("too old resource version: 9 (12)").ErrStatus
+	return watch.Event{Type: watch.Error, Object: &status}
+}
+
+// drain establishes the next watch and handles its events until the server
+// closes it, returning the states it delivered.
+func drain(t *testing.T, rw *resourceWatch) []string {
+	t.Helper()
+	if err := rw.ensure(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if rw.w == nil {
+		t.Fatalf("no watch established, resuming from %q", rw.resourceVersion)
+	}
+	var states []string
+	for rw.w != nil {
+		event, ok := <-rw.events()
+		if object, delivered := rw.handle(event, ok); delivered {
+			states = append(states, object.GetResourceVersion()+":"+getConditions(object)[0].Status)
+		}
+	}
+	return states
+}
+
+// TestResourceWatchResumesAndRelistsOnlyOnGone scripts a watch that is
+// closed after a bookmark and a change, one that ends in 410 Gone and one
+// refused as expired: each watch resumes from the last resource version
+// seen, bookmarks included, except after Gone, which starts over at once.
+func TestResourceWatchResumesAndRelistsOnlyOnGone(t *testing.T) {
+	captureConsole(t)
+	c, resumedFrom := scriptedWatches(t,
+		scriptedWatch{events: []watch.Event{
+			bookmark("7"),
+			{Type: watch.Modified, Object: watchedObject("8", "False")},
+			bookmark("9"),
+		}},
+		scriptedWatch{events: []watch.Event{
+			{Type: watch.Modified, Object: watchedObject("10", "False")},
+			gone(),
+		}},
+		scriptedWatch{events: []watch.Event{
+			{Type: watch.Added, Object: watchedObject("12", "False")},
+		}},
+		scriptedWatch{err: apierrors.NewResourceExpired("too old resource version: 12 (15)")},
+		scriptedWatch{events: []watch.Event{
+			{Type: watch.Added, Object: watchedObject("15", "True")},
+		}},
+	)
+	rw := &resourceWatch{checker: c, namespace: "apps", name: "db", resourceVersion: "5"}
+
+	if got := strings.Join(drain(t, rw), " "); got != "8:False" {
+		t.Errorf("first watch delivered %q, want the Modified state only", got)
+	}
+	if rw.resourceVersion != "9" {
+		t.Errorf("resourceVersion = %q after the first watch, want the bookmark's 9", rw.resourceVersion)
+	}
+	// A closed watch is re-established after rewatchInterval
+	if err := rw.ensure(context.Background()); err != nil || rw.w != nil {
+		t.Fatalf("watch re-established right after being closed: %v", err)
+	}
+	rw.lastAttempt = time.Time{}
+
+	if got := strings.Join(drain(t, rw), " "); got != "10:False" {
+		t.Errorf("second watch delivered %q, want the state before Gone", got)
+	}
+	// Gone starts over right away, without waiting for rewatchInterval
+	if got := strings.Join(drain(t, rw), " "); got != "12:False" {
+		t.Errorf("third watch delivered %q, want the current state", got)
+	}
+	rw.lastAttempt = time.Time{}
+
+	// Refused as expired, the watch starts over at the next attempt
+	if err := rw.ensure(context.Background()); err != nil || rw.w != nil {
+		t.Fatalf("ensure = %v, %v, want no watch when the version expired", rw.w, err)
+	}
+	if got := strings.Join(drain(t, rw), " "); got != "15:True" {
+		t.Errorf("last watch delivered %q, want the Ready state", got)
+	}
+
+	if got, want := strings.Join(*resumedFrom, ","), "5,9,,12,"; got != want {
+		t.Errorf("watches requested from %q, want %q", got, want)
+	}
+	if got := c.apiCalls.Stats().Reconnects; got != 3 {
+		t.Errorf("reconnects = %d, want 3", got)
+	}
+}
+
+// TestResourceWatchFollowsDeletion checks that a deleted object is no longer
+// current until it is created again.
+func TestResourceWatchFollowsDeletion(t *testing.T) {
+	out := captureConsole(t)
+	c, _ := scriptedWatches(t, scriptedWatch{})
+	rw := &resourceWatch{checker: c, namespace: "apps", name: "db"}
+	if err := rw.ensure(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, delivered := rw.handle(watch.Event{Type: watch.Deleted, Object: watchedObject("20", "True")}, true); delivered || rw.current() {
+		t.Errorf("a deletion delivered a state, or left the watch current")
+	}
+	if !strings.Contains(out.String(), "ExternalSecret db was deleted") {
+		t.Errorf("deletion not logged:\n%s", out)
+	}
+	if object, delivered := rw.handle(watch.Event{Type: watch.Added, Object: watchedObject("21", "False")}, true); !delivered || object.GetResourceVersion() != "21" || !rw.current() {
+		t.Errorf("the recreated object was not delivered")
+	}
+	rw.stop()
+}
+
+// TestWaitReturnsOnWatchedReadyFlip delivers the flip to Ready through the
+// watch: the wait returns without polling again.
+func TestWaitReturnsOnWatchedReadyFlip(t *testing.T) {
+	out := captureConsole(t)
+	c := newTestCluster(watchedObject("7", "False"))
+	var mu sync.Mutex
+	gets := 0
+	c.dynamicClient.PrependReactor("get", "externalsecrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		gets++
+		return false, nil, nil
+	})
+	c.dynamicClient.PrependWatchReactor("externalsecrets", func(k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFakeWithChanSize(1, false)
+		w.Modify(watchedObject("8", "True"))
+		return true, w, nil
+	})
+
+	results, code := c.check(t, 30*time.Second, "-namespace=apps", "-name=db", "-interval=2s", "-skip-freshness")
+	if code != exitOK || !results[0].Ready() {
+		t.Fatalf("exit code %d, outcome %s, want Ready:\n%s", code, results[0].Outcome, out)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if gets != 1 {
+		t.Errorf("%d gets, want the initial one only", gets)
+	}
+}
+
+// TestWaitOnSilentWatchKeepsTheTimeout watches a resource that never
+// changes: the wait still ends at the timeout.
+func TestWaitOnSilentWatchKeepsTheTimeout(t *testing.T) {
+	captureConsole(t)
+	c := newTestCluster(watchedObject("7", "False"))
+	c.dynamicClient.PrependWatchReactor("externalsecrets", func(k8stesting.Action) (bool, watch.Interface, error) {
+		return true, watch.NewFake(), nil
+	})
+
+	const timeout = 500 * time.Millisecond
+	start := time.Now()
+	results, code := c.check(t, timeout, "-namespace=apps", "-name=db", "-interval=100ms", "-skip-freshness")
+	if results[0].Outcome != outcomeTimeout || code != exitTimeout {
+		t.Errorf("exit code %d, outcome %s, want a timeout", code, results[0].Outcome)
+	}
+	if elapsed := time.Since(start); elapsed > timeout+time.Second {
+		t.Errorf("the wait took %s with a timeout of %s", elapsed, timeout)
+	}
+}
+
+// rejectingWatches serves ExternalSecrets db and cache that become Ready
+// after a few Gets, rejecting every watch of them with err.
+func rejectingWatches(err error) (*testCluster, func() int) {
+	c := newTestCluster(watchedObject("7", "False"))
+	var mu sync.Mutex
+	watches, gets := 0, 0
+	c.dynamicClient.PrependWatchReactor("externalsecrets", func(k8stesting.Action) (bool, watch.Interface, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		watches++
+		return true, nil, err
+	})
+	c.dynamicClient.PrependReactor("get", "externalsecrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		gets++
+		ready := "False"
+		if gets > 6 {
+			ready = "True"
+		}
+		name := action.(k8stesting.GetAction).GetName()
+		return true, newTestObject(action.GetResource(), "ExternalSecret", "apps", name, readyCondition(ready, "SecretSynced")), nil
+	})
+	return c, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return watches
+	}
+}
+
+// TestRejectedWatchFallsBackToPolling rejects the watches of two waits: both
+// poll instead, the first rejection switching the run to polling, which the
+// stats record.
+func TestRejectedWatchFallsBackToPolling(t *testing.T) {
+	for _, err := range []error{
+		apierrors.NewMethodNotSupported(externalSecretGVR.GroupResource(), "watch"),
+		apierrors.NewForbidden(externalSecretGVR.GroupResource(), "", errors.New("watch not granted")),
+	} {
+		out := captureConsole(t)
+		c, watches := rejectingWatches(err)
+		results, code := c.check(t, 10*time.Second, "-namespace=apps", "-name=db,cache", "-interval=20ms", "-skip-freshness")
+		if code != exitOK || !results[0].Ready() || !results[1].Ready() {
+			t.Fatalf("%v: exit code %d, want both Ready by polling:\n%s", err, code, out)
+		}
+		if got := watches(); got < 1 || got > 2 {
+			t.Errorf("%v: %d watch attempts, want one per wait at most", err, got)
+		}
+		if n := strings.Count(out.String(), "does not allow watching externalsecrets"); n != 1 {
+			t.Errorf("%v: the fallback was logged %d times, want once:\n%s", err, n, out)
+		}
+		stats := c.apiCalls.Stats()
+		want := "watch of externalsecrets rejected: " + string(apierrors.ReasonForError(err))
+		if stats.WatchFallback != want || !strings.Contains(stats.String(), `polling-fallback="`+want+`"`) {
+			t.Errorf("%v: stats %s, want the fallback %q", err, stats, want)
+		}
+		if record := newStatsRecord(&stats); record.WatchFallback != want {
+			t.Errorf("%v: stats record fallback = %q", err, record.WatchFallback)
+		}
+	}
+}
+
+// TestForcedWatchModes checks that -watch-mode=watch fails on a rejected
+// watch, and that -watch-mode=poll never watches.
+func TestForcedWatchModes(t *testing.T) {
+	captureConsole(t)
+	c, _ := rejectingWatches(apierrors.NewMethodNotSupported(externalSecretGVR.GroupResource(), "watch"))
+	results, code := c.check(t, 10*time.Second, "-namespace=apps", "-name=db", "-interval=20ms", "-watch-mode=watch", "-skip-freshness")
+	if code == exitOK || results[0].Ready() || !strings.Contains(fmt.Sprint(results[0].lastErr), "-watch-mode=watch requires") {
+		t.Errorf("-watch-mode=watch: exit code %d, outcome %s, error %v, want the rejected watch to fail", code, results[0].Outcome, results[0].lastErr)
+	}
+
+	c, watches := rejectingWatches(apierrors.NewMethodNotSupported(externalSecretGVR.GroupResource(), "watch"))
+	if _, code := c.check(t, 10*time.Second, "-namespace=apps", "-name=db", "-interval=20ms", "-watch-mode=poll", "-skip-freshness"); code != exitOK || watches() != 0 {
+		t.Errorf("-watch-mode=poll: exit code %d after %d watches, want Ready without watching", code, watches())
+	}
+	if fallback := c.apiCalls.Stats().WatchFallback; fallback != "" {
+		t.Errorf("-watch-mode=poll recorded a fallback: %q", fallback)
+	}
+}